@@ -1,13 +1,20 @@
 module github.com/blakearoberts/redis-token-bucket-rate-limiter
 
-go 1.13
+go 1.18
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/alicebob/miniredis/v2 v2.39.0
 	github.com/garyburd/redigo v1.6.0
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/time v0.3.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.1.1 // indirect
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
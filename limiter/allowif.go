@@ -0,0 +1,28 @@
+package limiter
+
+import "math"
+
+// AllowIf returns true if the given number of events may happen for the given
+// key and its token bucket held at least expectMin tokens before taking them,
+// false otherwise. The tokens are compared in the same decision that takes
+// them, as a raised MinTokens, so low priority work may proceed only while
+// ample tokens remain. Like Check, the decision is atomic, made in a
+// transaction watching the key's token bucket, and events are always decided
+// by Redis rather than sampled or estimated locally.
+func (l *redisLimiter) AllowIf(key string, n int, expectMin float64) (bool, error) {
+	c := l.keyed(key).atomically()
+	c.minTokens = math.Max(c.minTokens, expectMin-float64(n))
+	allowed, _, err := c.allowNRemaining(key, n, c.rate, c.burst)
+	return allowed, err
+}
+
+func (l *inMemoryLimiter) AllowIf(key string, n int, expectMin float64) (bool, error) {
+	c := *l.keyed(key)
+	c.minTokens = math.Max(c.minTokens, expectMin-float64(n))
+	allowed, _, err := c.allowNRemaining(key, n, c.rate, c.burst)
+	return allowed, err
+}
+
+func (l *disabledLimiter) AllowIf(key string, n int, expectMin float64) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestAllowIf(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 10
+		config.Interval = time.Hour
+		l := New(config)
+
+		// a new bucket holds the burst
+		if allowed, err := l.AllowIf("foo", 2, 10); err != nil || !allowed {
+			t.Errorf("%s: expected a full bucket to pass: %v", name, err)
+		}
+		if allowed, err := l.AllowIf("foo", 2, 8); err != nil || !allowed {
+			t.Errorf("%s: expected 8 tokens to pass: %v", name, err)
+		}
+
+		// 6 tokens remain, failing the predicate takes nothing
+		if allowed, err := l.AllowIf("foo", 1, 7); err != nil || allowed {
+			t.Errorf("%s: expected 6 tokens to fail: %v", name, err)
+		}
+		if tokens, _ := l.Tokens("foo"); tokens != 6 {
+			t.Errorf("%s: expected 6 tokens to remain, got %v", name, tokens)
+		}
+
+		// the tokens taken are still bound by the bucket
+		if allowed, _ := l.AllowIf("foo", 7, 0); allowed {
+			t.Errorf("%s: expected more events than tokens to fail", name)
+		}
+		if allowed, _ := l.AllowIf("foo", 6, 6); !allowed {
+			t.Errorf("%s: expected the remaining tokens to be taken", name)
+		}
+	}
+}
+
+func TestRedisAllowIfAtomic(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	key := "foo"
+	l.Allow(key)
+
+	// the bucket is drained after it is compared, aborting the decision which
+	// is retried against the drained bucket
+	other := l.pool.Get()
+	defer other.Close()
+	drained := false
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return hookConn{Conn: c, hook: func(cmd string, args ...interface{}) {
+			if cmd == "EXEC" && !drained {
+				drained = true
+				other.Do("LSET", key, 0, 5)
+			}
+		}}, err
+	}
+
+	if allowed, err := l.AllowIf(key, 1, 8); err != nil || allowed {
+		t.Errorf("expected the drained bucket to fail: %v %v", allowed, err)
+	}
+	if tokens, _ := l.Tokens(key); tokens != 5 {
+		t.Errorf("expected 5 tokens to remain, got %v", tokens)
+	}
+}
+
+func TestAllowIfNew(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 10, Interval: time.Hour})
+	if allowed, _ := l.AllowIf("foo", 1, 11); allowed {
+		t.Error("expected a new bucket to fail above the burst")
+	}
+	if allowed, _ := l.AllowIf("foo", 10, 10); !allowed {
+		t.Error("expected the burst to be taken")
+	}
+}
+
+func TestDisabledAllowIf(t *testing.T) {
+	if allowed, _ := New(Config{Type: TypeDisabled}).AllowIf("foo", 1, 100); !allowed {
+		t.Error("expected the disabled limiter to allow")
+	}
+	if allowed, _ := New(Config{Type: TypeBlockAll}).AllowIf("foo", 1, 0); allowed {
+		t.Error("expected the block all limiter to deny")
+	}
+}
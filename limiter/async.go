@@ -0,0 +1,148 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// asyncWorkers is how many background decisions AllowAsync makes at once
+const asyncWorkers = 8
+
+// asyncQueueSize is how many background decisions AllowAsync queues before
+// denying events
+const asyncQueueSize = 1024
+
+// asyncEstimate is the local estimate AllowAsync decides events by, holding
+// when each key denied by the background decisions may be allowed again, and
+// the queue of background decisions
+type asyncEstimate struct {
+	denied  sync.Map
+	pending sync.WaitGroup
+
+	workers int
+	size    int
+	start   sync.Once
+	mux     sync.RWMutex
+	queue   chan func()
+	running sync.WaitGroup
+	closed  bool
+}
+
+// newAsyncEstimate returns an estimate making background decisions with the
+// given number of workers, queuing up to the given number of decisions
+func newAsyncEstimate(workers, size int) *asyncEstimate {
+	return &asyncEstimate{workers: workers, size: size}
+}
+
+// allow returns true unless the given key is estimated to be out of tokens at
+// the given time
+func (e *asyncEstimate) allow(key string, now time.Time) bool {
+	until, ok := e.denied.Load(key)
+	return !ok || !now.Before(until.(time.Time))
+}
+
+// update records when the given key may be allowed again, clearing the key if
+// it may be allowed now
+func (e *asyncEstimate) update(key string, now time.Time, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		e.denied.Delete(key)
+		return
+	}
+	e.denied.Store(key, now.Add(retryAfter))
+}
+
+// enqueue queues the given decision to be made in the background, starting
+// the workers on first use. It returns false if the queue is full or closed.
+func (e *asyncEstimate) enqueue(decide func()) bool {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	if e.closed {
+		return false
+	}
+	e.start.Do(e.run)
+
+	e.pending.Add(1)
+	select {
+	case e.queue <- decide:
+		return true
+	default:
+		e.pending.Done()
+		return false
+	}
+}
+
+// run creates the queue and starts the workers making its decisions
+func (e *asyncEstimate) run() {
+	e.queue = make(chan func(), e.size)
+	for i := 0; i < e.workers; i++ {
+		e.running.Add(1)
+		go func() {
+			defer e.running.Done()
+			for decide := range e.queue {
+				decide()
+				e.pending.Done()
+			}
+		}()
+	}
+}
+
+// close stops queuing decisions and waits for the workers to make those
+// already queued
+func (e *asyncEstimate) close() {
+	e.mux.Lock()
+	if e.closed {
+		e.mux.Unlock()
+		return
+	}
+	e.closed = true
+	if e.queue != nil {
+		close(e.queue)
+	}
+	e.mux.Unlock()
+
+	e.running.Wait()
+}
+
+// AllowAsync returns immediately, allowing the given number of events for the
+// given key unless a local estimate says the key is out of tokens, while the
+// events are decided by Redis in the background. Each background decision
+// updates the estimate with how long until the key has tokens again, so a key
+// over its limit is denied locally once the decisions catch up. Events
+// allowed before then slip past the limit: AllowAsync trades accuracy under
+// contention for no round trip on the calling path. Errors are ignored.
+// Background decisions are made by a fixed number of workers, events are
+// denied while their queue is full, shedding load rather than allowing events
+// which cannot be decided, and after Close.
+func (l *redisLimiter) AllowAsync(key string, n int) bool {
+	if !l.async.allow(key, l.now()) {
+		return false
+	}
+
+	return l.async.enqueue(func() {
+		k := l.keyed(key)
+		_, remaining, err := k.allowNRemaining(key, n, k.rate, k.burst)
+		if err != nil {
+			return
+		}
+
+		// the next events are denied until the bucket has tokens for them
+		var retryAfter time.Duration
+		if remaining-float64(n) < k.minTokens {
+			if retryAfter = k.delay(remaining, n); retryAfter < 0 {
+				// tokens are never added, check again next interval
+				retryAfter = k.interval
+			}
+		}
+		l.async.update(key, l.now(), retryAfter)
+	})
+}
+
+// AllowAsync is AllowN since the in-memory Limiter decides without a round
+// trip
+func (l *inMemoryLimiter) AllowAsync(key string, n int) bool {
+	return l.AllowN(key, n)
+}
+
+func (l *disabledLimiter) AllowAsync(key string, n int) bool {
+	return true
+}
@@ -0,0 +1,79 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisAllowAsync(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if !l.AllowAsync("foo", 1) {
+			t.Errorf("expected to optimistically allow event %d", i)
+		}
+		l.async.pending.Wait()
+	}
+
+	// the background decisions were written to Redis
+	if tokens, _ := l.Tokens("foo"); tokens != 0 {
+		t.Errorf("expected the background decisions to take the burst: %v", tokens)
+	}
+
+	// the local estimate enforces the limit without a round trip
+	if l.AllowAsync("foo", 1) {
+		t.Error("expected the local estimate to deny once the burst is taken")
+	}
+
+	// until the bucket has tokens again
+	now = now.Add(time.Hour)
+	if !l.AllowAsync("foo", 1) {
+		t.Error("expected to allow once the bucket has refilled")
+	}
+	l.async.pending.Wait()
+}
+
+func TestInMemoryAllowAsync(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, Interval: time.Hour})
+
+	if !l.AllowAsync("foo", 1) {
+		t.Error("expected to allow the burst")
+	}
+	if l.AllowAsync("foo", 1) {
+		t.Error("expected the in-memory limiter to decide synchronously")
+	}
+}
+
+func TestRedisAllowAsyncQueueFull(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+
+	// without workers the queue is never drained
+	l.async = newAsyncEstimate(0, 2)
+
+	for i := 0; i < 2; i++ {
+		if !l.AllowAsync("foo", 1) {
+			t.Errorf("expected to queue event %d", i)
+		}
+	}
+	if l.AllowAsync("foo", 1) {
+		t.Error("expected to deny events while the queue is full")
+	}
+}
@@ -0,0 +1,169 @@
+package limiter
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// backend is the minimal set of operations the Redis Limiter needs to decide
+// whether events are allowed, letting tests supply a fake without modeling
+// redigo connections
+type backend interface {
+	// exists returns true if the given key exists
+	exists(key string) (bool, error)
+
+	// del deletes the given keys
+	del(keys ...string) error
+
+	// get returns the value stored at the given key, nil if it does not exist
+	get(key string) (interface{}, error)
+
+	// sadd adds the given members to the set stored at the given key
+	sadd(key string, members ...string) error
+
+	// read returns the token bucket stored at the given key and true, or false
+	// if the key does not exist
+	read(key string, withState bool) (bucket, bool, error)
+
+	// readBlocked is like read but also returns true if the key is blocked,
+	// checked in the same round trip as the token bucket is read
+	readBlocked(key string, withState bool) (bucket, bool, bool, error)
+
+	// create stores a new token bucket at the given key
+	create(key string, b bucket) error
+
+	// update updates the tokens and last update time of the token bucket
+	// stored at the given key
+	update(key string, b bucket) error
+
+	// eval runs the given Lua script with the given keys and arguments
+	eval(s script, keysAndArgs ...interface{}) (interface{}, error)
+
+	// close releases the backend
+	close() error
+}
+
+// connBackend is a backend using a Redis connection and the configured
+// storage layout
+type connBackend struct {
+	c       redis.Conn
+	storage storage
+}
+
+func (b connBackend) exists(key string) (bool, error) {
+	return redis.Bool(b.c.Do("EXISTS", key))
+}
+
+func (b connBackend) del(keys ...string) error {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	_, err := b.c.Do("DEL", args...)
+	return err
+}
+
+func (b connBackend) get(key string) (interface{}, error) {
+	return b.c.Do("GET", key)
+}
+
+func (b connBackend) sadd(key string, members ...string) error {
+	args := []interface{}{key}
+	for _, member := range members {
+		args = append(args, member)
+	}
+	_, err := b.c.Do("SADD", args...)
+	return err
+}
+
+func (b connBackend) read(key string, withState bool) (bucket, bool, error) {
+	return b.storage.read(b.c, key, withState)
+}
+
+func (b connBackend) readBlocked(key string, withState bool) (bucket, bool, bool, error) {
+	c, err := sendAhead(b.c, "EXISTS", blockKey(key))
+	if err != nil {
+		return bucket{}, false, false, err
+	}
+
+	bk, ok, err := b.storage.read(c, key, withState)
+	blocked, existsErr := redis.Bool(c.receive())
+	if err != nil {
+		return bucket{}, false, false, err
+	}
+	if existsErr != nil {
+		return bucket{}, false, false, existsErr
+	}
+	return bk, ok, blocked, nil
+}
+
+func (b connBackend) create(key string, bk bucket) error {
+	return b.storage.create(b.c, key, bk)
+}
+
+func (b connBackend) update(key string, bk bucket) error {
+	return b.storage.update(b.c, key, bk)
+}
+
+func (b connBackend) eval(s script, keysAndArgs ...interface{}) (interface{}, error) {
+	return scripts[s].Do(b.c, keysAndArgs...)
+}
+
+func (b connBackend) close() error {
+	return b.c.Close()
+}
+
+// backend returns the backend to decide events against, a pooled connection
+// watching token buckets with optimistic locking or to draw from overflow
+// buckets, unless newBackend is set
+func (l *redisLimiter) backend() backend {
+	if l.newBackend != nil {
+		return l.newBackend()
+	}
+	db := connBackend{c: l.pool.Get(), storage: l.storage}
+	if l.transactional() {
+		return watchBackend{db}
+	}
+	return db
+}
+
+// pipelinedConn is a connection which sends a command ahead of the next
+// command done on it so both share a round trip, keeping the reply of the
+// command sent ahead
+type pipelinedConn struct {
+	redis.Conn
+	sent  bool
+	reply interface{}
+	err   error
+}
+
+// sendAhead sends the given command on the given connection, its reply
+// received along with the next command done on the returned connection
+func sendAhead(c redis.Conn, cmd string, args ...interface{}) (*pipelinedConn, error) {
+	if err := c.Send(cmd, args...); err != nil {
+		return nil, err
+	}
+	return &pipelinedConn{Conn: c, sent: true}, nil
+}
+
+func (c *pipelinedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if !c.sent {
+		return c.Conn.Do(cmd, args...)
+	}
+	if err := c.Conn.Send(cmd, args...); err != nil {
+		return nil, err
+	}
+	c.receive()
+	return c.Conn.Receive()
+}
+
+// receive returns the reply of the command sent ahead, flushing it on its own
+// if no command was done since, as when a read is served from a cache
+func (c *pipelinedConn) receive() (interface{}, error) {
+	if c.sent {
+		c.sent = false
+		if c.err = c.Conn.Flush(); c.err == nil {
+			c.reply, c.err = c.Conn.Receive()
+		}
+	}
+	return c.reply, c.err
+}
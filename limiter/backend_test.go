@@ -0,0 +1,169 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeBackend is a backend storing token buckets in memory
+type fakeBackend struct {
+	buckets map[string]bucket
+	keys    map[string]bool
+	evals   []script
+	err     error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{buckets: map[string]bucket{}, keys: map[string]bool{}}
+}
+
+func (f *fakeBackend) exists(key string) (bool, error) {
+	_, ok := f.buckets[key]
+	return ok || f.keys[key], f.err
+}
+
+func (f *fakeBackend) del(keys ...string) error {
+	for _, key := range keys {
+		delete(f.buckets, key)
+		delete(f.keys, key)
+	}
+	return f.err
+}
+
+func (f *fakeBackend) get(key string) (interface{}, error) {
+	return nil, f.err
+}
+
+func (f *fakeBackend) sadd(key string, members ...string) error {
+	return f.err
+}
+
+func (f *fakeBackend) read(key string, withState bool) (bucket, bool, error) {
+	b, ok := f.buckets[key]
+	return b, ok, f.err
+}
+
+func (f *fakeBackend) readBlocked(key string, withState bool) (bucket, bool, bool, error) {
+	b, ok := f.buckets[key]
+	return b, ok, f.keys[blockKey(key)], f.err
+}
+
+func (f *fakeBackend) create(key string, b bucket) error {
+	f.buckets[key] = b
+	return f.err
+}
+
+func (f *fakeBackend) update(key string, b bucket) error {
+	f.buckets[key] = b
+	return f.err
+}
+
+func (f *fakeBackend) eval(s script, keysAndArgs ...interface{}) (interface{}, error) {
+	f.evals = append(f.evals, s)
+	return nil, errors.New("fake backend does not run scripts")
+}
+
+func (f *fakeBackend) close() error {
+	return nil
+}
+
+// newFakeBackendLimiter returns a Redis Limiter deciding events against a
+// fake backend on a fixed clock
+func newFakeBackendLimiter(config Config) (*redisLimiter, *fakeBackend, *time.Time) {
+	config.Type = TypeRedis
+	l := New(config).(*redisLimiter)
+
+	f := newFakeBackend()
+	l.newBackend = func() backend { return f }
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, f, &now
+}
+
+func TestBackendAllowN(t *testing.T) {
+	l, f, now := newFakeBackendLimiter(Config{RateLimit: 1, BurstLimit: 2})
+
+	if !l.Allow("foo") || !l.Allow("foo") {
+		t.Fatal("expected to allow the burst")
+	}
+	if l.Allow("foo") {
+		t.Error("expected to deny once the bucket is empty")
+	}
+	if b := f.buckets["foo"]; b.tokens != 0 || b.last != now.Unix() {
+		t.Errorf("expected an empty bucket updated now: %+v", b)
+	}
+
+	*now = now.Add(time.Second)
+	if !l.Allow("foo") {
+		t.Error("expected to allow after an interval")
+	}
+	if l.AllowN("foo", 2) {
+		t.Error("expected to deny more events than tokens")
+	}
+}
+
+func TestBackendBlocked(t *testing.T) {
+	l, f, _ := newFakeBackendLimiter(Config{RateLimit: 1, BurstLimit: 2})
+	f.keys[blockKey("foo")] = true
+
+	if l.Allow("foo") {
+		t.Error("expected to deny a blocked key")
+	}
+	if _, ok := f.buckets["foo"]; ok {
+		t.Error("expected a blocked key to not create a bucket")
+	}
+}
+
+func TestBackendPrune(t *testing.T) {
+	l, f, now := newFakeBackendLimiter(Config{RateLimit: 1, BurstLimit: 2, PruneFullBuckets: true})
+
+	l.Allow("foo")
+	*now = now.Add(time.Minute)
+	if tokens, _ := l.Tokens("foo"); tokens != 2 {
+		t.Errorf("expected a full bucket: %v", tokens)
+	}
+	if _, ok := f.buckets["foo"]; ok {
+		t.Error("expected the full bucket to be pruned")
+	}
+}
+
+func TestBackendError(t *testing.T) {
+	for _, failOpen := range []bool{false, true} {
+		l, f, _ := newFakeBackendLimiter(Config{RateLimit: 1, BurstLimit: 2, FailOpen: failOpen})
+		f.err = errors.New("not good")
+
+		allowed, _, err := l.AllowNWithRemaining("foo", 1)
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if allowed != failOpen {
+			t.Errorf("expected to fail open %v: %v", failOpen, allowed)
+		}
+	}
+}
+
+func TestBackendCoversScripts(t *testing.T) {
+	l, f, now := newFakeBackendLimiter(Config{RateLimit: 1, BurstLimit: 5, GlobalRateLimit: 1, GlobalBurstLimit: 5})
+	f.buckets["foo"] = bucket{tokens: 2, last: now.Unix()}
+
+	if allowed, tokens, err := l.CheckOnly("foo", 3); err != nil || allowed || tokens != 2 {
+		t.Errorf("expected to read the bucket from the backend: %v %v %v", allowed, tokens, err)
+	}
+
+	l.AllowChild("foo", "bar", 1)
+	l.Transfer("foo", "bar", 1)
+	l.adjust("foo", 1)
+	l.AllowSeq("foo", 1, 1)
+	l.GlobalAllow(1)
+	expected := []script{allowChildScript, transferScript, adjustScript, allowSeqScript, allowGlobalScript}
+	if len(f.evals) != len(expected) {
+		t.Fatalf("expected the scripts to be run by the backend: %v", f.evals)
+	}
+	for i, s := range expected {
+		if f.evals[i] != s {
+			t.Errorf("expected script %v to be run: %v", s, f.evals[i])
+		}
+	}
+}
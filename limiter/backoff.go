@@ -0,0 +1,39 @@
+package limiter
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff shapes how long Wait sleeps before retrying a denied event
+type Backoff interface {
+	// Backoff returns how long to sleep after the given number of denied
+	// attempts, starting at zero, given the delay until enough tokens are
+	// added to the bucket
+	Backoff(attempt int, delay time.Duration) time.Duration
+}
+
+// NoJitter sleeps until enough tokens are added to the bucket, the default
+// Backoff
+type NoJitter struct{}
+
+func (NoJitter) Backoff(attempt int, delay time.Duration) time.Duration {
+	return delay
+}
+
+// FullJitter sleeps a random duration up to the delay until enough tokens are
+// added to the bucket so waiters denied together do not retry together
+type FullJitter struct {
+	// Max caps the sleep duration, zero does not cap it
+	Max time.Duration
+}
+
+func (b FullJitter) Backoff(attempt int, delay time.Duration) time.Duration {
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
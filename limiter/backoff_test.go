@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNoJitter(t *testing.T) {
+	if d := (NoJitter{}).Backoff(3, time.Second); d != time.Second {
+		t.Errorf("expected to sleep %v: %v", time.Second, d)
+	}
+}
+
+func TestFullJitter(t *testing.T) {
+	for _, tc := range []struct {
+		backoff FullJitter
+		delay   time.Duration
+		max     time.Duration
+	}{
+		{FullJitter{}, time.Second, time.Second},
+		{FullJitter{Max: 100 * time.Millisecond}, time.Second, 100 * time.Millisecond},
+		{FullJitter{}, 0, 0},
+	} {
+		for attempt := 0; attempt < 100; attempt++ {
+			d := tc.backoff.Backoff(attempt, tc.delay)
+			if d < 0 || d > tc.max {
+				t.Fatalf("expected to sleep between 0 and %v: %v", tc.max, d)
+			}
+		}
+	}
+}
+
+// recordBackoff records the delays passed to it and sleeps up to a fixed
+// duration
+type recordBackoff struct {
+	sleep  time.Duration
+	delays []time.Duration
+}
+
+func (b *recordBackoff) Backoff(attempt int, delay time.Duration) time.Duration {
+	b.delays = append(b.delays, delay)
+	if delay < b.sleep {
+		return delay
+	}
+	return b.sleep
+}
+
+func TestWaitBackoff(t *testing.T) {
+	backoff := &recordBackoff{sleep: 300 * time.Millisecond}
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Second,
+		Backoff:    backoff,
+	}).(*inMemoryLimiter)
+
+	// the clock only advances by the durations slept
+	now := time.Unix(1700000000, 0).Add(250 * time.Millisecond)
+	var sleeps []time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+	ctx := context.Background()
+	key := "foo"
+
+	if err := l.Wait(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if len(sleeps) != 0 {
+		t.Errorf("expected the first event to not wait: %v", sleeps)
+	}
+
+	if err := l.Wait(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// the strategy's shorter sleep is retried until the next interval
+	ms := time.Millisecond
+	if delays := []time.Duration{750 * ms, 450 * ms, 150 * ms}; !reflect.DeepEqual(backoff.delays, delays) {
+		t.Errorf("expected delays %v: %v", delays, backoff.delays)
+	}
+	if want := []time.Duration{300 * ms, 300 * ms, 150 * ms}; !reflect.DeepEqual(sleeps, want) {
+		t.Errorf("expected sleeps %v: %v", want, sleeps)
+	}
+}
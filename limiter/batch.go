@@ -0,0 +1,181 @@
+package limiter
+
+import "github.com/garyburd/redigo/redis"
+
+// allowAllScript decides events for several token buckets in order, taking
+// tokens from each bucket, or from its overflow bucket once it is empty, unless
+// the bucket's key is blocked. Tokens are rounded to the given precision unless
+// it is negative. It returns a status and the tokens remaining for each
+// bucket: 1 if the events are allowed, 0 if not and -1 if the key is blocked.
+//
+// KEYS[3i+1] bucket key, KEYS[3i+2] block key, KEYS[3i+3] overflow key
+// ARGV[1] storageArg, ARGV[2] now, ARGV[3] interval (seconds), ARGV[4] min
+// tokens, ARGV[5] precision, ARGV[6] overflow rate, ARGV[7] overflow burst,
+// ARGV[3i+8] n, ARGV[3i+9] rate, ARGV[3i+10] burst
+var allowAllScript = newScript(-1, luaStorage+luaRefill+`
+local now = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+local min_tokens = tonumber(ARGV[4])
+local precision = tonumber(ARGV[5])
+local overflow_rate = tonumber(ARGV[6])
+local overflow_burst = tonumber(ARGV[7])
+
+local function round(tokens)
+	if precision < 0 then
+		return tokens
+	end
+	local scale = 10 ^ precision
+	if tokens < 0 then
+		return -math.floor(-tokens * scale + 0.5) / scale
+	end
+	return math.floor(tokens * scale + 0.5) / scale
+end
+
+-- take takes n tokens from the bucket at the given key if it has them,
+-- returning whether they were taken and the tokens remaining
+local function take(key, n, rate, burst)
+	local b = read_bucket(key)
+	local tokens = round(refill(b, now, interval, rate, burst))
+	if tokens - n < min_tokens then
+		return false, tokens
+	end
+	tokens = round(tokens - n)
+	write_bucket(key, {tokens = tokens, last = now}, b)
+	return true, tokens
+end
+
+local results = {}
+for i = 0, #KEYS / 3 - 1 do
+	local status, tokens = -1, 0
+	if redis.call("EXISTS", KEYS[3 * i + 2]) == 0 then
+		local n = tonumber(ARGV[3 * i + 8])
+		local allowed
+		allowed, tokens = take(KEYS[3 * i + 1], n, tonumber(ARGV[3 * i + 9]), tonumber(ARGV[3 * i + 10]))
+		if not allowed and overflow_burst > 0 then
+			allowed = take(KEYS[3 * i + 3], n, overflow_rate, overflow_burst)
+		end
+		status = allowed and 1 or 0
+	end
+	table.insert(results, status)
+	table.insert(results, string.format("%.17g", tokens))
+end
+return results
+`)
+
+// AllowAll decides an event for each of the given IDs in order like Check and
+// returns their decisions by ID so callers may retry just the IDs denied,
+// after their RetryAfter. The Redis Limiter decides every ID atomically in a
+// single script, so one round trip is made for the whole batch. Of the per-key
+// features only lists, blocks, overflow buckets and MinTokens apply; per-key
+// intervals, warm up, penalties, hysteresis, MaxKeys, groups, stats and usage
+// do not, and IDs are not decided by the in-memory fallback while failing
+// over. IDs given more than once are decided for each occurrence, the last
+// decision being returned. The first error of any decision is returned, the
+// decisions carrying their own.
+func (l *redisLimiter) AllowAll(ids []string) (map[string]Decision, error) {
+	return decisionMap(l.decideBatch(ids))
+}
+
+// decideBatch decides an event for each of the given IDs in order in a single
+// script like AllowAll, returning their decisions in order
+func (l *redisLimiter) decideBatch(ids []string) []Decision {
+	l = l.scheduled()
+	decisions := make([]Decision, len(ids))
+
+	// listed and invalid IDs are decided without the script
+	var scripted []int
+	var keys, args []interface{}
+	for i, id := range ids {
+		if decided, allowed := l.lists.check(id); decided {
+			decisions[i] = l.decision(id, allowed, listedRemaining(allowed), nil)
+			continue
+		}
+		key, err := l.keyLength.key(id)
+		if err != nil {
+			decisions[i] = l.decision(id, false, 0, err)
+			continue
+		}
+		scripted = append(scripted, i)
+		keys = append(keys, key, blockKey(key), overflowKey(key))
+		args = append(args, 1, l.refillRate(l.rate), l.burst)
+	}
+
+	if len(scripted) > 0 {
+		taken, err := l.allowAll(keys, args)
+		for j, i := range scripted {
+			if err != nil {
+				// fail open on redis error
+				decisions[i] = l.decision(ids[i], l.failMode(keys[3*j].(string), err), 0, err)
+				continue
+			}
+			if taken[j].allowed {
+				l.allowed.add(1)
+			}
+			decisions[i] = l.decision(ids[i], taken[j].allowed, taken[j].remaining, nil)
+		}
+	}
+
+	for _, d := range decisions {
+		l.counts.record(1, d.Allowed, d.Err)
+	}
+	return decisions
+}
+
+// batchTake is the outcome of allowAllScript for a key
+type batchTake struct {
+	allowed   bool
+	remaining float64
+}
+
+// allowAll runs allowAllScript for the given keys and per key arguments,
+// returning the outcome for each key
+func (l *redisLimiter) allowAll(keys, args []interface{}) ([]batchTake, error) {
+	db := l.backend()
+	defer db.close()
+
+	keysAndArgs := append([]interface{}{len(keys)}, keys...)
+	keysAndArgs = append(keysAndArgs,
+		storageArg(l.layout, l.format), l.boundary().Unix(), l.interval.Seconds(),
+		l.minTokens, int(l.precision), l.refillRate(l.overflowRate), l.overflowBurst,
+	)
+	values, err := redis.Values(db.eval(allowAllScript, append(keysAndArgs, args...)...))
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make([]batchTake, len(values)/2)
+	for i := range taken {
+		var status int
+		if values, err = redis.Scan(values, &status, &taken[i].remaining); err != nil {
+			return nil, err
+		}
+		taken[i].allowed = status == 1
+	}
+	return taken, nil
+}
+
+// decision returns the Decision of a single event for the given ID
+func (l *redisLimiter) decision(id string, allowed bool, remaining float64, err error) Decision {
+	return decision(id, 1, l.burst, allowed, remaining, err, l.lists, l.delay)
+}
+
+func (l *inMemoryLimiter) AllowAll(ids []string) (map[string]Decision, error) {
+	return decisionMap(decideAll(ids, l.Check))
+}
+
+func (l *disabledLimiter) AllowAll(ids []string) (map[string]Decision, error) {
+	return decisionMap(decideAll(ids, l.Check))
+}
+
+// decisionMap returns the given decisions by ID along with the first error
+func decisionMap(decisions []Decision) (map[string]Decision, error) {
+	var err error
+	m := make(map[string]Decision, len(decisions))
+	for _, d := range decisions {
+		if d.Err != nil && err == nil {
+			err = d.Err
+		}
+		m[d.ID] = d
+	}
+	return m, err
+}
@@ -0,0 +1,196 @@
+package limiter
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestAllowAll(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		config.DenyList = []string{"baz"}
+		l := New(config)
+		l.Allow("foo")
+
+		decisions, err := l.AllowAll([]string{"foo", "bar", "baz", "qux"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var allowed, denied []string
+		for id, d := range decisions {
+			if d.ID != id {
+				t.Errorf("%s: expected the decision of %s, got %s", name, id, d.ID)
+			}
+			if d.Allowed {
+				allowed = append(allowed, id)
+			} else {
+				denied = append(denied, id)
+			}
+		}
+		sort.Strings(allowed)
+		sort.Strings(denied)
+		if want := []string{"bar", "qux"}; !reflect.DeepEqual(allowed, want) {
+			t.Errorf("%s: expected %v to be allowed, got %v", name, want, allowed)
+		}
+		if want := []string{"baz", "foo"}; !reflect.DeepEqual(denied, want) {
+			t.Errorf("%s: expected %v to be denied, got %v", name, want, denied)
+		}
+
+		// throttled keys may be retried once they have tokens, deny listed
+		// keys never
+		if d := decisions["foo"]; d.Reason != DecisionLimited || d.RetryAfter <= 0 {
+			t.Errorf("%s: expected foo to be limited with a retry delay, got %v", name, d)
+		}
+		if d := decisions["baz"]; d.Reason != DecisionDenied || d.RetryAfter >= 0 {
+			t.Errorf("%s: expected baz to never be allowed, got %v", name, d)
+		}
+	}
+}
+
+func TestAllowAllSharedConn(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+
+	if _, err := l.AllowAll([]string{"foo", "bar", "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.TotalConnectionCount(); n != 1 {
+		t.Errorf("expected the batch to use one connection, got %d", n)
+	}
+}
+
+func TestAllowAllRoundTrip(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	var trips int
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return tripConn{Conn: c, trips: &trips}, err
+	}
+
+	// the script is loaded by the first batch
+	l.AllowAll([]string{"foo"})
+	trips = 0
+	if _, err := l.AllowAll([]string{"foo", "bar", "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if trips != 1 {
+		t.Errorf("expected the batch to make one round trip, got %d", trips)
+	}
+}
+
+func TestAllowAllScript(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		for _, format := range []TimeFormat{TimeUnix, TimeUnixMilli, TimeRFC3339} {
+			s.FlushAll()
+			l := New(Config{
+				Type:          TypeRedis,
+				Address:       s.Addr(),
+				RateLimit:     1,
+				BurstLimit:    2,
+				Interval:      time.Hour,
+				MinTokens:     -1,
+				OverflowRate:  1,
+				OverflowBurst: 1,
+				StorageLayout: layout,
+				TimeFormat:    format,
+			}).(*redisLimiter)
+			l.Block("baz", time.Hour)
+
+			// foo draws its bucket and then its overflow bucket into debt,
+			// each occurrence decided in order
+			ids := []string{"foo", "foo", "foo", "foo", "foo", "foo", "bar", "baz"}
+			var keys, args []interface{}
+			for _, id := range ids {
+				keys = append(keys, id, blockKey(id), overflowKey(id))
+				args = append(args, 1, l.rate, l.burst)
+			}
+			taken, err := l.allowAll(keys, args)
+			if err != nil {
+				t.Fatalf("%d/%d: %v", layout, format, err)
+			}
+			var allowed []bool
+			for _, take := range taken {
+				allowed = append(allowed, take.allowed)
+			}
+			if want := []bool{true, true, true, true, true, false, true, false}; !reflect.DeepEqual(allowed, want) {
+				t.Errorf("%d/%d: expected %v, got %v", layout, format, want, allowed)
+			}
+			if taken[2].remaining != -1 || taken[6].remaining != 1 {
+				t.Errorf("%d/%d: expected -1 and 1 tokens to remain: %+v", layout, format, taken)
+			}
+
+			// the buckets are stored as decisions made one at a time store them
+			if tokens, err := l.Tokens("foo"); err != nil || tokens != -1 {
+				t.Errorf("%d/%d: expected foo to hold -1 tokens: %v %v", layout, format, tokens, err)
+			}
+			if tokens, err := l.Tokens("baz"); err != nil || tokens != 2 {
+				t.Errorf("%d/%d: expected blocked baz to keep its tokens: %v %v", layout, format, tokens, err)
+			}
+			if tokens, err := l.Tokens("bar"); err != nil || tokens != 1 {
+				t.Errorf("%d/%d: expected bar to hold one token: %v %v", layout, format, tokens, err)
+			}
+		}
+	}
+}
+
+func TestAllowAllError(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	s.Close()
+
+	decisions, err := l.AllowAll([]string{"foo", "bar"})
+	if err == nil {
+		t.Error("expected an error")
+	}
+	for id, d := range decisions {
+		if d.Allowed || d.Reason != DecisionError {
+			t.Errorf("expected %s to fail closed, got %v", id, d)
+		}
+	}
+}
+
+func TestDisabledAllowAll(t *testing.T) {
+	if decisions, _ := New(Config{Type: TypeDisabled}).AllowAll([]string{"foo"}); !decisions["foo"].Allowed {
+		t.Error("expected the disabled limiter to allow")
+	}
+	if decisions, _ := New(Config{Type: TypeBlockAll}).AllowAll([]string{"foo"}); decisions["foo"].Allowed {
+		t.Error("expected the block all limiter to deny")
+	}
+}
@@ -0,0 +1,199 @@
+package limiter
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// noop is returned by Begin for keys which are not limited
+func noop() {}
+
+// noopCommit is returned by Begin for keys which are not limited
+func noopCommit(n int) error { return nil }
+
+// Begin reserves a token for the given key, see BeginN
+func (l *redisLimiter) Begin(key string) (func(n int) error, func()) {
+	return l.BeginN(key, 1)
+}
+
+// BeginN reserves the given number of tokens for the given key before the work
+// they pay for is done. Once the work is done, commit charges the actual
+// number of tokens, refunding or taking the difference from the reserved
+// tokens, or abort refunds all of the reserved tokens. Charges beyond the
+// reservation may put the bucket into debt. Both functions are nil if the key
+// is not allowed. Refunds apply to token buckets, not calendar windows.
+func (l *redisLimiter) BeginN(key string, n int) (func(n int) error, func()) {
+	return begin(l, key, n, l.adjust)
+}
+
+// adjustScript atomically adds tokens to a token bucket after allotment,
+// taking tokens when negative. The bucket is capped at the burst limit. A
+// missing bucket is full so refunds leave it missing.
+//
+// KEYS[1] key
+// ARGV[1] storageArg, ARGV[2] tokens, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] rate, ARGV[6] burst
+var adjustScript = newScript(1, luaStorage+luaRefill+`
+local tokens = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local interval = tonumber(ARGV[4])
+local rate = tonumber(ARGV[5])
+local burst = tonumber(ARGV[6])
+
+local b = read_bucket(KEYS[1])
+if not b and tokens >= 0 then
+	return 0
+end
+
+write_bucket(KEYS[1], {tokens = math.min(refill(b, now, interval, rate, burst) + tokens, burst), last = now}, b)
+return 1
+`)
+
+// adjust adds the given number of tokens to the given key's token bucket after
+// allotment, taking tokens when negative. The bucket is capped at the burst
+// limit.
+func (l *redisLimiter) adjust(key string, tokens float64) error {
+	if decided, _ := l.lists.check(key); decided {
+		return nil
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	_, err = db.eval(adjustScript,
+		key,
+		storageArg(l.layout, l.format), tokens, now, l.interval.Seconds(),
+		l.refillRate(l.rate), l.burst,
+	)
+	return err
+}
+
+func (l *inMemoryLimiter) Begin(key string) (func(n int) error, func()) {
+	return l.BeginN(key, 1)
+}
+
+func (l *inMemoryLimiter) BeginN(key string, n int) (func(n int) error, func()) {
+	if l.pureGo || l.window != WindowNone {
+		return begin(l, key, n, l.adjust)
+	}
+
+	// a rate.Limiter cannot be given tokens so refunds cancel reservations
+	if decided, allowed := l.lists.check(key); decided {
+		if allowed {
+			return noopCommit, noop
+		}
+		return nil, nil
+	}
+	key, err := l.keyLength.key(key)
+	if err != nil || l.blocked(key) {
+		return nil, nil
+	}
+
+	now := l.boundary()
+	limiter := l.limiter(key, l.refillRate(l.rate), l.burst, now)
+	r := limiter.ReserveN(now, n)
+	if !r.OK() || r.DelayFrom(now) > 0 {
+		r.CancelAt(now)
+		return nil, nil
+	}
+	l.allowed.add(n)
+
+	commit := func(m int) error {
+		now := l.boundary()
+		if m == n {
+			return nil
+		}
+		if m < n {
+			r.CancelAt(now)
+			reserve(limiter, m, now)
+			return nil
+		}
+		reserve(limiter, m-n, now)
+		return nil
+	}
+	abort := func() {
+		r.CancelAt(l.boundary())
+	}
+	return commit, abort
+}
+
+// reserve takes the given number of tokens from the given rate.Limiter
+// regardless of whether it has them, capped at its burst limit
+func reserve(limiter *rate.Limiter, n int, now time.Time) {
+	if n > limiter.Burst() {
+		n = limiter.Burst()
+	}
+	if n > 0 {
+		limiter.ReserveN(now, n)
+	}
+}
+
+// adjust adds the given number of tokens to the given key's token bucket after
+// allotment, taking tokens when negative. The bucket is capped at the burst
+// limit.
+func (l *inMemoryLimiter) adjust(key string, tokens float64) error {
+	if decided, _ := l.lists.check(key); decided {
+		return nil
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.window != WindowNone {
+		start, _ := l.window.Bounds(now, l.location)
+		if w, ok := l.windows[key]; ok && w.start.Equal(start) {
+			w.count = int(math.Max(float64(w.count)-tokens, 0))
+		}
+		return nil
+	}
+
+	b := math.Min(l.tokens(key, l.refillRate(l.rate), l.burst, now)+tokens, float64(l.burst))
+	l.setBucket(key, b, now)
+	return nil
+}
+
+func (l *disabledLimiter) Begin(key string) (func(n int) error, func()) {
+	return noopCommit, noop
+}
+
+func (l *disabledLimiter) BeginN(key string, n int) (func(n int) error, func()) {
+	return noopCommit, noop
+}
+
+// begin takes the given number of tokens from the given key and returns
+// functions adjusting the key's tokens by the difference between the actual
+// and reserved tokens on commit, or refunding them on abort
+func begin(l Limiter, key string, n int, adjust func(key string, tokens float64) error) (func(n int) error, func()) {
+	if !l.AllowN(key, n) {
+		return nil, nil
+	}
+
+	commit := func(m int) error {
+		if m == n {
+			return nil
+		}
+		return adjust(key, float64(n-m))
+	}
+	abort := func() {
+		adjust(key, float64(n))
+	}
+	return commit, abort
+}
@@ -0,0 +1,149 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+func newBeginLimiters(t *testing.T) map[string]Limiter {
+	s := miniredis.RunT(t)
+
+	limiters := map[string]Limiter{}
+	for name, c := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		c.RateLimit = 1
+		c.BurstLimit = 10
+		c.Interval = time.Hour
+		limiters[name] = New(c)
+	}
+	return limiters
+}
+
+func TestBeginCommitLess(t *testing.T) {
+	for name, l := range newBeginLimiters(t) {
+		commit, abort := l.BeginN("foo", 5)
+		if commit == nil || abort == nil {
+			t.Fatalf("%s: expected to reserve 5 tokens", name)
+		}
+		if err := commit(2); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// the 3 unused tokens are refunded
+		if !l.AllowN("foo", 8) {
+			t.Errorf("%s: expected 8 tokens after committing 2", name)
+		}
+		if l.Allow("foo") {
+			t.Errorf("%s: expected no tokens left", name)
+		}
+	}
+}
+
+func TestBeginCommitMore(t *testing.T) {
+	for name, l := range newBeginLimiters(t) {
+		commit, _ := l.BeginN("foo", 2)
+		if commit == nil {
+			t.Fatalf("%s: expected to reserve 2 tokens", name)
+		}
+		if err := commit(5); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if !l.AllowN("foo", 5) {
+			t.Errorf("%s: expected 5 tokens after committing 5", name)
+		}
+		if l.Allow("foo") {
+			t.Errorf("%s: expected no tokens left", name)
+		}
+	}
+}
+
+func TestBeginAbort(t *testing.T) {
+	for name, l := range newBeginLimiters(t) {
+		_, abort := l.BeginN("foo", 6)
+		if abort == nil {
+			t.Fatalf("%s: expected to reserve 6 tokens", name)
+		}
+
+		// the reservation holds tokens until aborted
+		if l.AllowN("foo", 5) {
+			t.Errorf("%s: expected reserved tokens to be unavailable", name)
+		}
+
+		abort()
+		if !l.AllowN("foo", 10) {
+			t.Errorf("%s: expected abort to refund all reserved tokens", name)
+		}
+	}
+}
+
+func TestBeginDenied(t *testing.T) {
+	for name, l := range newBeginLimiters(t) {
+		if commit, abort := l.BeginN("foo", 11); commit != nil || abort != nil {
+			t.Errorf("%s: expected reservation beyond the burst limit to be denied", name)
+		}
+	}
+}
+
+func TestDisabledBegin(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	commit, abort := l.Begin("foo")
+	if commit == nil || abort == nil {
+		t.Fatal("expected disabled limiter to allow")
+	}
+	if err := commit(10); err != nil {
+		t.Error(err)
+	}
+	abort()
+}
+
+func TestRedisBeginAbortAtomic(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	other := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		Interval:   time.Hour,
+	})
+
+	// events allowed elsewhere while the refund is made are kept
+	armed, sent := false, 0
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return hookConn{Conn: c, hook: func(cmd string, args ...interface{}) {
+			if !armed || cmd == "" {
+				return
+			}
+			if sent++; sent == 2 {
+				other.AllowN("foo", 3)
+			}
+		}}, err
+	}
+
+	_, abort := l.BeginN("foo", 5)
+	if abort == nil {
+		t.Fatal("expected to reserve 5 tokens")
+	}
+	armed = true
+	abort()
+	armed = false
+
+	if tokens, _ := l.Tokens("foo"); tokens != 7 {
+		t.Errorf("expected the refund to keep the 3 tokens taken meanwhile: %v", tokens)
+	}
+}
@@ -0,0 +1,106 @@
+package limiter
+
+import (
+	"errors"
+	"time"
+)
+
+// errBlocked is returned while deciding events for a blocked key, which are
+// denied regardless of their tokens
+var errBlocked = errors.New("limiter: key is blocked")
+
+// blockKey returns the key marking the given key as blocked
+func blockKey(key string) string {
+	return suffixedKey(key, "blocked")
+}
+
+// Block denies all events for the given key for the given duration regardless
+// of the tokens in its bucket. The block is a separate Redis key which expires
+// after the duration, a non-positive duration removes the block.
+func (l *redisLimiter) Block(key string, d time.Duration) error {
+	if d <= 0 {
+		return l.Unblock(key)
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	_, err = c.Do("SET", blockKey(key), 1, "PX", d.Milliseconds())
+	return err
+}
+
+// Unblock removes a block set by Block from the given key
+func (l *redisLimiter) Unblock(key string) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	_, err = c.Do("DEL", blockKey(key))
+	return err
+}
+
+func (l *inMemoryLimiter) Block(key string, d time.Duration) error {
+	if d <= 0 {
+		return l.Unblock(key)
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.blocks[key] = l.now().Add(d)
+	return nil
+}
+
+func (l *inMemoryLimiter) Unblock(key string) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.blocks, key)
+	return nil
+}
+
+// blocked returns true if the given key is blocked, removing expired blocks
+func (l *inMemoryLimiter) blocked(key string) bool {
+	l.mux.RLock()
+	until, ok := l.blocks[key]
+	l.mux.RUnlock()
+	if !ok {
+		return false
+	}
+
+	if l.now().Before(until) {
+		return true
+	}
+
+	l.mux.Lock()
+	if until, ok := l.blocks[key]; ok && !l.now().Before(until) {
+		delete(l.blocks, key)
+	}
+	l.mux.Unlock()
+	return false
+}
+
+func (l *disabledLimiter) Block(key string, d time.Duration) error {
+	return nil
+}
+
+func (l *disabledLimiter) Unblock(key string) error {
+	return nil
+}
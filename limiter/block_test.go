@@ -0,0 +1,205 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestRedisBlock(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+	})
+	key := "foo"
+
+	if err := l.Block(key, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL(blockKey(key)); ttl != 10*time.Minute {
+		t.Errorf("expected the block to expire in 10m: %v", ttl)
+	}
+
+	// the key is denied even though its bucket is full
+	if l.Allow(key) {
+		t.Errorf("expected blocked key to not be allowed: %s", key)
+	}
+	if allowed, _, _ := l.AllowWithState(key, 1); allowed {
+		t.Errorf("expected blocked key to not be allowed: %s", key)
+	}
+	if tokens, _ := l.Tokens(key); tokens != 10 {
+		t.Errorf("expected blocked key to keep its tokens: %v", tokens)
+	}
+
+	s.FastForward(10 * time.Minute)
+	if !l.Allow(key) {
+		t.Errorf("expected key to be allowed after the block expires: %s", key)
+	}
+}
+
+// tripConn is a redis.Conn counting the round trips made on it
+type tripConn struct {
+	redis.Conn
+
+	trips *int
+}
+
+func (c tripConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "" {
+		*c.trips++
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c tripConn) Flush() error {
+	*c.trips++
+	return c.Conn.Flush()
+}
+
+func TestRedisBlockRoundTrips(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+	}).(*redisLimiter)
+	var trips int
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return tripConn{Conn: c, trips: &trips}, err
+	}
+	key := "foo"
+
+	// the block is checked in the round trip reading the bucket, which is
+	// then created
+	if !l.Allow(key) {
+		t.Errorf("expected key to be allowed: %s", key)
+	}
+	if trips != 2 {
+		t.Errorf("expected the read and the write, got %d round trips", trips)
+	}
+
+	l.Block(key, time.Hour)
+	trips = 0
+	if l.Allow(key) {
+		t.Errorf("expected blocked key to not be allowed: %s", key)
+	}
+	if trips != 1 {
+		t.Errorf("expected only the read, got %d round trips", trips)
+	}
+}
+
+func TestRedisBlockDecisions(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"bucket":     {},
+		"optimistic": {OptimisticRetries: 1},
+		"window":     {CalendarWindow: WindowDay},
+	} {
+		s.FlushAll()
+		config.Type = TypeRedis
+		config.Address = s.Addr()
+		config.RateLimit = 1
+		config.BurstLimit = 10
+		l := New(config)
+		key := "foo"
+
+		l.Block(key, time.Hour)
+		if l.Allow(key) {
+			t.Errorf("%s: expected blocked key to not be allowed: %s", name, key)
+		}
+		l.Unblock(key)
+		if !l.Allow(key) {
+			t.Errorf("%s: expected unblocked key to be allowed: %s", name, key)
+		}
+	}
+}
+
+func TestRedisUnblock(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+	})
+	key := "foo"
+
+	l.Block(key, time.Hour)
+	if err := l.Unblock(key); err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists(blockKey(key)) {
+		t.Error("expected the block to be removed")
+	}
+	if !l.Allow(key) {
+		t.Errorf("expected unblocked key to be allowed: %s", key)
+	}
+}
+
+func TestRedisBlockedError(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		FailOpen:   true,
+	})
+	s.SetError("not good")
+
+	if !l.Allow("foo") {
+		t.Error("expected to fail open")
+	}
+	if err := l.Block("foo", time.Minute); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestInMemoryBlock(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 10,
+	}).(*inMemoryLimiter)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	key := "foo"
+
+	if err := l.Block(key, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if l.Allow(key) {
+		t.Errorf("expected blocked key to not be allowed: %s", key)
+	}
+	if !l.Allow("bar") {
+		t.Error("expected other keys to be allowed")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if !l.Allow(key) {
+		t.Errorf("expected key to be allowed after the block expires: %s", key)
+	}
+
+	l.Block(key, time.Hour)
+	l.Unblock(key)
+	if !l.Allow(key) {
+		t.Errorf("expected unblocked key to be allowed: %s", key)
+	}
+}
+
+func TestDisabledBlock(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	l.Block("foo", time.Hour)
+	if !l.Allow("foo") {
+		t.Error("expected disabled limiter to allow")
+	}
+}
@@ -0,0 +1,156 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// blockAllLimiter denies every event, a kill switch for incidents. It does not
+// require storage and is otherwise a disabledLimiter.
+type blockAllLimiter struct {
+	disabledLimiter
+}
+
+func (l *blockAllLimiter) Allow(key string) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowN(key string, n int) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowDynamic(key string, rate float64, burst int) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowNDynamic(key string, n int, rate float64, burst int) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowWith(key string, opts ...Option) (bool, error) {
+	return false, nil
+}
+
+// Check reports every event as denied and never allowed
+func (l *blockAllLimiter) Check(key string, n int) (Decision, error) {
+	return Decision{ID: key, Reason: DecisionDenied, RetryAfter: -1}, nil
+}
+
+func (l *blockAllLimiter) AllowWithin(key string, n int, maxWait time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (l *blockAllLimiter) AllowIf(key string, n int, expectMin float64) (bool, error) {
+	return false, nil
+}
+
+func (l *blockAllLimiter) AllowStream(ctx context.Context, ids <-chan string) <-chan Decision {
+	return stream(ctx, ids, func(batch []string) []Decision {
+		return decideAll(batch, l.Check)
+	})
+}
+
+func (l *blockAllLimiter) AllowAll(ids []string) (map[string]Decision, error) {
+	return decisionMap(decideAll(ids, l.Check))
+}
+
+func (l *blockAllLimiter) AllowNDynamicInterval(key string, n int, rate float64, burst int, interval time.Duration) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowAsync(key string, n int) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowAtTick(key string, tick uint64, n int) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowSeq(key string, seq uint64, n int) (bool, error) {
+	return false, nil
+}
+
+func (l *blockAllLimiter) AllowSometimes(key string, first, every int, interval time.Duration) bool {
+	return false
+}
+
+func (l *blockAllLimiter) AllowChild(parent, child string, n int) (bool, error) {
+	return false, nil
+}
+
+// AllowChildReason reports the parent since it is the binding constraint for
+// all children
+func (l *blockAllLimiter) AllowChildReason(parent, child string, n int) (bool, Reason, error) {
+	return false, ReasonParent, nil
+}
+
+func (l *blockAllLimiter) AllowField(key, field string, n int) (bool, error) {
+	return false, nil
+}
+
+func (l *blockAllLimiter) AllowWithState(key string, n int) (bool, string, error) {
+	return false, "", nil
+}
+
+func (l *blockAllLimiter) AllowNWithRemaining(key string, n int) (bool, float64, error) {
+	return false, 0, nil
+}
+
+func (l *blockAllLimiter) CheckOnly(key string, n int) (bool, float64, error) {
+	return false, 0, nil
+}
+
+func (l *blockAllLimiter) Begin(key string) (func(n int) error, func()) {
+	return nil, nil
+}
+
+func (l *blockAllLimiter) BeginN(key string, n int) (func(n int) error, func()) {
+	return nil, nil
+}
+
+func (l *blockAllLimiter) Tokens(key string) (float64, error) {
+	return 0, nil
+}
+
+func (l *blockAllLimiter) TokensAt(key string, t time.Time) (float64, error) {
+	return 0, nil
+}
+
+func (l *blockAllLimiter) Transfer(from, to string, n int) error {
+	return ErrInsufficientTokens
+}
+
+// Wait returns ErrNeverAllowed rather than blocking since no event is ever
+// allowed
+func (l *blockAllLimiter) Wait(ctx context.Context, key string) error {
+	return ErrNeverAllowed
+}
+
+func (l *blockAllLimiter) WaitN(ctx context.Context, key string, n int) error {
+	return ErrNeverAllowed
+}
+
+func (l *blockAllLimiter) RetryAfter(key string, n int) (time.Duration, error) {
+	return 0, ErrNeverAllowed
+}
+
+func (l *blockAllLimiter) Rate() float64 {
+	return 0
+}
+
+func (l *blockAllLimiter) Burst() int {
+	return 0
+}
+
+func (l *blockAllLimiter) BackendType() Type {
+	return TypeBlockAll
+}
+
+// FailOpenMode returns false as the block all limiter denies every event
+func (l *blockAllLimiter) FailOpenMode() bool {
+	return false
+}
+
+func (l *blockAllLimiter) GlobalAllow(n int) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBlockAllLimiter(t *testing.T) {
+	l := New(Config{Type: TypeBlockAll})
+
+	for name, allowed := range map[string]bool{
+		"Allow":                 l.Allow("foo"),
+		"AllowN":                l.AllowN("foo", 1),
+		"AllowDynamic":          l.AllowDynamic("foo", 1, 1),
+		"AllowNDynamic":         l.AllowNDynamic("foo", 1, 1, 1),
+		"AllowNDynamicInterval": l.AllowNDynamicInterval("foo", 1, 1, 1, time.Second),
+		"AllowAtTick":           l.AllowAtTick("foo", 1, 1),
+		"AllowSometimes":        l.AllowSometimes("foo", 1, 1, time.Second),
+	} {
+		if allowed {
+			t.Errorf("expected %s to deny", name)
+		}
+	}
+
+	if allowed, _ := l.AllowChild("foo", "bar", 1); allowed {
+		t.Error("expected AllowChild to deny")
+	}
+	if allowed, reason, _ := l.AllowChildReason("foo", "bar", 1); allowed || reason != ReasonParent {
+		t.Errorf("expected AllowChildReason to deny with the parent: %s", reason)
+	}
+	if allowed, _, _ := l.AllowWithState("foo", 1); allowed {
+		t.Error("expected AllowWithState to deny")
+	}
+	if allowed, remaining, _ := l.AllowNWithRemaining("foo", 1); allowed || remaining != 0 {
+		t.Errorf("expected AllowNWithRemaining to deny with no tokens: %v", remaining)
+	}
+	if allowed, remaining, _ := l.CheckOnly("foo", 1); allowed || remaining != 0 {
+		t.Errorf("expected CheckOnly to deny with no tokens: %v", remaining)
+	}
+	if commit, abort := l.Begin("foo"); commit != nil || abort != nil {
+		t.Error("expected Begin to deny")
+	}
+	if tokens, _ := l.Tokens("foo"); tokens != 0 {
+		t.Errorf("expected no tokens: %v", tokens)
+	}
+	if err := l.Transfer("foo", "bar", 1); err != ErrInsufficientTokens {
+		t.Errorf("expected ErrInsufficientTokens: %v", err)
+	}
+	if err := l.Wait(context.Background(), "foo"); err != ErrNeverAllowed {
+		t.Errorf("expected ErrNeverAllowed: %v", err)
+	}
+	if _, err := l.RetryAfter("foo", 1); err != ErrNeverAllowed {
+		t.Errorf("expected ErrNeverAllowed: %v", err)
+	}
+
+	if l.Rate() != 0 || l.Burst() != 0 {
+		t.Errorf("expected zero rate and burst limits: %v %d", l.Rate(), l.Burst())
+	}
+}
@@ -0,0 +1,279 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// invalidateChannel is the channel Redis publishes client side caching
+// invalidation messages to for connections redirecting them
+const invalidateChannel = "__redis__:invalidate"
+
+// cacheReconnectDelay is how long the clientCache waits before reconnecting
+// its invalidation connection after failing to connect or losing it
+const cacheReconnectDelay = time.Second
+
+// cachedBucket is a token bucket read from Redis, or its absence
+type cachedBucket struct {
+	bucket    bucket
+	ok        bool
+	withState bool
+}
+
+// clientCache caches token buckets read from Redis until Redis reports their
+// keys were modified. A dedicated invalidation connection enables broadcast
+// tracking of keys with the key prefix redirected to itself and subscribes to
+// invalidation messages, so keys are invalidated no matter which connection
+// read them or whether it is still open. Nothing is cached while the
+// invalidation connection is down; it is reconnected in the background.
+type clientCache struct {
+	dial   func() (redis.Conn, error)
+	prefix string
+	delay  time.Duration
+
+	mux       sync.Mutex
+	running   bool
+	connected bool
+	closed    bool
+	conn      redis.Conn
+	done      chan struct{}
+	epoch     uint64
+	buckets   map[string]cachedBucket
+}
+
+// newClientCache returns a clientCache which connects its invalidation
+// connection using the given dial function on first use, tracking keys with
+// the given prefix
+func newClientCache(dial func() (redis.Conn, error), prefix string) *clientCache {
+	return &clientCache{
+		dial:    dial,
+		prefix:  prefix,
+		delay:   cacheReconnectDelay,
+		done:    make(chan struct{}),
+		buckets: make(map[string]cachedBucket),
+	}
+}
+
+// start connects the invalidation connection in the background unless it is
+// already running. The caller must hold the lock.
+func (cc *clientCache) start() {
+	if cc.running || cc.closed {
+		return
+	}
+	cc.running = true
+	go cc.run()
+}
+
+// run connects the invalidation connection and listens to it, reconnecting
+// after the delay whenever connecting fails or the connection is lost, until
+// the cache is closed
+func (cc *clientCache) run() {
+	for {
+		if c, err := cc.connect(); err == nil && cc.connectedTo(c) {
+			cc.listen(c)
+		}
+
+		t := time.NewTimer(cc.delay)
+		select {
+		case <-cc.done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// connect dials the invalidation connection, enables broadcast tracking
+// redirected to itself and subscribes it to invalidation messages
+func (cc *clientCache) connect() (redis.Conn, error) {
+	c, err := cc.dial()
+	if err != nil {
+		return nil, err
+	}
+	id, err := redis.Int64(c.Do("CLIENT", "ID"))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	args := []interface{}{"TRACKING", "ON", "REDIRECT", id, "BCAST"}
+	if cc.prefix != "" {
+		args = append(args, "PREFIX", cc.prefix)
+	}
+	if _, err := c.Do("CLIENT", args...); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Send("SUBSCRIBE", invalidateChannel); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// invalidations are only delivered once subscribed
+	if _, err := c.Receive(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connectedTo enables caching now that the given invalidation connection is
+// subscribed, returning false and closing it if the cache was closed
+func (cc *clientCache) connectedTo(c redis.Conn) bool {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	if cc.closed {
+		c.Close()
+		return false
+	}
+	cc.conn = c
+	cc.connected = true
+	cc.epoch++
+	return true
+}
+
+// listen invalidates cached token buckets as invalidation messages are
+// received on the given connection until it fails
+func (cc *clientCache) listen(c redis.Conn) {
+	defer c.Close()
+
+	for {
+		reply, err := redis.Values(c.Receive())
+		if err != nil {
+			cc.disconnect()
+			return
+		}
+
+		var kind, channel string
+		if _, err := redis.Scan(reply, &kind, &channel); err != nil || kind != "message" || channel != invalidateChannel {
+			continue
+		}
+
+		// a nil message means Redis flushed its keys
+		keys, err := redis.Strings(reply[2], nil)
+		if err != nil {
+			cc.flush()
+			continue
+		}
+		cc.invalidate(keys...)
+	}
+}
+
+// get returns the cached token bucket stored at the given key, the epoch to
+// pass to set once the bucket is read from Redis on a miss, and true on a hit.
+// The invalidation connection is connected in the background on first use.
+func (cc *clientCache) get(key string, withState bool) (cachedBucket, uint64, bool) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	cc.start()
+
+	b, ok := cc.buckets[key]
+	if !ok || (withState && !b.withState) {
+		return cachedBucket{}, cc.epoch, false
+	}
+	return b, cc.epoch, true
+}
+
+// set caches the token bucket read from the given key unless an invalidation
+// was received since the given epoch, since the bucket may predate it, or the
+// invalidation connection is down
+func (cc *clientCache) set(key string, b cachedBucket, epoch uint64) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	if !cc.connected || cc.epoch != epoch {
+		return
+	}
+	cc.buckets[key] = b
+}
+
+// invalidate removes the given keys from the cache
+func (cc *clientCache) invalidate(keys ...string) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	cc.epoch++
+	for _, key := range keys {
+		delete(cc.buckets, key)
+	}
+}
+
+// flush removes all keys from the cache
+func (cc *clientCache) flush() {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	cc.epoch++
+	cc.buckets = make(map[string]cachedBucket)
+}
+
+// disconnect flushes the cache and stops caching until the invalidation
+// connection is reconnected, since invalidations may be missed meanwhile
+func (cc *clientCache) disconnect() {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	cc.epoch++
+	cc.connected = false
+	cc.conn = nil
+	cc.buckets = make(map[string]cachedBucket)
+}
+
+// close disables the cache for good, closing the invalidation connection and
+// stopping it from reconnecting
+func (cc *clientCache) close() {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+
+	if cc.closed {
+		return
+	}
+	cc.closed = true
+	close(cc.done)
+	if cc.conn != nil {
+		cc.conn.Close()
+	}
+	cc.epoch++
+	cc.connected = false
+	cc.buckets = make(map[string]cachedBucket)
+}
+
+// cachedStorage serves token bucket reads from a clientCache, falling back to
+// the wrapped storage on a miss
+type cachedStorage struct {
+	storage
+	cache *clientCache
+}
+
+func (s cachedStorage) read(c redis.Conn, key string, withState bool) (bucket, bool, error) {
+	cached, epoch, hit := s.cache.get(key, withState)
+	if hit {
+		return cached.bucket, cached.ok, nil
+	}
+
+	b, ok, err := s.storage.read(c, key, withState)
+	if err != nil {
+		return b, ok, err
+	}
+	s.cache.set(key, cachedBucket{bucket: b, ok: ok, withState: withState}, epoch)
+	return b, ok, nil
+}
+
+func (s cachedStorage) create(c redis.Conn, key string, b bucket) error {
+	err := s.storage.create(c, key, b)
+	s.cache.invalidate(key)
+	return err
+}
+
+func (s cachedStorage) update(c redis.Conn, key string, b bucket) error {
+	err := s.storage.update(c, key, b)
+	s.cache.invalidate(key)
+	return err
+}
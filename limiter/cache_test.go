@@ -0,0 +1,337 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+// fakeInvalidationConn is an invalidation connection which records the
+// commands it is sent, receives the push messages sent on its channel and
+// fails once the channel is closed
+type fakeInvalidationConn struct {
+	redis.Conn
+	messages chan interface{}
+
+	mux      sync.Mutex
+	commands [][]interface{}
+}
+
+func newFakeInvalidationConn() *fakeInvalidationConn {
+	c := &fakeInvalidationConn{messages: make(chan interface{}, 2)}
+	c.messages <- []interface{}{[]byte("subscribe"), []byte(invalidateChannel), int64(1)}
+	return c
+}
+
+func (c *fakeInvalidationConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.commands = append(c.commands, append([]interface{}{cmd}, args...))
+	return int64(7), nil
+}
+
+func (c *fakeInvalidationConn) Send(cmd string, args ...interface{}) error { return nil }
+
+func (c *fakeInvalidationConn) Flush() error { return nil }
+
+func (c *fakeInvalidationConn) Close() error { return nil }
+
+func (c *fakeInvalidationConn) Receive() (interface{}, error) {
+	m, ok := <-c.messages
+	if !ok {
+		return nil, errors.New("closed")
+	}
+	return m, nil
+}
+
+// invalidate sends an invalidation message for the given keys, a nil slice
+// flushes all keys
+func (c *fakeInvalidationConn) invalidate(keys []interface{}) {
+	var data interface{}
+	if keys != nil {
+		data = keys
+	}
+	c.messages <- []interface{}{[]byte("message"), []byte(invalidateChannel), data}
+}
+
+// eventuallyConnects fails unless the cache connects its invalidation
+// connection before the deadline
+func eventuallyConnects(t *testing.T, cache *clientCache) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		cache.get("", false)
+		cache.mux.Lock()
+		connected := cache.connected
+		cache.mux.Unlock()
+		if connected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the invalidation connection to connect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newCachedStorage(t *testing.T, fakes ...*fakeInvalidationConn) (cachedStorage, *fakeInvalidationConn, redis.Conn) {
+	s := miniredis.RunT(t)
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	fake := newFakeInvalidationConn()
+	dials := append([]*fakeInvalidationConn{fake}, fakes...)
+	var mux sync.Mutex
+	cache := newClientCache(func() (redis.Conn, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		if len(dials) == 0 {
+			return nil, errors.New("refused")
+		}
+		next := dials[0]
+		dials = dials[1:]
+		return next, nil
+	}, "")
+	cache.delay = time.Millisecond
+	t.Cleanup(cache.close)
+
+	eventuallyConnects(t, cache)
+	return cachedStorage{storage: listStorage{}, cache: cache}, fake, c
+}
+
+// eventuallyReads fails unless reading the given key returns the given tokens
+// before the deadline
+func eventuallyReads(t *testing.T, s storage, c redis.Conn, key string, tokens float64) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		b, _, err := s.read(c, key, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.tokens == tokens {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected to read %v tokens: %v", tokens, b.tokens)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachedStorageInvalidate(t *testing.T) {
+	s, fake, c := newCachedStorage(t)
+
+	if err := s.create(c, "foo", bucket{tokens: 5, last: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, _ := s.read(c, "foo", false); !ok || b.tokens != 5 {
+		t.Fatalf("expected to read 5 tokens: %v", b.tokens)
+	}
+
+	// modified by another client so the cached read is stale
+	listStorage{}.update(c, "foo", bucket{tokens: 9, last: 200})
+	if b, _, _ := s.read(c, "foo", false); b.tokens != 5 {
+		t.Errorf("expected read to be served from the cache: %v", b.tokens)
+	}
+
+	fake.invalidate([]interface{}{[]byte("foo")})
+	eventuallyReads(t, s, c, "foo", 9)
+}
+
+func TestCachedStorageFlush(t *testing.T) {
+	s, fake, c := newCachedStorage(t)
+
+	// missing keys are cached too
+	if _, ok, _ := s.read(c, "foo", false); ok {
+		t.Fatal("expected foo to not exist")
+	}
+	listStorage{}.create(c, "foo", bucket{tokens: 3, last: 100})
+	if _, ok, _ := s.read(c, "foo", false); ok {
+		t.Error("expected read to be served from the cache")
+	}
+
+	fake.invalidate(nil)
+	eventuallyReads(t, s, c, "foo", 3)
+}
+
+func TestCachedStorageWrite(t *testing.T) {
+	s, _, c := newCachedStorage(t)
+
+	s.create(c, "foo", bucket{tokens: 5, last: 100})
+	s.read(c, "foo", false)
+
+	// writes through the cache invalidate it immediately
+	if err := s.update(c, "foo", bucket{tokens: 4, last: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _, _ := s.read(c, "foo", false); b.tokens != 4 {
+		t.Errorf("expected to read 4 tokens: %v", b.tokens)
+	}
+}
+
+// newConnectedCache returns a clientCache which acts as if its invalidation
+// connection is connected without dialing one
+func newConnectedCache() *clientCache {
+	cache := newClientCache(nil, "")
+	cache.running = true
+	cache.connected = true
+	return cache
+}
+
+func TestClientCacheStaleSet(t *testing.T) {
+	cache := newConnectedCache()
+
+	_, epoch, hit := cache.get("foo", false)
+	if hit {
+		t.Fatal("expected a miss")
+	}
+
+	// an invalidation received during the read discards its result
+	cache.invalidate("foo")
+	cache.set("foo", cachedBucket{ok: true}, epoch)
+	if _, _, hit := cache.get("foo", false); hit {
+		t.Error("expected bucket read before the invalidation to not be cached")
+	}
+}
+
+func TestClientCacheState(t *testing.T) {
+	cache := newConnectedCache()
+
+	_, epoch, _ := cache.get("foo", false)
+	cache.set("foo", cachedBucket{ok: true}, epoch)
+	if _, _, hit := cache.get("foo", true); hit {
+		t.Error("expected bucket read without state to miss reads with state")
+	}
+}
+
+func TestClientCacheReconnect(t *testing.T) {
+	next := newFakeInvalidationConn()
+	s, fake, c := newCachedStorage(t, next)
+
+	s.create(c, "foo", bucket{tokens: 5, last: 100})
+	s.read(c, "foo", false)
+	close(fake.messages)
+
+	// without invalidations every read goes to Redis
+	listStorage{}.update(c, "foo", bucket{tokens: 9, last: 200})
+	eventuallyReads(t, s, c, "foo", 9)
+
+	// caching resumes once reconnected
+	eventuallyConnects(t, s.cache)
+	s.read(c, "foo", false)
+	listStorage{}.update(c, "foo", bucket{tokens: 2, last: 300})
+	if b, _, _ := s.read(c, "foo", false); b.tokens != 9 {
+		t.Errorf("expected read to be served from the cache: %v", b.tokens)
+	}
+	next.invalidate([]interface{}{[]byte("foo")})
+	eventuallyReads(t, s, c, "foo", 2)
+}
+
+func TestClientCacheClose(t *testing.T) {
+	s, _, c := newCachedStorage(t)
+
+	s.cache.close()
+	s.create(c, "foo", bucket{tokens: 5, last: 100})
+	s.read(c, "foo", false)
+	listStorage{}.update(c, "foo", bucket{tokens: 9, last: 200})
+	if b, _, _ := s.read(c, "foo", false); b.tokens != 9 {
+		t.Errorf("expected reads to go to Redis once closed: %v", b.tokens)
+	}
+	s.cache.mux.Lock()
+	defer s.cache.mux.Unlock()
+	if s.cache.connected {
+		t.Error("expected the invalidation connection to be closed")
+	}
+}
+
+func TestClientCacheConnect(t *testing.T) {
+	fake := newFakeInvalidationConn()
+	cache := newClientCache(func() (redis.Conn, error) { return fake, nil }, "rl:")
+
+	c, err := cache.connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != fake {
+		t.Fatal("expected the dialed connection")
+	}
+	expected := [][]interface{}{
+		{"CLIENT", "ID"},
+		{"CLIENT", "TRACKING", "ON", "REDIRECT", int64(7), "BCAST", "PREFIX", "rl:"},
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v: %v", expected, fake.commands)
+	}
+}
+
+func TestClientCacheConnectFails(t *testing.T) {
+	cache := newClientCache(func() (redis.Conn, error) { return nil, errors.New("refused") }, "")
+	cache.delay = time.Millisecond
+	defer cache.close()
+
+	// reads are not cached until connected
+	_, epoch, _ := cache.get("foo", false)
+	cache.set("foo", cachedBucket{ok: true}, epoch)
+	if _, _, hit := cache.get("foo", false); hit {
+		t.Error("expected nothing to be cached while disconnected")
+	}
+}
+
+// trackingConn answers the client side caching commands miniredis lacks
+type trackingConn struct {
+	redis.Conn
+}
+
+func (c trackingConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "CLIENT" {
+		return int64(7), nil
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+func TestRedisClientCache(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:        TypeRedis,
+		RateLimit:   1,
+		BurstLimit:  5,
+		Interval:    time.Hour,
+		ClientCache: true,
+		DialFunc: func(ctx context.Context) (redis.Conn, error) {
+			c, err := redis.Dial("tcp", s.Addr())
+			return trackingConn{c}, err
+		},
+	})
+	defer l.Close()
+
+	if !l.Allow("foo") {
+		t.Fatal("expected to allow key: foo")
+	}
+	eventuallyConnects(t, l.(*redisLimiter).cache)
+
+	now := time.Now()
+	if tokens, err := l.TokensAt("foo", now); err != nil || tokens != 4 {
+		t.Fatalf("expected 4 tokens: %v %v", tokens, err)
+	}
+
+	// modified without an invalidation so the second read is served from the cache
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Do("LSET", "foo", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, err := l.TokensAt("foo", now); err != nil || tokens != 4 {
+		t.Errorf("expected read to be served from the cache: %v %v", tokens, err)
+	}
+}
@@ -0,0 +1,118 @@
+package limiter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// CalendarWindow defines a calendar period a key's quota resets on
+type CalendarWindow int
+
+const (
+	// WindowNone limits keys with a token bucket on a rolling interval
+	WindowNone CalendarWindow = iota
+	// WindowDay resets quotas at midnight
+	WindowDay
+	// WindowWeek resets quotas at midnight on Monday
+	WindowWeek
+	// WindowMonth resets quotas at midnight on the first day of the month
+	WindowMonth
+)
+
+// Bounds returns the start and end of the calendar window containing the
+// given time in the given time zone
+func (w CalendarWindow) Bounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch w {
+	case WindowDay:
+		start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	case WindowWeek:
+		// weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7)
+	case WindowMonth:
+		start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+	return t, t
+}
+
+// windowKey returns the key counting queries in the window starting at start
+func windowKey(key string, start time.Time) string {
+	return suffixedKey(key, "window:"+strconv.FormatInt(start.Unix(), 10))
+}
+
+// allowWindowScript counts queries in a calendar window, expiring the count at
+// the end of the window. It returns whether the queries are allowed and the
+// count of queries in the window, or nil without counting them if the key is
+// blocked.
+//
+// KEYS[1] window key, KEYS[2] block key
+// ARGV[1] n, ARGV[2] quota, ARGV[3] window end (unix seconds)
+var allowWindowScript = newScript(2, `
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return nil
+end
+local n = tonumber(ARGV[1])
+local count = redis.call("INCRBY", KEYS[1], n)
+if count == n then
+	redis.call("EXPIREAT", KEYS[1], ARGV[3])
+end
+if count > tonumber(ARGV[2]) then
+	return {0, redis.call("DECRBY", KEYS[1], n)}
+end
+return {1, count}
+`)
+
+// allowWindow returns true if the given key has made fewer than quota queries
+// in the current calendar window, false otherwise, along with the queries
+// remaining in the window. errBlocked is returned if the key is blocked.
+func (l *redisLimiter) allowWindow(db backend, key string, n int, quota float64) (bool, float64, error) {
+	start, end := l.window.Bounds(l.now(), l.location)
+	values, err := redis.Values(db.eval(allowWindowScript,
+		windowKey(key, start), blockKey(key), n, quota, end.Unix(),
+	))
+	if err == redis.ErrNil {
+		return false, 0, errBlocked
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	var allowed bool
+	var count int64
+	if _, err := redis.Scan(values, &allowed, &count); err != nil {
+		return false, 0, err
+	}
+	return allowed, quota - float64(count), nil
+}
+
+// windowCount counts queries in the calendar window starting at start
+type windowCount struct {
+	start time.Time
+	count int
+}
+
+func (l *inMemoryLimiter) allowWindow(key string, n int, quota float64) (bool, float64) {
+	start, _ := l.window.Bounds(l.now(), l.location)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	w, ok := l.windows[key]
+	if !ok || !w.start.Equal(start) {
+		w = &windowCount{start: start}
+		l.windows[key] = w
+	}
+
+	if float64(w.count+n) > quota {
+		return false, quota - float64(w.count)
+	}
+	w.count += n
+	return true, quota - float64(w.count)
+}
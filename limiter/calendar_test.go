@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// est is a non-UTC time zone without daylight saving time
+var est = time.FixedZone("EST", -5*60*60)
+
+func TestCalendarWindowBounds(t *testing.T) {
+	// Wednesday January 15th 2020 at 23:30 EST, 04:30 the next day in UTC
+	now := time.Date(2020, time.January, 15, 23, 30, 0, 0, est)
+
+	for _, tc := range []struct {
+		window     CalendarWindow
+		start, end time.Time
+	}{
+		{
+			WindowDay,
+			time.Date(2020, time.January, 15, 0, 0, 0, 0, est),
+			time.Date(2020, time.January, 16, 0, 0, 0, 0, est),
+		},
+		{
+			WindowWeek,
+			time.Date(2020, time.January, 13, 0, 0, 0, 0, est),
+			time.Date(2020, time.January, 20, 0, 0, 0, 0, est),
+		},
+		{
+			WindowMonth,
+			time.Date(2020, time.January, 1, 0, 0, 0, 0, est),
+			time.Date(2020, time.February, 1, 0, 0, 0, 0, est),
+		},
+	} {
+		start, end := tc.window.Bounds(now, est)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("expected window %d to be [%v, %v): [%v, %v)",
+				tc.window, tc.start, tc.end, start, end)
+		}
+	}
+}
+
+func TestRedisCalendarWindow(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.window = WindowDay
+	l.location = est
+	key := "foo"
+
+	now := time.Date(2020, time.January, 15, 23, 30, 0, 0, est)
+	l.now = func() time.Time { return now }
+	midnight := time.Date(2020, time.January, 16, 0, 0, 0, 0, est)
+
+	m.On("Do", "EVALSHA", []interface{}{
+		scripts[allowWindowScript].Hash(), 2,
+		windowKey(key, midnight.AddDate(0, 0, -1)), blockKey(key), 1, l.rate, midnight.Unix(),
+	}).Return([]interface{}{int64(0), int64(10)}, nil).Once()
+
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+}
+
+func TestRedisCalendarWindowResets(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.window = WindowDay
+	l.location = est
+	key := "foo"
+
+	// just past local midnight counts against a new window
+	now := time.Date(2020, time.January, 16, 0, 0, 1, 0, est)
+	l.now = func() time.Time { return now }
+	midnight := time.Date(2020, time.January, 16, 0, 0, 0, 0, est)
+
+	m.On("Do", "EVALSHA", []interface{}{
+		scripts[allowWindowScript].Hash(), 2,
+		windowKey(key, midnight), blockKey(key), 1, l.rate, midnight.AddDate(0, 0, 1).Unix(),
+	}).Return([]interface{}{int64(1), int64(1)}, nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+}
+
+func TestRedisCalendarWindowError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.window = WindowDay
+	l.failOpen = true
+
+	m.On("Do", "EVALSHA", mock.Anything).Return(nil, errors.New("not good")).Once()
+
+	if !l.Allow("foo") {
+		t.Error("expected to fail open")
+	}
+}
+
+func TestInMemoryCalendarWindow(t *testing.T) {
+	l := New(Config{
+		Type:           TypeInMemory,
+		RateLimit:      3,
+		BurstLimit:     3,
+		CalendarWindow: WindowDay,
+		Location:       est,
+	}).(*inMemoryLimiter)
+	key := "foo"
+
+	// a minute before local midnight is already the next day in UTC
+	now := time.Date(2020, time.January, 15, 23, 59, 0, 0, est)
+	l.now = func() time.Time { return now }
+
+	if !l.AllowN(key, 3) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+
+	// the quota resets at local midnight
+	now = time.Date(2020, time.January, 16, 0, 0, 0, 0, est)
+	if !l.AllowN(key, 3) {
+		t.Errorf("expected to allow key after local midnight: %s", key)
+	}
+}
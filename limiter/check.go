@@ -0,0 +1,134 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// Reasons reported by Decision
+const (
+	// DecisionAllowed is reported when the events are allowed
+	DecisionAllowed = "allowed"
+	// DecisionLimited is reported when the key's token bucket does not have
+	// enough tokens for the events, or the key is blocked
+	DecisionLimited = "limited"
+	// DecisionDenied is reported when the key is on the deny list
+	DecisionDenied = "denied"
+	// DecisionError is reported when the events were decided by the fail
+	// open behavior after a storage error
+	DecisionError = "error"
+)
+
+// Decision is the outcome of deciding events for a key, with what a gateway
+// needs to respond without further calls
+type Decision struct {
+	ID      string
+	Allowed bool
+	// Remaining is the tokens remaining in the key's bucket after the
+	// decision, or the queries remaining in its calendar window
+	Remaining float64
+	// Limit is the burst limit in effect for the key
+	Limit int
+	// RetryAfter is how long until the key has tokens for the events, zero if
+	// they were allowed and negative if they will never be allowed
+	RetryAfter time.Duration
+	// Reason is one of DecisionAllowed, DecisionLimited, DecisionDenied or
+	// DecisionError
+	Reason string
+	// Err is the storage error the events were decided after, nil otherwise.
+	// When set, Reason is DecisionError and Allowed reflects the fail open
+	// behavior, so a failed open decision is allowed with Err set.
+	Err error
+}
+
+// decision returns the Decision for the outcome of allowNRemaining, computing
+// the retry delay from the remaining tokens rather than another round trip
+func decision(key string, n, limit int, allowed bool, remaining float64, err error, lists keyLists, delay func(tokens float64, n int) time.Duration) Decision {
+	d := Decision{ID: key, Allowed: allowed, Remaining: remaining, Limit: limit, Reason: DecisionAllowed, Err: err}
+	if decided, listed := lists.check(key); err == nil && decided && !listed {
+		d.Reason = DecisionDenied
+		d.RetryAfter = -1
+		return d
+	}
+	switch {
+	case err != nil:
+		d.Reason = DecisionError
+	case !allowed:
+		d.Reason = DecisionLimited
+		d.RetryAfter = delay(remaining, n)
+	}
+	return d
+}
+
+// Check decides the given number of events for the given key like
+// AllowNWithRemaining and returns the Decision. The key's token bucket is
+// decided atomically, in a transaction watching it along with the key's block
+// and overflow bucket, retried like OptimisticRetries or 3 times without them.
+// Unlike Allow, events are always decided by Redis rather than sampled or
+// estimated locally.
+func (l *redisLimiter) Check(key string, n int) (Decision, error) {
+	l = l.keyed(key).atomically()
+	allowed, remaining, err := l.allowNRemaining(key, n, l.rate, l.burst)
+	return decision(key, n, l.burst, allowed, remaining, err, l.lists, l.delay), err
+}
+
+func (l *inMemoryLimiter) Check(key string, n int) (Decision, error) {
+	l = l.keyed(key)
+	allowed, remaining, err := l.allowNRemaining(key, n, l.rate, l.burst)
+	return decision(key, n, l.burst, allowed, remaining, err, l.lists, l.delay), err
+}
+
+func (l *disabledLimiter) Check(key string, n int) (Decision, error) {
+	return Decision{ID: key, Allowed: true, Remaining: math.MaxFloat64, Reason: DecisionAllowed}, nil
+}
+
+// CheckOnly returns true if the given key has enough tokens for the given
+// number of events along with the tokens in its bucket after allotment. It
+// only reads the key so a never seen key is reported as a full bucket without
+// being created. The overflow bucket is not considered.
+func (l *redisLimiter) CheckOnly(key string, n int) (bool, float64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	b, ok, err := db.read(key, false)
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen, 0, err
+	}
+	if !ok {
+		return float64(l.burst-n) >= l.minTokens, float64(l.burst), nil
+	}
+
+	tokens := refill(b, l.now().Add(l.grace), l.interval, l.refillRate(l.rate), l.burst)
+	return tokens-float64(n) >= l.minTokens, tokens, nil
+}
+
+func (l *inMemoryLimiter) CheckOnly(key string, n int) (bool, float64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	tokens := float64(l.burst)
+	if l.pureGo {
+		tokens = l.tokens(key, l.refillRate(l.rate), l.burst, now)
+	} else if limiter, ok := l.limiters[key]; ok {
+		tokens = limiterTokens(limiter, now)
+	}
+	return tokens-float64(n) >= l.minTokens, tokens, nil
+}
+
+func (l *disabledLimiter) CheckOnly(key string, n int) (bool, float64, error) {
+	return true, math.MaxFloat64, nil
+}
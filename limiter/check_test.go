@@ -0,0 +1,237 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRedisCheckOnly(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("1"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Second).Unix())),
+		}, nil,
+	).Twice()
+
+	allowed, remaining, err := l.CheckOnly(key, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || remaining != 11 {
+		t.Errorf("expected to allow with 11 remaining: %v %v", allowed, remaining)
+	}
+
+	// each check borrows a connection from the pool
+	var n []interface{} = nil
+	m.On("Do", "", n).Return(nil, nil).Once()
+	m.On("Err").Return(nil).Once()
+	m.On("Close").Return(nil).Once()
+
+	if allowed, _, _ := l.CheckOnly(key, 12); allowed {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+
+	// only the read is issued
+	m.AssertNotCalled(t, "Do", "LPUSH", mock.Anything)
+	m.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	m.AssertExpectations(t)
+}
+
+func TestRedisCheckOnlyNoKey(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return([]interface{}{}, nil).Once()
+
+	allowed, remaining, err := l.CheckOnly(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || remaining != float64(l.burst) {
+		t.Errorf("expected to allow with %v remaining: %v %v", l.burst, allowed, remaining)
+	}
+
+	// the key is not created
+	m.AssertNotCalled(t, "Do", "LPUSH", mock.Anything)
+	m.AssertExpectations(t)
+}
+
+func TestRedisCheckOnlyError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(nil, errors.New("not good")).Once()
+
+	allowed, _, err := l.CheckOnly(key, 1)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if allowed {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+}
+
+func TestInMemoryCheckOnly(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 2,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+		now := time.Now().Truncate(time.Second)
+		l.now = func() time.Time { return now }
+		key := "foo"
+
+		allowed, remaining, _ := l.CheckOnly(key, 2)
+		if !allowed || remaining != 2 {
+			t.Errorf("expected to allow with 2 remaining: %v %v", allowed, remaining)
+		}
+		if keys, _ := l.Keys(context.Background()); len(keys) != 0 {
+			t.Errorf("expected no keys to be created: %v", keys)
+		}
+
+		l.AllowN(key, 2)
+		for i := 0; i < 2; i++ {
+			allowed, remaining, _ = l.CheckOnly(key, 1)
+			if allowed || remaining != 0 {
+				t.Errorf("expected to not allow with 0 remaining: %v %v", allowed, remaining)
+			}
+		}
+
+		now = now.Add(time.Second)
+		if allowed, _, _ = l.CheckOnly(key, 1); !allowed {
+			t.Errorf("expected to allow key: %s", key)
+		}
+	}
+}
+
+func TestDisabledCheckOnly(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if allowed, remaining, _ := l.CheckOnly("foo", 1); !allowed || remaining != math.MaxFloat64 {
+		t.Errorf("expected to allow with %v remaining: %v %v", math.MaxFloat64, allowed, remaining)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		config.DenyList = []string{"bad"}
+		l := New(config)
+
+		d, err := l.Check("foo", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Allowed || d.ID != "foo" || d.Reason != DecisionAllowed || d.Limit != 2 || d.RetryAfter != 0 || d.Err != nil {
+			t.Errorf("%s: expected foo to be allowed: %+v", name, d)
+		}
+		if math.Abs(d.Remaining-1) > 1e-3 {
+			t.Errorf("%s: expected one token remaining: %v", name, d.Remaining)
+		}
+
+		// the denial reports when the bucket has tokens for the events
+		d, err = l.Check("foo", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed || d.Reason != DecisionLimited || d.Limit != 2 {
+			t.Errorf("%s: expected foo to be limited: %+v", name, d)
+		}
+		if math.Abs(d.Remaining-1) > 1e-3 {
+			t.Errorf("%s: expected one token remaining: %v", name, d.Remaining)
+		}
+		if d.RetryAfter <= 0 || d.RetryAfter > time.Hour {
+			t.Errorf("%s: expected to retry within the interval: %v", name, d.RetryAfter)
+		}
+
+		d, _ = l.Check("bad", 1)
+		if d.Allowed || d.Reason != DecisionDenied || d.RetryAfter >= 0 {
+			t.Errorf("%s: expected the deny listed key to never be allowed: %+v", name, d)
+		}
+	}
+}
+
+func TestCheckAtomic(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	key := "foo"
+	l.Allow(key)
+
+	// the bucket is rewritten between every read and write of the check
+	other := l.pool.Get()
+	defer other.Close()
+	attempts := 0
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return hookConn{Conn: c, hook: func(cmd string, args ...interface{}) {
+			if cmd == "EXEC" {
+				attempts++
+				other.Do("LSET", key, 0, 1)
+			}
+		}}, err
+	}
+
+	d, err := l.Check(key, 1)
+	if err != ErrConflict || d.Allowed || d.Reason != DecisionError {
+		t.Errorf("expected the check to conflict: %+v", d)
+	}
+	if attempts != defaultOptimisticRetries+1 {
+		t.Errorf("expected the check to be retried %d times, got %d attempts", defaultOptimisticRetries, attempts)
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{Type: TypeRedis, Address: s.Addr(), RateLimit: 1, FailOpen: true})
+	s.Close()
+
+	d, err := l.Check("foo", 1)
+	if err == nil || d.Err != err {
+		t.Errorf("expected the error in the decision: %v %v", err, d.Err)
+	}
+	if !d.Allowed || d.Reason != DecisionError {
+		t.Errorf("expected to fail open: %+v", d)
+	}
+}
+
+func TestDisabledCheck(t *testing.T) {
+	if d, _ := New(Config{Type: TypeDisabled}).Check("foo", 1); !d.Allowed || d.Reason != DecisionAllowed {
+		t.Errorf("expected the disabled limiter to allow: %+v", d)
+	}
+	if d, _ := New(Config{Type: TypeBlockAll}).Check("foo", 1); d.Allowed || d.Reason != DecisionDenied {
+		t.Errorf("expected the block all limiter to deny: %+v", d)
+	}
+}
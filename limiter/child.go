@@ -0,0 +1,215 @@
+package limiter
+
+import (
+	"math"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// allowChildScript atomically consumes tokens from both a parent and a child
+// token bucket, consuming from neither unless both buckets have enough tokens.
+// It returns 1 if allowed, 0 if the parent's bucket denied the events, and -1
+// if the child's bucket denied the events. The child's key is added to the set
+// of the parent's children so it is deleted along with the parent.
+//
+// KEYS[1] parent key, KEYS[2] child key, KEYS[3] parent's children set
+// ARGV[1] storageArg, ARGV[2] n, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] parent rate, ARGV[6] parent burst
+// ARGV[7] child rate, ARGV[8] child burst, ARGV[9] min tokens
+var allowChildScript = newScript(3, luaStorage+luaRefill+`
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local interval = tonumber(ARGV[4])
+local min = tonumber(ARGV[9])
+
+local parent = read_bucket(KEYS[1])
+local child = read_bucket(KEYS[2])
+local parentTokens = refill(parent, now, interval, tonumber(ARGV[5]), tonumber(ARGV[6]))
+local childTokens = refill(child, now, interval, tonumber(ARGV[7]), tonumber(ARGV[8]))
+
+if parentTokens - n < min then
+	return 0
+end
+if childTokens - n < min then
+	return -1
+end
+
+write_bucket(KEYS[1], {tokens = parentTokens - n, last = now}, parent)
+write_bucket(KEYS[2], {tokens = childTokens - n, last = now}, child)
+redis.call("SADD", KEYS[3], KEYS[2])
+return 1
+`)
+
+// Reason identifies the token bucket which denied an event
+type Reason int
+
+const (
+	// ReasonNone is reported when an event is allowed
+	ReasonNone Reason = iota
+	// ReasonParent is reported when the parent's token bucket denied an event
+	ReasonParent
+	// ReasonChild is reported when the child's token bucket denied an event
+	ReasonChild
+)
+
+// String returns the name of the denying token bucket, suitable for metrics
+// labels
+func (r Reason) String() string {
+	switch r {
+	case ReasonParent:
+		return "parent"
+	case ReasonChild:
+		return "child"
+	}
+	return "none"
+}
+
+// childKey returns the key of a child's token bucket scoped to its parent
+func childKey(parent, child string) string {
+	return suffixedKey(parent, "child:"+child)
+}
+
+// childrenKey returns the key of the set of the keys of a parent's children
+func childrenKey(parent string) string {
+	return suffixedKey(parent, "children")
+}
+
+// childShare returns the fraction of a parent's quota allotted to the given
+// child. Children are bound only by their parent when no weights are defined.
+func childShare(weights map[string]float64, child string) float64 {
+	if len(weights) == 0 {
+		return 1
+	}
+
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+
+	w, ok := weights[child]
+	if !ok {
+		w = 1
+	}
+	if total <= 0 {
+		return 0
+	}
+	return math.Min(w/total, 1)
+}
+
+// childLimits returns the rate and burst limits of a child given its share of
+// the parent's rate and burst limits
+func childLimits(share, rate float64, burst int) (float64, int) {
+	return rate * share, int(math.Ceil(float64(burst) * share))
+}
+
+// AllowChild returns true if both the parent and the child have enough tokens
+// for the given number of events, false otherwise. Tokens are consumed from
+// both buckets atomically. The child's bucket is a weighted share of the
+// parent's rate and burst limits so lower weighted children are throttled
+// before higher weighted ones while the parent's bucket remains the binding
+// constraint for all children.
+func (l *redisLimiter) AllowChild(parent, child string, n int) (bool, error) {
+	allowed, _, err := l.AllowChildReason(parent, child, n)
+	return allowed, err
+}
+
+// AllowChildReason is like AllowChild but also returns the Reason identifying
+// which token bucket denied the events. The parent is reported when both
+// buckets lack tokens since it is the binding constraint.
+func (l *redisLimiter) AllowChildReason(parent, child string, n int) (bool, Reason, error) {
+	parent, child, err := l.keyLength.childKeys(parent, child)
+	if err != nil {
+		return false, ReasonNone, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	childRate, childBurst := childLimits(childShare(l.weights, child), l.rate, l.burst)
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	res, err := redis.Int(db.eval(allowChildScript,
+		parent, childKey(parent, child), childrenKey(parent),
+		storageArg(l.layout, l.format), n, now, l.interval.Seconds(),
+		l.refillRate(l.rate), l.burst,
+		l.refillRate(childRate), childBurst,
+		l.minTokens,
+	))
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen, ReasonNone, err
+	}
+
+	switch res {
+	case 0:
+		return false, ReasonParent, nil
+	case -1:
+		return false, ReasonChild, nil
+	}
+	l.allowed.add(n)
+	return true, ReasonNone, nil
+}
+
+func (l *inMemoryLimiter) AllowChild(parent, child string, n int) (bool, error) {
+	allowed, _, err := l.AllowChildReason(parent, child, n)
+	return allowed, err
+}
+
+func (l *inMemoryLimiter) AllowChildReason(parent, child string, n int) (bool, Reason, error) {
+	parent, child, err := l.keyLength.childKeys(parent, child)
+	if err != nil {
+		return false, ReasonNone, err
+	}
+
+	parentRate := l.refillRate(l.rate)
+	childRate, childBurst := childLimits(childShare(l.weights, child), parentRate, l.burst)
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	if l.pureGo {
+		l.mux.Lock()
+		defer l.mux.Unlock()
+
+		parentTokens := l.tokens(parent, parentRate, l.burst, now) - float64(n)
+		childTokens := l.tokens(childKey(parent, child), childRate, childBurst, now) - float64(n)
+		if parentTokens < l.minTokens {
+			return false, ReasonParent, nil
+		}
+		if childTokens < l.minTokens {
+			return false, ReasonChild, nil
+		}
+
+		l.setBucket(parent, parentTokens, now)
+		l.setBucket(childKey(parent, child), childTokens, now)
+		l.allowed.add(n)
+		return true, ReasonNone, nil
+	}
+
+	p := l.limiter(parent, parentRate, l.burst, now).ReserveN(now, n)
+	if !p.OK() || p.DelayFrom(now) > 0 {
+		p.CancelAt(now)
+		return false, ReasonParent, nil
+	}
+
+	c := l.limiter(childKey(parent, child), childRate, childBurst, now).ReserveN(now, n)
+	if !c.OK() || c.DelayFrom(now) > 0 {
+		// give the parent back its tokens
+		c.CancelAt(now)
+		p.CancelAt(now)
+		return false, ReasonChild, nil
+	}
+
+	l.allowed.add(n)
+	return true, ReasonNone, nil
+}
+
+func (l *disabledLimiter) AllowChild(parent, child string, n int) (bool, error) {
+	return true, nil
+}
+
+func (l *disabledLimiter) AllowChildReason(parent, child string, n int) (bool, Reason, error) {
+	return true, ReasonNone, nil
+}
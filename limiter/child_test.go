@@ -0,0 +1,193 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChildShare(t *testing.T) {
+	weights := map[string]float64{"a": 3, "b": 1}
+
+	for _, tc := range []struct {
+		weights map[string]float64
+		child   string
+		share   float64
+	}{
+		{nil, "a", 1},
+		{weights, "a", 0.75},
+		{weights, "b", 0.25},
+		{weights, "c", 0.25},
+		{map[string]float64{"a": 0}, "a", 0},
+	} {
+		if share := childShare(tc.weights, tc.child); share != tc.share {
+			t.Errorf("expected %s to have a share of %v: %v", tc.child, tc.share, share)
+		}
+	}
+}
+
+func TestRedisAllowChild(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.weights = map[string]float64{"a": 3, "b": 1}
+
+	m.On(
+		"Do", "EVALSHA",
+		mock.MatchedBy(func(args []interface{}) bool {
+			if len(args) != 14 {
+				return false
+			}
+			return args[0] == scripts[allowChildScript].Hash() &&
+				args[1] == 3 &&
+				args[2] == "foo" &&
+				args[3] == childKey("foo", "b") &&
+				args[4] == childrenKey("foo") &&
+				args[5] == int(LayoutList) &&
+				args[6] == 1 &&
+				args[11] == 2.5 &&
+				args[12] == 5
+		}),
+	).Return(int64(1), nil).Once()
+
+	allowed, err := l.AllowChild("foo", "b", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Error("expected to allow child: b")
+	}
+}
+
+func TestRedisAllowChildError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "EVALSHA", mock.Anything).Return(nil, errors.New("not good")).Once()
+
+	allowed, err := l.AllowChild("foo", "a", 1)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if allowed {
+		t.Error("expected to not allow child: a")
+	}
+}
+
+func TestRedisAllowChildReason(t *testing.T) {
+	for _, tc := range []struct {
+		res     int64
+		allowed bool
+		reason  Reason
+	}{
+		{1, true, ReasonNone},
+		{0, false, ReasonParent},
+		{-1, false, ReasonChild},
+	} {
+		m := &mockConn{}
+		l := newMockRedisLimiter(m)
+
+		m.On("Do", "EVALSHA", mock.Anything).Return(tc.res, nil).Once()
+
+		allowed, reason, err := l.AllowChildReason("foo", "a", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != tc.allowed || reason != tc.reason {
+			t.Errorf("expected %v with reason %s: %v %s", tc.allowed, tc.reason, allowed, reason)
+		}
+	}
+}
+
+func TestInMemoryAllowChildReason(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:         TypeInMemory,
+			RateLimit:    1,
+			BurstLimit:   4,
+			Interval:     time.Hour,
+			PureGo:       pureGo,
+			ChildWeights: map[string]float64{"a": 3, "b": 1},
+		})
+
+		if allowed, reason, _ := l.AllowChildReason("foo", "b", 1); !allowed || reason != ReasonNone {
+			t.Fatalf("expected to allow child b: %s", reason)
+		}
+
+		// child b has used its share while the parent has tokens
+		if _, reason, _ := l.AllowChildReason("foo", "b", 1); reason != ReasonChild {
+			t.Errorf("expected child b to be denied by its own bucket: %s", reason)
+		}
+
+		// child a has tokens but the parent is exhausted
+		l.AllowChild("foo", "a", 2)
+		if _, reason, _ := l.AllowChildReason("foo", "a", 2); reason != ReasonParent {
+			t.Errorf("expected child a to be denied by the parent: %s", reason)
+		}
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	for reason, s := range map[Reason]string{
+		ReasonNone:   "none",
+		ReasonParent: "parent",
+		ReasonChild:  "child",
+	} {
+		if reason.String() != s {
+			t.Errorf("expected reason %s: %s", s, reason)
+		}
+	}
+}
+
+func TestInMemoryAllowChildParentBinding(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+	})
+
+	// without weights children are only bound by the parent's quota
+	for i := 0; i < 4; i++ {
+		if allowed, _ := l.AllowChild("foo", "a", 1); !allowed {
+			t.Fatalf("expected to allow child a on event %d", i)
+		}
+	}
+	if allowed, _ := l.AllowChild("foo", "b", 1); allowed {
+		t.Error("expected the exhausted parent to throttle child b")
+	}
+}
+
+func TestInMemoryAllowChildWeights(t *testing.T) {
+	l := New(Config{
+		Type:         TypeInMemory,
+		RateLimit:    1,
+		BurstLimit:   4,
+		Interval:     time.Hour,
+		ChildWeights: map[string]float64{"a": 3, "b": 1},
+	})
+
+	if allowed, _ := l.AllowChild("foo", "b", 1); !allowed {
+		t.Fatal("expected to allow child b")
+	}
+	if allowed, _ := l.AllowChild("foo", "b", 1); allowed {
+		t.Error("expected lower weighted child b to be throttled first")
+	}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := l.AllowChild("foo", "a", 1); !allowed {
+			t.Fatalf("expected to allow child a on event %d", i)
+		}
+	}
+	if allowed, _ := l.AllowChild("foo", "a", 1); allowed {
+		t.Error("expected child a to be throttled after its share")
+	}
+}
+
+func TestDisabledAllowChild(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if allowed, err := l.AllowChild("foo", "a", 1); !allowed || err != nil {
+		t.Error("expected disabled limiter to allow")
+	}
+}
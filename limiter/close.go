@@ -0,0 +1,26 @@
+package limiter
+
+// Close stops the workers making AllowAsync decisions and the reconciler of
+// local estimates once the decisions and reconciles already queued are made.
+// AllowAsync denies events after Close, and local estimates are no longer
+// reconciled in the background. The client cache's invalidation connection is
+// closed and caching disabled. The Redis pool is not closed.
+func (l *redisLimiter) Close() error {
+	l.async.close()
+	if l.layered != nil {
+		l.layered.close()
+	}
+	if l.cache != nil {
+		l.cache.close()
+	}
+	return nil
+}
+
+// Close does nothing as the in-memory Limiter has no background work
+func (l *inMemoryLimiter) Close() error {
+	return nil
+}
+
+func (l *disabledLimiter) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisClose(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 10,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+
+	// a single worker so the decisions do not contend for the bucket
+	l.async = newAsyncEstimate(1, asyncQueueSize)
+
+	for i := 0; i < 5; i++ {
+		l.AllowAsync("foo", 1)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queued decisions were made before Close returned
+	if tokens, _ := l.Tokens("foo"); tokens != 5 {
+		t.Errorf("expected the queued decisions to be made: %v", tokens)
+	}
+	if l.AllowAsync("foo", 1) {
+		t.Error("expected to deny events after Close")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("expected closing twice to succeed: %v", err)
+	}
+}
+
+func TestInMemoryClose(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDisabledClose(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+package limiter
+
+import "time"
+
+// defaultColdStartPeriod is how long freshly created in-memory token buckets
+// start partially filled when ColdStartRateFraction is set
+const defaultColdStartPeriod = 10 * time.Second
+
+// processStart is when the process started, approximated by when the package
+// was initialized
+var processStart = time.Now()
+
+// coldStart reduces the fill of token buckets created shortly after the
+// process started, so instances started together by an autoscale event do not
+// each allow a full burst for the same keys
+type coldStart struct {
+	started  time.Time
+	period   time.Duration
+	fraction float64
+}
+
+// fill returns the tokens a token bucket created at the given time, not
+// truncated to the interval, starts with, scaling linearly from the fraction
+// of the burst limit at process start to the full burst limit once the cold
+// start period has passed
+func (c coldStart) fill(burst int, now time.Time) float64 {
+	if c.fraction <= 0 {
+		return float64(burst)
+	}
+	return float64(burst) * warmUpFactor(now.Sub(c.started), c.period, c.fraction)
+}
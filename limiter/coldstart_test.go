@@ -0,0 +1,59 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestColdStart(t *testing.T) {
+	for name, config := range map[string]Config{
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 10
+		config.Interval = time.Hour
+		config.ColdStartRateFraction = 0.2
+		l := New(config).(*inMemoryLimiter)
+
+		started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		now := started
+		l.now = func() time.Time { return now }
+		l.coldStart.started = started
+
+		// buckets created later in the cold start begin fuller
+		for _, tc := range []struct {
+			age     time.Duration
+			allowed int
+		}{
+			{0, 2},
+			{5 * time.Second, 6},
+			{defaultColdStartPeriod, 10},
+			{time.Hour, 10},
+		} {
+			now = started.Add(tc.age)
+			key := fmt.Sprint("foo", tc.age)
+
+			allowed := 0
+			for i := 0; i < 20; i++ {
+				if l.Allow(key) {
+					allowed++
+				}
+			}
+			if allowed != tc.allowed {
+				t.Errorf("%s: expected %d events allowed %v after start, got %d", name, tc.allowed, tc.age, allowed)
+			}
+		}
+	}
+}
+
+func TestColdStartDisabled(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 10, Interval: time.Hour}).(*inMemoryLimiter)
+	l.coldStart.started = l.now()
+
+	// buckets start full by default even right after the process starts
+	if !l.AllowN("foo", 10) {
+		t.Error("expected a full bucket")
+	}
+}
@@ -0,0 +1,176 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrBurstTooSmall is returned by Config.Validate when the burst limit
+	// would never allow an event
+	ErrBurstTooSmall = errors.New("limiter: burst limit must be at least 1")
+
+	// ErrZeroRate is returned by Config.Validate when the rate limit would
+	// never replenish a token bucket
+	ErrZeroRate = errors.New("limiter: effective rate limit is zero")
+
+	// ErrBurstConflict is returned by Config.Validate when both a burst limit
+	// and a burst multiplier are set
+	ErrBurstConflict = errors.New("limiter: only one of burst limit and burst multiplier may be set")
+
+	// ErrInvalidAddress is returned by Config.Validate when a Redis server
+	// address is not of the form host:port
+	ErrInvalidAddress = errors.New("limiter: invalid address")
+
+	// ErrInvalidURL is returned by Config.Validate when the Redis server URL
+	// is malformed or not a redis:// or rediss:// URL
+	ErrInvalidURL = errors.New("limiter: invalid URL")
+
+	// ErrAddressConflict is returned by Config.Validate when both an address
+	// and a URL are set
+	ErrAddressConflict = errors.New("limiter: only one of address and URL may be set")
+
+	// ErrInvalidTLS is returned by Config.Validate when TLS settings conflict
+	// with the URL scheme or would be ignored
+	ErrInvalidTLS = errors.New("limiter: invalid TLS settings")
+)
+
+// EffectiveQPS returns the number of queries per second permitted by the rate
+// limit and interval, defaulting to a one second interval like New
+func (c Config) EffectiveQPS() float64 {
+	interval := c.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	return c.RateLimit / interval.Seconds()
+}
+
+// burstLimit returns the burst limit, computing a zero burst limit from the
+// burst multiplier if set, otherwise defaulting it to the rate limit rounded up
+// and at least 1 so every token bucket holds an event
+func (c Config) burstLimit() int {
+	if c.BurstLimit != 0 {
+		return c.BurstLimit
+	}
+	if c.BurstMultiplier != 0 {
+		return int(math.Ceil(c.RateLimit * c.BurstMultiplier))
+	}
+	return int(math.Max(math.Ceil(c.RateLimit), 1))
+}
+
+// Validate returns an error describing a misconfiguration that would result
+// in a Limiter that does not allow any events, never replenishes its token
+// buckets, or cannot dial its Redis servers, nil otherwise. New does not
+// connect to Redis so call Validate to catch typos such as a missing port
+// before any traffic flows.
+func (c Config) Validate() error {
+	if c.Type == TypeDisabled || c.Type == TypeBlockAll {
+		return nil
+	}
+	if c.Type == TypeRedis {
+		if err := c.validateConnection(); err != nil {
+			return err
+		}
+	}
+	if c.BurstLimit != 0 && c.BurstMultiplier != 0 {
+		return ErrBurstConflict
+	}
+	if c.burstLimit() < 1 {
+		return ErrBurstTooSmall
+	}
+	if c.EffectiveQPS() <= 0 {
+		return ErrZeroRate
+	}
+	return nil
+}
+
+// validateAddress returns an error wrapping ErrInvalidAddress if the given
+// address is set but is not of the form host:port with a valid port
+func validateAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidAddress, address, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("%w %q: invalid port %q", ErrInvalidAddress, address, port)
+	}
+	return nil
+}
+
+// validateConnection returns an error if the settings used to connect to the
+// Redis servers are malformed or conflict
+func (c Config) validateConnection() error {
+	if c.URL != "" && c.Address != "" {
+		return ErrAddressConflict
+	}
+	if err := validateAddress(c.Address); err != nil {
+		return err
+	}
+	if err := validateAddress(c.SecondaryAddress); err != nil {
+		return err
+	}
+	useTLS, err := validateURL(c.URL)
+	if err != nil {
+		return err
+	}
+	return c.validateTLS(useTLS)
+}
+
+// dbPath matches the optional database number path of a Redis URL
+var dbPath = regexp.MustCompile(`^/?(\d*)$`)
+
+// validateURL returns an error wrapping ErrInvalidURL if the given URL is set
+// but is not a redis:// or rediss:// URL with a valid port and database, and
+// whether the URL uses TLS
+func validateURL(rawURL string) (bool, error) {
+	if rawURL == "" {
+		return false, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return false, fmt.Errorf("%w %q: unsupported scheme %q", ErrInvalidURL, rawURL, u.Scheme)
+	}
+	if u.Port() != "" {
+		if p, err := strconv.Atoi(u.Port()); err != nil || p < 1 || p > 65535 {
+			return false, fmt.Errorf("%w %q: invalid port %q", ErrInvalidURL, rawURL, u.Port())
+		}
+	}
+	if !dbPath.MatchString(u.Path) {
+		return false, fmt.Errorf("%w %q: invalid database %q", ErrInvalidURL, rawURL, u.Path)
+	}
+	return u.Scheme == "rediss", nil
+}
+
+// validateTLS returns an error wrapping ErrInvalidTLS if TLS is enabled for a
+// redis:// URL, or TLS settings are set but would not be used, given whether
+// the URL uses TLS
+func (c Config) validateTLS(urlTLS bool) error {
+	if c.UseTLS && c.URL != "" && !urlTLS {
+		return fmt.Errorf("%w: UseTLS with a redis:// URL, use rediss:// instead", ErrInvalidTLS)
+	}
+	if c.DialFunc != nil && (c.UseTLS || c.TLSConfig != nil || c.TLSSkipVerify) {
+		return fmt.Errorf("%w: TLS settings are not used by DialFunc", ErrInvalidTLS)
+	}
+	if c.TLSConfig == nil && !c.TLSSkipVerify {
+		return nil
+	}
+	if !c.UseTLS && !urlTLS {
+		return fmt.Errorf("%w: TLS settings without UseTLS or a rediss:// URL", ErrInvalidTLS)
+	}
+	if t := c.TLSConfig; t != nil && t.MaxVersion != 0 && t.MinVersion > t.MaxVersion {
+		return fmt.Errorf("%w: TLS MinVersion is greater than MaxVersion", ErrInvalidTLS)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package limiter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestConfigEffectiveQPS(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		qps    float64
+	}{
+		{Config{RateLimit: 10}, 10},
+		{Config{RateLimit: 10, Interval: time.Second}, 10},
+		{Config{RateLimit: 1, Interval: 500 * time.Millisecond}, 2},
+		{Config{RateLimit: 60, Interval: time.Minute}, 1},
+		{Config{RateLimit: 1, Interval: time.Hour}, 1.0 / 3600},
+		{Config{RateLimit: 0, Interval: time.Second}, 0},
+	} {
+		if qps := tc.config.EffectiveQPS(); qps != tc.qps {
+			t.Errorf("expected %+v to permit %v qps: %v", tc.config, tc.qps, qps)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		err    error
+	}{
+		{Config{RateLimit: 10, BurstLimit: 20}, nil},
+		{Config{RateLimit: 1, BurstLimit: 1, Interval: time.Hour}, nil},
+		{Config{RateLimit: 1, BurstLimit: 0, Interval: time.Hour}, nil},
+		{Config{RateLimit: 1, BurstLimit: -1}, ErrBurstTooSmall},
+		{Config{RateLimit: 0, BurstLimit: 20}, ErrZeroRate},
+		{Config{RateLimit: -1, BurstLimit: 20}, ErrZeroRate},
+		{Config{Type: TypeDisabled}, nil},
+		{Config{Type: TypeBlockAll}, nil},
+		{Config{RateLimit: 10, BurstMultiplier: 3}, nil},
+		{Config{RateLimit: 10, BurstLimit: 20, BurstMultiplier: 3}, ErrBurstConflict},
+		{Config{RateLimit: 10, BurstMultiplier: 0.05}, nil},
+		{Config{RateLimit: 10, BurstMultiplier: -1}, ErrBurstTooSmall},
+	} {
+		if err := tc.config.Validate(); err != tc.err {
+			t.Errorf("expected %+v to return %v: %v", tc.config, tc.err, err)
+		}
+	}
+}
+
+func TestConfigValidateAddress(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		err    error
+	}{
+		{Config{Address: "localhost:6379"}, nil},
+		{Config{Address: "10.0.0.1:6379", SecondaryAddress: "[::1]:6380"}, nil},
+		{Config{Address: "localhost"}, ErrInvalidAddress},
+		{Config{Address: "localhost:"}, ErrInvalidAddress},
+		{Config{Address: "localhost:redis"}, ErrInvalidAddress},
+		{Config{Address: "localhost:99999"}, ErrInvalidAddress},
+		{Config{Address: "redis://localhost:6379"}, ErrInvalidAddress},
+		{Config{Address: "localhost:6379", SecondaryAddress: "::1:6380"}, ErrInvalidAddress},
+		{Config{Type: TypeInMemory, Address: "localhost"}, nil},
+	} {
+		tc.config.RateLimit = 1
+		if err := tc.config.Validate(); !errors.Is(err, tc.err) {
+			t.Errorf("expected %+v to return %v: %v", tc.config, tc.err, err)
+		}
+	}
+}
+
+func TestConfigBurstLimit(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		burst  int
+	}{
+		{Config{RateLimit: 10, BurstLimit: 20}, 20},
+		{Config{RateLimit: 10}, 10},
+		{Config{RateLimit: 2.5}, 3},
+		{Config{RateLimit: 0.5}, 1},
+		{Config{RateLimit: 0}, 1},
+		{Config{RateLimit: 10, BurstLimit: -1}, -1},
+		{Config{RateLimit: 10, BurstMultiplier: 3}, 30},
+		{Config{RateLimit: 2.5, BurstMultiplier: 2}, 5},
+		{Config{RateLimit: 1, BurstMultiplier: 1.5}, 2},
+		{Config{RateLimit: 0.5, BurstMultiplier: 3}, 2},
+		{Config{RateLimit: 10, BurstLimit: 5, BurstMultiplier: 3}, 5},
+	} {
+		if burst := tc.config.burstLimit(); burst != tc.burst {
+			t.Errorf("expected %+v to have a burst limit of %v: %v", tc.config, tc.burst, burst)
+		}
+	}
+}
+
+func TestConfigValidateURL(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		err    error
+	}{
+		{Config{URL: "redis://localhost:6379"}, nil},
+		{Config{URL: "redis://:secret@localhost:6379/2"}, nil},
+		{Config{URL: "rediss://localhost"}, nil},
+		{Config{URL: "redis://localhost/"}, nil},
+		{Config{URL: "http://localhost:6379"}, ErrInvalidURL},
+		{Config{URL: "localhost:6379"}, ErrInvalidURL},
+		{Config{URL: "redis://localhost:redis"}, ErrInvalidURL},
+		{Config{URL: "redis://localhost:99999"}, ErrInvalidURL},
+		{Config{URL: "redis://localhost:6379/db"}, ErrInvalidURL},
+		{Config{URL: "redis://%zz"}, ErrInvalidURL},
+		{Config{URL: "redis://localhost:6379", Address: "localhost:6379"}, ErrAddressConflict},
+		{Config{Type: TypeInMemory, URL: "http://localhost"}, nil},
+	} {
+		tc.config.RateLimit = 1
+		if err := tc.config.Validate(); !errors.Is(err, tc.err) {
+			t.Errorf("expected %+v to return %v: %v", tc.config, tc.err, err)
+		}
+	}
+}
+
+func TestConfigValidateTLS(t *testing.T) {
+	dial := func(ctx context.Context) (redis.Conn, error) { return nil, nil }
+	for _, tc := range []struct {
+		config Config
+		err    error
+	}{
+		{Config{Address: "localhost:6379", UseTLS: true}, nil},
+		{Config{Address: "localhost:6379", UseTLS: true, TLSConfig: &tls.Config{ServerName: "redis"}}, nil},
+		{Config{Address: "localhost:6379", UseTLS: true, TLSSkipVerify: true}, nil},
+		{Config{URL: "rediss://localhost:6379", TLSSkipVerify: true}, nil},
+		{Config{URL: "rediss://localhost:6379", UseTLS: true}, nil},
+		{Config{URL: "redis://localhost:6379", UseTLS: true}, ErrInvalidTLS},
+		{Config{URL: "redis://localhost:6379", TLSConfig: &tls.Config{}}, ErrInvalidTLS},
+		{Config{Address: "localhost:6379", TLSSkipVerify: true}, ErrInvalidTLS},
+		{Config{Address: "localhost:6379", UseTLS: true, DialFunc: dial}, ErrInvalidTLS},
+		{Config{Address: "localhost:6379", UseTLS: true, TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS13,
+			MaxVersion: tls.VersionTLS12,
+		}}, ErrInvalidTLS},
+	} {
+		tc.config.RateLimit = 1
+		if err := tc.config.Validate(); !errors.Is(err, tc.err) {
+			t.Errorf("expected %+v to return %v: %v", tc.config, tc.err, err)
+		}
+	}
+}
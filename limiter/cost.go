@@ -0,0 +1,71 @@
+package limiter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultCostBuckets are the upper bounds of the buckets of a CostHistogram
+// created without any
+var DefaultCostBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// CostHistogram is a Prometheus histogram of the costs of events, for capacity
+// planning. Its Observe method is a Config.ObserveCost hook.
+type CostHistogram struct {
+	buckets []float64
+
+	mux    sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewCostHistogram returns a CostHistogram with the given bucket upper bounds,
+// DefaultCostBuckets if none are given
+func NewCostHistogram(buckets ...float64) *CostHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultCostBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &CostHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records the cost of an event of the given ID
+func (h *CostHistogram) Observe(id string, cost float64) {
+	i := sort.SearchFloat64s(h.buckets, cost)
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += cost
+	h.count++
+}
+
+// WriteMetrics writes the histogram in Prometheus text exposition format
+func (h *CostHistogram) WriteMetrics(w io.Writer) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if _, err := fmt.Fprint(w, "# HELP limiter_event_cost Cost in tokens of events decided with a cost.\n# TYPE limiter_event_cost histogram\n"); err != nil {
+		return err
+	}
+
+	// buckets are cumulative
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		if _, err := fmt.Fprintf(w, "limiter_event_cost_bucket{le=%q} %d\n",
+			strconv.FormatFloat(le, 'g', -1, 64), cumulative); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "limiter_event_cost_bucket{le=\"+Inf\"} %d\nlimiter_event_cost_sum %s\nlimiter_event_cost_count %d\n",
+		h.count, strconv.FormatFloat(h.sum, 'g', -1, 64), h.count)
+	return err
+}
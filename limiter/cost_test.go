@@ -0,0 +1,77 @@
+package limiter
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// costRecorder records the observed costs
+type costRecorder struct {
+	costs []float64
+	ids   []string
+}
+
+func (r *costRecorder) observe(id string, cost float64) {
+	r.ids = append(r.ids, id)
+	r.costs = append(r.costs, cost)
+}
+
+func TestObserveCost(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		r := &costRecorder{}
+		config.RateLimit = 1
+		config.BurstLimit = 5
+		config.Interval = time.Hour
+		config.ObserveCost = r.observe
+		l := New(config)
+
+		// denied events are observed, events without a cost are not
+		l.AllowWith("foo", WithCost(3))
+		l.AllowWith("foo", WithN(2), WithCost(2))
+		l.AllowWith("bar", WithCost(1), WithLabels(map[string]string{"method": "GET"}))
+		l.AllowWith("foo")
+		l.Allow("foo")
+
+		if want := []float64{3, 4, 1}; !reflect.DeepEqual(r.costs, want) {
+			t.Errorf("%s: expected costs %v, got %v", name, want, r.costs)
+		}
+		if want := []string{"foo", "foo", "bar"}; !reflect.DeepEqual(r.ids, want) {
+			t.Errorf("%s: expected IDs %v, got %v", name, want, r.ids)
+		}
+	}
+}
+
+func TestCostHistogram(t *testing.T) {
+	h := NewCostHistogram(10, 1, 5)
+	for _, cost := range []float64{1, 2, 5, 6, 50} {
+		h.Observe("foo", cost)
+	}
+
+	var b bytes.Buffer
+	if err := h.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP limiter_event_cost Cost in tokens of events decided with a cost.
+# TYPE limiter_event_cost histogram
+limiter_event_cost_bucket{le="1"} 1
+limiter_event_cost_bucket{le="5"} 3
+limiter_event_cost_bucket{le="10"} 4
+limiter_event_cost_bucket{le="+Inf"} 5
+limiter_event_cost_sum 64
+limiter_event_cost_count 5
+`
+	if got := b.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,148 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultDrainPollInterval is how often Drain checks the tracked buckets when
+// DrainLimiter.PollInterval is not set
+const defaultDrainPollInterval = 100 * time.Millisecond
+
+// DrainLimiter wraps a Limiter so a service shutting down may drain in-flight
+// work at the Limiter's rate. It tracks the keys it admits whose buckets are
+// not yet drained, and once Drain is called rejects keys it is not tracking
+// while tracked keys continue to be rate limited as usual.
+type DrainLimiter struct {
+	// Limiter defines the wrapped Limiter
+	Limiter Limiter
+	// Threshold defines the level at or under which a bucket is drained, its
+	// level being the tokens taken and not yet replenished
+	Threshold float64
+	// PollInterval defines how often Drain checks the tracked buckets,
+	// defaults to 100ms
+	PollInterval time.Duration
+
+	mux      sync.RWMutex
+	keys     map[string]struct{}
+	pruneAt  int
+	draining bool
+}
+
+// NewDrain creates a new DrainLimiter wrapping the given Limiter
+func NewDrain(l Limiter, threshold float64) *DrainLimiter {
+	return &DrainLimiter{Limiter: l, Threshold: threshold}
+}
+
+// Allow returns true if an event may happen for the given key
+func (d *DrainLimiter) Allow(key string) bool {
+	return d.AllowN(key, 1)
+}
+
+// AllowN returns true if the given number of events may happen for the given
+// key, always false for keys not tracked when Drain was called
+func (d *DrainLimiter) AllowN(key string, n int) bool {
+	// the read lock is held across the decision so the key is not pruned
+	// between being tracked and taking its tokens
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	for {
+		if _, ok := d.keys[key]; ok {
+			return d.Limiter.AllowN(key, n)
+		}
+		if d.draining {
+			return false
+		}
+		d.mux.RUnlock()
+		d.track(key)
+		d.mux.RLock()
+	}
+}
+
+// track adds the given key to the tracked keys unless draining. Each time the
+// tracked keys double, keys whose buckets have since drained are pruned first
+// so only keys with work in flight are kept.
+func (d *DrainLimiter) track(key string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.draining {
+		return
+	}
+	if d.keys == nil {
+		d.keys = make(map[string]struct{})
+	}
+	if len(d.keys) >= d.pruneAt {
+		d.prune()
+		d.pruneAt = 2 * len(d.keys)
+	}
+	d.keys[key] = struct{}{}
+}
+
+// prune deletes the tracked keys whose buckets are at or under the threshold,
+// keeping any key whose bucket cannot be read. The caller must hold the lock.
+func (d *DrainLimiter) prune() {
+	burst := float64(d.Limiter.Burst())
+	for key := range d.keys {
+		tokens, err := d.Limiter.Tokens(key)
+		if err == nil && burst-tokens <= d.Threshold {
+			delete(d.keys, key)
+		}
+	}
+}
+
+// Draining returns true once Drain has been called
+func (d *DrainLimiter) Draining() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.draining
+}
+
+// Drain stops admitting new keys and waits until the buckets of every tracked
+// key are drained, returning the context's error if it is done first or any
+// error reading the buckets
+func (d *DrainLimiter) Drain(ctx context.Context) error {
+	d.mux.Lock()
+	d.draining = true
+	keys := make([]string, 0, len(d.keys))
+	for key := range d.keys {
+		keys = append(keys, key)
+	}
+	d.mux.Unlock()
+
+	interval := d.PollInterval
+	if interval <= 0 {
+		interval = defaultDrainPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		drained, err := d.drained(keys)
+		if err != nil || drained {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// drained returns true if the buckets of the given keys are at or under the
+// threshold
+func (d *DrainLimiter) drained(keys []string) (bool, error) {
+	burst := float64(d.Limiter.Burst())
+	for _, key := range keys {
+		tokens, err := d.Limiter.Tokens(key)
+		if err != nil {
+			return false, err
+		}
+		if burst-tokens > d.Threshold {
+			return false, nil
+		}
+	}
+	return true, nil
+}
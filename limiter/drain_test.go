@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 2, Interval: time.Hour})
+	d := NewDrain(l, 0)
+	d.PollInterval = time.Millisecond
+
+	if !d.Allow("foo") {
+		t.Fatal("expected foo to be allowed")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.Drain(context.Background()) }()
+	for !d.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// new keys are rejected while existing keys continue until empty
+	if d.Allow("bar") {
+		t.Error("expected a new key to be rejected while draining")
+	}
+	if !d.Allow("foo") {
+		t.Error("expected an existing key to be allowed while draining")
+	}
+	if d.Allow("foo") {
+		t.Error("expected an existing key to be limited once empty")
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected foo to not be drained: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// the tokens taken are replenished
+	if err := l.Seed("foo", 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected to be drained: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected to be drained")
+	}
+}
+
+func TestDrainThreshold(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 5, Interval: time.Hour})
+	d := NewDrain(l, 2)
+	d.AllowN("foo", 2)
+
+	// a bucket at the threshold is drained
+	if err := d.Drain(context.Background()); err != nil {
+		t.Errorf("expected to be drained: %v", err)
+	}
+}
+
+func TestDrainCancel(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 2, Interval: time.Hour})
+	d := NewDrain(l, 0)
+	d.PollInterval = time.Millisecond
+	d.Allow("foo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestDrainPrune(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 2, Interval: time.Hour})
+	d := NewDrain(l, 0)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		d.Allow(key)
+		if err := l.Seed(key, 2, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Allow("foo")
+
+	// keys whose buckets drained are no longer tracked
+	d.mux.RLock()
+	n := len(d.keys)
+	d.mux.RUnlock()
+	if n > 2 {
+		t.Errorf("expected drained keys to be pruned, %d keys tracked", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Drain(ctx); err != context.Canceled {
+		t.Errorf("expected foo to not be drained, got %v", err)
+	}
+	if d.Allow("0") {
+		t.Error("expected a pruned key to be rejected while draining")
+	}
+	if !d.Allow("foo") {
+		t.Error("expected an in-flight key to be allowed while draining")
+	}
+}
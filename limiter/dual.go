@@ -0,0 +1,180 @@
+package limiter
+
+import (
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// scripts are the Lua scripts loaded onto secondary Redis servers so script
+// calls can be replayed on them by SHA, registered by newScript
+var scripts []*redis.Script
+
+// script identifies a Lua script registered by newScript, run by a backend's
+// eval
+type script int
+
+// newScript returns a new script like redis.NewScript and registers it to be
+// loaded onto secondary Redis servers
+func newScript(keyCount int, src string) script {
+	scripts = append(scripts, redis.NewScript(keyCount, src))
+	return script(len(scripts) - 1)
+}
+
+// writeCommands are the commands dual written to the secondary Redis server
+var writeCommands = map[string]bool{
+	"DEL":      true,
+	"DECRBY":   true,
+	"DISCARD":  true,
+	"EVAL":     true,
+	"EVALSHA":  true,
+	"EXEC":     true,
+	"EXPIREAT": true,
+	"HSET":     true,
+	"INCRBY":   true,
+	"LPUSH":    true,
+	"LSET":     true,
+	"MULTI":    true,
+	"PEXPIRE":  true,
+	"SADD":     true,
+	"SET":      true,
+}
+
+// dualConn is a redis.Conn which sends all commands to a primary connection
+// and additionally sends write commands to a secondary connection. Replies and
+// errors come from the primary alone, a failing secondary is redialed on the
+// next write. The write commands of a transaction are held until the primary
+// executes it with Do and replayed on the secondary only if it was committed,
+// since WATCH is not mirrored and an aborted transaction is retried.
+type dualConn struct {
+	redis.Conn
+
+	dial      func() (redis.Conn, error)
+	secondary redis.Conn
+	pending   int
+
+	// multi is true inside a transaction, whose write commands are queued
+	multi  bool
+	queued [][]interface{}
+}
+
+// newDualConn returns a dualConn writing to the given primary connection and
+// connections returned by dial
+func newDualConn(primary redis.Conn, dial func() (redis.Conn, error)) *dualConn {
+	return &dualConn{Conn: primary, dial: dial}
+}
+
+// dialSecondary returns a dial function for the secondary Redis server at the
+// given address which loads scripts onto each new connection
+func dialSecondary(address string) func() (redis.Conn, error) {
+	return func() (redis.Conn, error) {
+		c, err := redis.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range scripts {
+			if err := s.Load(c); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+}
+
+// conn returns the secondary connection, dialing it if it is not connected
+func (c *dualConn) conn() redis.Conn {
+	if c.secondary != nil && c.secondary.Err() != nil {
+		c.secondary.Close()
+		c.secondary = nil
+		c.pending = 0
+	}
+	if c.secondary == nil {
+		secondary, err := c.dial()
+		if err != nil {
+			return nil
+		}
+		c.secondary = secondary
+	}
+	return c.secondary
+}
+
+// queue tracks the given command's transaction, queuing it if it is a write
+// command inside one. It returns true if the command is not to be sent to
+// the secondary now.
+func (c *dualConn) queue(cmd string, args []interface{}) bool {
+	switch cmd = strings.ToUpper(cmd); cmd {
+	case "MULTI":
+		c.multi, c.queued = true, nil
+		return true
+	case "EXEC", "DISCARD":
+		c.multi, c.queued = false, nil
+		return true
+	}
+	if !c.multi {
+		return false
+	}
+	if writeCommands[cmd] {
+		c.queued = append(c.queued, append([]interface{}{cmd}, args...))
+	}
+	return true
+}
+
+// commit replays the queued transaction on the secondary if the primary
+// committed it, EXEC replying nil when a watched key was modified
+func (c *dualConn) commit(reply interface{}, err error) {
+	queued := c.queued
+	c.multi, c.queued = false, nil
+	if err != nil || reply == nil || len(queued) == 0 {
+		return
+	}
+	if s := c.conn(); s != nil {
+		s.Send("MULTI")
+		for _, q := range queued {
+			s.Send(q[0].(string), q[1:]...)
+		}
+		s.Do("EXEC")
+		c.pending = 0
+	}
+}
+
+func (c *dualConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	if cmd == "" {
+		// flush the secondary along with the primary
+		c.Flush()
+	} else if strings.ToUpper(cmd) == "EXEC" {
+		c.commit(reply, err)
+	} else if !c.queue(cmd, args) && writeCommands[strings.ToUpper(cmd)] {
+		if s := c.conn(); s != nil {
+			s.Do(cmd, args...)
+			c.pending = 0
+		}
+	}
+	return reply, err
+}
+
+func (c *dualConn) Send(cmd string, args ...interface{}) error {
+	if !c.queue(cmd, args) && writeCommands[strings.ToUpper(cmd)] {
+		if s := c.conn(); s != nil && s.Send(cmd, args...) == nil {
+			c.pending++
+		}
+	}
+	return c.Conn.Send(cmd, args...)
+}
+
+func (c *dualConn) Flush() error {
+	// drain the replies of writes pipelined to the secondary
+	if c.pending > 0 && c.secondary != nil {
+		c.secondary.Do("")
+		c.pending = 0
+	}
+	return c.Conn.Flush()
+}
+
+func (c *dualConn) Close() error {
+	if c.secondary != nil {
+		c.secondary.Close()
+	}
+	return c.Conn.Close()
+}
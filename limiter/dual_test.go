@@ -0,0 +1,296 @@
+package limiter
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+func newDualLimiter(t *testing.T, layout StorageLayout) (Limiter, *miniredis.Miniredis, *miniredis.Miniredis) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	l := New(Config{
+		Type:             TypeRedis,
+		Address:          primary.Addr(),
+		SecondaryAddress: secondary.Addr(),
+		RateLimit:        1,
+		BurstLimit:       5,
+		Interval:         time.Hour,
+		StorageLayout:    layout,
+	})
+	return l, primary, secondary
+}
+
+func TestRedisDualWrite(t *testing.T) {
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		l, primary, secondary := newDualLimiter(t, layout)
+		key := "foo"
+
+		// create then update the bucket
+		l.AllowN(key, 2)
+		l.AllowN(key, 1)
+		if err := l.SetState(key, "pro"); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Block("bar", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		if p, s := primary.Dump(), secondary.Dump(); p != s {
+			t.Errorf("expected writes to both servers:\n%s\n%s", p, s)
+		}
+		if !secondary.Exists(key) || !secondary.Exists(blockKey("bar")) {
+			t.Errorf("expected the secondary to have keys: %v", secondary.Keys())
+		}
+	}
+}
+
+func TestRedisDualWriteReadsPrimary(t *testing.T) {
+	l, _, secondary := newDualLimiter(t, LayoutString)
+	key := "foo"
+
+	l.AllowN(key, 2)
+	secondary.Set(key, "0:0")
+
+	if tokens, _ := l.Tokens(key); tokens != 3 {
+		t.Errorf("expected tokens to be read from the primary: %v", tokens)
+	}
+}
+
+func TestRedisDualWriteSecondaryDown(t *testing.T) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	l := New(Config{
+		Type:             TypeRedis,
+		Address:          primary.Addr(),
+		SecondaryAddress: secondary.Addr(),
+		RateLimit:        1,
+		BurstLimit:       5,
+		Interval:         time.Hour,
+	})
+	secondary.Close()
+
+	for i := 0; i < 5; i++ {
+		allowed, _, err := l.AllowNWithRemaining("foo", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed {
+			t.Fatalf("expected to allow key on event %d", i)
+		}
+	}
+	if l.Allow("foo") {
+		t.Error("expected to not allow key after its burst")
+	}
+
+	// writes resume once the secondary is back
+	if err := secondary.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	l.Block("foo", time.Minute)
+	if !secondary.Exists(blockKey("foo")) {
+		t.Error("expected the secondary to receive writes after restarting")
+	}
+}
+
+func TestRedisDualWriteCalendarWindow(t *testing.T) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	l := New(Config{
+		Type:             TypeRedis,
+		Address:          primary.Addr(),
+		SecondaryAddress: secondary.Addr(),
+		RateLimit:        3,
+		CalendarWindow:   WindowDay,
+	})
+
+	l.AllowN("foo", 2)
+	if p, s := primary.Dump(), secondary.Dump(); p != s {
+		t.Errorf("expected the window count to be written to both servers:\n%s\n%s", p, s)
+	}
+}
+
+func TestRedisDualWriteUsage(t *testing.T) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	l := New(Config{
+		Type:             TypeRedis,
+		Address:          primary.Addr(),
+		SecondaryAddress: secondary.Addr(),
+		RateLimit:        1,
+		BurstLimit:       5,
+		Interval:         time.Hour,
+		UsageWindow:      time.Hour,
+	})
+
+	// the primary already has the script so it is called by SHA alone
+	c, err := redis.Dial("tcp", primary.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := scripts[usageScript].Load(c); err != nil {
+		t.Fatal(err)
+	}
+
+	l.AllowN("foo", 2)
+	if !secondary.Exists(usageKey("foo")) {
+		t.Errorf("expected usage to be written to the secondary: %v", secondary.Keys())
+	}
+}
+
+// readCommands are the commands issued through the pool which are not dual
+// written as they do not modify data
+var readCommands = map[string]bool{
+	"EXISTS":  true,
+	"GET":     true,
+	"HGETALL": true,
+	"HMGET":   true,
+	"LRANGE":  true,
+	"PING":    true,
+	"SCAN":    true,
+	"TYPE":    true,
+	"UNWATCH": true,
+	"WATCH":   true,
+}
+
+func TestDualConnTransaction(t *testing.T) {
+	primary := miniredis.RunT(t)
+	secondary := miniredis.RunT(t)
+	p, err := redis.Dial("tcp", primary.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newDualConn(p, dialSecondary(secondary.Addr()))
+	defer c.Close()
+
+	// a transaction aborted by a watched key is not written to the secondary
+	c.Do("WATCH", "foo")
+	primary.Set("foo", "other")
+	c.Send("MULTI")
+	c.Send("SET", "foo", "aborted")
+	if reply, err := c.Do("EXEC"); err != nil || reply != nil {
+		t.Fatalf("expected the transaction to abort: %v %v", reply, err)
+	}
+	if secondary.Exists("foo") {
+		t.Error("expected the aborted transaction to not be written to the secondary")
+	}
+
+	// nor is a discarded one
+	c.Send("MULTI")
+	c.Send("SET", "foo", "discarded")
+	c.Do("DISCARD")
+	if secondary.Exists("foo") {
+		t.Error("expected the discarded transaction to not be written to the secondary")
+	}
+
+	// a committed transaction is
+	c.Do("WATCH", "foo")
+	c.Send("MULTI")
+	c.Send("SET", "foo", "committed")
+	c.Send("INCRBY", "bar", 2)
+	if reply, err := c.Do("EXEC"); err != nil || reply == nil {
+		t.Fatalf("expected the transaction to commit: %v %v", reply, err)
+	}
+	if v, _ := secondary.Get("foo"); v != "committed" {
+		t.Errorf("expected the committed transaction on the secondary: %v", v)
+	}
+	if v, _ := secondary.Get("bar"); v != "2" {
+		t.Errorf("expected the committed transaction on the secondary: %v", v)
+	}
+}
+
+// recordConn is a redis.Conn recording the commands issued on it
+type recordConn struct {
+	redis.Conn
+
+	cmds map[string]bool
+}
+
+func (c recordConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "" {
+		c.cmds[strings.ToUpper(cmd)] = true
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c recordConn) Send(cmd string, args ...interface{}) error {
+	c.cmds[strings.ToUpper(cmd)] = true
+	return c.Conn.Send(cmd, args...)
+}
+
+func TestWriteCommandsClassified(t *testing.T) {
+	s := miniredis.RunT(t)
+	cmds := make(map[string]bool)
+
+	for _, retries := range []int{0, 3} {
+		l := New(Config{
+			Type:              TypeRedis,
+			Address:           s.Addr(),
+			RateLimit:         1,
+			BurstLimit:        5,
+			Interval:          time.Hour,
+			OverflowRate:      1,
+			OverflowBurst:     1,
+			OptimisticRetries: retries,
+			StatsWindow:       time.Hour,
+			UsageWindow:       time.Hour,
+			KeyFailOpen:       true,
+			GroupFunc:         func(id string) string { return "group" },
+		}).(*redisLimiter)
+		dial := l.pool.Dial
+		l.pool.Dial = func() (redis.Conn, error) {
+			c, err := dial()
+			if err != nil {
+				return nil, err
+			}
+			return recordConn{Conn: c, cmds: cmds}, nil
+		}
+
+		ctx := context.Background()
+		l.AllowN("foo", 6)
+		l.AllowChild("foo", "bar", 1)
+		l.AllowField("foo", "bar", 1)
+		l.AllowSeq("foo", 1, 1)
+		l.AllowSometimes("foo", 1, 2, time.Hour)
+		l.GlobalAllow(1)
+		l.SetState("foo", "pro")
+		l.AllowWithState("foo", 1)
+		l.SetInterval("foo", time.Minute)
+		l.SetFailOpen("foo", true)
+		l.ClearFailOpen("foo")
+		l.Seed("bar", 1, time.Now())
+		l.SeedWithTTL("bar", 1, time.Now(), time.Hour)
+		l.Transfer("foo", "bar", 1)
+		l.Block("foo", time.Minute)
+		l.Unblock("foo")
+		l.BlockGroup("group", time.Minute)
+		l.ResetGroup("group")
+		l.Stats("foo")
+		l.Usage("foo", time.Hour)
+		l.Tokens("foo")
+		l.Exists("foo")
+		l.LastSeen("foo")
+		l.Keys(ctx)
+		l.Inspect(ctx, "foo")
+		l.Dump(ctx, io.Discard)
+		l.AllowAll([]string{"foo", "qux"})
+		l.ResetAll(ctx)
+	}
+
+	for cmd := range cmds {
+		if !writeCommands[cmd] && !readCommands[cmd] {
+			t.Errorf("expected %s to be classified as a read or write command", cmd)
+		}
+	}
+	for _, cmd := range []string{"PEXPIRE", "SADD", "WATCH"} {
+		if !cmds[cmd] {
+			t.Errorf("expected %s to be issued: %v", cmd, cmds)
+		}
+	}
+}
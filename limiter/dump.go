@@ -0,0 +1,143 @@
+package limiter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Dump writes the key, stored tokens, last update, and remaining tokens of
+// every token bucket in Redis to the given writer. Keys are found with SCAN so
+// the dump is not a consistent snapshot of a changing database.
+func (l *redisLimiter) Dump(ctx context.Context, w io.Writer) error {
+	return dump(ctx, l, w)
+}
+
+// Dump writes the key, stored tokens, last update, and remaining tokens of
+// every token bucket to the given writer
+func (l *inMemoryLimiter) Dump(ctx context.Context, w io.Writer) error {
+	return dump(ctx, l, w)
+}
+
+func (l *disabledLimiter) Dump(ctx context.Context, w io.Writer) error {
+	return dump(ctx, l, w)
+}
+
+// dump writes a table of the given Limiter's token buckets sorted by key
+func dump(ctx context.Context, l Limiter, w io.Writer) error {
+	keys, err := l.Keys(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tTOKENS\tLAST UPDATE\tREMAINING")
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state, err := l.Inspect(ctx, key)
+		if err == ErrKeyNotFound {
+			// the key was removed since it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		remaining, err := l.Tokens(key)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(tw, "%s\t%g\t%s\t%g\n",
+			key, state.Tokens, state.LastUpdate.Format(time.RFC3339), remaining)
+	}
+	return tw.Flush()
+}
+
+// bucketJSON is an element of the array written by InspectJSON
+type bucketJSON struct {
+	Key        string    `json:"key"`
+	Tokens     float64   `json:"tokens"`
+	LastUpdate time.Time `json:"lastUpdate"`
+	Remaining  float64   `json:"remaining"`
+	// ResetAfter is the seconds until the bucket is full, null if it is never
+	// refilled
+	ResetAfter *float64 `json:"resetAfter"`
+}
+
+// InspectJSON returns a JSON array of the key, stored tokens, last update,
+// remaining tokens, and seconds until full of the token buckets of the given
+// keys, for tooling. Keys without token buckets are omitted.
+func (l *redisLimiter) InspectJSON(ctx context.Context, keys []string) ([]byte, error) {
+	return inspectJSON(ctx, l, keys, func(key string, remaining float64) time.Duration {
+		k := l.keyed(key)
+		return waitDelay(remaining, k.burst, 0, k.refillRate(k.rate), k.interval, k.now().Add(k.grace))
+	})
+}
+
+// InspectJSON returns a JSON array of the key, stored tokens, last update,
+// remaining tokens, and seconds until full of the token buckets of the given
+// keys. Keys without token buckets are omitted.
+func (l *inMemoryLimiter) InspectJSON(ctx context.Context, keys []string) ([]byte, error) {
+	return inspectJSON(ctx, l, keys, func(key string, remaining float64) time.Duration {
+		k := l.keyed(key)
+
+		// a rate.Limiter adds tokens per second rather than per interval
+		rate := k.refillRate(k.rate)
+		if !k.pureGo {
+			rate *= k.interval.Seconds()
+		}
+		return waitDelay(remaining, k.burst, 0, rate, k.interval, k.now().Add(k.grace))
+	})
+}
+
+func (l *disabledLimiter) InspectJSON(ctx context.Context, keys []string) ([]byte, error) {
+	return inspectJSON(ctx, l, keys, nil)
+}
+
+// inspectJSON marshals the state of the given keys' token buckets, computing
+// how long until each is full with the given function
+func inspectJSON(ctx context.Context, l Limiter, keys []string, resetAfter func(key string, remaining float64) time.Duration) ([]byte, error) {
+	buckets := []bucketJSON{}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		state, err := l.Inspect(ctx, key)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		remaining, err := l.Tokens(key)
+		if err != nil {
+			return nil, err
+		}
+
+		b := bucketJSON{
+			Key:        key,
+			Tokens:     state.Tokens,
+			LastUpdate: state.LastUpdate,
+			Remaining:  remaining,
+		}
+		if remaining >= float64(l.Burst()) {
+			b.ResetAfter = new(float64)
+		} else if d := resetAfter(key, remaining); d >= 0 {
+			seconds := d.Seconds()
+			b.ResetAfter = &seconds
+		}
+		buckets = append(buckets, b)
+	}
+	return json.Marshal(buckets)
+}
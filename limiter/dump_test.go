@@ -0,0 +1,147 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisDump(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+	last := now.Add(-time.Second)
+
+	// each command borrows a connection from the pool
+	var n []interface{} = nil
+	m.On("Do", "", n).Return(nil, nil).Twice()
+	m.On("Err").Return(nil).Twice()
+	m.On("Close").Return(nil).Twice()
+
+	m.On("Do", "SCAN", []interface{}{0, "COUNT", scanCount}).Return(
+		[]interface{}{[]byte("0"), []interface{}{[]byte("foo")}}, nil,
+	).Once()
+	m.On("Do", "TYPE", []interface{}{"foo"}).Return("list", nil).Once()
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 2}).Return(
+		[]interface{}{[]byte("2"), []byte(fmt.Sprint(last.Unix()))}, nil,
+	).Once()
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 1}).Return(
+		[]interface{}{[]byte("2"), []byte(fmt.Sprint(last.Unix()))}, nil,
+	).Once()
+
+	var buf bytes.Buffer
+	if err := l.Dump(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	row := fmt.Sprintf("foo  2       %s  12", last.Format(time.RFC3339))
+	if !strings.Contains(buf.String(), row) {
+		t.Errorf("expected dump to contain %q:\n%s", row, buf.String())
+	}
+}
+
+func TestInMemoryDump(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 4,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+		now := time.Now().Truncate(time.Second)
+		l.now = func() time.Time { return now }
+
+		l.AllowN("foo", 3)
+		l.AllowN("bar", 1)
+		now = now.Add(time.Second)
+
+		var buf bytes.Buffer
+		if err := l.Dump(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected a header and 2 rows:\n%s", buf.String())
+		}
+		for i, prefix := range []string{"KEY", "bar", "foo"} {
+			if !strings.HasPrefix(lines[i], prefix) {
+				t.Errorf("expected line %d to start with %s: %s", i, prefix, lines[i])
+			}
+		}
+		if fields := strings.Fields(lines[2]); fields[len(fields)-1] != "2" {
+			t.Errorf("expected foo to have 2 remaining tokens: %s", lines[2])
+		}
+	}
+}
+
+func TestDisabledDump(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+
+	var buf bytes.Buffer
+	if err := l.Dump(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != "KEY  TOKENS  LAST UPDATE  REMAINING" {
+		t.Errorf("expected only a header: %q", buf.String())
+	}
+}
+
+func TestInspectJSON(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 4
+		config.Interval = time.Hour
+		l := New(config)
+
+		l.AllowN("foo", 3)
+		l.AllowN("bar", 1)
+
+		data, err := l.InspectJSON(context.Background(), []string{"foo", "bar", "missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buckets []struct {
+			Key        string    `json:"key"`
+			Tokens     float64   `json:"tokens"`
+			LastUpdate time.Time `json:"lastUpdate"`
+			Remaining  float64   `json:"remaining"`
+			ResetAfter *float64  `json:"resetAfter"`
+		}
+		if err := json.Unmarshal(data, &buckets); err != nil {
+			t.Fatalf("%s: expected valid JSON: %v: %s", name, err, data)
+		}
+		if len(buckets) != 2 {
+			t.Fatalf("%s: expected the missing key to be omitted: %s", name, data)
+		}
+
+		for i, key := range []string{"foo", "bar"} {
+			b := buckets[i]
+			state, err := l.Inspect(context.Background(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remaining, _ := l.Tokens(key)
+			if b.Key != key || b.Tokens != state.Tokens || !b.LastUpdate.Equal(state.LastUpdate) || b.Remaining != remaining {
+				t.Errorf("%s: expected %s to match its state %+v: %s", name, key, state, data)
+			}
+			if b.ResetAfter == nil || *b.ResetAfter <= 0 || *b.ResetAfter > (4*time.Hour).Seconds() {
+				t.Errorf("%s: expected %s to reset within 4 intervals: %s", name, key, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package limiter
+
+import "errors"
+
+// ErrDynamicLimit is the error counted when events are denied for dynamic rate
+// or burst limits outside of the configured bounds
+var ErrDynamicLimit = errors.New("limiter: dynamic limit out of bounds")
+
+// dynamicBounds bounds the rate and burst limits passed to the dynamic Allow
+// methods, zero maximums are unbounded
+type dynamicBounds struct {
+	maxRate  float64
+	maxBurst int
+	reject   bool
+}
+
+// limits returns the given rate and burst limits clamped to the bounds, or
+// ErrDynamicLimit if they are out of bounds and out of bounds limits are
+// rejected. Negative limits are out of bounds.
+func (b dynamicBounds) limits(rate float64, burst int) (float64, int, error) {
+	clamped, clampedBurst := rate, burst
+	if clamped < 0 {
+		clamped = 0
+	}
+	if b.maxRate > 0 && clamped > b.maxRate {
+		clamped = b.maxRate
+	}
+	if clampedBurst < 0 {
+		clampedBurst = 0
+	}
+	if b.maxBurst > 0 && clampedBurst > b.maxBurst {
+		clampedBurst = b.maxBurst
+	}
+
+	if b.reject && (clamped != rate || clampedBurst != burst) {
+		return 0, 0, ErrDynamicLimit
+	}
+	return clamped, clampedBurst, nil
+}
+
+// allowDynamic is like allowN but bounds the given rate and burst limits,
+// denying the events if they are rejected
+func (l *redisLimiter) allowDynamic(key string, n int, rate float64, burst int) bool {
+	rate, burst, err := l.dynamic.limits(rate, burst)
+	if err != nil {
+		l.counts.record(n, false, err)
+		return false
+	}
+	return l.allowN(key, n, rate, burst)
+}
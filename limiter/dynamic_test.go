@@ -0,0 +1,80 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDynamicBoundsLimits(t *testing.T) {
+	clamp := dynamicBounds{maxRate: 10, maxBurst: 20}
+	reject := dynamicBounds{maxRate: 10, maxBurst: 20, reject: true}
+
+	for _, tc := range []struct {
+		bounds dynamicBounds
+		rate   float64
+		burst  int
+		limits [2]float64
+		err    error
+	}{
+		{clamp, 5, 10, [2]float64{5, 10}, nil},
+		{clamp, 10, 20, [2]float64{10, 20}, nil},
+		{clamp, 50, 100, [2]float64{10, 20}, nil},
+		{clamp, -1, -1, [2]float64{0, 0}, nil},
+		{reject, 5, 10, [2]float64{5, 10}, nil},
+		{reject, 50, 10, [2]float64{}, ErrDynamicLimit},
+		{reject, 5, 100, [2]float64{}, ErrDynamicLimit},
+		{reject, -1, 10, [2]float64{}, ErrDynamicLimit},
+		{dynamicBounds{}, 1e9, 1e9, [2]float64{1e9, 1e9}, nil},
+	} {
+		rate, burst, err := tc.bounds.limits(tc.rate, tc.burst)
+		if err != tc.err || rate != tc.limits[0] || burst != int(tc.limits[1]) {
+			t.Errorf("expected %v %v with %+v to be %v %v: %v %v %v",
+				tc.rate, tc.burst, tc.bounds, tc.limits, tc.err, rate, burst, err)
+		}
+	}
+}
+
+func TestAllowDynamicBounds(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		config.MaxDynamicRate = 5
+		config.MaxDynamicBurst = 5
+
+		clamp := New(config)
+		if !clamp.AllowNDynamic("in", 5, 5, 5) {
+			t.Errorf("%s: expected in bounds limits to allow", name)
+		}
+		if clamp.AllowNDynamic("clamped", 6, 100, 100) {
+			t.Errorf("%s: expected clamped burst to not allow 6 events", name)
+		}
+		if !clamp.AllowNDynamic("clamped", 5, 100, 100) {
+			t.Errorf("%s: expected clamped burst to allow 5 events", name)
+		}
+
+		config.KeyPrefix = "reject:"
+		config.RejectDynamicOutOfBounds = true
+		reject := New(config)
+		if !reject.AllowNDynamic("in", 5, 5, 5) {
+			t.Errorf("%s: expected in bounds limits to allow", name)
+		}
+		if reject.AllowDynamic("rejected", 100, 1) {
+			t.Errorf("%s: expected out of bounds rate to be rejected", name)
+		}
+		if reject.AllowNDynamicInterval("rejected", 1, 1, 100, time.Minute) {
+			t.Errorf("%s: expected out of bounds burst to be rejected", name)
+		}
+		if ok, _ := reject.Exists("rejected"); ok {
+			t.Errorf("%s: expected rejected key to not have a bucket", name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package limiter
+
+import "encoding/base64"
+
+// KeyEncoder encodes IDs into the keys their token buckets are stored at and
+// decodes stored keys back into IDs
+type KeyEncoder interface {
+	// Encode returns the key the given ID is stored at
+	Encode(id string) string
+	// Decode returns the ID stored at the given key
+	Decode(key string) (string, error)
+}
+
+// IdentityKeyEncoder stores IDs as they are, the default KeyEncoder
+type IdentityKeyEncoder struct{}
+
+func (IdentityKeyEncoder) Encode(id string) string {
+	return id
+}
+
+func (IdentityKeyEncoder) Decode(key string) (string, error) {
+	return key, nil
+}
+
+// Base64KeyEncoder stores IDs URL-safe base64 encoded without padding, so keys
+// never contain spaces, newlines, colons, or other bytes that confuse Redis
+// tooling, nor the separator reserved for the keys storing per-key state
+type Base64KeyEncoder struct{}
+
+func (Base64KeyEncoder) Encode(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func (Base64KeyEncoder) Decode(key string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(key)
+	return string(id), err
+}
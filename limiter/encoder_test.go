@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// unsafeIDs contain bytes which confuse Redis tooling or are reserved for the
+// keys storing per-key state
+var unsafeIDs = []string{"foo bar", "tenant:user", "line\nbreak", "null" + keySeparator + "byte"}
+
+func TestBase64KeyEncoder(t *testing.T) {
+	e := Base64KeyEncoder{}
+	for _, id := range unsafeIDs {
+		key := e.Encode(id)
+		if strings.ContainsAny(key, " :\n") {
+			t.Errorf("expected %q to be encoded safely: %q", id, key)
+		}
+		if decoded, err := e.Decode(key); err != nil || decoded != id {
+			t.Errorf("expected %q to round trip: %q, %v", id, decoded, err)
+		}
+	}
+}
+
+func TestKeyEncoder(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr(), KeyPrefix: "test:"},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.KeyEncoder = Base64KeyEncoder{}
+		l := New(config)
+
+		for _, id := range unsafeIDs {
+			if !l.Allow(id) {
+				t.Errorf("%s: expected to allow %q", name, id)
+			}
+		}
+
+		keys, err := l.Keys(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(keys)
+		expected := append([]string(nil), unsafeIDs...)
+		sort.Strings(expected)
+		if strings.Join(keys, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected the original IDs: %q", name, keys)
+		}
+
+		var buf bytes.Buffer
+		if err := l.Dump(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "tenant:user") {
+			t.Errorf("%s: expected dump to contain the original ID:\n%s", name, buf.String())
+		}
+	}
+
+	for _, key := range s.Keys() {
+		if strings.ContainsAny(strings.TrimPrefix(key, "test:"), " :\n") {
+			t.Errorf("expected stored keys to be encoded: %q", key)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package limiter
+
+import "github.com/garyburd/redigo/redis"
+
+// Exists returns true if the given key has a token bucket, or a count in the
+// current calendar window, false if the key has never been seen or its bucket
+// was pruned
+func (l *redisLimiter) Exists(key string) (bool, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	if l.window != WindowNone {
+		start, _ := l.window.Bounds(l.now(), l.location)
+		key = windowKey(key, start)
+	}
+	return redis.Bool(c.Do("EXISTS", key))
+}
+
+func (l *inMemoryLimiter) Exists(key string) (bool, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.window != WindowNone {
+		start, _ := l.window.Bounds(l.now(), l.location)
+		w, ok := l.windows[key]
+		return ok && w.start.Equal(start), nil
+	}
+	if l.expired(key) {
+		return false, nil
+	}
+	if l.pureGo {
+		_, ok := l.buckets[key]
+		return ok, nil
+	}
+	_, ok := l.limiters[key]
+	return ok, nil
+}
+
+// Exists returns false as the disabled limiter does not store token buckets
+func (l *disabledLimiter) Exists(key string) (bool, error) {
+	return false, nil
+}
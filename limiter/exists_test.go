@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// exists returns true if the given key has a token bucket, failing on error
+func exists(t *testing.T, l Limiter, key string) bool {
+	ok, err := l.Exists(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestExists(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+		"window":   {Type: TypeInMemory, CalendarWindow: WindowDay},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+		s.FlushAll()
+
+		if exists(t, l, "foo") {
+			t.Errorf("%s: expected never seen key to not exist", name)
+		}
+		l.Allow("foo")
+		if !exists(t, l, "foo") {
+			t.Errorf("%s: expected key to exist", name)
+		}
+
+		// a full bucket exists, unlike one never created
+		l.AllowN("bar", 0)
+		if tokens, _ := l.Tokens("bar"); tokens != 2 || !exists(t, l, "bar") {
+			t.Errorf("%s: expected full key to exist", name)
+		}
+	}
+}
+
+func TestRedisExistsWindow(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:           TypeRedis,
+		Address:        s.Addr(),
+		RateLimit:      2,
+		CalendarWindow: WindowDay,
+	})
+
+	if exists(t, l, "foo") {
+		t.Error("expected never seen key to not exist")
+	}
+	l.Allow("foo")
+	if !exists(t, l, "foo") {
+		t.Error("expected key to have a count in the current window")
+	}
+}
+
+func TestExistsReset(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":  {Type: TypeRedis, Address: s.Addr()},
+		"pureGo": {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		config.PruneFullBuckets = true
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		l.Allow("foo")
+		now = now.Add(time.Hour)
+
+		// the refilled bucket is pruned on its next access
+		l.Allow("foo")
+		now = now.Add(time.Hour)
+		l.Tokens("foo")
+		if exists(t, l, "foo") {
+			t.Errorf("%s: expected pruned key to not exist", name)
+		}
+	}
+}
+
+func TestRedisExistsError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "EXISTS", []interface{}{"foo"}).Return(nil, errors.New("not good")).Once()
+
+	if _, err := l.Exists("foo"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := l.Exists(strings.Repeat("a", defaultMaxKeyLength+1)); err != ErrKeyTooLong {
+		t.Errorf("expected ErrKeyTooLong: %v", err)
+	}
+}
+
+func TestDisabledExists(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if ok, err := l.Exists("foo"); ok || err != nil {
+		t.Errorf("expected disabled limiter to have no keys: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,79 @@
+package limiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConfigSchemaVersion is the version of the schema Config.Export writes.
+// It is incremented when a Config field is renamed or changes meaning so
+// ImportConfig can tell older blobs apart from newer ones it does not know.
+const ConfigSchemaVersion = 1
+
+// ErrSchemaVersion is returned by ImportConfig for configs exported with a
+// schema version it does not support, such as one written by a newer release
+var ErrSchemaVersion = errors.New("limiter: unsupported config schema version")
+
+// exportedConfig is the versioned form of a Config. Locations are stored by
+// name since time.Location has no exported fields.
+type exportedConfig struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Location      string `json:"location,omitempty"`
+	Config        Config `json:"config"`
+}
+
+// Export returns the config as JSON tagged with ConfigSchemaVersion, for
+// config management tooling to persist and share, or an error if the config
+// is invalid. Functions and interfaces, such as DialFunc, KeyEncoder, Backoff
+// and the hooks, cannot be serialized and are left out, the importer sets
+// them again.
+func (c Config) Export() ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	e := exportedConfig{SchemaVersion: ConfigSchemaVersion, Config: c}
+	if c.Location != nil {
+		e.Location = c.Location.String()
+	}
+	return json.Marshal(e)
+}
+
+// ImportConfig returns the config exported by Config.Export, or an error
+// wrapping ErrSchemaVersion if it was exported with an unsupported schema
+// version. Unknown fields are rejected rather than silently ignored, and the
+// imported config is validated.
+func ImportConfig(data []byte) (Config, error) {
+	var version struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return Config{}, err
+	}
+	if version.SchemaVersion != ConfigSchemaVersion {
+		return Config{}, fmt.Errorf("%w: %d", ErrSchemaVersion, version.SchemaVersion)
+	}
+
+	var e exportedConfig
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&e); err != nil {
+		return Config{}, err
+	}
+
+	c := e.Config
+	if e.Location != "" {
+		location, err := time.LoadLocation(e.Location)
+		if err != nil {
+			return Config{}, err
+		}
+		c.Location = location
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
@@ -0,0 +1,118 @@
+package limiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestConfigExport(t *testing.T) {
+	config := Config{
+		Type:           TypeRedis,
+		Address:        "localhost:6379",
+		RateLimit:      100,
+		BurstLimit:     200,
+		Interval:       time.Minute,
+		FailOpen:       true,
+		CalendarWindow: WindowDay,
+		Location:       time.UTC,
+		Schedule:       []Window{{Start: time.Hour, End: 2 * time.Hour, RateLimit: 10}},
+		StorageLayout:  LayoutHash,
+		AllowList:      []string{"admin"},
+		ChildWeights:   map[string]float64{"api-key-1": 3},
+		WarmUp:         10 * time.Second,
+		WarmUpFloor:    0.1,
+	}
+
+	data, err := config.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported, config) {
+		t.Errorf("expected %+v, got %+v", config, imported)
+	}
+}
+
+func TestConfigExportFuncs(t *testing.T) {
+	config := Config{
+		Type:      TypeRedis,
+		Address:   "localhost:6379",
+		RateLimit: 1,
+		DialFunc: func(ctx context.Context) (redis.Conn, error) {
+			return nil, errors.New("not dialed")
+		},
+		GroupFunc:  func(id string) string { return id },
+		KeyEncoder: IdentityKeyEncoder{},
+		Backoff:    NoJitter{},
+	}
+
+	// functions and interfaces are left out rather than failing the export
+	data, err := config.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.DialFunc != nil || imported.GroupFunc != nil || imported.KeyEncoder != nil || imported.Backoff != nil {
+		t.Errorf("expected functions and interfaces to be left out: %+v", imported)
+	}
+	if imported.Address != config.Address || imported.RateLimit != config.RateLimit {
+		t.Errorf("expected the other fields to be imported: %+v", imported)
+	}
+}
+
+func TestConfigExportInvalid(t *testing.T) {
+	if _, err := (Config{Type: TypeRedis, Address: "localhost"}).Export(); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected an invalid config to not be exported: %v", err)
+	}
+}
+
+func TestImportConfigSchemaVersion(t *testing.T) {
+	data, err := Config{Type: TypeInMemory, RateLimit: 1}.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e map[string]interface{}
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["schemaVersion"] != float64(ConfigSchemaVersion) {
+		t.Errorf("expected schema version %d: %v", ConfigSchemaVersion, e["schemaVersion"])
+	}
+
+	// configs from newer releases, or without a version, are rejected
+	for _, version := range []interface{}{ConfigSchemaVersion + 1, nil} {
+		e["schemaVersion"] = version
+		data, _ := json.Marshal(e)
+		if _, err := ImportConfig(data); !errors.Is(err, ErrSchemaVersion) {
+			t.Errorf("expected schema version %v to be rejected: %v", version, err)
+		}
+	}
+}
+
+func TestImportConfigUnknownField(t *testing.T) {
+	data := `{"schemaVersion":1,"config":{"Type":2,"RateLimit":1,"RateLimt":2}}`
+	if _, err := ImportConfig([]byte(data)); err == nil || !strings.Contains(err.Error(), "RateLimt") {
+		t.Errorf("expected the unknown field to be rejected: %v", err)
+	}
+}
+
+func TestImportConfigInvalid(t *testing.T) {
+	data := `{"schemaVersion":1,"config":{"Type":2,"RateLimit":0}}`
+	if _, err := ImportConfig([]byte(data)); err != ErrZeroRate {
+		t.Errorf("expected the imported config to be validated: %v", err)
+	}
+}
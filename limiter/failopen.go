@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// failOpenKey returns the key storing the FailOpen override set for the given
+// key by SetFailOpen
+func failOpenKey(key string) string {
+	return suffixedKey(key, "failopen")
+}
+
+// keyFailOpens holds the FailOpen overrides last read or set by this process,
+// consulted when Redis cannot be asked for a key's override
+type keyFailOpens struct {
+	mux  sync.RWMutex
+	keys map[string]bool
+}
+
+// newKeyFailOpens returns the overrides of a Limiter reading them, nil
+// otherwise
+func newKeyFailOpens(read bool) *keyFailOpens {
+	if !read {
+		return nil
+	}
+	return &keyFailOpens{keys: make(map[string]bool)}
+}
+
+// get returns the given key's override and whether it has one
+func (f *keyFailOpens) get(key string) (bool, bool) {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	failOpen, ok := f.keys[key]
+	return failOpen, ok
+}
+
+// set records the given key's override, or its removal
+func (f *keyFailOpens) set(key string, failOpen, ok bool) {
+	if f == nil {
+		return
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if !ok {
+		delete(f.keys, key)
+		return
+	}
+	f.keys[key] = failOpen
+}
+
+// SetFailOpen stores an override of Config.FailOpen for the given key, so
+// critical keys may fail closed under a fail open Limiter or the reverse.
+// Stored overrides are only read when Config.KeyFailOpen is set.
+func (l *redisLimiter) SetFailOpen(key string, failOpen bool) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("SET", failOpenKey(key), failOpen); err != nil {
+		return err
+	}
+	l.failOpens.set(key, failOpen, true)
+	return nil
+}
+
+// ClearFailOpen removes the override stored for the given key by SetFailOpen
+func (l *redisLimiter) ClearFailOpen(key string) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("DEL", failOpenKey(key)); err != nil {
+		return err
+	}
+	l.failOpens.set(key, false, false)
+	return nil
+}
+
+// keyFailOpen returns whether events of the given stored key are allowed on a
+// Redis error. The key's override is read from Redis, which may still answer
+// if the error was particular to the key's bucket, falling back to the
+// override last known to this process and then to Config.FailOpen.
+func (l *redisLimiter) keyFailOpen(key string) bool {
+	if l.failOpens == nil {
+		return l.failOpen
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	failOpen, err := redis.Bool(c.Do("GET", failOpenKey(key)))
+	switch err {
+	case nil:
+		l.failOpens.set(key, failOpen, true)
+		return failOpen
+	case redis.ErrNil:
+		l.failOpens.set(key, false, false)
+		return l.failOpen
+	}
+
+	if failOpen, ok := l.failOpens.get(key); ok {
+		return failOpen
+	}
+	return l.failOpen
+}
+
+// SetFailOpen does nothing as the in-memory Limiter's storage cannot fail
+func (l *inMemoryLimiter) SetFailOpen(key string, failOpen bool) error {
+	return nil
+}
+
+func (l *inMemoryLimiter) ClearFailOpen(key string) error {
+	return nil
+}
+
+func (l *disabledLimiter) SetFailOpen(key string, failOpen bool) error {
+	return nil
+}
+
+func (l *disabledLimiter) ClearFailOpen(key string) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestKeyFailOpen(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:        TypeRedis,
+		Address:     s.Addr(),
+		RateLimit:   1,
+		BurstLimit:  1,
+		Interval:    time.Hour,
+		FailOpen:    true,
+		KeyFailOpen: true,
+	})
+
+	if err := l.SetFailOpen("critical", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the override is known to the process while Redis fails
+	s.SetError("not good")
+	if allowed, err := l.AllowWith("critical"); err == nil || allowed {
+		t.Errorf("expected critical to fail closed with an error, got %v, %v", allowed, err)
+	}
+	if allowed, err := l.AllowWith("foo"); err == nil || !allowed {
+		t.Errorf("expected foo to fail open with an error, got %v, %v", allowed, err)
+	}
+
+	// the call's fail mode takes precedence over the key's
+	if allowed, _ := l.AllowWith("critical", WithFailMode(true)); !allowed {
+		t.Error("expected the call to fail open")
+	}
+	s.SetError("")
+
+	// cleared overrides fall back to FailOpen
+	if err := l.ClearFailOpen("critical"); err != nil {
+		t.Fatal(err)
+	}
+	s.SetError("not good")
+	if allowed, err := l.AllowWith("critical"); err == nil || !allowed {
+		t.Errorf("expected critical to fail open with an error, got %v, %v", allowed, err)
+	}
+}
+
+func TestKeyFailOpenStored(t *testing.T) {
+	s := miniredis.RunT(t)
+	config := Config{
+		Type:        TypeRedis,
+		Address:     s.Addr(),
+		RateLimit:   1,
+		BurstLimit:  1,
+		Interval:    time.Hour,
+		FailOpen:    true,
+		KeyFailOpen: true,
+	}
+	if err := New(config).SetFailOpen("critical", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process reads the override when only the key's bucket errors
+	s.Set("critical", "not a bucket")
+	s.Set("foo", "not a bucket")
+	l := New(config)
+	if allowed, err := l.AllowWith("critical"); err == nil || allowed {
+		t.Errorf("expected critical to fail closed with an error, got %v, %v", allowed, err)
+	}
+	if allowed, err := l.AllowWith("foo"); err == nil || !allowed {
+		t.Errorf("expected foo to fail open with an error, got %v, %v", allowed, err)
+	}
+
+	// stored overrides are ignored unless read
+	config.KeyFailOpen = false
+	if allowed, err := New(config).AllowWith("critical"); err == nil || !allowed {
+		t.Errorf("expected critical to fail open with an error, got %v, %v", allowed, err)
+	}
+}
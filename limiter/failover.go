@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultFailoverProbeInterval is how often Redis is probed while the Redis
+// Limiter decides with its in-memory fallback
+const defaultFailoverProbeInterval = 5 * time.Second
+
+// failover switches the Redis Limiter to an in-memory fallback after
+// sustained Redis failures, probing Redis to switch back once it is healthy
+type failover struct {
+	threshold int
+	interval  time.Duration
+	hook      func(from, to Type)
+	fallback  *inMemoryLimiter
+
+	mux      *sync.Mutex
+	failures int
+	degraded bool
+	probeAt  time.Time
+}
+
+// newFailover returns a failover to an in-memory Limiter with the given
+// config, which decides with the same token bucket math as Redis, or nil if
+// failover is disabled
+func newFailover(config Config) *failover {
+	if config.FailoverThreshold <= 0 {
+		return nil
+	}
+
+	fallback := config
+	fallback.Type = TypeInMemory
+	fallback.PureGo = true
+	fallback.FailoverThreshold = 0
+
+	return &failover{
+		threshold: config.FailoverThreshold,
+		interval:  config.FailoverProbeInterval,
+		hook:      config.OnFailover,
+		fallback:  New(fallback).(*inMemoryLimiter),
+		mux:       &sync.Mutex{},
+	}
+}
+
+// failed returns true if the given error is a Redis failure rather than the
+// events being rejected with Redis available
+func failed(err error) bool {
+	return err != nil && err != ErrConflict && !errors.Is(err, ErrKeyTooLong)
+}
+
+// decide decides events with Redis, or with the fallback while Redis is
+// failing. Redis is probed at most once per probe interval while degraded,
+// switching back once it responds. Each switch calls the hook.
+func (f *failover) decide(now time.Time, ping func(ctx context.Context) error, redis, fallback func() (bool, float64, error)) (bool, float64, error) {
+	if f.useFallback(now, ping) {
+		return fallback()
+	}
+
+	allowed, remaining, err := redis()
+
+	f.mux.Lock()
+	switched := false
+	if !failed(err) {
+		f.failures = 0
+	} else if f.failures++; f.failures >= f.threshold && !f.degraded {
+		f.degraded = true
+		f.probeAt = now.Add(f.interval)
+		switched = true
+	}
+	f.mux.Unlock()
+
+	if switched {
+		f.switched(TypeRedis, TypeInMemory)
+	}
+	return allowed, remaining, err
+}
+
+// useFallback returns true if events are decided with the fallback, probing
+// Redis if it is degraded and a probe is due
+func (f *failover) useFallback(now time.Time, ping func(ctx context.Context) error) bool {
+	f.mux.Lock()
+	if !f.degraded || now.Before(f.probeAt) {
+		defer f.mux.Unlock()
+		return f.degraded
+	}
+
+	// other events keep using the fallback while this one probes
+	f.probeAt = now.Add(f.interval)
+	f.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.interval)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		return true
+	}
+
+	f.mux.Lock()
+	f.degraded = false
+	f.failures = 0
+	f.mux.Unlock()
+
+	f.switched(TypeInMemory, TypeRedis)
+	return false
+}
+
+// switched calls the hook, if any, for a switch between the given backends
+func (f *failover) switched(from, to Type) {
+	if f.hook != nil {
+		f.hook(from, to)
+	}
+}
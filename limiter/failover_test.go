@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestFailover(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	var switches [][2]Type
+	l := New(Config{
+		Type:                  TypeRedis,
+		Address:               s.Addr(),
+		RateLimit:             1,
+		BurstLimit:            2,
+		Interval:              time.Hour,
+		FailoverThreshold:     2,
+		FailoverProbeInterval: time.Minute,
+		OnFailover: func(from, to Type) {
+			switches = append(switches, [2]Type{from, to})
+		},
+	}).(*redisLimiter)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	if allowed, err := l.AllowWith("foo"); err != nil || !allowed {
+		t.Fatalf("expected Redis to allow foo: %v", err)
+	}
+
+	// sustained failures switch to the in-memory fallback
+	s.Close()
+	for i := 0; i < 2; i++ {
+		if allowed, err := l.AllowWith("foo"); err == nil || allowed {
+			t.Errorf("expected failure %d to fail closed: %v", i, err)
+		}
+	}
+	if want := [][2]Type{{TypeRedis, TypeInMemory}}; !reflect.DeepEqual(switches, want) {
+		t.Errorf("expected to fail over: %v", switches)
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, err := l.AllowWith("foo"); err != nil || !allowed {
+			t.Errorf("expected the fallback to allow foo: %v", err)
+		}
+	}
+	if allowed, _ := l.AllowWith("foo"); allowed {
+		t.Error("expected the fallback to limit foo")
+	}
+
+	// a failed probe keeps the fallback
+	now = now.Add(time.Minute)
+	if allowed, err := l.AllowWith("bar"); err != nil || !allowed {
+		t.Errorf("expected the fallback to allow bar: %v", err)
+	}
+
+	// Redis recovering is only noticed once the next probe is due
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := l.AllowWith("foo"); allowed {
+		t.Error("expected the fallback to still limit foo")
+	}
+	now = now.Add(time.Minute)
+
+	// foo has the token Redis left it before failing over
+	if allowed, err := l.AllowWith("foo"); err != nil || !allowed {
+		t.Errorf("expected Redis to allow foo again: %v", err)
+	}
+	if allowed, _ := l.AllowWith("foo"); allowed {
+		t.Error("expected Redis to limit foo")
+	}
+	want := [][2]Type{{TypeRedis, TypeInMemory}, {TypeInMemory, TypeRedis}}
+	if !reflect.DeepEqual(switches, want) {
+		t.Errorf("expected to switch back: %v", switches)
+	}
+}
+
+func TestFailoverIntermittent(t *testing.T) {
+	f := newFailover(Config{
+		Type:                  TypeRedis,
+		RateLimit:             1,
+		FailoverThreshold:     2,
+		FailoverProbeInterval: time.Minute,
+	})
+	now := time.Now()
+
+	redisErr := func() (bool, float64, error) { return false, 0, errors.New("not good") }
+	redisOK := func() (bool, float64, error) { return true, 0, nil }
+	conflict := func() (bool, float64, error) { return false, 0, ErrConflict }
+	fallback := func() (bool, float64, error) {
+		t.Error("expected not to fail over")
+		return false, 0, nil
+	}
+
+	// only consecutive Redis failures count toward failing over
+	for _, redis := range []func() (bool, float64, error){redisErr, redisOK, redisErr, conflict, conflict, redisErr} {
+		f.decide(now, nil, redis, fallback)
+	}
+	if f.degraded {
+		t.Error("expected intermittent failures to not fail over")
+	}
+}
+
+func TestFailoverDisabled(t *testing.T) {
+	if f := newFailover(Config{Type: TypeRedis}); f != nil {
+		t.Error("expected failover to be disabled by default")
+	}
+}
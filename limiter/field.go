@@ -0,0 +1,109 @@
+package limiter
+
+import (
+	"math"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// allowFieldScript consumes tokens from a token bucket stored as a field of a
+// hash, of the form tokens:last, and expires the whole hash once every field
+// would have refilled. It returns 1 if allowed, 0 otherwise.
+//
+// KEYS[1] hash key
+// ARGV[1] field, ARGV[2] n, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] rate, ARGV[6] burst, ARGV[7] min tokens, ARGV[8] ttl (milliseconds)
+var allowFieldScript = newScript(1, luaRefill+`
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local b
+local v = redis.call("HGET", KEYS[1], ARGV[1])
+if v then
+	local sep = string.find(v, ":", 1, true)
+	b = {tokens = tonumber(string.sub(v, 1, sep - 1)), last = tonumber(string.sub(v, sep + 1))}
+end
+local tokens = refill(b, now, tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6]))
+
+if tokens - n < tonumber(ARGV[7]) then
+	return 0
+end
+
+redis.call("HSET", KEYS[1], ARGV[1], (tokens - n) .. ":" .. now)
+local ttl = tonumber(ARGV[8])
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// fieldKey returns the key of a field's token bucket in the in-memory Limiter
+func fieldKey(key, field string) string {
+	return suffixedKey(key, "field:"+field)
+}
+
+// fieldTTL returns how long until an emptied token bucket refills, after which
+// a hash of buckets last updated now may expire. Zero is returned if buckets
+// never refill.
+func fieldTTL(rate float64, burst int, minTokens float64, interval time.Duration) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	intervals := math.Ceil((float64(burst)-minTokens)/rate) + 1
+	return time.Duration(intervals) * interval
+}
+
+// AllowField returns true if the given number of events may happen for the
+// given field of the given key. Each field has its own token bucket with the
+// default limits, stored as a field of a single Redis hash at the key rather
+// than as a key of its own, so many related buckets, such as every endpoint
+// of one user, share one key and expire together once all of them are full.
+// Blocks, lists, and the other per-key features do not apply to fields.
+func (l *redisLimiter) AllowField(key, field string, n int) (bool, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	rate := l.refillRate(l.rate)
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	allowed, err := redis.Bool(db.eval(allowFieldScript,
+		key, field, n, now, l.interval.Seconds(),
+		rate, l.burst, l.minTokens,
+		fieldTTL(rate, l.burst, l.minTokens, l.interval).Milliseconds(),
+	))
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen, err
+	}
+	if allowed {
+		l.allowed.add(n)
+	}
+	return allowed, nil
+}
+
+// AllowField returns true if the given number of events may happen for the
+// given field of the given key, which has its own token bucket
+func (l *inMemoryLimiter) AllowField(key, field string, n int) (bool, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	// fields are keys of their own prefixed by the field key
+	c := *l
+	c.keyLength = keyLength{max: -1, prefix: fieldKey(key, "")}
+	allowed, _, err := c.allowNRemaining(field, n, l.rate, l.burst)
+	return allowed, err
+}
+
+func (l *disabledLimiter) AllowField(key, field string, n int) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAllowField(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Minute
+		l := New(config)
+
+		for i := 0; i < 2; i++ {
+			if allowed, err := l.AllowField("user", "/search", 1); err != nil || !allowed {
+				t.Errorf("%s: expected to allow /search: %v", name, err)
+			}
+		}
+		if allowed, _ := l.AllowField("user", "/search", 1); allowed {
+			t.Errorf("%s: expected to deny /search past its burst", name)
+		}
+
+		// fields are accounted independently
+		if allowed, _ := l.AllowField("user", "/profile", 2); !allowed {
+			t.Errorf("%s: expected to allow /profile", name)
+		}
+		if allowed, _ := l.AllowField("other", "/search", 1); !allowed {
+			t.Errorf("%s: expected to allow /search for another user", name)
+		}
+	}
+
+	// the fields share one hash expiring once every field has refilled
+	if fields, _ := s.HKeys("user"); len(fields) != 2 {
+		t.Errorf("expected both fields in one hash: %v", fields)
+	}
+	if ttl := s.TTL("user"); ttl != 3*time.Minute {
+		t.Errorf("expected the hash to expire after 3 intervals: %v", ttl)
+	}
+}
+
+func TestFieldTTL(t *testing.T) {
+	for _, tc := range []struct {
+		rate      float64
+		burst     int
+		minTokens float64
+		ttl       time.Duration
+	}{
+		{1, 2, 0, 3 * time.Second},
+		{2, 5, 0, 4 * time.Second},
+		{1, 2, -2, 5 * time.Second},
+		{0, 2, 0, 0},
+	} {
+		if ttl := fieldTTL(tc.rate, tc.burst, tc.minTokens, time.Second); ttl != tc.ttl {
+			t.Errorf("expected rate %v burst %v min %v to expire after %v: %v", tc.rate, tc.burst, tc.minTokens, tc.ttl, ttl)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package limiter
+
+import "github.com/garyburd/redigo/redis"
+
+// defaultGlobalKey is the ID of the global token bucket unless configured
+const defaultGlobalKey = "limiter:global"
+
+// globalLimit is the single token bucket limiting events across all IDs
+type globalLimit struct {
+	key   string
+	rate  float64
+	burst int
+}
+
+// allowGlobalScript atomically consumes tokens from a single token bucket.
+// Returns 1 if allowed, 0 otherwise.
+//
+// KEYS[1] key
+// ARGV[1] storageArg, ARGV[2] n, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] rate, ARGV[6] burst, ARGV[7] min tokens
+var allowGlobalScript = newScript(1, luaStorage+luaRefill+`
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local b = read_bucket(KEYS[1])
+local tokens = refill(b, now, tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6]))
+if tokens - n < tonumber(ARGV[7]) then
+	return 0
+end
+
+write_bucket(KEYS[1], {tokens = tokens - n, last = now}, b)
+return 1
+`)
+
+// GlobalAllow returns true if the global token bucket, shared by every ID and
+// limited by GlobalRateLimit and GlobalBurstLimit, has enough tokens for the
+// given number of events. Tokens are consumed atomically in a script,
+// independently of any ID's token bucket.
+func (l *redisLimiter) GlobalAllow(n int) (bool, error) {
+	key, err := l.keyLength.key(l.global.key)
+	if err != nil {
+		return false, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	allowed, err := redis.Bool(db.eval(allowGlobalScript,
+		key,
+		storageArg(l.layout, l.format), n, now, l.interval.Seconds(),
+		l.refillRate(l.global.rate), l.global.burst, l.minTokens,
+	))
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen, err
+	}
+	if allowed {
+		l.allowed.add(n)
+	}
+	return allowed, nil
+}
+
+func (l *inMemoryLimiter) GlobalAllow(n int) (bool, error) {
+	key, err := l.keyLength.key(l.global.key)
+	if err != nil {
+		return false, err
+	}
+
+	allowed, _ := l.take(key, n, l.global.rate, l.global.burst, l.boundary())
+	if allowed {
+		l.allowed.add(n)
+	}
+	return allowed, nil
+}
+
+func (l *disabledLimiter) GlobalAllow(n int) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestGlobalAllow(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		config.GlobalKey = "total"
+		config.GlobalBurstLimit = 3
+		l := New(config)
+
+		// per-key limits do not limit the global bucket
+		l.Allow("foo")
+		if l.Allow("foo") {
+			t.Errorf("%s: expected foo to be limited", name)
+		}
+		for i := 0; i < 3; i++ {
+			if allowed, err := l.GlobalAllow(1); err != nil || !allowed {
+				t.Errorf("%s: expected to allow global event %d: %v", name, i, err)
+			}
+		}
+		if allowed, _ := l.GlobalAllow(1); allowed {
+			t.Errorf("%s: expected to deny once the global burst is taken", name)
+		}
+
+		// and the global bucket does not limit per-key limits
+		if !l.Allow("bar") {
+			t.Errorf("%s: expected bar to be allowed", name)
+		}
+
+		if name == "redis" && !s.Exists("total") {
+			t.Errorf("%s: expected the global bucket at the configured key", name)
+		}
+	}
+}
+
+func TestGlobalAllowDefaults(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	})
+
+	// the global bucket defaults to the default limits
+	for i := 0; i < 2; i++ {
+		if allowed, _ := l.GlobalAllow(1); !allowed {
+			t.Errorf("expected to allow global event %d", i)
+		}
+	}
+	if allowed, _ := l.GlobalAllow(1); allowed {
+		t.Error("expected to deny once the default burst is taken")
+	}
+	if !s.Exists(defaultGlobalKey) {
+		t.Errorf("expected the global bucket at %s", defaultGlobalKey)
+	}
+}
+
+func TestDisabledGlobalAllow(t *testing.T) {
+	if allowed, _ := New(Config{Type: TypeDisabled}).GlobalAllow(1); !allowed {
+		t.Error("expected the disabled limiter to allow")
+	}
+	if allowed, _ := New(Config{Type: TypeBlockAll}).GlobalAllow(1); allowed {
+		t.Error("expected the block all limiter to deny")
+	}
+}
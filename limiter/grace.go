@@ -0,0 +1,17 @@
+package limiter
+
+import "time"
+
+// boundary returns the current time truncated to the interval, counting times
+// within the configured BoundaryGrace of the next interval as the next
+// interval
+func (l *redisLimiter) boundary() time.Time {
+	return l.now().Add(l.grace).Truncate(l.interval)
+}
+
+// boundary returns the current time truncated to the interval, counting times
+// within the configured BoundaryGrace of the next interval as the next
+// interval
+func (l *inMemoryLimiter) boundary() time.Time {
+	return l.now().Add(l.grace).Truncate(l.interval)
+}
@@ -0,0 +1,45 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBoundaryGrace(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, grace := range []time.Duration{0, 100 * time.Millisecond} {
+		for name, config := range map[string]Config{
+			"redis":    {Type: TypeRedis, Address: s.Addr(), KeyPrefix: grace.String() + ":"},
+			"inMemory": {Type: TypeInMemory},
+			"pureGo":   {Type: TypeInMemory, PureGo: true},
+		} {
+			config.RateLimit = 1
+			config.BurstLimit = 1
+			config.BoundaryGrace = grace
+
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+			clock := func() time.Time { return now }
+			l := New(config)
+			switch l := l.(type) {
+			case *redisLimiter:
+				l.now = clock
+			case *inMemoryLimiter:
+				l.now = clock
+			}
+
+			if !l.Allow("foo") {
+				t.Fatalf("%s: expected to allow the burst", name)
+			}
+
+			// 50ms before the next boundary
+			now = start.Add(950 * time.Millisecond)
+			if allowed := l.Allow("foo"); allowed != (grace > 0) {
+				t.Errorf("%s: expected a grace of %v to allow %v just before the boundary: %v", name, grace, grace > 0, allowed)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package limiter
+
+import (
+	"time"
+)
+
+// groupKey returns the key of the set of keys in the given group
+func groupKey(group string) string {
+	return suffixedKey(group, "members")
+}
+
+// keySuffixes returns the suffixes of the keys storing per-key state alongside
+// a key's token bucket which ResetGroup and MaxKeys eviction delete, the
+// suffix of the set of the key's children first. The current day, week and
+// month calendar windows are deleted whichever is configured, earlier windows
+// expiring when they end.
+func (l *redisLimiter) keySuffixes() []interface{} {
+	suffixes := []interface{}{
+		childrenKey(""), blockKey(""), overflowKey(""), statsKey(""),
+		createdKey(""), penaltyKey(""), sometimesKey(""), seqKey(""),
+		hysteresisKey(""), usageKey(""), intervalKey(""), failOpenKey(""),
+	}
+	for _, w := range []CalendarWindow{WindowDay, WindowWeek, WindowMonth} {
+		start, _ := w.Bounds(l.now(), l.location)
+		suffixes = append(suffixes, windowKey("", start))
+	}
+	return suffixes
+}
+
+// luaDeleteKey defines a function for Lua scripts to delete a key's token
+// bucket along with its per-key state and its children, given keySuffixes
+const luaDeleteKey = `
+local function delete_key(key, suffixes)
+	for _, child in ipairs(redis.call("SMEMBERS", key .. suffixes[1])) do
+		redis.call("DEL", child)
+	end
+	redis.call("DEL", key)
+	for _, suffix in ipairs(suffixes) do
+		redis.call("DEL", key .. suffix)
+	end
+end
+`
+
+// resetGroupScript deletes every member of a group along with the keys with
+// the given suffixes storing their state, then the group itself.
+//
+// KEYS[1] group key
+// ARGV suffixes
+var resetGroupScript = newScript(1, luaDeleteKey+`
+local members = redis.call("SMEMBERS", KEYS[1])
+for _, key in ipairs(members) do
+	delete_key(key, ARGV)
+end
+redis.call("DEL", KEYS[1])
+return #members
+`)
+
+// blockGroupScript blocks every member of a group, or unblocks them if the
+// duration is not positive.
+//
+// KEYS[1] group key
+// ARGV[1] block suffix, ARGV[2] duration (milliseconds)
+var blockGroupScript = newScript(1, `
+local members = redis.call("SMEMBERS", KEYS[1])
+local d = tonumber(ARGV[2])
+for _, key in ipairs(members) do
+	if d > 0 then
+		redis.call("SET", key .. ARGV[1], 1, "PX", d)
+	else
+		redis.call("DEL", key .. ARGV[1])
+	end
+end
+return #members
+`)
+
+// join adds the given key to its group if it has one
+func (l *redisLimiter) join(db backend, key string) error {
+	if l.groupFunc == nil {
+		return nil
+	}
+	group := l.groupFunc(l.keyLength.id(key))
+	if group == "" {
+		return nil
+	}
+	return db.sadd(groupKey(l.keyLength.prefix+group), key)
+}
+
+// ResetGroup deletes the token buckets of every key in the given group along
+// with their blocks, overflow buckets, children, calendar windows, stats, and
+// other per-key state, in a single script. Keys rejoin the group when their
+// buckets are recreated.
+func (l *redisLimiter) ResetGroup(group string) error {
+	db := l.backend()
+	defer db.close()
+
+	args := append([]interface{}{groupKey(l.keyLength.prefix + group)}, l.keySuffixes()...)
+	_, err := db.eval(resetGroupScript, args...)
+	return err
+}
+
+// BlockGroup blocks every key in the given group for the given duration in a
+// single script, a non-positive duration removes their blocks. Keys joining
+// the group later are not blocked.
+func (l *redisLimiter) BlockGroup(group string, d time.Duration) error {
+	db := l.backend()
+	defer db.close()
+
+	_, err := db.eval(blockGroupScript, groupKey(l.keyLength.prefix+group), blockKey(""), d.Milliseconds())
+	return err
+}
+
+// join adds the given key to its group if it has one
+func (l *inMemoryLimiter) join(key string) {
+	if l.groupFunc == nil {
+		return
+	}
+	group := l.groupFunc(l.keyLength.id(key))
+	if group == "" {
+		return
+	}
+
+	l.mux.RLock()
+	joined := l.groups[group][key]
+	l.mux.RUnlock()
+	if joined {
+		return
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.groups[group] == nil {
+		l.groups[group] = make(map[string]bool)
+	}
+	l.groups[group][key] = true
+}
+
+func (l *inMemoryLimiter) ResetGroup(group string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for key := range l.groups[group] {
+		l.forget(key)
+	}
+	delete(l.groups, group)
+	return nil
+}
+
+func (l *inMemoryLimiter) BlockGroup(group string, d time.Duration) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for key := range l.groups[group] {
+		if d <= 0 {
+			delete(l.blocks, key)
+		} else {
+			l.blocks[key] = l.now().Add(d)
+		}
+	}
+	return nil
+}
+
+func (l *disabledLimiter) ResetGroup(group string) error {
+	return nil
+}
+
+func (l *disabledLimiter) BlockGroup(group string, d time.Duration) error {
+	return nil
+}
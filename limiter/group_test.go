@@ -0,0 +1,157 @@
+package limiter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// tenant returns the tenant of keys of the form tenant:user
+func tenant(id string) string {
+	if i := strings.Index(id, ":"); i > 0 {
+		return id[:i]
+	}
+	return ""
+}
+
+func TestGroups(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr(), KeyPrefix: "test:"},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.GroupFunc = tenant
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		keys := []string{"a:1", "a:2", "b:1", "ungrouped"}
+		for _, key := range keys {
+			l.Allow(key)
+		}
+
+		// blocking a group only blocks its members
+		if err := l.BlockGroup("a", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+		for key, allowed := range map[string]bool{"a:1": false, "a:2": false, "b:1": true, "ungrouped": true} {
+			if l.Allow(key) != allowed {
+				t.Errorf("%s: expected %s to be allowed %v while a is blocked", name, key, allowed)
+			}
+		}
+
+		if err := l.BlockGroup("a", 0); err != nil {
+			t.Fatal(err)
+		}
+		if !l.Allow("a:1") {
+			t.Errorf("%s: expected a:1 to be allowed once a is unblocked", name)
+		}
+
+		// resetting a group only resets its members
+		if err := l.ResetGroup("a"); err != nil {
+			t.Fatal(err)
+		}
+		for key, exists := range map[string]bool{"a:1": false, "a:2": false, "b:1": true, "ungrouped": true} {
+			if ok, _ := l.Exists(key); ok != exists {
+				t.Errorf("%s: expected %s to exist %v after resetting a", name, key, exists)
+			}
+		}
+		if !l.Allow("a:1") {
+			t.Errorf("%s: expected a:1 to start full after resetting a", name)
+		}
+		if l.Allow("b:1") {
+			t.Errorf("%s: expected b:1 to remain empty after resetting a", name)
+		}
+
+		// reset keys rejoin their group
+		if err := l.BlockGroup("a", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+		if l.Allow("a:1") {
+			t.Errorf("%s: expected a:1 to rejoin its group", name)
+		}
+	}
+}
+
+func TestRedisResetGroupState(t *testing.T) {
+	s := miniredis.RunT(t)
+	config := Config{
+		Type:          TypeRedis,
+		Address:       s.Addr(),
+		KeyPrefix:     "test:",
+		RateLimit:     1,
+		BurstLimit:    2,
+		Interval:      time.Hour,
+		GroupFunc:     tenant,
+		OverflowRate:  1,
+		OverflowBurst: 1,
+		Stats:         true,
+		StatsWindow:   time.Hour,
+		UsageWindow:   time.Hour,
+		WarmUp:        time.Hour,
+		WarmUpFloor:   1,
+		PenaltyQuiet:  time.Hour,
+		PenaltyFloor:  1,
+		Hysteresis:    0.5,
+		KeyIntervals:  true,
+		KeyFailOpen:   true,
+	}
+	l := New(config)
+	window := config
+	window.CalendarWindow = WindowDay
+	w := New(window)
+
+	l.Allow("a:1")
+	if allowed, _ := l.AllowChild("a:1", "x", 1); !allowed {
+		t.Fatal("expected to allow child: x")
+	}
+	for i := 0; i < 3; i++ {
+		l.Allow("a:1")
+	}
+	l.AllowSometimes("a:1", 1, 2, time.Hour)
+	l.AllowSeq("a:1", 1, 1)
+	l.SetInterval("a:1", time.Minute)
+	l.SetFailOpen("a:1", true)
+	w.Allow("a:1")
+	if w.Allow("a:1") {
+		t.Fatal("expected the calendar window quota to be spent")
+	}
+	l.Block("a:1", time.Minute)
+
+	// every key storing a:1's state is deleted, so its quota starts over
+	if err := l.ResetGroup("a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range s.Keys() {
+		if strings.HasPrefix(key, "test:a:1") {
+			t.Errorf("expected the key to be deleted with a:1: %q", key)
+		}
+	}
+	if !w.Allow("a:1") {
+		t.Error("expected the calendar window quota to be reset")
+	}
+}
+
+func TestDisabledGroups(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.ResetGroup("a"); err != nil {
+		t.Error(err)
+	}
+	if err := l.BlockGroup("a", time.Minute); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,113 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// hysteresisKey returns the key marking the given key as denied until its
+// token bucket accrues the hysteresis tokens
+func hysteresisKey(key string) string {
+	return suffixedKey(key, "hysteresis")
+}
+
+// hysteresisScript marks a key as denied, expiring the mark once its token
+// bucket has refilled.
+//
+// KEYS[1] hysteresis key
+// ARGV[1] time to refill (milliseconds), zero if never refilled
+var hysteresisScript = newScript(1, `
+if tonumber(ARGV[1]) > 0 then
+	return redis.call("SET", KEYS[1], 1, "PX", ARGV[1])
+end
+return redis.call("SET", KEYS[1], 1)
+`)
+
+// recovered returns true if the given tokens are enough for the given number
+// of events while recovering from a denial, which requires the hysteresis
+// tokens on top of the minimum tokens, or a full bucket
+func recovered(tokens float64, n int, minTokens, hysteresis float64, burst int) bool {
+	return tokens >= math.Min(float64(n)+minTokens+hysteresis, float64(burst))
+}
+
+// recovering returns true if the given key was denied and its token bucket has
+// yet to recover enough tokens for the given number of events, along with the
+// bucket's tokens and whether the key was marked as denied
+func (l *redisLimiter) recovering(db backend, key string, n int, rate float64, burst int) (bool, float64, bool, error) {
+	if l.hysteresis <= 0 {
+		return false, 0, false, nil
+	}
+
+	denied, err := db.exists(hysteresisKey(key))
+	if err != nil || !denied {
+		return false, 0, false, err
+	}
+
+	b, ok, err := db.read(key, false)
+	if err != nil {
+		return false, 0, false, err
+	}
+	tokens := float64(burst)
+	if ok {
+		tokens = refill(b, l.now().Add(l.grace), l.interval, l.refillRate(rate), burst)
+	}
+	return !recovered(tokens, n, l.minTokens, l.hysteresis, burst), tokens, true, nil
+}
+
+// markDenied marks the given key as denied if its events were not allowed, or
+// removes its mark once they are, if hysteresis is enabled. Marks are best
+// effort so errors are ignored.
+func (l *redisLimiter) markDenied(db backend, key string, rate float64, burst int, allowed, denied bool) {
+	if l.hysteresis <= 0 {
+		return
+	}
+	if !allowed {
+		ttl := fieldTTL(l.refillRate(rate), burst, l.minTokens, l.interval)
+		db.eval(hysteresisScript, hysteresisKey(key), ttl.Milliseconds())
+		return
+	}
+	if denied {
+		db.del(hysteresisKey(key))
+	}
+}
+
+// recovering returns true if the given key was denied and its token bucket has
+// yet to recover enough tokens for the given number of events, along with the
+// bucket's tokens
+func (l *inMemoryLimiter) recovering(key string, n int, ratelimit float64, burst int, now time.Time) (bool, float64) {
+	if l.hysteresis <= 0 {
+		return false, 0
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if !l.flapping[key] {
+		return false, 0
+	}
+
+	tokens := float64(burst)
+	if l.pureGo {
+		tokens = l.tokens(key, l.refillRate(ratelimit), burst, now)
+	} else if limiter, ok := l.limiters[key]; ok {
+		tokens = limiterTokens(limiter, now)
+	}
+	return !recovered(tokens, n, l.minTokens, l.hysteresis, burst), tokens
+}
+
+// markDenied marks the given key as denied if its events were not allowed, or
+// removes its mark once they are, if hysteresis is enabled
+func (l *inMemoryLimiter) markDenied(key string, allowed bool) {
+	if l.hysteresis <= 0 {
+		return
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if allowed {
+		delete(l.flapping, key)
+	} else {
+		l.flapping[key] = true
+	}
+}
@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestHysteresis(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		// decisions returns the decisions for two events a second, twice the
+		// rate limit, once the burst is taken
+		decisions := func(hysteresis float64) []bool {
+			s.FlushAll()
+			config.RateLimit = 1
+			config.BurstLimit = 4
+			config.Hysteresis = hysteresis
+			l := New(config)
+
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			switch l := l.(type) {
+			case *redisLimiter:
+				l.now = func() time.Time { return now }
+			case *inMemoryLimiter:
+				l.now = func() time.Time { return now }
+			}
+
+			l.AllowN("foo", 4)
+			var decisions []bool
+			for i := 0; i < 12; i++ {
+				now = now.Add(time.Second)
+				decisions = append(decisions, l.Allow("foo"), l.Allow("foo"))
+			}
+			return decisions
+		}
+
+		// transitions counts the changes between allowing and denying
+		transitions := func(decisions []bool) int {
+			n := 0
+			for i := 1; i < len(decisions); i++ {
+				if decisions[i] != decisions[i-1] {
+					n++
+				}
+			}
+			return n
+		}
+
+		flapping := decisions(0)
+		if n := transitions(flapping); n != len(flapping)-1 {
+			t.Errorf("%s: expected to flap without hysteresis: %v", name, flapping)
+		}
+
+		// a denied key waits for 2 tokens beyond the event, then is allowed
+		// until its bucket is empty again
+		smoothed := decisions(2)
+		expected := []bool{
+			true, false, false, false, false, false,
+			true, true, true, true, true, false,
+		}
+		for i, allowed := range expected {
+			if smoothed[i] != allowed {
+				t.Fatalf("%s: expected %v with hysteresis: %v", name, expected, smoothed[:len(expected)])
+			}
+		}
+		if n := transitions(smoothed); n*3 > transitions(flapping) {
+			t.Errorf("%s: expected hysteresis to smooth transitions: %v", name, smoothed)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"golang.org/x/time/rate"
+)
+
+// ErrKeyNotFound is returned when a key does not have a token bucket
+var ErrKeyNotFound = errors.New("limiter: key not found")
+
+// scanCount is the number of keys requested per Redis SCAN
+const scanCount = 100
+
+// BucketState is a point-in-time snapshot of a key's token bucket
+type BucketState struct {
+	// Tokens is the number of tokens in the bucket as of LastUpdate
+	Tokens float64
+	// LastUpdate is the last time tokens were added to the bucket
+	LastUpdate time.Time
+	// State is the state stored alongside the bucket by SetState
+	State string
+}
+
+// bucketState returns the BucketState of a token bucket read from Redis
+func bucketState(b bucket) BucketState {
+	return BucketState{
+		Tokens:     b.tokens,
+		LastUpdate: time.Unix(b.last, 0),
+		State:      b.state,
+	}
+}
+
+// restorer is implemented by limiters that can overwrite a key's token bucket
+// with a BucketState
+type restorer interface {
+	restore(ctx context.Context, key string, state BucketState) error
+}
+
+// scan returns the next cursor and batch of keys with the configured
+// KeyPrefix starting from the given cursor
+func (l *redisLimiter) scan(c redis.Conn, cursor int) (int, []string, error) {
+	args := []interface{}{cursor}
+	if l.keyLength.prefix != "" {
+		args = append(args, "MATCH", escapeGlob(l.keyLength.prefix)+"*")
+	}
+
+	resp, err := redis.Values(c.Do("SCAN", append(args, "COUNT", scanCount)...))
+	if err != nil {
+		return 0, nil, err
+	}
+	var batch []string
+	if _, err := redis.Scan(resp, &cursor, &batch); err != nil {
+		return 0, nil, err
+	}
+	return cursor, batch, nil
+}
+
+// escapeGlob escapes the characters of the given string special to Redis
+// glob-style patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isBucketKey returns true if the given stored key has the given prefix and
+// holds the token bucket of an ID rather than per-key state
+func isBucketKey(prefix, key string) bool {
+	return strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], keySeparator)
+}
+
+// layoutType returns the Redis type of keys holding token buckets
+func (l *redisLimiter) layoutType() string {
+	switch l.layout {
+	case LayoutHash:
+		return "hash"
+	case LayoutString:
+		return "string"
+	}
+	return "list"
+}
+
+// Keys returns the keys of all token buckets by scanning the Redis database for
+// keys of the configured StorageLayout's type. The keys storing per-key state,
+// such as blocks, overflow buckets, stats and calendar window counts, along
+// with the token buckets of children and fields, are not listed. Only keys
+// with the configured KeyPrefix are listed, without the prefix.
+func (l *redisLimiter) Keys(ctx context.Context) ([]string, error) {
+	c, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var keys []string
+	cursor := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var batch []string
+		cursor, batch, err = l.scan(c, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		// pipeline the type of each key in the batch
+		for _, key := range batch {
+			c.Send("TYPE", key)
+		}
+		if err := c.Flush(); err != nil {
+			return nil, err
+		}
+		for _, key := range batch {
+			t, err := redis.String(c.Receive())
+			if err != nil {
+				return nil, err
+			}
+			if t == l.layoutType() && isBucketKey(l.keyLength.prefix, key) {
+				keys = append(keys, l.keyLength.id(key))
+			}
+		}
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// Inspect returns the state of the given key's token bucket as stored in
+// Redis, ErrKeyNotFound if the key does not exist
+func (l *redisLimiter) Inspect(ctx context.Context, key string) (BucketState, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return BucketState{}, err
+	}
+
+	c, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return BucketState{}, err
+	}
+	defer c.Close()
+
+	b, ok, err := l.storage.read(c, key, true)
+	if err != nil {
+		return BucketState{}, err
+	}
+	if !ok {
+		return BucketState{}, ErrKeyNotFound
+	}
+	return bucketState(b), nil
+}
+
+// restore overwrites the given key's token bucket with the given state
+func (l *redisLimiter) restore(ctx context.Context, key string, state BucketState) error {
+	return l.restoreTTL(ctx, key, state, 0)
+}
+
+// restoreTTL overwrites the given key's token bucket with the given state which
+// expires after the given TTL, if positive
+func (l *redisLimiter) restoreTTL(ctx context.Context, key string, state BucketState, ttl time.Duration) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	c.Send("MULTI")
+	c.Send("DEL", key)
+	if err := l.storage.create(c, key, bucket{
+		tokens: state.Tokens,
+		last:   state.LastUpdate.Unix(),
+		state:  state.State,
+	}); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		c.Send("PEXPIRE", key, ttl.Milliseconds())
+	}
+	return exec(c)
+}
+
+// Keys returns the keys of all token buckets, those of a Namespace only
+// returning its own keys
+func (l *inMemoryLimiter) Keys(ctx context.Context) ([]string, error) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	var keys []string
+	if l.pureGo {
+		for key := range l.buckets {
+			if isBucketKey(l.keyLength.prefix, key) {
+				keys = append(keys, l.keyLength.id(key))
+			}
+		}
+	} else {
+		for key := range l.limiters {
+			if isBucketKey(l.keyLength.prefix, key) {
+				keys = append(keys, l.keyLength.id(key))
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Inspect returns the state of the given key's token bucket, ErrKeyNotFound if
+// the key does not exist. Unless using PureGo, rate.Limiter does not expose
+// when tokens were last added so the state is as of the current interval.
+func (l *inMemoryLimiter) Inspect(ctx context.Context, key string) (BucketState, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return BucketState{}, err
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.expired(key) {
+		return BucketState{}, ErrKeyNotFound
+	}
+
+	if l.pureGo {
+		b, ok := l.buckets[key]
+		if !ok {
+			return BucketState{}, ErrKeyNotFound
+		}
+		b.state = l.states[key]
+		return bucketState(b), nil
+	}
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		return BucketState{}, ErrKeyNotFound
+	}
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+	return BucketState{
+		Tokens:     limiterTokens(limiter, now),
+		LastUpdate: now,
+		State:      l.states[key],
+	}, nil
+}
+
+// restore overwrites the given key's token bucket with the given state. Unless
+// using PureGo, rate.Limiter can only be drawn down by whole tokens so
+// fractional tokens are dropped.
+func (l *inMemoryLimiter) restore(ctx context.Context, key string, state BucketState) error {
+	return l.restoreTTL(ctx, key, state, 0)
+}
+
+// restoreTTL is like restore but the token bucket expires after the given TTL,
+// if positive
+func (l *inMemoryLimiter) restoreTTL(ctx context.Context, key string, state BucketState, ttl time.Duration) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	delete(l.expires, key)
+	if ttl > 0 {
+		l.expires[key] = l.now().Add(ttl)
+	}
+
+	if state.State != "" {
+		l.states[key] = state.State
+	}
+
+	if l.pureGo {
+		l.buckets[key] = bucket{tokens: state.Tokens, last: state.LastUpdate.Unix()}
+		return nil
+	}
+
+	// a new limiter starts full, draw it down to the restored tokens
+	limiter := rate.NewLimiter(rate.Limit(l.refillRate(l.rate)), l.burst)
+	if n := l.burst - int(state.Tokens); n > 0 {
+		limiter.ReserveN(state.LastUpdate, n)
+	}
+	l.limiters[key] = limiter
+	return nil
+}
+
+func (l *disabledLimiter) Keys(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (l *disabledLimiter) Inspect(ctx context.Context, key string) (BucketState, error) {
+	return BucketState{}, ErrKeyNotFound
+}
+
+func (l *disabledLimiter) restore(ctx context.Context, key string, state BucketState) error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisKeys(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "SCAN", []interface{}{0, "COUNT", scanCount}).Return(
+		[]interface{}{
+			[]byte("7"),
+			[]interface{}{[]byte("foo"), []byte("foo:1579064400")},
+		}, nil,
+	).Once()
+	m.On("Do", "SCAN", []interface{}{7, "COUNT", scanCount}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]interface{}{[]byte("bar")},
+		}, nil,
+	).Once()
+	m.On("Do", "TYPE", []interface{}{"foo"}).Return("list", nil).Once()
+	m.On("Do", "TYPE", []interface{}{"foo:1579064400"}).Return("string", nil).Once()
+	m.On("Do", "TYPE", []interface{}{"bar"}).Return("list", nil).Once()
+
+	keys, err := l.Keys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[foo bar]" {
+		t.Errorf("expected keys [foo bar]: %v", keys)
+	}
+}
+
+func TestRedisKeysPerKeyState(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		s.FlushAll()
+		l := New(Config{
+			Type:          TypeRedis,
+			Address:       s.Addr(),
+			RateLimit:     1,
+			BurstLimit:    1,
+			Interval:      time.Hour,
+			StorageLayout: layout,
+			OverflowRate:  1,
+			OverflowBurst: 1,
+			StatsWindow:   time.Hour,
+			UsageWindow:   time.Hour,
+			GroupFunc:     func(id string) string { return "group" },
+		})
+
+		// the second event is drawn from the overflow bucket
+		l.AllowN("foo", 1)
+		l.AllowN("foo", 1)
+		l.AllowChild("foo", "child", 1)
+		l.AllowField("foo", "field", 1)
+		l.Block("foo", time.Minute)
+		l.Allow("bar")
+
+		keys, err := l.Keys(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(keys)
+		if fmt.Sprint(keys) != "[bar foo]" {
+			t.Errorf("layout %d: expected only the token buckets: %q", layout, keys)
+		}
+	}
+}
+
+func TestRedisKeysError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "SCAN", []interface{}{0, "COUNT", scanCount}).Return(
+		nil, errors.New("not good"),
+	).Once()
+
+	if _, err := l.Keys(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRedisInspect(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return(
+		[]interface{}{[]byte("1.5"), []byte("100"), []byte("pro")}, nil,
+	).Once()
+
+	state, err := l.Inspect(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := BucketState{Tokens: 1.5, LastUpdate: time.Unix(100, 0), State: "pro"}
+	if state != expected {
+		t.Errorf("expected state %+v: %+v", expected, state)
+	}
+}
+
+func TestRedisInspectNotFound(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return([]interface{}{}, nil).Once()
+
+	if _, err := l.Inspect(context.Background(), key); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound: %v", err)
+	}
+}
+
+func TestInMemoryInspect(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 4,
+			Interval:   time.Hour,
+			PureGo:     pureGo,
+		})
+		ctx := context.Background()
+
+		l.AllowN("foo", 3)
+		l.Allow("bar")
+		l.SetState("bar", "pro")
+
+		keys, err := l.Keys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(keys)
+		if fmt.Sprint(keys) != "[bar foo]" {
+			t.Errorf("expected keys [bar foo]: %v", keys)
+		}
+
+		state, err := l.Inspect(ctx, "bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Tokens != 3 || state.State != "pro" {
+			t.Errorf("expected bar to have 3 tokens and state pro: %+v", state)
+		}
+
+		if _, err := l.Inspect(ctx, "baz"); err != ErrKeyNotFound {
+			t.Errorf("expected ErrKeyNotFound: %v", err)
+		}
+	}
+}
+
+func TestDisabledInspect(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	ctx := context.Background()
+
+	if keys, err := l.Keys(ctx); len(keys) != 0 || err != nil {
+		t.Errorf("expected no keys: %v", keys)
+	}
+	if _, err := l.Inspect(ctx, "foo"); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func (l *redisLimiter) AllowNDynamicInterval(key string, n int, rate float64, burst int, interval time.Duration) bool {
+	return l.withInterval(interval).allowDynamic(key, n, rate, burst)
+}
+
+// withInterval returns a copy of the limiter sharing its storage which rate
+// limits on the given interval
+func (l *redisLimiter) withInterval(interval time.Duration) *redisLimiter {
+	c := *l
+	c.interval = interval
+	return &c
+}
+
+func (l *inMemoryLimiter) AllowNDynamicInterval(key string, n int, ratelimit float64, burst int, interval time.Duration) bool {
+	ratelimit, burst, err := l.dynamic.limits(ratelimit, burst)
+	if err != nil {
+		l.counts.record(n, false, err)
+		return false
+	}
+
+	// rate.Limiters add tokens per second, their limits are updated in place
+	// so a key's tokens carry over when its interval changes
+	if !l.pureGo {
+		ratelimit /= interval.Seconds()
+	}
+	return l.withInterval(interval).allowN(key, n, ratelimit, burst)
+}
+
+// withInterval returns a copy of the limiter sharing its storage which rate
+// limits on the given interval
+func (l *inMemoryLimiter) withInterval(interval time.Duration) *inMemoryLimiter {
+	c := *l
+	c.interval = interval
+	return &c
+}
+
+func (l *disabledLimiter) AllowNDynamicInterval(key string, n int, rate float64, burst int, interval time.Duration) bool {
+	return true
+}
+
+// intervalKey returns the key storing the interval set for the given key by
+// SetInterval
+func intervalKey(key string) string {
+	return suffixedKey(key, "interval")
+}
+
+// SetInterval stores the interval the given key is rate limited on, RateLimit
+// tokens being added per interval. Stored intervals are only read when
+// Config.KeyIntervals is set. A non-positive interval removes the key's
+// interval.
+func (l *redisLimiter) SetInterval(key string, interval time.Duration) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	if interval <= 0 {
+		_, err = c.Do("DEL", intervalKey(key))
+		return err
+	}
+	_, err = c.Do("SET", intervalKey(key), interval.Milliseconds())
+	return err
+}
+
+// keyed returns a copy of the limiter with the limits of the active scheduled
+// window, rate limiting on the interval stored for the given key, or the
+// limiter itself if neither applies. Errors fall back to the limiter itself
+// since they surface when the key's bucket is read.
+func (l *redisLimiter) keyed(key string) *redisLimiter {
+	l = l.scheduled()
+	if !l.keyIntervals {
+		return l
+	}
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return l
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	ms, err := redis.Int64(c.Do("GET", intervalKey(key)))
+	if err != nil || ms <= 0 {
+		return l
+	}
+
+	// the stored interval has been read
+	k := l.withInterval(time.Duration(ms) * time.Millisecond)
+	k.keyIntervals = false
+	return k
+}
+
+func (l *inMemoryLimiter) SetInterval(key string, interval time.Duration) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if interval <= 0 {
+		delete(l.intervals, key)
+		return nil
+	}
+	l.intervals[key] = interval
+	return nil
+}
+
+func (l *inMemoryLimiter) keyed(key string) *inMemoryLimiter {
+	l = l.scheduled()
+	if !l.keyIntervals {
+		return l
+	}
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return l
+	}
+
+	l.mux.RLock()
+	interval, ok := l.intervals[key]
+	l.mux.RUnlock()
+	if !ok {
+		return l
+	}
+
+	// the stored interval has been read
+	k := l.withInterval(interval)
+	k.keyIntervals = false
+
+	// rate.Limiters add tokens per second
+	if !l.pureGo {
+		k.rate /= interval.Seconds()
+	}
+	return k
+}
+
+func (l *disabledLimiter) SetInterval(key string, interval time.Duration) error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func testAllowNDynamicInterval(t *testing.T, l Limiter, clock *time.Time) {
+	// 5 per minute
+	for i := 0; i < 5; i++ {
+		if !l.AllowNDynamicInterval("minute", 1, 5, 5, time.Minute) {
+			t.Fatalf("expected to allow event %d", i)
+		}
+	}
+	if l.AllowNDynamicInterval("minute", 1, 5, 5, time.Minute) {
+		t.Error("expected to not allow more than 5 events per minute")
+	}
+
+	// 1 per second
+	if !l.AllowNDynamicInterval("second", 1, 1, 1, time.Second) {
+		t.Fatal("expected to allow event")
+	}
+	if l.AllowNDynamicInterval("second", 1, 1, 1, time.Second) {
+		t.Error("expected to not allow more than 1 event per second")
+	}
+
+	*clock = clock.Add(time.Second)
+	if !l.AllowNDynamicInterval("second", 1, 1, 1, time.Second) {
+		t.Error("expected to allow event after a second")
+	}
+	if l.AllowNDynamicInterval("minute", 1, 5, 5, time.Minute) {
+		t.Error("expected to not allow event before a minute")
+	}
+
+	*clock = clock.Add(time.Minute)
+	if !l.AllowNDynamicInterval("minute", 5, 5, 5, time.Minute) {
+		t.Error("expected to allow 5 events after a minute")
+	}
+}
+
+func TestRedisAllowNDynamicInterval(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  10,
+		BurstLimit: 10,
+	}).(*redisLimiter)
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return clock }
+	testAllowNDynamicInterval(t, l, &clock)
+}
+
+func TestInMemoryAllowNDynamicInterval(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  10,
+			BurstLimit: 10,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+
+		clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		l.now = func() time.Time { return clock }
+		testAllowNDynamicInterval(t, l, &clock)
+	}
+}
+
+func TestDisabledAllowNDynamicInterval(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if !l.AllowNDynamicInterval("foo", 1, 0, 0, time.Minute) {
+		t.Error("expected disabled limiter to allow")
+	}
+}
+
+func TestKeyIntervals(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.KeyIntervals = true
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		// one per second by default, one per ten seconds for slow
+		if err := l.SetInterval("slow", 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if !l.Allow("fast") || !l.Allow("slow") {
+			t.Fatalf("%s: expected to allow the first events", name)
+		}
+		if l.Allow("fast") || l.Allow("slow") {
+			t.Fatalf("%s: expected to deny events once the buckets are empty", name)
+		}
+		if d, _ := l.RetryAfter("slow", 1); d <= time.Second {
+			t.Errorf("%s: expected slow to retry after more than a second: %v", name, d)
+		}
+
+		now = now.Add(time.Second)
+		if !l.Allow("fast") {
+			t.Errorf("%s: expected fast to be replenished after a second", name)
+		}
+		if l.Allow("slow") {
+			t.Errorf("%s: expected slow to not be replenished after a second", name)
+		}
+
+		now = now.Add(9 * time.Second)
+		if !l.Allow("slow") {
+			t.Errorf("%s: expected slow to be replenished after ten seconds", name)
+		}
+
+		// removing the interval restores the default
+		if err := l.SetInterval("slow", 0); err != nil {
+			t.Fatal(err)
+		}
+		if d, _ := l.RetryAfter("slow", 1); d > time.Second {
+			t.Errorf("%s: expected slow to retry within a second: %v", name, d)
+		}
+	}
+}
+
+func TestKeyIntervalsDisabled(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, PureGo: true}).(*inMemoryLimiter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	l.SetInterval("slow", time.Hour)
+	l.Allow("slow")
+	now = now.Add(time.Second)
+	if !l.Allow("slow") {
+		t.Error("expected stored intervals to be ignored without KeyIntervals")
+	}
+}
@@ -0,0 +1,96 @@
+package limiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrKeyTooLong is returned when a key is longer than the configured maximum
+// key length and keys are not hashed. Methods which do not return an error do
+// not allow events for such keys.
+var ErrKeyTooLong = errors.New("limiter: key too long")
+
+// ErrReservedKey is returned when a key or label contains keySeparator, which
+// is reserved for the keys storing per-key state. Methods which do not return
+// an error do not allow events for such keys.
+var ErrReservedKey = errors.New("limiter: key contains a reserved separator")
+
+// keySeparator separates a key from the suffix of the keys storing per-key
+// state alongside its token bucket. Keys may not contain it so the keys
+// storing per-key state never collide with a token bucket.
+const keySeparator = "\x00"
+
+// suffixedKey returns the key storing the per-key state with the given suffix
+// of the given key
+func suffixedKey(key, suffix string) string {
+	return key + keySeparator + suffix
+}
+
+// defaultMaxKeyLength is the maximum key length when not configured
+const defaultMaxKeyLength = 512
+
+// keyLength enforces the configured maximum key length and prefixes keys with
+// the configured key prefix after encoding them with the configured encoder
+type keyLength struct {
+	max     int
+	hash    bool
+	prefix  string
+	encoder KeyEncoder
+	// labeled permits keySeparator in keys built by labeledKey, which checks
+	// the ID and labels for it instead
+	labeled bool
+}
+
+// key returns the given key encoded if it is not longer than the maximum key
+// length, otherwise its SHA-256 hex digest if hashing is enabled or
+// ErrKeyTooLong. A negative maximum disables the check. Keys containing
+// keySeparator return ErrReservedKey unless labeled. The returned key is
+// prefixed.
+func (k keyLength) key(key string) (string, error) {
+	if k.encoder != nil {
+		key = k.encoder.Encode(key)
+	}
+	if !k.labeled && strings.Contains(key, keySeparator) {
+		return "", ErrReservedKey
+	}
+	if k.max < 0 || len(key) <= k.max {
+		return k.prefix + key, nil
+	}
+	if !k.hash {
+		return "", ErrKeyTooLong
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return k.prefix + hex.EncodeToString(sum[:]), nil
+}
+
+// id returns the ID stored at the given key, without the key prefix and
+// decoded. Keys which do not decode, such as hashed keys or the keys storing
+// per-key state, are returned without the prefix.
+func (k keyLength) id(key string) string {
+	key = strings.TrimPrefix(key, k.prefix)
+	if k.encoder == nil {
+		return key
+	}
+	if id, err := k.encoder.Decode(key); err == nil {
+		return id
+	}
+	return key
+}
+
+// childKeys returns the given parent and child keys after enforcing the maximum
+// key length on each. Only the parent is prefixed since child keys are scoped
+// to their parent.
+func (k keyLength) childKeys(parent, child string) (string, string, error) {
+	parent, err := k.key(parent)
+	if err != nil {
+		return "", "", err
+	}
+	child, err = keyLength{max: k.max, hash: k.hash, encoder: k.encoder}.key(child)
+	if err != nil {
+		return "", "", err
+	}
+	return parent, child, nil
+}
@@ -0,0 +1,135 @@
+package limiter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestKeyLength(t *testing.T) {
+	under := strings.Repeat("a", defaultMaxKeyLength)
+	over := strings.Repeat("a", defaultMaxKeyLength+1)
+	sum := sha256.Sum256([]byte(over))
+	digest := hex.EncodeToString(sum[:])
+
+	for _, tc := range []struct {
+		keyLength keyLength
+		key       string
+		expected  string
+		err       error
+	}{
+		{keyLength{max: defaultMaxKeyLength}, under, under, nil},
+		{keyLength{max: defaultMaxKeyLength}, over, "", ErrKeyTooLong},
+		{keyLength{max: defaultMaxKeyLength, hash: true}, under, under, nil},
+		{keyLength{max: defaultMaxKeyLength, hash: true}, over, digest, nil},
+		{keyLength{max: -1}, over, over, nil},
+		{keyLength{max: defaultMaxKeyLength}, "a" + keySeparator + "b", "", ErrReservedKey},
+		{keyLength{max: defaultMaxKeyLength, encoder: Base64KeyEncoder{}}, keySeparator, "AA", nil},
+	} {
+		key, err := tc.keyLength.key(tc.key)
+		if key != tc.expected || err != tc.err {
+			t.Errorf("expected %d long key to be %.8s, %v: %.8s, %v", len(tc.key), tc.expected, tc.err, key, err)
+		}
+	}
+}
+
+func TestRedisKeyTooLong(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.failOpen = true
+	key := strings.Repeat("a", defaultMaxKeyLength+1)
+
+	// redis is not called for keys which are too long
+	if l.Allow(key) {
+		t.Error("expected to not allow a key which is too long")
+	}
+	if _, err := l.Tokens(key); err != ErrKeyTooLong {
+		t.Errorf("expected ErrKeyTooLong: %v", err)
+	}
+	if _, _, err := l.AllowChildReason("foo", key, 1); err != ErrKeyTooLong {
+		t.Errorf("expected ErrKeyTooLong: %v", err)
+	}
+}
+
+func TestRedisHashKeys(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.keyLength.hash = true
+	key := strings.Repeat("a", defaultMaxKeyLength+1)
+	sum := sha256.Sum256([]byte(key))
+
+	m.On("Do", "LRANGE", []interface{}{hex.EncodeToString(sum[:]), 0, 1}).Return(
+		[]interface{}{}, nil,
+	).Once()
+
+	if tokens, err := l.Tokens(key); err != nil || tokens != float64(l.burst) {
+		t.Errorf("expected %v tokens: %v, %v", l.burst, tokens, err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestInMemoryMaxKeyLength(t *testing.T) {
+	for _, hash := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 1,
+			HashKeys:   hash,
+		})
+		under := strings.Repeat("a", defaultMaxKeyLength)
+		over := strings.Repeat("a", defaultMaxKeyLength+1)
+
+		if !l.Allow(under) {
+			t.Error("expected to allow a key at the maximum length")
+		}
+		if l.Allow(over) != hash {
+			t.Errorf("expected a key over the maximum length to be allowed only when hashed: %v", hash)
+		}
+
+		keys, _ := l.Keys(context.Background())
+		for _, key := range keys {
+			if len(key) > defaultMaxKeyLength {
+				t.Errorf("expected no key over the maximum length: %d", len(key))
+			}
+		}
+
+		if err := l.SetState(over, "bar"); hash != (err == nil) {
+			t.Errorf("expected SetState to fail only when not hashing: %v", err)
+		}
+	}
+}
+
+func TestRedisSuffixedKeysDoNotCollide(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+		GroupFunc:  func(id string) string { return "alice" },
+	})
+
+	// IDs which look like the keys storing another key's state are buckets
+	// of their own
+	if err := l.Block("alice", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"alice:blocked", "alice:members", "alice:b"} {
+		if !l.Allow(id) {
+			t.Errorf("expected to allow %s", id)
+		}
+	}
+	if l.Allow("alice") {
+		t.Error("expected to deny the blocked key")
+	}
+
+	if _, err := l.AllowWith("alice" + keySeparator + "blocked"); err != ErrReservedKey {
+		t.Errorf("expected IDs containing the separator to be rejected: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package limiter
+
+import "time"
+
+// LastSeen returns when the given key's token bucket was last updated,
+// truncated to the configured interval, or ErrKeyNotFound if the key does not
+// have a token bucket. Buckets are only updated when events are allowed.
+func (l *redisLimiter) LastSeen(key string) (time.Time, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	b, ok, err := db.read(key, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, ErrKeyNotFound
+	}
+	return time.Unix(b.last, 0), nil
+}
+
+// see records when the given key's rate.Limiter last allowed events since it
+// does not expose its last update time
+func (l *inMemoryLimiter) see(key string, now time.Time) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.seen[key] = now
+}
+
+func (l *inMemoryLimiter) LastSeen(key string) (time.Time, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.pureGo {
+		b, ok := l.buckets[key]
+		if !ok {
+			return time.Time{}, ErrKeyNotFound
+		}
+		return time.Unix(b.last, 0), nil
+	}
+
+	// a pruned limiter leaves its last seen time behind
+	seen, ok := l.seen[key]
+	if _, exists := l.limiters[key]; !ok || !exists {
+		return time.Time{}, ErrKeyNotFound
+	}
+	return seen, nil
+}
+
+func (l *disabledLimiter) LastSeen(key string) (time.Time, error) {
+	return time.Time{}, ErrKeyNotFound
+}
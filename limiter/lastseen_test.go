@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLastSeen(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		if _, err := l.LastSeen("foo"); err != ErrKeyNotFound {
+			t.Errorf("%s: expected ErrKeyNotFound: %v", name, err)
+		}
+
+		l.Allow("foo")
+		if seen, err := l.LastSeen("foo"); err != nil || !seen.Equal(now) {
+			t.Errorf("%s: expected to be seen at %v: %v %v", name, now, seen, err)
+		}
+
+		// denied events do not update the bucket
+		allowedAt := now.Add(5 * time.Second)
+		now = allowedAt
+		l.Allow("foo")
+		now = now.Add(500 * time.Millisecond)
+		if l.Allow("foo") {
+			t.Fatalf("%s: expected to deny within the interval", name)
+		}
+		if seen, err := l.LastSeen("foo"); err != nil || !seen.Equal(allowedAt) {
+			t.Errorf("%s: expected to be seen at the last allow %v: %v %v", name, allowedAt, seen, err)
+		}
+	}
+}
+
+func TestDisabledLastSeen(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if _, err := l.LastSeen("foo"); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// layered decides events against local estimates of Redis token buckets,
+// only deciding in Redis once an estimate is within a margin of the limit.
+// Events allowed locally are taken from Redis in the background every
+// reconcile interval, refreshing the estimate.
+type layered struct {
+	interval time.Duration
+	margin   float64
+
+	mux     sync.Mutex
+	buckets map[string]*localBucket
+	pending sync.WaitGroup
+
+	start   sync.Once
+	queue   chan reconciliation
+	running sync.WaitGroup
+	closed  bool
+}
+
+// reconcileQueueSize is how many reconciles are queued for the reconciler
+// before buckets wait for a later event to reconcile
+const reconcileQueueSize = 1024
+
+// reconciliation takes events allowed locally for a bucket from Redis
+type reconciliation struct {
+	bucket   *localBucket
+	unsynced int
+	now      time.Time
+	take     func(n int) (float64, error)
+}
+
+// localBucket is a local estimate of a key's token bucket in Redis
+type localBucket struct {
+	// tokens is the bucket's tokens when last read from Redis less the events
+	// allowed locally since
+	tokens float64
+	// unsynced is the number of events allowed locally not yet taken in Redis
+	unsynced int
+	synced   time.Time
+	syncing  bool
+}
+
+// newLayered returns a layered reconciling every given interval, nil if
+// every event should be decided by Redis
+func newLayered(interval time.Duration, margin float64) *layered {
+	if interval <= 0 {
+		return nil
+	}
+	return &layered{
+		interval: interval,
+		margin:   margin,
+		buckets:  map[string]*localBucket{},
+	}
+}
+
+// allow returns the decision for the given number of events for the given key
+// at the given time and whether it was made locally. Events leaving the key's
+// estimate at or above the margin are allowed locally, other events are decided
+// in Redis by the given decide function after the events allowed locally are
+// taken by the given take function. Both return the tokens remaining in Redis.
+func (s *layered) allow(key string, n int, now time.Time, decide func(n int) (bool, float64, error), take func(n int) (float64, error)) (bool, bool) {
+	s.mux.Lock()
+	b, ok := s.buckets[key]
+	if ok && b.tokens-float64(n) >= s.margin {
+		b.tokens -= float64(n)
+		b.unsynced += n
+		if !b.syncing && now.Sub(b.synced) >= s.interval {
+			s.reconcile(b, now, take)
+		}
+		s.mux.Unlock()
+		return true, true
+	}
+
+	unsynced := 0
+	if ok {
+		unsynced, b.unsynced = b.unsynced, 0
+	}
+	s.mux.Unlock()
+
+	// near the limit Redis decides, having seen every event allowed locally
+	if unsynced > 0 {
+		if _, err := take(unsynced); err != nil {
+			s.mux.Lock()
+			b.unsynced += unsynced
+			s.mux.Unlock()
+		}
+	}
+
+	allowed, remaining, err := decide(n)
+	if err != nil {
+		return allowed, false
+	}
+
+	s.mux.Lock()
+	if b, ok = s.buckets[key]; !ok {
+		b = &localBucket{}
+		s.buckets[key] = b
+	}
+	b.tokens = remaining - float64(b.unsynced)
+	b.synced = now
+	s.mux.Unlock()
+	return allowed, false
+}
+
+// reconcile queues taking the events allowed locally for the given bucket from
+// Redis in the background, refreshing its estimate. The bucket is left to
+// reconcile at a later event if the queue is full or closed. The caller must
+// hold the lock.
+func (s *layered) reconcile(b *localBucket, now time.Time, take func(n int) (float64, error)) {
+	if s.closed {
+		return
+	}
+	s.start.Do(s.run)
+
+	s.pending.Add(1)
+	select {
+	case s.queue <- reconciliation{bucket: b, unsynced: b.unsynced, now: now, take: take}:
+		b.unsynced = 0
+		b.syncing = true
+	default:
+		s.pending.Done()
+	}
+}
+
+// run creates the queue and starts the reconciler loop
+func (s *layered) run() {
+	s.queue = make(chan reconciliation, reconcileQueueSize)
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		for r := range s.queue {
+			s.sync(r)
+			s.pending.Done()
+		}
+	}()
+}
+
+// sync takes the given reconciliation's events from Redis and refreshes its
+// bucket's estimate
+func (s *layered) sync(r reconciliation) {
+	remaining, err := r.take(r.unsynced)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	b := r.bucket
+	b.syncing = false
+	if err != nil {
+		// try again at the next reconcile
+		b.unsynced += r.unsynced
+		return
+	}
+	b.tokens = remaining - float64(b.unsynced)
+	b.synced = r.now
+}
+
+// close stops queuing reconciles and waits for the reconciler to finish those
+// already queued
+func (s *layered) close() {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return
+	}
+	s.closed = true
+	if s.queue != nil {
+		close(s.queue)
+	}
+	s.mux.Unlock()
+
+	s.running.Wait()
+}
+
+// reset forgets every local estimate
+func (s *layered) reset() {
+	s.mux.Lock()
+	s.buckets = map[string]*localBucket{}
+	s.mux.Unlock()
+}
+
+// settle takes the given number of events allowed locally from the given key's
+// token bucket, into debt if need be, returning the tokens remaining
+func (l *redisLimiter) settle(key string, n int) (float64, error) {
+	if n > 0 {
+		if err := l.adjust(key, -float64(n)); err != nil {
+			return 0, err
+		}
+	}
+	return l.Tokens(key)
+}
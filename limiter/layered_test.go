@@ -0,0 +1,199 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newLayeredLimiter returns a Redis Limiter with local estimates at the given
+// address and a clock stopped at the given time
+func newLayeredLimiter(addr string, now *time.Time) *redisLimiter {
+	l := New(Config{
+		Type:              TypeRedis,
+		Address:           addr,
+		RateLimit:         1,
+		BurstLimit:        100,
+		Interval:          time.Hour,
+		ReconcileInterval: time.Minute,
+		LocalMargin:       20,
+	}).(*redisLimiter)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestRedisLayered(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLayeredLimiter(s.Addr(), &now)
+
+	allowed := 0
+	for i := 0; i < 150; i++ {
+		if l.Allow("foo") {
+			allowed++
+		}
+	}
+
+	// a single process never allows more than the limit
+	if allowed != 100 {
+		t.Errorf("expected to allow the burst: %d", allowed)
+	}
+	if tokens, _ := l.Tokens("foo"); tokens != 0 {
+		t.Errorf("expected Redis to have seen every event: %v", tokens)
+	}
+}
+
+func TestRedisLayeredCounted(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLayeredLimiter(s.Addr(), &now)
+	l.allowed = newThroughput(func() time.Time { return now })
+
+	for i := 0; i < 150; i++ {
+		l.Allow("foo")
+	}
+
+	// events allowed locally are counted alongside those decided in Redis
+	if allowed := atomic.LoadUint64(&l.counts.allowed); allowed != 100 {
+		t.Errorf("expected 100 allowed events to be counted: %d", allowed)
+	}
+	if denied := atomic.LoadUint64(&l.counts.denied); denied != 50 {
+		t.Errorf("expected 50 denied events to be counted: %d", denied)
+	}
+	if r := l.Throughput(); r != 10 {
+		t.Errorf("expected a throughput of 10: %v", r)
+	}
+}
+
+func TestRedisLayeredReconcile(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLayeredLimiter(s.Addr(), &now)
+
+	for i := 0; i < 11; i++ {
+		l.Allow("foo")
+	}
+
+	// only the first event went to Redis
+	if tokens, _ := l.Tokens("foo"); tokens != 99 {
+		t.Errorf("expected events to be allowed locally: %v", tokens)
+	}
+
+	// the first event after the reconcile interval reconciles in the background
+	now = now.Add(time.Minute)
+	l.Allow("foo")
+	l.layered.pending.Wait()
+
+	if tokens, _ := l.Tokens("foo"); tokens != 88 {
+		t.Errorf("expected the events allowed locally to be taken: %v", tokens)
+	}
+	if estimate := l.layered.buckets["foo"]; estimate.tokens != 88 || estimate.unsynced != 0 {
+		t.Errorf("expected the estimate to be refreshed: %+v", estimate)
+	}
+}
+
+func TestRedisLayeredOverAllow(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	processes := []*redisLimiter{
+		newLayeredLimiter(s.Addr(), &now),
+		newLayeredLimiter(s.Addr(), &now),
+		newLayeredLimiter(s.Addr(), &now),
+	}
+
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		if processes[i%len(processes)].Allow("foo") {
+			allowed++
+		}
+	}
+
+	// each other process allows at most the burst less the margin unseen
+	bound := 100 + (len(processes)-1)*(100-20)
+	if allowed < 100 || allowed > bound {
+		t.Errorf("expected to allow between %d and %d events: %d", 100, bound, allowed)
+	}
+}
+
+func TestRedisLayeredClose(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLayeredLimiter(s.Addr(), &now)
+
+	for i := 0; i < 11; i++ {
+		l.Allow("foo")
+	}
+	now = now.Add(time.Minute)
+	l.Allow("foo")
+
+	// the queued reconcile is finished before Close returns
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _ := l.Tokens("foo"); tokens != 88 {
+		t.Errorf("expected the queued reconcile to be finished: %v", tokens)
+	}
+
+	// events are still allowed locally but no longer reconciled
+	now = now.Add(time.Minute)
+	if !l.Allow("foo") {
+		t.Error("expected to allow the event locally")
+	}
+	if estimate := l.layered.buckets["foo"]; estimate.syncing || estimate.unsynced != 1 {
+		t.Errorf("expected the event to not be reconciled: %+v", estimate)
+	}
+}
+
+func TestLayeredQueueFull(t *testing.T) {
+	s := newLayered(time.Minute, 0)
+	s.start.Do(func() { s.queue = make(chan reconciliation, 1) })
+	take := func(n int) (float64, error) { return 0, nil }
+
+	a, b := &localBucket{unsynced: 1}, &localBucket{unsynced: 2}
+	s.mux.Lock()
+	s.reconcile(a, time.Now(), take)
+	s.reconcile(b, time.Now(), take)
+	s.mux.Unlock()
+
+	// the bucket not queued reconciles at a later event
+	if !a.syncing || a.unsynced != 0 {
+		t.Errorf("expected the first bucket to be queued: %+v", a)
+	}
+	if b.syncing || b.unsynced != 2 {
+		t.Errorf("expected the second bucket to wait for a later event: %+v", b)
+	}
+}
+
+func BenchmarkRedisAllow(b *testing.B) {
+	s := miniredis.RunT(b)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1e9,
+		BurstLimit: 1e9,
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Allow("foo")
+	}
+}
+
+func BenchmarkRedisLayered(b *testing.B) {
+	s := miniredis.RunT(b)
+	l := New(Config{
+		Type:              TypeRedis,
+		Address:           s.Addr(),
+		RateLimit:         1e9,
+		BurstLimit:        1e9,
+		ReconcileInterval: 100 * time.Millisecond,
+		LocalMargin:       1e6,
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Allow("foo")
+	}
+}
@@ -0,0 +1,23 @@
+package limiter
+
+import "time"
+
+// Limit is a rate limit of Rate tokens added every Interval to a token bucket
+// holding up to Burst tokens
+type Limit struct {
+	Rate     float64
+	Burst    int
+	Interval time.Duration
+}
+
+// Equal returns true if both limits have the same burst and add tokens at the
+// same rate per second, so 1 token per second equals 60 tokens per minute. A
+// zero interval is one second like New.
+func (l Limit) Equal(o Limit) bool {
+	return l.Burst == o.Burst && l.perSecond() == o.perSecond()
+}
+
+// perSecond returns the tokens added per second
+func (l Limit) perSecond() float64 {
+	return Config{RateLimit: l.Rate, Interval: l.Interval}.EffectiveQPS()
+}
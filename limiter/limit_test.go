@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitEqual(t *testing.T) {
+	for _, tc := range []struct {
+		a, b  Limit
+		equal bool
+	}{
+		{Limit{1, 2, time.Second}, Limit{1, 2, time.Second}, true},
+		{Limit{1, 2, time.Second}, Limit{60, 2, time.Minute}, true},
+		{Limit{1, 2, 0}, Limit{1, 2, time.Second}, true},
+		{Limit{0, 2, time.Second}, Limit{0, 2, time.Hour}, true},
+		{Limit{1, 2, time.Second}, Limit{2, 2, time.Second}, false},
+		{Limit{1, 2, time.Second}, Limit{1, 3, time.Second}, false},
+		{Limit{1, 2, time.Second}, Limit{1, 2, time.Minute}, false},
+	} {
+		if equal := tc.a.Equal(tc.b); equal != tc.equal {
+			t.Errorf("expected %v equal to %v to be %v", tc.a, tc.b, tc.equal)
+		}
+		if equal := tc.b.Equal(tc.a); equal != tc.equal {
+			t.Errorf("expected %v equal to %v to be %v", tc.b, tc.a, tc.equal)
+		}
+	}
+}
+
+func TestInMemoryLimiterUnchanged(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 2,
+	}).(*inMemoryLimiter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if !l.limiter("foo", 1, 2, now).AllowN(now, 2) {
+		t.Fatal("expected to allow the burst")
+	}
+
+	// setting the limits of a rate.Limiter at an earlier time rewinds its last
+	// update, so an unchanged limit must not be set again
+	limiter := l.limiter("foo", 1, 2, now.Add(-time.Second))
+	if tokens := limiterTokens(limiter, now); tokens != 0 {
+		t.Errorf("expected unchanged limits to not be set: %v", tokens)
+	}
+
+	// changed limits are still set
+	limiter = l.limiter("foo", 2, 3, now)
+	if limiter.Limit() != 2 || limiter.Burst() != 3 {
+		t.Errorf("expected the changed limits to be set: %v %v", limiter.Limit(), limiter.Burst())
+	}
+}
@@ -1,6 +1,9 @@
 package limiter
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
 	"math"
 	"sync"
 	"time"
@@ -15,8 +18,14 @@ const (
 	TypeRedis Type = iota << 1
 	TypeInMemory
 	TypeDisabled
+	// TypeBlockAll denies every event, a kill switch for incidents
+	TypeBlockAll
 )
 
+// defaultMaxIdle is how many idle Redis connections the pool keeps when
+// Config.MaxIdle is not set
+const defaultMaxIdle = 8
+
 // Limiter defines a rate limiter interface
 type Limiter interface {
 	// Allow returns true if an event may happen for the given ID
@@ -34,11 +43,227 @@ type Limiter interface {
 	// the given ID taking into consideration the given rate and burst limits
 	AllowNDynamic(id string, n int, rate float64, burst int) bool
 
+	// AllowWith returns true if the events described by the given options may
+	// happen for the given ID, composing the variants above in one call
+	AllowWith(id string, opts ...Option) (bool, error)
+
+	// AllowIf returns true if the given number of events may happen for the
+	// given ID and its bucket holds at least expectMin tokens, taking them
+	// only then
+	AllowIf(id string, n int, expectMin float64) (bool, error)
+
+	// Check decides the given number of events for the given ID and returns
+	// the Decision, with the tokens remaining and how long to retry after
+	Check(id string, n int) (Decision, error)
+
+	// AllowStream decides an event for each ID received from the given
+	// channel, emitting the decisions in order until the IDs are closed or the
+	// context is done
+	AllowStream(ctx context.Context, ids <-chan string) <-chan Decision
+
+	// AllowAll decides an event for each of the given IDs at once and returns
+	// their decisions by ID
+	AllowAll(ids []string) (map[string]Decision, error)
+
+	// AllowNDynamicInterval returns true if the given number of events may
+	// happen for the given ID taking into consideration the given rate limit
+	// in queries per the given interval and burst limit
+	AllowNDynamicInterval(id string, n int, rate float64, burst int, interval time.Duration) bool
+
+	// AllowAtTick returns true if the given number of events may happen for
+	// the given ID at the given tick of a caller controlled logical clock,
+	// refilling RateLimit tokens per tick
+	AllowAtTick(id string, tick uint64, n int) bool
+
+	// AllowSeq returns true if the given number of events may happen for the
+	// given ID, applying each sequence number at most once
+	AllowSeq(id string, seq uint64, n int) (bool, error)
+
+	// AllowAsync returns immediately, allowing the given number of events for
+	// the given ID unless it is estimated to be out of tokens while deciding
+	// the events in the background
+	AllowAsync(id string, n int) bool
+
+	// AllowSometimes returns true for the first events for the given ID in
+	// each interval and then for every Mth event, for sampling log output
+	AllowSometimes(id string, first, every int, interval time.Duration) bool
+
+	// SetInterval stores the interval the given ID is rate limited on, read
+	// when Config.KeyIntervals is set
+	SetInterval(id string, interval time.Duration) error
+
+	// SetFailOpen stores an override of FailOpen for the given ID, read when
+	// Config.KeyFailOpen is set
+	SetFailOpen(id string, failOpen bool) error
+
+	// ClearFailOpen removes the given ID's FailOpen override
+	ClearFailOpen(id string) error
+
 	// Rate returns the default rate limit
 	Rate() float64
 
 	// Burst returns the default burst limit
 	Burst() int
+
+	// BackendType returns the Type of the Limiter's backend
+	BackendType() Type
+
+	// FailOpenMode returns true if events are allowed when the Limiter's
+	// backend fails
+	FailOpenMode() bool
+
+	// AllowChild returns true if the given number of events may happen for the
+	// given child ID taking into consideration both the child's weighted share
+	// and the parent's quota
+	AllowChild(parent, child string, n int) (bool, error)
+
+	// AllowChildReason is like AllowChild but also returns the Reason
+	// identifying which token bucket denied the events
+	AllowChildReason(parent, child string, n int) (bool, Reason, error)
+
+	// GlobalAllow returns true if the given number of events may happen
+	// across all IDs, limited by a single global token bucket
+	GlobalAllow(n int) (bool, error)
+
+	// AllowField returns true if the given number of events may happen for the
+	// given field of the given ID, whose fields' token buckets are stored
+	// together
+	AllowField(id, field string, n int) (bool, error)
+
+	// AllowWithState returns true if the given number of events may happen for
+	// the given ID along with the state stored next to the ID's token bucket
+	AllowWithState(id string, n int) (allowed bool, state string, err error)
+
+	// SetState stores the given state next to the given ID's token bucket
+	SetState(id, state string) error
+
+	// Keys returns the IDs of all token buckets
+	Keys(ctx context.Context) ([]string, error)
+
+	// Inspect returns the state of the given ID's token bucket
+	Inspect(ctx context.Context, id string) (BucketState, error)
+
+	// Seed writes the given ID's token bucket with the given tokens and last
+	// update time, returning ErrTokensExceedBurst if tokens exceed the burst
+	// limit
+	Seed(id string, tokens float64, lastUpdate time.Time) error
+
+	// SeedWithTTL is like Seed but the token bucket, along with the state
+	// stored next to it, expires after the given TTL
+	SeedWithTTL(id string, tokens float64, lastUpdate time.Time, ttl time.Duration) error
+
+	// LastSeen returns when the given ID's token bucket was last updated,
+	// ErrKeyNotFound if it does not exist
+	LastSeen(id string) (time.Time, error)
+
+	// ResetGroup removes the token buckets and other per-key state of every
+	// ID in the given group
+	ResetGroup(group string) error
+
+	// BlockGroup blocks every ID in the given group for the given duration
+	BlockGroup(group string, d time.Duration) error
+
+	// Block denies all events for the given ID for the given duration
+	// regardless of its tokens
+	Block(id string, d time.Duration) error
+
+	// Unblock removes a block set by Block from the given ID
+	Unblock(id string) error
+
+	// Throughput returns the number of events allowed per second across all
+	// IDs
+	Throughput() float64
+
+	// Saturation returns the mean fraction of the burst limit used by a random
+	// sample of at most the given number of token buckets, every bucket if it
+	// is not positive
+	Saturation(ctx context.Context, sampleKeys int) (float64, error)
+
+	// Tokens returns the number of tokens in the given ID's token bucket
+	Tokens(id string) (float64, error)
+
+	// TokensAt returns the number of tokens the given ID's token bucket will
+	// have at the given time if no events happen until then
+	TokensAt(id string, t time.Time) (float64, error)
+
+	// Exists returns true if the given ID has a token bucket, distinguishing a
+	// full bucket from one never created
+	Exists(id string) (bool, error)
+
+	// Stats returns the number of events allowed and denied for the given ID
+	// since its counts were last reset, zero unless Config.Stats is set
+	Stats(id string) (allowed, denied uint64, err error)
+
+	// Usage returns the number of events allowed for the given ID per usage
+	// window started within the given span, keyed by the window's start
+	Usage(id string, span time.Duration) (map[time.Time]uint64, error)
+
+	// Transfer atomically moves the given number of tokens from one ID's token
+	// bucket to another's, capped at the destination's burst limit, returning
+	// ErrInsufficientTokens if the source does not have enough tokens
+	Transfer(from, to string, n int) error
+
+	// AllowNWithRemaining returns true if the given number of events may
+	// happen for the given ID along with the tokens remaining in its token
+	// bucket after the events
+	AllowNWithRemaining(id string, n int) (allowed bool, remaining float64, err error)
+
+	// CheckOnly returns true if the given number of events may happen for the
+	// given ID along with the tokens remaining in its token bucket without
+	// consuming tokens or creating the token bucket
+	CheckOnly(id string, n int) (allowed bool, remaining float64, err error)
+
+	// Wait blocks until an event may happen for the given ID
+	Wait(ctx context.Context, id string) error
+
+	// WaitN blocks until the given number of events may happen for the given
+	// ID
+	WaitN(ctx context.Context, id string, n int) error
+
+	// AllowWithin returns true once the given number of events may happen for
+	// the given ID, waiting up to maxWait, or false without waiting if the
+	// tokens would not be added in time
+	AllowWithin(id string, n int, maxWait time.Duration) (bool, error)
+
+	// Begin reserves a token for the given ID returning functions to commit
+	// the actual number of tokens used or abort and refund the reservation
+	Begin(id string) (commit func(n int) error, abort func())
+
+	// BeginN reserves the given number of tokens for the given ID returning
+	// functions to commit the actual number of tokens used or abort and refund
+	// the reservation
+	BeginN(id string, n int) (commit func(n int) error, abort func())
+
+	// RetryAfter returns how long until the given number of events may happen
+	// for the given ID
+	RetryAfter(id string, n int) (time.Duration, error)
+
+	// WriteMetrics writes the total events allowed, denied, and errored, and
+	// the number of active keys in Prometheus text exposition format
+	WriteMetrics(w io.Writer) error
+
+	// WriteOpenMetrics writes the metrics of WriteMetrics in OpenMetrics text
+	// format with an exemplar of the latest denial on the denied counter
+	WriteOpenMetrics(w io.Writer) error
+
+	// DeniedExemplar attaches the given Exemplar of the given number of
+	// denied events to the denied events counter
+	DeniedExemplar(n int, e Exemplar)
+
+	// ResetAll removes every token bucket and all other per-key state
+	ResetAll(ctx context.Context) error
+
+	// Dump writes a human readable table of every token bucket to the given
+	// writer
+	Dump(ctx context.Context, w io.Writer) error
+
+	// InspectJSON returns a JSON array of the state of the given IDs' token
+	// buckets
+	InspectJSON(ctx context.Context, ids []string) ([]byte, error)
+
+	// Close stops the Limiter's background work, waiting for the decisions
+	// already queued to be made
+	Close() error
 }
 
 // Config defines a struct passed to New to configure a Limiter
@@ -47,60 +272,611 @@ type Config struct {
 	Type Type
 	// Address defines the Redis server address
 	Address string
+	// URL defines the Redis server as a redis:// URL, or a rediss:// URL to
+	// connect with TLS, which may include a password and database number. It
+	// is used in place of Address, only one of them may be set.
+	URL string
+	// UseTLS determines if connections to Address use TLS
+	UseTLS bool
+	// TLSConfig defines the TLS configuration of connections using TLS
+	TLSConfig *tls.Config `json:"-"`
+	// TLSSkipVerify disables verifying the Redis server's certificate on
+	// connections using TLS
+	TLSSkipVerify bool
+	// DialFunc, when set, establishes connections to the Redis server in place
+	// of dialing Address, for example through a tunnel or proxy. Connections
+	// are still paired with SecondaryAddress.
+	DialFunc func(ctx context.Context) (redis.Conn, error) `json:"-"`
+	// SecondaryAddress defines a second Redis server which token bucket
+	// updates are also written to, for example while migrating between Redis
+	// servers. Reads are served by Address alone and errors writing to the
+	// secondary server are ignored.
+	SecondaryAddress string
 	// RateLimit defines the rate limit in queries per Interval
 	RateLimit float64
-	// BurstLimit defines the burst limit or bucket size of the Limiter
+	// BurstLimit defines the burst limit or bucket size of the Limiter,
+	// defaults to RateLimit rounded up and at least 1
 	BurstLimit int
+	// BurstMultiplier computes a zero BurstLimit as RateLimit times the
+	// multiplier rounded up, for example 3 allows bursts of 3 intervals of
+	// events. Only one of BurstLimit and BurstMultiplier may be set.
+	BurstMultiplier float64
 	// Interval defines the token refresh rate of RateLimit tokens per Interval
 	Interval time.Duration
+	// BoundaryGrace counts events arriving within the grace of the next
+	// interval boundary as the next interval, so jitter just before a
+	// boundary does not miss its tokens. Zero truncates times to the interval.
+	BoundaryGrace time.Duration
 	// FailOpen determines if Allow should return true on Redis server errors
 	FailOpen bool
+	// ConnMaxIdleCheck defines how long a pooled Redis connection may be idle
+	// before it is checked with a PING when borrowed, defaults to one minute
+	ConnMaxIdleCheck time.Duration
+	// MaxIdle defines how many idle Redis connections the pool keeps for
+	// reuse, defaults to 8. A negative value keeps none so connections are
+	// closed after each use.
+	MaxIdle int
+	// EagerConnect determines if Open should dial and PING Redis before
+	// returning so an unreachable address is caught at startup rather than on
+	// the first call to Allow
+	EagerConnect bool
+	// MinTokens defines the floor a token bucket may be drawn down to, a
+	// negative value allows keys to go into debt which is repaid as tokens are
+	// added to the bucket
+	MinTokens float64
+	// CalendarWindow limits keys to RateLimit queries per calendar day, week,
+	// or month rather than on a rolling Interval
+	CalendarWindow CalendarWindow
+	// Location defines the time zone of calendar windows and the Schedule,
+	// defaults to UTC
+	Location *time.Location `json:"-"`
+	// Schedule overrides the default limits during daily windows, the first
+	// window containing the current time applies. Allow, AllowN,
+	// AllowNWithRemaining, Tokens, RetryAfter, and Wait use the schedule.
+	Schedule []Window
+	// StorageLayout defines how token buckets are stored in Redis, defaults to
+	// LayoutList
+	StorageLayout StorageLayout
+	// TimeFormat defines how the last update time of token buckets is stored
+	// in Redis, defaults to TimeUnix. Token math is unaffected, buckets are
+	// refilled per interval elapsed since the last update in whole seconds.
+	TimeFormat TimeFormat
+	// TokenPrecision defines the number of decimal places tokens are rounded
+	// to before they are stored so fractional rates do not accumulate drift,
+	// defaults to 6 and a negative value stores tokens unrounded
+	TokenPrecision int
+	// OverflowBurst defines the size of a separate token bucket drawn from when
+	// a key's token bucket is empty, zero disables the overflow bucket. A
+	// bucket and its overflow bucket are decided in one transaction, retried
+	// like OptimisticRetries, or 3 times without them.
+	OverflowBurst int
+	// OverflowRate defines the rate limit of the overflow bucket in queries per
+	// Interval
+	OverflowRate float64
+	// PureGo determines if the in-memory Limiter should use the same token
+	// bucket math as the Redis Limiter rather than golang.org/x/time/rate
+	PureGo bool
+	// NoRefill disables adding tokens to token buckets so each key has a fixed
+	// quota of BurstLimit events which is never replenished
+	NoRefill bool
+	// PruneFullBuckets deletes token buckets found to be full rather than
+	// rewriting them since a full bucket is indistinguishable from a missing
+	// one, state stored alongside a pruned bucket is discarded
+	PruneFullBuckets bool
+	// IdleTimeout deletes in-memory token buckets which have not been updated
+	// for this long, swept at most once per IdleTimeout as events are
+	// decided. Zero keeps idle token buckets.
+	IdleTimeout time.Duration
+	// OptimisticRetries enables optimistic locking of token buckets in Redis,
+	// so concurrent events cannot both take the same tokens, without
+	// scripts. Each bucket is watched while it is read and written in a
+	// transaction, retried up to this many times if the bucket was modified
+	// in between before failing with ErrConflict. Zero writes buckets without
+	// locking.
+	OptimisticRetries int
+	// KeyPrefix defines a prefix added to every key the Redis Limiter stores,
+	// scoping Keys and ResetAll to the Limiter's own keys
+	KeyPrefix string
+	// KeyEncoder encodes IDs before they are stored, and Keys decodes them,
+	// defaults to IdentityKeyEncoder. Base64KeyEncoder keeps IDs with spaces,
+	// colons, or other unsafe bytes from confusing Redis tooling.
+	KeyEncoder KeyEncoder `json:"-"`
+	// MaxKeyLength defines the maximum length of an ID, defaults to 512 and a
+	// negative value disables the check
+	MaxKeyLength int
+	// HashKeys determines if IDs longer than MaxKeyLength are replaced by
+	// their SHA-256 digest rather than rejected with ErrKeyTooLong
+	HashKeys bool
+	// AllowList defines keys which are always allowed without consulting
+	// their token buckets. Entries ending in * match by prefix and entries
+	// containing *, ?, or [ elsewhere are glob patterns.
+	AllowList []string
+	// DenyList defines keys which are never allowed, matched like AllowList
+	// and taking precedence over it
+	DenyList []string
+	// Backoff shapes how long Wait sleeps before retrying a denied event,
+	// defaults to sleeping until enough tokens are added to the bucket
+	Backoff Backoff `json:"-"`
+	// ClientCache determines if token buckets read from Redis are cached in
+	// memory until Redis reports they were modified, using client side caching
+	// on Redis 6 or later. Buckets modified elsewhere may be read stale until
+	// their invalidation message is received.
+	ClientCache bool
+	// Stats determines if the number of events allowed and denied for each key
+	// are counted for Stats, off by default to avoid extra writes
+	Stats bool
+	// StatsWindow defines how long counts are kept before they are reset,
+	// defaults to an hour
+	StatsWindow time.Duration
+	// SampleRate defines the fraction, between 0 and 1, of events for which
+	// the Redis Limiter consults Redis. Each sampled event takes tokens for the
+	// events it stands in for, up to the burst limit, and the events between
+	// samples follow the key's last sampled outcome. This trades accuracy for
+	// fewer round trips: limits are enforced in steps of 1/SampleRate events
+	// and a key is only throttled or released once sampled. Zero disables
+	// sampling.
+	SampleRate float64
+	// ReconcileInterval enables deciding most events of the Redis Limiter
+	// against local estimates of token buckets, going to Redis only when an
+	// estimate is within LocalMargin tokens of the limit. Events allowed
+	// locally are taken from Redis, and estimates refreshed, in the background
+	// every ReconcileInterval. Each process may allow up to BurstLimit minus
+	// LocalMargin events per key beyond what other processes have taken, and
+	// blocks and resets apply once reconciled. Zero disables local estimates.
+	ReconcileInterval time.Duration
+	// LocalMargin defines how many tokens an estimate must keep for events to
+	// be allowed locally when ReconcileInterval is set
+	LocalMargin float64
+	// WarmUp defines how long a new key's rate and burst limits take to scale
+	// linearly from WarmUpFloor to their full values, zero disables warm up.
+	// It applies to token buckets rather than calendar windows, and a pruned
+	// bucket warms up again.
+	WarmUp time.Duration
+	// WarmUpFloor defines the fraction of the rate and burst limits in effect
+	// when a key is created
+	WarmUpFloor float64
+	// PenaltyQuiet enables penalizing keys which are repeatedly denied: each
+	// denial lowers a key's effective burst limit by one, down to
+	// PenaltyFloor, until the key goes PenaltyQuiet without being denied.
+	// Zero disables penalties.
+	PenaltyQuiet time.Duration
+	// PenaltyFloor defines the lowest effective burst limit of a penalized
+	// key, defaults to 1
+	PenaltyFloor int
+	// Hysteresis defines how many tokens beyond those an event takes a
+	// denied key's token bucket must accrue before the key is allowed again,
+	// so keys hovering at the limit are not alternately allowed and denied. A
+	// full bucket is always allowed. Zero disables hysteresis.
+	Hysteresis float64
+	// ColdStartRateFraction defines the fraction of the burst limit in-memory
+	// token buckets created right after the process starts begin with,
+	// converging linearly to a full bucket over ColdStartPeriod, so instances
+	// started together do not each allow a full burst. Zero starts buckets
+	// full.
+	ColdStartRateFraction float64
+	// ColdStartPeriod defines how long after the process starts new in-memory
+	// token buckets are partially filled, defaults to 10 seconds
+	ColdStartPeriod time.Duration
+	// FailoverThreshold enables switching the Redis Limiter to an in-memory
+	// fallback once this many consecutive events fail with Redis errors.
+	// While degraded Redis is probed every FailoverProbeInterval, switching
+	// back once it responds. Zero disables failover.
+	FailoverThreshold int
+	// FailoverProbeInterval defines how often Redis is probed while failed
+	// over, defaults to 5 seconds
+	FailoverProbeInterval time.Duration
+	// OnFailover is called when the Redis Limiter switches from one backend
+	// to the other, TypeRedis to TypeInMemory when failing over and back
+	OnFailover func(from, to Type) `json:"-"`
+	// UsageWindow enables counting the events allowed for each key per
+	// calendar window of this length in UTC, for example time.Hour, for usage
+	// reports read with Usage. Zero disables usage counts.
+	UsageWindow time.Duration
+	// UsageRetention defines how long usage windows are kept, defaults to 24
+	// windows
+	UsageRetention time.Duration
+	// MaxDynamicRate bounds the rate limits passed to the dynamic Allow
+	// methods, zero is unbounded
+	MaxDynamicRate float64
+	// MaxDynamicBurst bounds the burst limits passed to the dynamic Allow
+	// methods, zero is unbounded
+	MaxDynamicBurst int
+	// RejectDynamicOutOfBounds determines if events with negative or out of
+	// bounds dynamic limits are denied rather than having their limits clamped
+	RejectDynamicOutOfBounds bool
+	// KeyIntervals determines if intervals stored for keys by SetInterval are
+	// read, off by default to avoid an extra read per event. Keys with an
+	// interval add RateLimit tokens per their interval for Allow, AllowN,
+	// AllowNWithRemaining, Tokens, RetryAfter, and Wait.
+	KeyIntervals bool
+	// KeyFailOpen determines if FailOpen overrides stored for keys by
+	// SetFailOpen are read when Redis fails deciding their events, falling
+	// back to the overrides last known to the process if Redis cannot be read
+	KeyFailOpen bool
+	// GroupFunc returns the group of the given ID, empty for none, so
+	// ResetGroup and BlockGroup may act on every key in a group. Keys are
+	// added to their group when their token bucket is created.
+	GroupFunc func(id string) string `json:"-"`
+	// SoftBurst defines a soft burst limit below BurstLimit: allowed events
+	// whose key's consumption crosses it call OnSoftLimit, giving early
+	// warning before the key is throttled. Zero disables the soft limit.
+	SoftBurst int
+	// OnSoftLimit is called with the ID and remaining tokens when an allowed
+	// event takes its key's token bucket past SoftBurst
+	OnSoftLimit func(id string, remaining float64) `json:"-"`
+	// ObserveCost is called with the ID and tokens taken by each AllowWith
+	// call given WithCost, allowed or not, for example CostHistogram.Observe
+	ObserveCost func(id string, cost float64) `json:"-"`
+	// OnEvict is called with the ID and final state of each token bucket the
+	// in-memory Limiter evicts, for example to persist or log them. Buckets
+	// are evicted when full if PruneFullBuckets is enabled and when idle for
+	// longer than IdleTimeout. It is called in its own goroutine.
+	OnEvict func(id string, state BucketState) `json:"-"`
+	// MaxKeys caps how many distinct keys the Redis Limiter creates token
+	// buckets for, zero is unlimited. Keys are tracked in a sorted set when
+	// their buckets are created by Allow and its variants; keys deleted by
+	// Reset or pruned remain counted until evicted, and buckets created by
+	// scripts such as AllowChild and Transfer are not counted.
+	MaxKeys int
+	// MaxKeysPolicy determines if new keys are denied or the oldest keys are
+	// evicted once MaxKeys keys exist, defaults to KeysDeny
+	MaxKeysPolicy KeysPolicy
+	// ChildWeights defines the relative weights of child IDs sharing a parent
+	// ID's quota via AllowChild, children not present have a weight of 1
+	ChildWeights map[string]float64
+	// GlobalKey defines the ID of the single token bucket GlobalAllow limits
+	// events across all IDs with, defaults to "limiter:global"
+	GlobalKey string
+	// GlobalRateLimit defines the rate limit of the global token bucket in
+	// queries per Interval, defaults to RateLimit
+	GlobalRateLimit float64
+	// GlobalBurstLimit defines the burst limit of the global token bucket,
+	// defaults to BurstLimit
+	GlobalBurstLimit int
 }
 
 // redisLimiter uses redis for its storage
 type redisLimiter struct {
-	rate     float64
-	burst    int
-	interval time.Duration
-	failOpen bool
+	rate      float64
+	burst     int
+	interval  time.Duration
+	grace     time.Duration
+	failOpen  bool
+	minTokens float64
+	weights   map[string]float64
+	global    globalLimit
+	window    CalendarWindow
+	location  *time.Location
+	schedule  []Window
+	layout    StorageLayout
+	format    TimeFormat
+	noRefill  bool
+	pruneFull bool
+	backoff   Backoff
+	keyLength keyLength
+	lists     keyLists
+
+	dynamic dynamicBounds
+
+	// statsWindow is zero unless stats are enabled
+	statsWindow time.Duration
+
+	usage usageWindows
 
-	pool *redis.Pool
+	warmUpPeriod time.Duration
+	warmUpFloor  float64
+
+	penaltyQuiet time.Duration
+	penaltyFloor int
+
+	hysteresis float64
+
+	groupFunc func(id string) string
+
+	maxKeys    int
+	keysPolicy KeysPolicy
+
+	soft softLimit
+
+	// observeCost is nil unless Config.ObserveCost is set
+	observeCost func(id string, cost float64)
+
+	optimisticRetries int
+	// atomic decides events in transactions even without optimisticRetries
+	atomic bool
+
+	overflowRate  float64
+	overflowBurst int
+
+	precision tokenPrecision
+
+	pool    *redis.Pool
+	storage storage
+	// cache is nil unless Config.ClientCache is set
+	cache   *clientCache
+	sampler *sampler
+	layered *layered
+	async   *asyncEstimate
+	allowed *throughput
+	counts  *counters
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	// keyIntervals is true if intervals stored by SetInterval are read
+	keyIntervals bool
+
+	// failOpens is nil unless overrides stored by SetFailOpen are read
+	failOpens *keyFailOpens
+
+	// newBackend replaces pooled connections as the backend, for tests
+	newBackend func() backend
+
+	// failover is nil unless Config.FailoverThreshold is set
+	failover *failover
 }
 
 // inMemoryLimiter uses memory for its storage, useful for local development
 type inMemoryLimiter struct {
-	rate     float64
-	burst    int
-	interval time.Duration
+	rate      float64
+	burst     int
+	interval  time.Duration
+	grace     time.Duration
+	minTokens float64
+	weights   map[string]float64
+	global    globalLimit
+	window    CalendarWindow
+	location  *time.Location
+	schedule  []Window
+	noRefill  bool
+	pruneFull bool
+	backoff   Backoff
+	keyLength keyLength
+	lists     keyLists
+
+	dynamic dynamicBounds
+
+	// statsWindow is zero unless stats are enabled
+	statsWindow time.Duration
+
+	usage usageWindows
+
+	warmUpPeriod time.Duration
+	warmUpFloor  float64
+
+	penaltyQuiet time.Duration
+	penaltyFloor int
 
+	hysteresis float64
+
+	coldStart coldStart
+
+	groupFunc func(id string) string
+
+	soft softLimit
+
+	// observeCost is nil unless Config.ObserveCost is set
+	observeCost func(id string, cost float64)
+
+	onEvict func(id string, state BucketState)
+
+	overflowRate  float64
+	overflowBurst int
+
+	precision tokenPrecision
+
+	// keyIntervals is true if intervals stored by SetInterval are read
+	keyIntervals bool
+	intervals    map[string]time.Duration
+
+	// sweeper is nil unless Config.IdleTimeout is set
+	sweeper *sweeper
+
+	pureGo   bool
+	buckets  map[string]bucket
 	limiters map[string]*rate.Limiter
+	states   map[string]string
+	windows  map[string]*windowCount
+	blocks   map[string]time.Time
+	flapping map[string]bool
+	expires  map[string]time.Time
+	stats    map[string]*keyStats
+	usages   map[string]map[int64]uint64
+	created  map[string]time.Time
+	seen     map[string]time.Time
+	groups   map[string]map[string]bool
+	seqs     map[string]seqMark
 	mux      *sync.RWMutex
+	seqMux   *sync.Mutex
+	allowed  *throughput
+	counts   *counters
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
 }
 
 // disabledLimiter does not require storage, useful for unit tests
 type disabledLimiter struct{}
 
-// New creates a new redis limiter and returns an error if
-// redis is not available at the configured redis address
+// New creates a new Limiter, connections to Redis are made lazily on first use
 func New(config Config) Limiter {
 	// default to rate limiting on a per second interval
 	if config.Interval == 0 {
 		config.Interval = time.Second
 	}
 
+	// default to checking connections idle for longer than a minute
+	if config.ConnMaxIdleCheck == 0 {
+		config.ConnMaxIdleCheck = time.Minute
+	}
+
+	// default to keeping connections idle for reuse
+	if config.MaxIdle == 0 {
+		config.MaxIdle = defaultMaxIdle
+	} else if config.MaxIdle < 0 {
+		config.MaxIdle = 0
+	}
+
+	// default to calendar windows in UTC
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+
+	// default to sleeping until enough tokens are added
+	if config.Backoff == nil {
+		config.Backoff = NoJitter{}
+	}
+
+	// default to a bucket holding at least one event
+	config.BurstLimit = config.burstLimit()
+
+	// default to resetting stats hourly, zero disables them
+	if config.StatsWindow == 0 {
+		config.StatsWindow = defaultStatsWindow
+	}
+	if !config.Stats {
+		config.StatsWindow = 0
+	}
+
+	if config.MaxKeyLength == 0 {
+		config.MaxKeyLength = defaultMaxKeyLength
+	}
+
+	// default to storing IDs as they are
+	if config.KeyEncoder == nil {
+		config.KeyEncoder = IdentityKeyEncoder{}
+	}
+
+	if config.TokenPrecision == 0 {
+		config.TokenPrecision = defaultTokenPrecision
+	}
+
+	if config.PenaltyFloor == 0 {
+		config.PenaltyFloor = 1
+	}
+
+	if config.ColdStartPeriod == 0 {
+		config.ColdStartPeriod = defaultColdStartPeriod
+	}
+
+	// default to keeping a day of hourly usage windows
+	if config.UsageRetention == 0 {
+		config.UsageRetention = defaultUsageWindows * config.UsageWindow
+	}
+
+	if config.FailoverProbeInterval == 0 {
+		config.FailoverProbeInterval = defaultFailoverProbeInterval
+	}
+
+	if config.GlobalKey == "" {
+		config.GlobalKey = defaultGlobalKey
+	}
+	if config.GlobalRateLimit == 0 {
+		config.GlobalRateLimit = config.RateLimit
+	}
+	if config.GlobalBurstLimit == 0 {
+		config.GlobalBurstLimit = config.BurstLimit
+	}
+
 	switch config.Type {
 	case TypeRedis:
+		dial := func() (redis.Conn, error) {
+			if config.DialFunc != nil {
+				return config.DialFunc(context.Background())
+			}
+			options := []redis.DialOption{
+				redis.DialTLSConfig(config.TLSConfig),
+				redis.DialTLSSkipVerify(config.TLSSkipVerify),
+			}
+			if config.URL != "" {
+				return redis.DialURL(config.URL, options...)
+			}
+			return redis.Dial("tcp", config.Address, append(options, redis.DialUseTLS(config.UseTLS))...)
+		}
+
+		store := newStorage(config.StorageLayout, config.TimeFormat)
+		store = roundedStorage{storage: store, precision: tokenPrecision(config.TokenPrecision)}
+		var cache *clientCache
+		if config.ClientCache {
+			cache = newClientCache(dial, config.KeyPrefix)
+			store = cachedStorage{storage: store, cache: cache}
+		}
+
 		return &redisLimiter{
-			rate:     config.RateLimit,
-			burst:    config.BurstLimit,
-			interval: config.Interval,
-			failOpen: config.FailOpen,
+			rate:      config.RateLimit,
+			burst:     config.BurstLimit,
+			interval:  config.Interval,
+			grace:     config.BoundaryGrace,
+			failOpen:  config.FailOpen,
+			minTokens: config.MinTokens,
+			weights:   config.ChildWeights,
+			global:    globalLimit{key: config.GlobalKey, rate: config.GlobalRateLimit, burst: config.GlobalBurstLimit},
+			window:    config.CalendarWindow,
+			location:  config.Location,
+			schedule:  config.Schedule,
+			layout:    config.StorageLayout,
+			format:    config.TimeFormat,
+			noRefill:  config.NoRefill,
+			pruneFull: config.PruneFullBuckets,
+			backoff:   config.Backoff,
+			keyLength: keyLength{
+				max:     config.MaxKeyLength,
+				hash:    config.HashKeys,
+				prefix:  config.KeyPrefix,
+				encoder: config.KeyEncoder,
+			},
+			lists: keyLists{
+				allow: newKeyList(config.AllowList),
+				deny:  newKeyList(config.DenyList),
+			},
+			storage: store,
+			cache:   cache,
+			sampler: newSampler(config.SampleRate),
+			layered: newLayered(config.ReconcileInterval, config.LocalMargin),
+			async:   newAsyncEstimate(asyncWorkers, asyncQueueSize),
+			allowed: newThroughput(time.Now),
+			counts:  &counters{},
+			now:     time.Now,
+			sleep:   sleep,
+
+			overflowRate:  config.OverflowRate,
+			overflowBurst: config.OverflowBurst,
+			statsWindow:   config.StatsWindow,
+			warmUpPeriod:  config.WarmUp,
+			warmUpFloor:   config.WarmUpFloor,
+			penaltyQuiet:  config.PenaltyQuiet,
+			penaltyFloor:  config.PenaltyFloor,
+			hysteresis:    config.Hysteresis,
+			failover:      newFailover(config),
+			groupFunc:     config.GroupFunc,
+			maxKeys:       config.MaxKeys,
+			keysPolicy:    config.MaxKeysPolicy,
+			soft:          softLimit{burst: config.SoftBurst, hook: config.OnSoftLimit},
+			observeCost:   config.ObserveCost,
+			usage:         usageWindows{size: config.UsageWindow, retention: config.UsageRetention},
+			precision:     tokenPrecision(config.TokenPrecision),
+			keyIntervals:  config.KeyIntervals,
+			failOpens:     newKeyFailOpens(config.KeyFailOpen),
+
+			optimisticRetries: config.OptimisticRetries,
+			dynamic: dynamicBounds{
+				maxRate:  config.MaxDynamicRate,
+				maxBurst: config.MaxDynamicBurst,
+				reject:   config.RejectDynamicOutOfBounds,
+			},
+
 			pool: &redis.Pool{
 				Dial: func() (redis.Conn, error) {
-					return redis.Dial("tcp", config.Address)
+					c, err := dial()
+					if err != nil {
+						return nil, err
+					}
+					if config.SecondaryAddress == "" {
+						return c, nil
+					}
+					return newDualConn(c, dialSecondary(config.SecondaryAddress)), nil
 				},
+				MaxIdle: config.MaxIdle,
 				TestOnBorrow: func(c redis.Conn, t time.Time) error {
-					if time.Since(t) < time.Minute {
+					if time.Since(t) < config.ConnMaxIdleCheck {
 						return nil
 					}
 					_, err := c.Do("PING")
@@ -110,106 +886,442 @@ func New(config Config) Limiter {
 		}
 	case TypeInMemory:
 		return &inMemoryLimiter{
-			rate:     config.RateLimit,
-			burst:    int(config.BurstLimit),
-			interval: config.Interval,
+			rate:      config.RateLimit,
+			burst:     int(config.BurstLimit),
+			interval:  config.Interval,
+			grace:     config.BoundaryGrace,
+			minTokens: config.MinTokens,
+			weights:   config.ChildWeights,
+			global:    globalLimit{key: config.GlobalKey, rate: config.GlobalRateLimit, burst: config.GlobalBurstLimit},
+			window:    config.CalendarWindow,
+			location:  config.Location,
+			schedule:  config.Schedule,
+			noRefill:  config.NoRefill,
+			pruneFull: config.PruneFullBuckets,
+			backoff:   config.Backoff,
+			keyLength: keyLength{
+				max:     config.MaxKeyLength,
+				hash:    config.HashKeys,
+				encoder: config.KeyEncoder,
+			},
+			lists: keyLists{
+				allow: newKeyList(config.AllowList),
+				deny:  newKeyList(config.DenyList),
+			},
+			pureGo:   config.PureGo,
+			buckets:  make(map[string]bucket),
 			limiters: make(map[string]*rate.Limiter),
+			states:   make(map[string]string),
+			windows:  make(map[string]*windowCount),
+			blocks:   make(map[string]time.Time),
+			flapping: make(map[string]bool),
+			expires:  make(map[string]time.Time),
+			stats:    make(map[string]*keyStats),
+			usages:   make(map[string]map[int64]uint64),
+			created:  make(map[string]time.Time),
+			seen:     make(map[string]time.Time),
+			groups:   make(map[string]map[string]bool),
+			seqs:     make(map[string]seqMark),
 			mux:      &sync.RWMutex{},
+			seqMux:   &sync.Mutex{},
+			allowed:  newThroughput(time.Now),
+			counts:   &counters{},
+			now:      time.Now,
+			sleep:    sleep,
+
+			overflowRate:  config.OverflowRate,
+			overflowBurst: config.OverflowBurst,
+			statsWindow:   config.StatsWindow,
+			warmUpPeriod:  config.WarmUp,
+			warmUpFloor:   config.WarmUpFloor,
+			penaltyQuiet:  config.PenaltyQuiet,
+			penaltyFloor:  config.PenaltyFloor,
+			hysteresis:    config.Hysteresis,
+			groupFunc:     config.GroupFunc,
+			soft:          softLimit{burst: config.SoftBurst, hook: config.OnSoftLimit},
+			observeCost:   config.ObserveCost,
+			usage:         usageWindows{size: config.UsageWindow, retention: config.UsageRetention},
+			onEvict:       config.OnEvict,
+			precision:     tokenPrecision(config.TokenPrecision),
+			keyIntervals:  config.KeyIntervals,
+			intervals:     make(map[string]time.Duration),
+			dynamic: dynamicBounds{
+				maxRate:  config.MaxDynamicRate,
+				maxBurst: config.MaxDynamicBurst,
+				reject:   config.RejectDynamicOutOfBounds,
+			},
+			coldStart: coldStart{
+				started:  processStart,
+				period:   config.ColdStartPeriod,
+				fraction: config.ColdStartRateFraction,
+			},
+			sweeper: newSweeper(config.IdleTimeout),
 		}
 	case TypeDisabled:
 		return &disabledLimiter{}
+	case TypeBlockAll:
+		return &blockAllLimiter{}
 	}
 	return nil
 }
 
+// NewWithPool creates a new Redis Limiter around a pool the caller already
+// owns, rather than one New would create, so an application shares a single
+// pool. The Limiter does not close the pool. Other settings take the defaults
+// of New.
+func NewWithPool(pool *redis.Pool, rate float64, burst int, interval time.Duration, failOpen bool) Limiter {
+	l := New(Config{
+		Type:       TypeRedis,
+		RateLimit:  rate,
+		BurstLimit: burst,
+		Interval:   interval,
+		FailOpen:   failOpen,
+	}).(*redisLimiter)
+
+	// the pool New created has not dialed so there is nothing to close
+	l.pool = pool
+	return l
+}
+
+// Open creates a new Limiter like New but returns an error wrapping
+// ErrInvalidAddress, ErrInvalidURL or ErrInvalidTLS if a Redis Limiter's
+// connection settings are malformed, catching typos such as a missing port
+// before any traffic flows. If the config enables EagerConnect a Redis Limiter
+// also dials and PINGs the configured address and returns an error if Redis is
+// not available.
+func Open(config Config) (Limiter, error) {
+	if config.Type == TypeRedis {
+		if err := config.validateConnection(); err != nil {
+			return nil, err
+		}
+	}
+
+	l := New(config)
+
+	r, ok := l.(*redisLimiter)
+	if !ok || !config.EagerConnect {
+		return l, nil
+	}
+
+	if err := r.ping(context.Background()); err != nil {
+		r.pool.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
 // Allow returns true if the given key has not breached the global rate limit,
 // false otherwise. Tokens are added to the bucket based on the global burst
 // limit.
 func (l *redisLimiter) Allow(key string) bool {
-	return l.allowN(key, 1, l.rate, l.burst)
+	allowed, _ := l.AllowWith(key)
+	return allowed
 }
 
 func (l *redisLimiter) AllowN(key string, n int) bool {
-	return l.allowN(key, n, l.rate, l.burst)
+	allowed, _ := l.AllowWith(key, WithN(n))
+	return allowed
 }
 
 // AllowDynamic returns true if the given key has not breached the given rate
 // limit, false otherwise. Tokens are added to the bucket based on the given
 // burst limit.
 func (l *redisLimiter) AllowDynamic(key string, rate float64, burst int) bool {
-	return l.allowN(key, 1, rate, burst)
+	allowed, _ := l.AllowWith(key, WithRate(rate), WithBurst(burst))
+	return allowed
 }
 
 func (l *redisLimiter) AllowNDynamic(key string, n int, rate float64, burst int) bool {
-	return l.allowN(key, n, rate, burst)
+	allowed, _ := l.AllowWith(key, WithN(n), WithRate(rate), WithBurst(burst))
+	return allowed
 }
 
-// allow returns true if the given key has not breached its rate limit, false
-// otherwise. In redis, the key is a list of two elements: the first is an int
-// which represents the token bucket/count, the second is a unix timestamp
-// which represents the last time tokens were added to the bucket.
+// allowN returns true if the given key has not breached its rate limit, false
+// otherwise. Redis server errors result in the configured fail open behavior.
 func (l *redisLimiter) allowN(key string, n int, rate float64, burst int) bool {
-	c := l.pool.Get()
-	defer c.Close()
+	if l.layered != nil {
+		allowed, local := l.layered.allow(key, n, l.now(), func(n int) (bool, float64, error) {
+			return l.allowNRemaining(key, n, rate, burst)
+		}, func(n int) (float64, error) {
+			return l.settle(key, n)
+		})
+		// events decided in Redis are counted by allowNRemaining
+		if local {
+			l.counts.record(n, true, nil)
+			l.allowed.add(n)
+		}
+		return allowed
+	}
+
+	if l.sampler != nil {
+		return l.sampler.allow(key, n, burst, func(n int) bool {
+			allowed, _, _ := l.allowNRemaining(key, n, rate, burst)
+			return allowed
+		})
+	}
+
+	allowed, _, _ := l.allowNRemaining(key, n, rate, burst)
+	return allowed
+}
 
-	// get list of token bucket and last token bucket update
-	resp, err := redis.Values(c.Do("LRANGE", key, 0, 1))
+// allowNRemaining is like allowN but also returns the tokens remaining in the
+// key's bucket, or its calendar window, along with any error encountered
+func (l *redisLimiter) allowNRemaining(key string, n int, rate float64, burst int) (bool, float64, error) {
+	allowed, remaining, err := l.decide(key, n, rate, burst)
+	l.counts.record(n, allowed, err)
+	return allowed, remaining, err
+}
+
+// decide returns the outcome of allowNRemaining before it is counted, decided
+// by the in-memory fallback while Redis is failing if failover is enabled
+func (l *redisLimiter) decide(key string, n int, rate float64, burst int) (bool, float64, error) {
+	if l.failover == nil {
+		return l.decideRedis(key, n, rate, burst)
+	}
+	return l.failover.decide(l.now(), l.ping, func() (bool, float64, error) {
+		return l.decideRedis(key, n, rate, burst)
+	}, func() (bool, float64, error) {
+		return l.failover.fallback.decide(key, n, rate, burst)
+	})
+}
+
+// decideRedis returns the outcome of allowNRemaining decided by Redis
+func (l *redisLimiter) decideRedis(key string, n int, rate float64, burst int) (bool, float64, error) {
+	// listed keys do not touch redis
+	if decided, allowed := l.lists.check(key); decided {
+		return allowed, listedRemaining(allowed), nil
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	var allowed bool
+	var remaining float64
+	if l.window != WindowNone {
+		allowed, remaining, err = l.allowWindow(db, key, n, rate)
+	} else {
+		allowed, remaining, err = l.allowBucket(db, key, n, rate, burst)
+	}
+	if err == errBlocked {
+		// blocked keys are denied regardless of their tokens
+		l.count(db, key, false)
+		return false, 0, nil
+	}
 	if err != nil {
 		// fail open on redis error
-		return l.failOpen
+		return l.failMode(key, err), 0, err
+	}
+	if allowed {
+		l.allowed.add(n)
+		l.use(db, key, n)
+		if l.window == WindowNone {
+			l.soft.check(l.keyLength.id(key), n, burst, remaining)
+		}
+	}
+	l.count(db, key, allowed)
+	return allowed, remaining, nil
+}
+
+// listedRemaining returns the tokens reported for keys on the allow or deny
+// lists which do not have token buckets
+func listedRemaining(allowed bool) float64 {
+	if allowed {
+		return math.MaxFloat64
+	}
+	return 0
+}
+
+// allowBucket returns true if the given key's token bucket, with its limits
+// lowered while it warms up or is penalized, has enough tokens for the given
+// number of events, along with the tokens remaining
+func (l *redisLimiter) allowBucket(db backend, key string, n int, rate float64, burst int) (bool, float64, error) {
+	rate, burst, err := l.warmUp(db, key, rate, burst)
+	if err != nil {
+		return false, 0, err
+	}
+	if burst, err = l.penalty(db, key, burst); err != nil {
+		return false, 0, err
+	}
+
+	// a denied key is denied until it recovers the hysteresis tokens
+	recovering, tokens, denied, err := l.recovering(db, key, n, rate, burst)
+	if err != nil {
+		return false, 0, err
+	}
+	if recovering {
+		l.penalize(db, key)
+		return false, tokens, nil
+	}
+
+	allowed, b, err := l.take(db, key, n, rate, burst, false)
+	if err != nil {
+		return false, 0, err
+	}
+	if !allowed {
+		l.penalize(db, key)
+	}
+	l.markDenied(db, key, rate, burst, allowed, denied)
+	return allowed, b.tokens, nil
+}
+
+// take returns true if the given key has not breached its rate limit or may
+// draw from its overflow bucket, false otherwise, along with the key's bucket
+// after taking tokens. Decisions are retried with optimistic locking while the
+// key's buckets are modified concurrently.
+func (l *redisLimiter) take(db backend, key string, n int, rate float64, burst int, withState bool) (bool, bucket, error) {
+	for retries := 0; ; retries++ {
+		allowed, b, err := l.tryTake(db, key, n, rate, burst, withState)
+		if err != ErrConflict || retries >= l.retries() {
+			return allowed, b, err
+		}
+	}
+}
+
+// overflowKey returns the key of the overflow bucket of the given key
+func overflowKey(key string) string {
+	return suffixedKey(key, "overflow")
+}
+
+// tryTake makes a single attempt of take. The key's bucket is read along with
+// whether the key is blocked, and its overflow bucket only once the bucket is
+// empty. With optimistic locking all three are watched, so the one bucket
+// written is written only if none changed since they were read and the
+// bucket and overflow bucket are decided atomically. errBlocked is returned
+// if the key is blocked.
+func (l *redisLimiter) tryTake(db backend, key string, n int, rate float64, burst int, withState bool) (bool, bucket, error) {
+	if w, ok := db.(watchBackend); ok {
+		keys := []string{key, blockKey(key)}
+		if l.overflowBurst > 0 {
+			keys = append(keys, overflowKey(key))
+		}
+		if err := w.watch(keys...); err != nil {
+			return false, bucket{}, err
+		}
+	}
+
+	// get token bucket and last token bucket update, and whether the key is
+	// blocked in the same round trip
+	b, ok, blocked, err := db.readBlocked(key, withState)
+	if err != nil {
+		return false, bucket{}, err
+	}
+	if blocked {
+		return false, bucket{}, errBlocked
+	}
+
+	allowed, b, err := l.takeBucket(db, key, b, ok, n, rate, burst)
+	if err != nil || allowed || l.overflowBurst == 0 {
+		return allowed, b, err
+	}
+
+	// the bucket is empty, draw from the overflow bucket
+	o, ok, err := db.read(overflowKey(key), false)
+	if err != nil {
+		return false, bucket{}, err
+	}
+	allowed, _, err = l.takeBucket(db, overflowKey(key), o, ok, n, l.overflowRate, l.overflowBurst)
+	if err != nil {
+		return false, bucket{}, err
+	}
+	return allowed, b, nil
+}
+
+// takeBucket returns true if the given key has not breached its rate limit,
+// false otherwise, given the bucket read from the key and whether it exists.
+// In redis, the key holds two values: the first is an int which represents the
+// token bucket/count, the second is a unix timestamp which represents the last
+// time tokens were added to the bucket. How these are stored depends on the
+// configured StorageLayout. Optional state set by SetState is stored
+// alongside. The bucket is returned as written, or as read if the events are
+// not allowed.
+func (l *redisLimiter) takeBucket(db backend, key string, b bucket, ok bool, n int, rate float64, burst int) (bool, bucket, error) {
+	// a pruned bucket is recreated as if the key did not exist
+	if ok {
+		pruned, err := l.prune(db, key, refill(b, l.now().Add(l.grace), l.interval, l.refillRate(rate), burst), burst)
+		if err != nil {
+			return false, bucket{}, err
+		}
+		ok = !pruned
 	}
 
 	// if key doesn't exist, add it and return true
-	if len(resp) == 0 {
+	if !ok {
 		// truncate to rate limit on configured interval
-		now := time.Now().Truncate(l.interval).Unix()
-		_, err := redis.Int(c.Do("LPUSH", key, now, float64(burst-1)))
+		now := l.boundary().Unix()
+
+		// a new bucket starts full
+		b = bucket{tokens: float64(burst - n), last: now}
+		if b.tokens < l.minTokens {
+			return false, bucket{tokens: float64(burst), last: now}, nil
+		}
+
+		admitted, err := l.admit(db, key)
 		if err != nil {
-			// fail open on redis error
-			return l.failOpen
+			return false, bucket{}, err
+		}
+		if !admitted {
+			return false, bucket{last: now}, nil
 		}
-		return true
-	}
 
-	var tokens float64
-	var last int64
-	if _, err := redis.Scan(resp, &tokens, &last); err != nil {
-		// fail open on redis error
-		return l.failOpen
-	}
+		if err := l.join(db, key); err != nil {
+			return false, bucket{}, err
+		}
 
-	// calculate how many tokens to add to the bucket
-	// token allotment is the number of intervals since the last update time
-	// multiplied by the rate limit
-	since := time.Since(time.Unix(last, 0)).Truncate(l.interval)
-	allotment := float64(since*l.interval) * rate
+		if err := db.create(key, b); err != nil {
+			return false, bucket{}, err
+		}
+		return true, b, nil
+	}
 
-	// calculate how many tokens we have after allotment
-	// cannot have more than max bucket size tokens (burst)
-	tokens = math.Min(tokens+allotment, float64(burst))
+	// calculate how many tokens we have after allotment, rounded so drift in
+	// fractional allotments does not deny events
+	b.tokens = l.precision.round(refill(b, l.now().Add(l.grace), l.interval, l.refillRate(rate), burst))
 
 	// if we don't have tokens, return false
-	if tokens < float64(n) {
-		return false
+	// tokens may be drawn down to, but not beyond, the configured minimum
+	if b.tokens-float64(n) < l.minTokens {
+		return false, b, nil
 	}
 
 	// use tokens
-	tokens -= float64(n)
+	b.tokens -= float64(n)
 
 	// truncate to rate limit on configured interval
-	now := time.Now().Truncate(l.interval).Unix()
+	b.last = l.boundary().Unix()
 
 	// update the bucket and last update time
-	c.Send("MULTI")
-	c.Send("LSET", key, 0, tokens)
-	c.Send("LSET", key, 1, now)
-	_, err = c.Do("EXEC")
-	if err != nil {
-		// fail open on redis error
-		return l.failOpen
+	if err := db.update(key, b); err != nil {
+		return false, bucket{}, err
 	}
 
-	return true
+	return true, b, nil
+}
+
+// refill returns the tokens in the given bucket after allotting tokens for the
+// intervals elapsed since its last update
+func refill(b bucket, now time.Time, interval time.Duration, rate float64, burst int) float64 {
+	// calculate how many tokens to add to the bucket
+	// token allotment is the number of intervals since the last update time
+	// multiplied by the rate limit
+	since := now.Sub(time.Unix(b.last, 0)).Truncate(interval)
+	allotment := float64(since/interval) * rate
+
+	// cannot have more than max bucket size tokens (burst)
+	return math.Min(b.tokens+allotment, float64(burst))
+}
+
+// refillRate returns the rate tokens are added to token buckets, zero if token
+// buckets are never refilled
+func (l *redisLimiter) refillRate(rate float64) float64 {
+	if l.noRefill {
+		return 0
+	}
+	return rate
 }
 
 func (l *redisLimiter) Rate() float64 {
@@ -220,23 +1332,157 @@ func (l *redisLimiter) Burst() int {
 	return l.burst
 }
 
+func (l *redisLimiter) BackendType() Type {
+	return TypeRedis
+}
+
+// FailOpenMode returns the configured FailOpen
+func (l *redisLimiter) FailOpenMode() bool {
+	return l.failOpen
+}
+
 func (l *inMemoryLimiter) Allow(key string) bool {
-	return l.allowN(key, 1, l.rate, l.burst)
+	allowed, _ := l.AllowWith(key)
+	return allowed
 }
 
 func (l *inMemoryLimiter) AllowN(key string, n int) bool {
-	return l.allowN(key, n, l.rate, l.burst)
+	allowed, _ := l.AllowWith(key, WithN(n))
+	return allowed
 }
 
 func (l *inMemoryLimiter) AllowDynamic(key string, rate float64, burst int) bool {
-	return l.allowN(key, 1, rate, burst)
+	allowed, _ := l.AllowWith(key, WithRate(rate), WithBurst(burst))
+	return allowed
 }
 
 func (l *inMemoryLimiter) AllowNDynamic(key string, n int, rate float64, burst int) bool {
-	return l.allowN(key, n, rate, burst)
+	allowed, _ := l.AllowWith(key, WithN(n), WithRate(rate), WithBurst(burst))
+	return allowed
 }
 
 func (l *inMemoryLimiter) allowN(key string, n int, ratelimit float64, burst int) bool {
+	allowed, _, _ := l.allowNRemaining(key, n, ratelimit, burst)
+	return allowed
+}
+
+// allowNRemaining is like allowN but also returns the tokens remaining in the
+// key's bucket, or its calendar window
+func (l *inMemoryLimiter) allowNRemaining(key string, n int, ratelimit float64, burst int) (bool, float64, error) {
+	allowed, remaining, err := l.decide(key, n, ratelimit, burst)
+	l.counts.record(n, allowed, err)
+	return allowed, remaining, err
+}
+
+// decide returns the outcome of allowNRemaining before it is counted
+func (l *inMemoryLimiter) decide(key string, n int, ratelimit float64, burst int) (bool, float64, error) {
+	l.sweep()
+
+	if decided, allowed := l.lists.check(key); decided {
+		return allowed, listedRemaining(allowed), nil
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	l.join(key)
+
+	// blocked keys are denied regardless of their tokens
+	if l.blocked(key) {
+		l.count(key, false)
+		return false, 0, nil
+	}
+
+	if l.window != WindowNone {
+		allowed, remaining := l.allowWindow(key, n, ratelimit)
+		if allowed {
+			l.allowed.add(n)
+			l.use(key, n)
+		}
+		l.count(key, allowed)
+		return allowed, remaining, nil
+	}
+
+	// the soft limit is relative to the burst limit before warm up and
+	// penalties lower it
+	hard := burst
+	ratelimit, burst = l.warmUp(key, ratelimit, burst)
+	burst = l.penalty(key, burst)
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	// a denied key is denied until it recovers the hysteresis tokens
+	if recovering, tokens := l.recovering(key, n, ratelimit, burst, now); recovering {
+		l.penalize(key)
+		l.count(key, false)
+		return false, tokens, nil
+	}
+
+	// draw from the overflow bucket if the bucket is empty
+	allowed, remaining := l.take(key, n, ratelimit, burst, now)
+	if !allowed && l.overflowBurst > 0 {
+		allowed, _ = l.take(overflowKey(key), n, l.overflowRate, l.overflowBurst, now)
+	}
+	if !allowed {
+		l.penalize(key)
+	}
+	l.markDenied(key, allowed)
+	if allowed {
+		l.allowed.add(n)
+		l.use(key, n)
+		l.soft.check(l.keyLength.id(key), n, hard, remaining)
+	}
+	l.count(key, allowed)
+	return allowed, remaining, nil
+}
+
+// take returns true if the given key's rate.Limiter allows the given number of
+// events, going into debt down to the configured minimum tokens, along with
+// the tokens remaining after taking them
+func (l *inMemoryLimiter) take(key string, n int, ratelimit float64, burst int, now time.Time) (bool, float64) {
+	ratelimit = l.refillRate(ratelimit)
+	if l.pureGo {
+		return l.takeBucket(key, n, ratelimit, burst, now)
+	}
+
+	l.mux.RLock()
+	_, expiring := l.expires[key]
+	l.mux.RUnlock()
+	if l.pruneFull || expiring {
+		l.mux.Lock()
+		l.prune(key, ratelimit, burst, now)
+		l.mux.Unlock()
+	}
+
+	limiter := l.limiter(key, ratelimit, burst, now)
+	if l.minTokens == 0 {
+		allowed := limiter.AllowN(now, n)
+		if allowed {
+			l.see(key, now)
+		}
+		return allowed, limiterTokens(limiter, now)
+	}
+
+	// reserving tokens the limiter does not have puts it into debt, leaving
+	// negative tokens which are replenished before the next reservation
+	r := limiter.ReserveN(now, n)
+	if !r.OK() {
+		return false, limiterTokens(limiter, now)
+	}
+	if limiterTokens(limiter, now) < l.minTokens {
+		r.CancelAt(now)
+		return false, limiterTokens(limiter, now)
+	}
+	l.see(key, now)
+	return true, limiterTokens(limiter, now)
+}
+
+// limiter returns the rate.Limiter for the given key, creating it if it does
+// not exist and updating its limits if they differ from the given limits
+func (l *inMemoryLimiter) limiter(key string, ratelimit float64, burst int, now time.Time) *rate.Limiter {
 	l.mux.RLock()
 	limiter, ok := l.limiters[key]
 	l.mux.RUnlock()
@@ -246,23 +1492,42 @@ func (l *inMemoryLimiter) allowN(key string, n int, ratelimit float64, burst int
 		limiter, ok = l.limiters[key]
 		if !ok {
 			limiter = rate.NewLimiter(rate.Limit(ratelimit), burst)
+
+			// a cold starting process creates partially filled limiters
+			if empty := int(math.Round(float64(burst) - l.coldStart.fill(burst, l.now()))); empty > 0 {
+				limiter.ReserveN(now, empty)
+			}
 			l.limiters[key] = limiter
 		}
 		l.mux.Unlock()
 	}
 
-	// truncate to rate limit on configured interval
-	now := time.Now().Truncate(l.interval)
-
-	if limiter.Burst() != burst {
-		limiter.SetBurstAt(now, burst)
+	// rate.Limiters add tokens per second regardless of the interval
+	current := Limit{Rate: float64(limiter.Limit()), Burst: limiter.Burst()}
+	if current.Equal(Limit{Rate: ratelimit, Burst: burst}) {
+		return limiter
 	}
 
 	if limiter.Limit() != rate.Limit(ratelimit) {
 		limiter.SetLimitAt(now, rate.Limit(ratelimit))
 	}
 
-	return limiter.AllowN(now, n)
+	// a limiter without a rate limit draws down its burst rather than its
+	// tokens so its burst may only be lowered
+	if limiter.Burst() != burst && (limiter.Limit() != 0 || burst < limiter.Burst()) {
+		limiter.SetBurstAt(now, burst)
+	}
+
+	return limiter
+}
+
+// refillRate returns the rate tokens are added to token buckets, zero if token
+// buckets are never refilled
+func (l *inMemoryLimiter) refillRate(rate float64) float64 {
+	if l.noRefill {
+		return 0
+	}
+	return rate
 }
 
 func (l *inMemoryLimiter) Rate() float64 {
@@ -273,6 +1538,15 @@ func (l *inMemoryLimiter) Burst() int {
 	return l.burst
 }
 
+func (l *inMemoryLimiter) BackendType() Type {
+	return TypeInMemory
+}
+
+// FailOpenMode returns false as the in-memory Limiter's storage cannot fail
+func (l *inMemoryLimiter) FailOpenMode() bool {
+	return false
+}
+
 func (l *disabledLimiter) Allow(key string) bool {
 	return true
 }
@@ -296,3 +1570,12 @@ func (l *disabledLimiter) Rate() float64 {
 func (l *disabledLimiter) Burst() int {
 	return 0
 }
+
+func (l *disabledLimiter) BackendType() Type {
+	return TypeDisabled
+}
+
+// FailOpenMode returns true as the disabled limiter allows every event
+func (l *disabledLimiter) FailOpenMode() bool {
+	return true
+}
@@ -1,18 +1,34 @@
 package limiter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/garyburd/redigo/redis"
 	"github.com/stretchr/testify/mock"
 )
 
 type mockConn struct {
 	mock.Mock
+
+	// multi is true inside a transaction, whose commands are expected sent
+	multi bool
+	// pipelined holds the commands sent outside transactions, replied to on
+	// Receive by their expected Do so commands are expected the same whether
+	// they are pipelined or not
+	pipelined []mockCommand
+}
+
+// mockCommand is a command sent on a mockConn
+type mockCommand struct {
+	cmd  string
+	args []interface{}
 }
 
 func (m *mockConn) Close() error {
@@ -26,22 +42,36 @@ func (m *mockConn) Err() error {
 }
 
 func (m *mockConn) Do(cmd string, cmdArgs ...interface{}) (interface{}, error) {
+	if cmd == "EXEC" || cmd == "DISCARD" {
+		m.multi = false
+	}
 	args := m.Called(cmd, cmdArgs)
 	return args.Get(0), args.Error(1)
 }
 
 func (m *mockConn) Send(cmd string, cmdArgs ...interface{}) error {
+	if cmd == "MULTI" {
+		m.multi = true
+	}
+	if !m.multi {
+		m.pipelined = append(m.pipelined, mockCommand{cmd: cmd, args: cmdArgs})
+		return nil
+	}
 	args := m.Called(cmd, cmdArgs)
 	return args.Error(0)
 }
 
 func (m *mockConn) Flush() error {
-	args := m.Called()
-	return args.Error(0)
+	return nil
 }
 
 func (m *mockConn) Receive() (interface{}, error) {
-	args := m.Called()
+	if len(m.pipelined) == 0 {
+		return nil, errors.New("mock: no command sent")
+	}
+	c := m.pipelined[0]
+	m.pipelined = m.pipelined[1:]
+	args := m.MethodCalled("Do", c.cmd, c.args)
 	return args.Get(0), args.Error(1)
 }
 
@@ -51,6 +81,8 @@ func newMockRedisLimiter(m *mockConn) *redisLimiter {
 		RateLimit:  10,
 		BurstLimit: 20,
 		FailOpen:   false,
+		// close the connection after each use as expected below
+		MaxIdle: -1,
 	}).(*redisLimiter)
 
 	l.pool.Dial = func() (redis.Conn, error) {
@@ -60,6 +92,11 @@ func newMockRedisLimiter(m *mockConn) *redisLimiter {
 	m.On("Do", "", n).Return(nil, nil).Once()
 	m.On("Err").Return(nil).Once()
 	m.On("Close").Return(nil).Once()
+
+	// keys are not blocked unless a test expects otherwise
+	m.On("Do", "EXISTS", mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 1 && strings.HasSuffix(args[0].(string), blockKey(""))
+	})).Return(int64(0), nil).Maybe()
 	return l
 }
 
@@ -99,6 +136,38 @@ func TestRedisAllowNoKey(t *testing.T) {
 	}
 }
 
+func TestNewWithPool(t *testing.T) {
+	m := &mockConn{}
+	dialed := 0
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			dialed++
+			return m, nil
+		},
+	}
+	l := NewWithPool(pool, 1, 2, time.Minute, false)
+
+	if l.Rate() != 1 || l.Burst() != 2 || l.BackendType() != TypeRedis {
+		t.Errorf("expected a Redis limiter with the given limits: %v %v %v", l.Rate(), l.Burst(), l.BackendType())
+	}
+
+	var n []interface{} = nil
+	m.On("Do", "", n).Return(nil, nil).Once()
+	m.On("Err").Return(nil).Once()
+	m.On("Close").Return(nil).Once()
+	m.On("Do", "EXISTS", []interface{}{blockKey("foo")}).Return(int64(0), nil).Once()
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 1}).Return([]interface{}{}, nil).Once()
+	m.On("Do", "LPUSH", mock.Anything).Return(int64(2), nil).Once()
+
+	if !l.Allow("foo") {
+		t.Error("expected to allow key: foo")
+	}
+	if dialed != 1 {
+		t.Errorf("expected the given pool to dial once: %d", dialed)
+	}
+	m.AssertExpectations(t)
+}
+
 func TestRedisAllowAddTokens(t *testing.T) {
 	m := &mockConn{}
 	l := newMockRedisLimiter(m)
@@ -127,13 +196,49 @@ func TestRedisAllowAddTokens(t *testing.T) {
 		"Send", "LSET",
 		[]interface{}{key, 1, time.Now().Truncate(time.Second).Unix()},
 	).Return(nil, nil).Once()
-	m.On("Do", "EXEC", n).Return(nil, nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
 
 	if !l.AllowN(key, 2) {
 		t.Errorf("expected to allow key: %s", key)
 	}
 }
 
+func TestRedisAllowPartialRefill(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	// mock get token bucket call
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			// return bucket with zero tokens
+			[]byte("0"),
+			// return last update time of one interval ago
+			[]byte(fmt.Sprintf(
+				"%d",
+				time.Now().Truncate(time.Second).Add(-1*time.Second).Unix()),
+			),
+		}, nil,
+	).Once()
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On(
+		// one interval allots the rate limit of tokens, minus the one used
+		"Send", "LSET", []interface{}{key, 0, l.rate - 1},
+	).Return(nil, nil).Once()
+	m.On(
+		"Send", "LSET",
+		[]interface{}{key, 1, time.Now().Truncate(time.Second).Unix()},
+	).Return(nil, nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	m.AssertExpectations(t)
+}
+
 func TestRedisAllowNoTokens(t *testing.T) {
 	m := &mockConn{}
 	l := newMockRedisLimiter(m)
@@ -311,6 +416,58 @@ func TestInMemoryLimiter(t *testing.T) {
 	}
 }
 
+func TestZeroBurstLimit(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, config := range []Config{
+		{Type: TypeRedis, Address: s.Addr()},
+		{Type: TypeInMemory},
+		{Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+
+		if l.Burst() != 2 {
+			t.Errorf("expected burst limit to default to the rate limit: %v", l.Burst())
+		}
+		if !l.AllowN("foo", 2) {
+			t.Errorf("expected type %v to allow the default burst", config.Type)
+		}
+		if tokens, _ := l.Tokens("foo"); tokens != 0 {
+			t.Errorf("expected type %v to store 0 tokens: %v", config.Type, tokens)
+		}
+		if l.Allow("foo") {
+			t.Errorf("expected type %v to not allow beyond the default burst", config.Type)
+		}
+	}
+}
+
+func TestBackendType(t *testing.T) {
+	for _, typ := range []Type{TypeRedis, TypeInMemory, TypeDisabled, TypeBlockAll} {
+		if l := New(Config{Type: typ}); l.BackendType() != typ {
+			t.Errorf("expected backend type %v: %v", typ, l.BackendType())
+		}
+	}
+}
+
+func TestFailOpenMode(t *testing.T) {
+	for _, tc := range []struct {
+		config   Config
+		failOpen bool
+	}{
+		{Config{Type: TypeRedis, FailOpen: true}, true},
+		{Config{Type: TypeRedis, FailOpen: false}, false},
+		{Config{Type: TypeInMemory, FailOpen: true}, false},
+		{Config{Type: TypeDisabled}, true},
+		{Config{Type: TypeBlockAll, FailOpen: true}, false},
+	} {
+		if l := New(tc.config); l.FailOpenMode() != tc.failOpen {
+			t.Errorf("expected %v to fail open %v: %v", tc.config.Type, tc.failOpen, l.FailOpenMode())
+		}
+	}
+}
+
 func TestDisabledLimiter(t *testing.T) {
 	l := New(Config{
 		Type: TypeDisabled,
@@ -336,3 +493,409 @@ func TestDisabledLimiter(t *testing.T) {
 		t.Errorf("expected l.Burst() to return %v: %v", 0, l.Burst())
 	}
 }
+
+func TestRedisConnMaxIdleCheck(t *testing.T) {
+	idle := 10 * time.Second
+	l := New(Config{
+		Type:             TypeRedis,
+		ConnMaxIdleCheck: idle,
+	}).(*redisLimiter)
+
+	m := &mockConn{}
+	var n []interface{} = nil
+	m.On("Do", "PING", n).Return("PONG", nil).Once()
+
+	// connection used within the threshold should not be checked
+	if err := l.pool.TestOnBorrow(m, time.Now().Add(-idle/2)); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertNotCalled(t, "Do", "PING", n)
+
+	// connection idle beyond the threshold should be checked
+	if err := l.pool.TestOnBorrow(m, time.Now().Add(-2*idle)); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertCalled(t, "Do", "PING", n)
+}
+
+func TestRedisMaxIdle(t *testing.T) {
+	for _, tc := range []struct {
+		maxIdle int
+		pool    int
+	}{
+		{0, defaultMaxIdle},
+		{3, 3},
+		{-1, 0},
+	} {
+		l := New(Config{Type: TypeRedis, MaxIdle: tc.maxIdle}).(*redisLimiter)
+		if l.pool.MaxIdle != tc.pool {
+			t.Errorf("expected MaxIdle %d to keep %d idle connections: %d", tc.maxIdle, tc.pool, l.pool.MaxIdle)
+		}
+	}
+}
+
+func TestRedisDialFunc(t *testing.T) {
+	m := &mockConn{}
+	dials := 0
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    "unused:6379",
+		RateLimit:  10,
+		BurstLimit: 20,
+		DialFunc: func(ctx context.Context) (redis.Conn, error) {
+			dials++
+			return m, nil
+		},
+	})
+
+	// the connection is kept idle for reuse rather than closed
+	var n []interface{} = nil
+	m.On("Do", "", n).Return(nil, nil).Once()
+	m.On("Err").Return(nil).Once()
+	m.On("Do", "EXISTS", []interface{}{blockKey("foo")}).Return(int64(0), nil).Once()
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 1}).Return([]interface{}{}, nil).Once()
+	m.On("Do", "LPUSH", mock.Anything).Return(int64(2), nil).Once()
+
+	if !l.Allow("foo") {
+		t.Error("expected to allow key: foo")
+	}
+	if dials != 1 {
+		t.Errorf("expected the dial func to be used once: %d", dials)
+	}
+	if idle := l.(*redisLimiter).pool.IdleCount(); idle != 1 {
+		t.Errorf("expected the connection to be kept idle: %d", idle)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestOpenEagerConnectUnreachable(t *testing.T) {
+	start := time.Now()
+	l, err := Open(Config{
+		Type:         TypeRedis,
+		Address:      "127.0.0.1:1",
+		EagerConnect: true,
+	})
+	if err == nil {
+		t.Error("expected an error connecting to an unreachable address")
+	}
+	if l != nil {
+		t.Errorf("expected no limiter: %v", l)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected eager connect to fail fast: %v", elapsed)
+	}
+}
+
+func TestOpenLazyConnect(t *testing.T) {
+	l, err := Open(Config{
+		Type:    TypeRedis,
+		Address: "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.(*redisLimiter); !ok {
+		t.Errorf("expected a redis limiter: %T", l)
+	}
+}
+
+func TestOpenInvalidAddress(t *testing.T) {
+	for _, config := range []Config{
+		{Type: TypeRedis, Address: "localhost"},
+		{Type: TypeRedis, Address: "localhost:6379", SecondaryAddress: "localhost:"},
+	} {
+		l, err := Open(config)
+		if !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("expected %+v to return ErrInvalidAddress: %v", config, err)
+		}
+		if l != nil {
+			t.Errorf("expected no limiter: %v", l)
+		}
+	}
+}
+
+func TestOpenInvalidConnection(t *testing.T) {
+	for _, tc := range []struct {
+		config Config
+		err    error
+	}{
+		{Config{Type: TypeRedis, URL: "http://localhost:6379"}, ErrInvalidURL},
+		{Config{Type: TypeRedis, URL: "redis://localhost:6379", Address: "localhost:6379"}, ErrAddressConflict},
+		{Config{Type: TypeRedis, URL: "redis://localhost:6379", UseTLS: true}, ErrInvalidTLS},
+	} {
+		l, err := Open(tc.config)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %+v to return %v: %v", tc.config, tc.err, err)
+		}
+		if l != nil {
+			t.Errorf("expected no limiter: %v", l)
+		}
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	l, err := Open(Config{
+		Type:         TypeRedis,
+		URL:          "redis://" + s.Addr() + "/2",
+		RateLimit:    1,
+		BurstLimit:   1,
+		EagerConnect: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Allow("foo") {
+		t.Error("expected to allow key: foo")
+	}
+	if !s.DB(2).Exists("foo") {
+		t.Errorf("expected the bucket in the URL's database: %v", s.DB(2).Keys())
+	}
+}
+
+func TestOpenEagerConnectInMemory(t *testing.T) {
+	if _, err := Open(Config{Type: TypeInMemory, EagerConnect: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisAllowIntoDebt(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.minTokens = -5
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+		}, nil,
+	).Once()
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 0, -3.0}).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 1, now.Unix()}).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
+
+	if !l.AllowN(key, 3) {
+		t.Errorf("expected to allow key into debt: %s", key)
+	}
+}
+
+func TestRedisAllowBeyondDebt(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.minTokens = -5
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("-4.5"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+		}, nil,
+	).Once()
+
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key beyond its debt: %s", key)
+	}
+}
+
+func TestRedisAllowRecoverFromDebt(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.minTokens = -5
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	// one interval later a rate of 10 takes the bucket from -5 to 5 tokens
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("-5"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Second).Unix())),
+		}, nil,
+	).Once()
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 0, 4.0}).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 1, now.Unix()}).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected key to recover from debt: %s", key)
+	}
+}
+
+func TestInMemoryAllowDebt(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 2,
+		MinTokens:  -2,
+	}).(*inMemoryLimiter)
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+	key := "foo"
+
+	// use the bucket's two tokens and go two tokens into debt
+	for i := 0; i < 4; i++ {
+		if !l.Allow(key) {
+			t.Fatalf("expected to allow key on event %d: %s", i, key)
+		}
+	}
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key beyond its debt: %s", key)
+	}
+
+	// two seconds repays the debt, one more earns a token which may be used
+	// before going back into debt
+	now = now.Add(3 * time.Second)
+	for i := 0; i < 3; i++ {
+		if !l.Allow(key) {
+			t.Fatalf("expected key to recover from debt on event %d: %s", i, key)
+		}
+	}
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key beyond its debt: %s", key)
+	}
+}
+
+func TestRedisAllowOverflow(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.overflowRate = 1
+	l.overflowBurst = 5
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+	var n []interface{} = nil
+
+	// the bucket and its overflow bucket are decided in one transaction
+	watch := []interface{}{key, blockKey(key), overflowKey(key)}
+	m.On("Do", "WATCH", watch).Return("OK", nil).Twice()
+
+	// the main bucket is empty
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+		}, nil,
+	).Twice()
+
+	// the overflow bucket is drawn from
+	m.On(
+		"Do", "LRANGE", []interface{}{overflowKey(key), 0, 1},
+	).Return([]interface{}{}, nil).Once()
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "DEL", []interface{}{overflowKey(key)}).Return(nil).Once()
+	m.On(
+		"Send", "LPUSH", []interface{}{overflowKey(key), now.Unix(), 4.0},
+	).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{int64(0), int64(2)}, nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key from its overflow bucket: %s", key)
+	}
+
+	// the overflow bucket is empty and nothing is written
+	m.On("Do", "", n).Return(nil, nil).Once()
+	m.On("Err").Return(nil).Once()
+	m.On("Close").Return(nil).Once()
+	m.On("Do", "LRANGE", []interface{}{overflowKey(key), 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+		}, nil,
+	).Once()
+
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+	m.AssertExpectations(t)
+}
+
+// hookConn is a redis.Conn calling hook before each command it does
+type hookConn struct {
+	redis.Conn
+
+	hook func(cmd string, args ...interface{})
+}
+
+func (c hookConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.hook(cmd, args...)
+	return c.Conn.Do(cmd, args...)
+}
+
+func TestRedisAllowOverflowAtomic(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:          TypeRedis,
+		Address:       s.Addr(),
+		RateLimit:     1,
+		BurstLimit:    1,
+		Interval:      time.Hour,
+		OverflowRate:  1,
+		OverflowBurst: 1,
+	}).(*redisLimiter)
+	key := "foo"
+	l.Allow(key)
+
+	// the main bucket is reset while the overflow bucket is read
+	other := l.pool.Get()
+	defer other.Close()
+	reset := false
+	c := hookConn{Conn: l.pool.Get(), hook: func(cmd string, args ...interface{}) {
+		if cmd == "LRANGE" && args[0] == overflowKey(key) && !reset {
+			reset = true
+			other.Do("DEL", key)
+		}
+	}}
+	defer c.Close()
+	db := watchBackend{connBackend{c: c, storage: l.storage}}
+
+	// drawing from the overflow bucket is aborted
+	allowed, _, err := l.tryTake(db, key, 1, l.rate, l.burst, false)
+	if err != ErrConflict || allowed {
+		t.Errorf("expected the reset to conflict: %v %v", allowed, err)
+	}
+	if s.Exists(overflowKey(key)) {
+		t.Error("expected the overflow bucket to not be drawn from")
+	}
+
+	// and retried against the reset bucket
+	if allowed, _, err := l.take(db, key, 1, l.rate, l.burst, false); err != nil || !allowed {
+		t.Errorf("expected the reset bucket to allow: %v %v", allowed, err)
+	}
+	if s.Exists(overflowKey(key)) {
+		t.Error("expected the overflow bucket to not be drawn from")
+	}
+}
+
+func TestInMemoryAllowOverflow(t *testing.T) {
+	l := New(Config{
+		Type:          TypeInMemory,
+		RateLimit:     1,
+		BurstLimit:    2,
+		Interval:      time.Hour,
+		OverflowRate:  1,
+		OverflowBurst: 1,
+	})
+	key := "foo"
+
+	// drain the main bucket then the overflow bucket
+	for i := 0; i < 3; i++ {
+		if !l.Allow(key) {
+			t.Fatalf("expected to allow key on event %d: %s", i, key)
+		}
+	}
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+}
@@ -0,0 +1,69 @@
+package limiter
+
+import (
+	"path"
+	"strings"
+)
+
+// keyList matches keys against a list of exact keys, prefixes, and glob
+// patterns. Entries ending in a single trailing * match keys by prefix, other
+// entries containing *, ?, or [ are matched with path.Match, and the rest must
+// match exactly.
+type keyList struct {
+	exact    map[string]struct{}
+	prefixes []string
+	globs    []string
+}
+
+// newKeyList returns a keyList of the given entries
+func newKeyList(entries []string) keyList {
+	l := keyList{exact: make(map[string]struct{})}
+	for _, e := range entries {
+		meta := strings.ContainsAny(e, "*?[")
+		switch {
+		case !meta:
+			l.exact[e] = struct{}{}
+		case strings.HasSuffix(e, "*") && !strings.ContainsAny(e[:len(e)-1], "*?["):
+			l.prefixes = append(l.prefixes, e[:len(e)-1])
+		default:
+			l.globs = append(l.globs, e)
+		}
+	}
+	return l
+}
+
+// match returns true if the given key matches an entry of the list
+func (l keyList) match(key string) bool {
+	if _, ok := l.exact[key]; ok {
+		return true
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	for _, g := range l.globs {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keyLists holds the configured allow and deny lists
+type keyLists struct {
+	allow keyList
+	deny  keyList
+}
+
+// check returns whether the given key is decided by the lists and if so,
+// whether it is allowed. The deny list takes precedence over the allow list.
+func (l keyLists) check(key string) (decided, allowed bool) {
+	if l.deny.match(key) {
+		return true, false
+	}
+	if l.allow.match(key) {
+		return true, true
+	}
+	return false, false
+}
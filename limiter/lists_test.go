@@ -0,0 +1,102 @@
+package limiter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestKeyList(t *testing.T) {
+	l := newKeyList([]string{"health", "internal:*", "svc-?:*", "[ab]x"})
+
+	for key, match := range map[string]bool{
+		"health":        true,
+		"healthz":       false,
+		"internal:":     true,
+		"internal:auth": true,
+		"internal":      false,
+		"svc-a:1":       true,
+		"svc-ab:1":      false,
+		"ax":            true,
+		"cx":            false,
+		"foo":           false,
+	} {
+		if l.match(key) != match {
+			t.Errorf("expected %s to match %v", key, match)
+		}
+	}
+}
+
+func TestKeyListsDenyPrecedence(t *testing.T) {
+	l := keyLists{
+		allow: newKeyList([]string{"internal:*"}),
+		deny:  newKeyList([]string{"internal:bad"}),
+	}
+
+	for _, tc := range []struct {
+		key              string
+		decided, allowed bool
+	}{
+		{"internal:good", true, true},
+		{"internal:bad", true, false},
+		{"foo", false, false},
+	} {
+		decided, allowed := l.check(tc.key)
+		if decided != tc.decided || allowed != tc.allowed {
+			t.Errorf("expected %s to be decided %v and allowed %v: %v %v",
+				tc.key, tc.decided, tc.allowed, decided, allowed)
+		}
+	}
+}
+
+func TestRedisAllowDenyList(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.lists = keyLists{
+		allow: newKeyList([]string{"health"}),
+		deny:  newKeyList([]string{"bad:*"}),
+	}
+	l.failOpen = true
+
+	// listed keys do not touch redis
+	if !l.AllowN("health", l.burst+1) {
+		t.Error("expected allow listed key to be allowed")
+	}
+	if l.Allow("bad:actor") {
+		t.Error("expected deny listed key to not be allowed")
+	}
+	m.AssertNotCalled(t, "Do", "LRANGE", mock.Anything)
+
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 1}).Return(
+		[]interface{}{[]byte("0"), []byte("0")}, nil,
+	).Once()
+	if l.AllowN("foo", l.burst+1) {
+		t.Error("expected normal key to be limited")
+	}
+	m.AssertExpectations(t)
+}
+
+func TestInMemoryAllowDenyList(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		AllowList:  []string{"health", "internal:*"},
+		DenyList:   []string{"bad"},
+	})
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("health") || !l.Allow("internal:auth") {
+			t.Fatalf("expected allow listed keys to be allowed on event %d", i)
+		}
+	}
+	if l.Allow("bad") {
+		t.Error("expected deny listed key to not be allowed")
+	}
+	if !l.Allow("foo") {
+		t.Error("expected normal key to be allowed")
+	}
+	if l.Allow("foo") {
+		t.Error("expected normal key to be limited")
+	}
+}
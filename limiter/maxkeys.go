@@ -0,0 +1,62 @@
+package limiter
+
+import "github.com/garyburd/redigo/redis"
+
+// KeysPolicy defines what the Redis Limiter does with a new key once MaxKeys
+// keys exist
+type KeysPolicy int
+
+const (
+	// KeysDeny denies events for new keys until existing keys are reset
+	KeysDeny KeysPolicy = iota
+	// KeysEvictOldest deletes the earliest created key and its per-key state
+	// to make room for the new key
+	KeysEvictOldest
+)
+
+// keySetKey returns the key of the sorted set of keys scored by the time
+// their token buckets were created
+func keySetKey(prefix string) string {
+	return suffixedKey(prefix+"limiter", "keys")
+}
+
+// admitScript adds a key to the key set if it is not a member, evicting the
+// oldest members and their per-key state or refusing the key if the set is
+// full. Returns 1 if the key is admitted, 0 otherwise.
+//
+// KEYS[1] key set
+// ARGV[1] key, ARGV[2] now (milliseconds), ARGV[3] max keys, ARGV[4] evict,
+// ARGV[5:] suffixes
+var admitScript = newScript(1, luaDeleteKey+`
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 1
+end
+local max = tonumber(ARGV[3])
+while redis.call("ZCARD", KEYS[1]) >= max do
+	if ARGV[4] ~= "1" then
+		return 0
+	end
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0)[1]
+	redis.call("ZREM", KEYS[1], oldest)
+	delete_key(oldest, {unpack(ARGV, 5)})
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// admit returns true if the given key may be created, always if MaxKeys is
+// not configured
+func (l *redisLimiter) admit(db backend, key string) (bool, error) {
+	if l.maxKeys <= 0 {
+		return true, nil
+	}
+
+	evict := 0
+	if l.keysPolicy == KeysEvictOldest {
+		evict = 1
+	}
+	args := append([]interface{}{
+		keySetKey(l.keyLength.prefix), key, l.now().UnixMilli(), l.maxKeys, evict,
+	}, l.keySuffixes()...)
+	return redis.Bool(db.eval(admitScript, args...))
+}
@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newMaxKeysLimiter(t *testing.T, policy KeysPolicy) (*redisLimiter, *miniredis.Miniredis, *time.Time) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:          TypeRedis,
+		Address:       s.Addr(),
+		KeyPrefix:     "test:",
+		RateLimit:     1,
+		BurstLimit:    2,
+		MaxKeys:       2,
+		MaxKeysPolicy: policy,
+	}).(*redisLimiter)
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	return l, s, &now
+}
+
+func TestMaxKeysDeny(t *testing.T) {
+	l, s, _ := newMaxKeysLimiter(t, KeysDeny)
+
+	if !l.Allow("foo") || !l.Allow("bar") {
+		t.Fatal("expected to allow keys up to the cap")
+	}
+	if l.Allow("baz") {
+		t.Error("expected to deny a new key past the cap")
+	}
+	if s.Exists("test:baz") {
+		t.Error("expected a denied key to not create a bucket")
+	}
+	if !l.Allow("foo") {
+		t.Error("expected to allow an existing key past the cap")
+	}
+}
+
+func TestMaxKeysEvictOldest(t *testing.T) {
+	l, s, now := newMaxKeysLimiter(t, KeysEvictOldest)
+
+	for _, key := range []string{"foo", "bar", "baz"} {
+		if !l.Allow(key) {
+			t.Errorf("expected to allow key: %s", key)
+		}
+		*now = now.Add(time.Millisecond)
+	}
+
+	if s.Exists("test:foo") {
+		t.Error("expected the oldest key to be evicted")
+	}
+	for _, key := range []string{"test:bar", "test:baz"} {
+		if !s.Exists(key) {
+			t.Errorf("expected key to exist: %s", key)
+		}
+	}
+	if members, _ := s.ZMembers(keySetKey("test:")); len(members) != 2 {
+		t.Errorf("expected 2 tracked keys: %v", members)
+	}
+}
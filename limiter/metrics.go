@@ -0,0 +1,179 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exemplar identifies the trace of a denied event so the denied events counter
+// links to it. An empty Exemplar is not recorded.
+type Exemplar struct {
+	TraceID string
+	SpanID  string
+}
+
+// exemplarLabel escapes exemplar label values in OpenMetrics text format
+var exemplarLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// String returns the exemplar's labels in OpenMetrics text format
+func (e Exemplar) String() string {
+	var labels []string
+	if e.TraceID != "" {
+		labels = append(labels, `trace_id="`+exemplarLabel.Replace(e.TraceID)+`"`)
+	}
+	if e.SpanID != "" {
+		labels = append(labels, `span_id="`+exemplarLabel.Replace(e.SpanID)+`"`)
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// counters counts the events decided by the Allow methods
+type counters struct {
+	allowed uint64
+	denied  uint64
+	errors  uint64
+
+	// exemplar is the latest denial given an Exemplar, if any
+	mux      sync.Mutex
+	exemplar *exemplarSample
+}
+
+// exemplarSample is an Exemplar of a number of denied events at a time
+type exemplarSample struct {
+	Exemplar
+	n  int
+	at time.Time
+}
+
+// record counts n allowed or denied events, and an error if one occurred
+func (c *counters) record(n int, allowed bool, err error) {
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	if allowed {
+		atomic.AddUint64(&c.allowed, uint64(n))
+	} else {
+		atomic.AddUint64(&c.denied, uint64(n))
+	}
+}
+
+// exemplify records the given Exemplar of the given number of denied events at
+// the given time, replacing any previous Exemplar
+func (c *counters) exemplify(n int, e Exemplar, at time.Time) {
+	if e == (Exemplar{}) {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.exemplar = &exemplarSample{Exemplar: e, n: n, at: at}
+}
+
+// latest returns the latest Exemplar recorded, nil if none was
+func (c *counters) latest() *exemplarSample {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.exemplar
+}
+
+// WriteMetrics writes the total events allowed and denied, the total errors
+// encountered, and the number of active keys in Prometheus text exposition
+// format. Active keys are found with Keys so every token bucket is scanned.
+func (l *redisLimiter) WriteMetrics(w io.Writer) error {
+	return writeMetrics(l, l.counts, w, false)
+}
+
+func (l *inMemoryLimiter) WriteMetrics(w io.Writer) error {
+	return writeMetrics(l, l.counts, w, false)
+}
+
+// WriteMetrics writes zeros as the disabled limiter does not count events
+func (l *disabledLimiter) WriteMetrics(w io.Writer) error {
+	return writeMetrics(l, &counters{}, w, false)
+}
+
+// WriteOpenMetrics writes the metrics of WriteMetrics in OpenMetrics text
+// format, with the latest Exemplar given to DeniedExemplar attached to the
+// denied events counter
+func (l *redisLimiter) WriteOpenMetrics(w io.Writer) error {
+	return writeMetrics(l, l.counts, w, true)
+}
+
+func (l *inMemoryLimiter) WriteOpenMetrics(w io.Writer) error {
+	return writeMetrics(l, l.counts, w, true)
+}
+
+func (l *disabledLimiter) WriteOpenMetrics(w io.Writer) error {
+	return writeMetrics(l, &counters{}, w, true)
+}
+
+// DeniedExemplar attaches the given Exemplar of the given number of denied
+// events, typically the trace of the request denied, to the denied events
+// counter written by WriteOpenMetrics. Only the latest Exemplar is kept.
+func (l *redisLimiter) DeniedExemplar(n int, e Exemplar) {
+	l.counts.exemplify(n, e, l.now())
+}
+
+func (l *inMemoryLimiter) DeniedExemplar(n int, e Exemplar) {
+	l.counts.exemplify(n, e, l.now())
+}
+
+// DeniedExemplar has no effect as the disabled limiter does not count events
+func (l *disabledLimiter) DeniedExemplar(n int, e Exemplar) {}
+
+// metric is a single sample in Prometheus text exposition format
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value uint64
+}
+
+// writeMetrics writes the given counters and the number of the given
+// Limiter's keys, in OpenMetrics text format with exemplars if openMetrics is
+// true and Prometheus text exposition format otherwise
+func writeMetrics(l Limiter, c *counters, w io.Writer, openMetrics bool) error {
+	keys, err := l.Keys(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range []metric{
+		{"limiter_allowed_total", "counter", "Total number of events allowed.", atomic.LoadUint64(&c.allowed)},
+		{"limiter_denied_total", "counter", "Total number of events denied.", atomic.LoadUint64(&c.denied)},
+		{"limiter_errors_total", "counter", "Total number of errors encountered deciding events.", atomic.LoadUint64(&c.errors)},
+		{"limiter_active_keys", "gauge", "Number of keys with token buckets.", uint64(len(keys))},
+	} {
+		if !openMetrics {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n",
+				m.name, m.help, m.name, m.kind, m.name, m.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// OpenMetrics names counters without their _total suffix
+		family := m.name
+		if m.kind == "counter" {
+			family = strings.TrimSuffix(m.name, "_total")
+		}
+		sample := fmt.Sprintf("%s %d", m.name, m.value)
+		if e := c.latest(); e != nil && m.name == "limiter_denied_total" {
+			sample += fmt.Sprintf(" # %s %d %.3f", e, e.n, float64(e.at.UnixMilli())/1000)
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n",
+			family, m.help, family, m.kind, sample); err != nil {
+			return err
+		}
+	}
+	if openMetrics {
+		_, err := fmt.Fprint(w, "# EOF\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package limiter
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	metricComment = regexp.MustCompile(`^# (HELP [a-zA-Z_:][a-zA-Z0-9_:]* .+|TYPE [a-zA-Z_:][a-zA-Z0-9_:]* (counter|gauge))$`)
+	metricSample  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*) (\S+)$`)
+)
+
+// parseMetrics returns the samples written in Prometheus text exposition
+// format, failing on malformed lines
+func parseMetrics(t *testing.T, text string) map[string]float64 {
+	samples := map[string]float64{}
+	types := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			if !metricComment.MatchString(line) {
+				t.Fatalf("malformed comment: %q", line)
+			}
+			if f := strings.Fields(line); f[1] == "TYPE" {
+				types[f[2]] = true
+			}
+			continue
+		}
+
+		m := metricSample.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("malformed sample: %q", line)
+		}
+		if !types[m[1]] {
+			t.Errorf("expected a TYPE before sample: %q", line)
+		}
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			t.Fatalf("malformed sample value: %q", line)
+		}
+		samples[m[1]] = v
+	}
+	return samples
+}
+
+func TestInMemoryWriteMetrics(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 3,
+		Interval:   time.Hour,
+	})
+
+	l.AllowN("foo", 2)
+	l.AllowN("foo", 2)
+	l.Allow("bar")
+	l.Allow(strings.Repeat("a", defaultMaxKeyLength+1))
+
+	var buf bytes.Buffer
+	if err := l.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := parseMetrics(t, buf.String())
+	for name, value := range map[string]float64{
+		"limiter_allowed_total": 3,
+		"limiter_denied_total":  3,
+		"limiter_errors_total":  1,
+		"limiter_active_keys":   2,
+	} {
+		if v, ok := samples[name]; !ok || v != value {
+			t.Errorf("expected %s to be %v: %v", name, value, v)
+		}
+	}
+}
+
+func TestRedisWriteMetricsError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "SCAN", []interface{}{0, "COUNT", scanCount}).Return(nil, errors.New("not good")).Once()
+
+	if err := l.WriteMetrics(&bytes.Buffer{}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDisabledWriteMetrics(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+
+	var buf bytes.Buffer
+	if err := l.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if samples := parseMetrics(t, buf.String()); len(samples) != 4 {
+		t.Errorf("expected 4 metrics: %v", samples)
+	}
+}
+
+var openMetricsSample = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*) (\S+)(?: # (\{.*\}) (\S+) (\S+))?$`)
+
+// parseOpenMetrics returns the samples and exemplars written in OpenMetrics
+// text format, failing on malformed lines
+func parseOpenMetrics(t *testing.T, text string) (map[string]float64, map[string]string) {
+	if !strings.HasSuffix(text, "# EOF\n") {
+		t.Fatalf("expected the exposition to end with # EOF: %q", text)
+	}
+
+	samples := map[string]float64{}
+	exemplars := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "# EOF\n"), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m := openMetricsSample.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("malformed sample: %q", line)
+		}
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			t.Fatalf("malformed sample value: %q", line)
+		}
+		samples[m[1]] = v
+		if m[3] != "" {
+			exemplars[m[1]] = m[3] + " " + m[4] + " " + m[5]
+		}
+	}
+	return samples, exemplars
+}
+
+func TestWriteOpenMetricsExemplar(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	}).(*inMemoryLimiter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	l.Allow("foo")
+	if l.AllowN("foo", 2) {
+		t.Fatal("expected to deny foo")
+	}
+
+	// without tracing there is no exemplar
+	l.DeniedExemplar(2, Exemplar{})
+	var buf bytes.Buffer
+	if err := l.WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, exemplars := parseOpenMetrics(t, buf.String()); len(exemplars) != 0 {
+		t.Errorf("expected no exemplars: %v", exemplars)
+	}
+
+	l.DeniedExemplar(2, Exemplar{TraceID: "abc", SpanID: `d"f`})
+	buf.Reset()
+	if err := l.WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, exemplars := parseOpenMetrics(t, buf.String())
+	if samples["limiter_denied_total"] != 2 || samples["limiter_allowed_total"] != 1 {
+		t.Errorf("expected the counters to be written: %v", samples)
+	}
+	expected := `{trace_id="abc",span_id="d\"f"} 2 1704067200.000`
+	if e := exemplars["limiter_denied_total"]; e != expected {
+		t.Errorf("expected the exemplar %s on the denied counter: %s", expected, e)
+	}
+	if len(exemplars) != 1 {
+		t.Errorf("expected only the denied counter to have an exemplar: %v", exemplars)
+	}
+
+	// Prometheus text exposition format has no exemplars
+	buf.Reset()
+	if err := l.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parseMetrics(t, buf.String())
+}
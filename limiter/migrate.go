@@ -0,0 +1,47 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMigrateUnsupported is returned by Migrate when the destination Limiter
+// cannot have token buckets written to it
+var ErrMigrateUnsupported = errors.New("limiter: destination does not support migration")
+
+// Migrate copies the token bucket of every key in src into dst, overwriting
+// any existing token buckets in dst. It is a point-in-time snapshot: events
+// allowed by src while migrating may not be reflected in dst, and keys created
+// after src's keys are listed are not migrated. Keys which do not hold a token
+// bucket, such as other data sharing the Redis database, are skipped.
+func Migrate(ctx context.Context, src, dst Limiter) error {
+	r, ok := dst.(restorer)
+	if !ok {
+		return ErrMigrateUnsupported
+	}
+
+	keys, err := src.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state, err := src.Inspect(ctx, key)
+		if err == ErrKeyNotFound || errors.Is(err, ErrMalformedBucket) {
+			// the key was removed since it was listed or is not a bucket
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := r.restore(ctx, key, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
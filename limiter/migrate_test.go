@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMigrateInMemoryToRedis(t *testing.T) {
+	src := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 20,
+		PureGo:     true,
+	}).(*inMemoryLimiter)
+	now := time.Now().Truncate(time.Second)
+	src.now = func() time.Time { return now }
+
+	src.AllowN("foo", 5)
+	src.SetState("foo", "pro")
+
+	m := &mockConn{}
+	dst := newMockRedisLimiter(m)
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "DEL", []interface{}{"foo"}).Return(nil).Once()
+	m.On(
+		"Do", "LPUSH", []interface{}{"foo", "pro", now.Unix(), 15.0},
+	).Return("QUEUED", nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{int64(1), int64(3)}, nil).Once()
+
+	if err := Migrate(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestMigrateRedisToInMemory(t *testing.T) {
+	m := &mockConn{}
+	src := newMockRedisLimiter(m)
+
+	m.On("Do", "SCAN", []interface{}{0, "COUNT", scanCount}).Return(
+		[]interface{}{[]byte("0"), []interface{}{[]byte("foo")}}, nil,
+	).Once()
+	m.On("Do", "TYPE", []interface{}{"foo"}).Return("list", nil).Once()
+
+	// listing keys and inspecting a key each borrow a connection
+	var n []interface{} = nil
+	m.On("Do", "", n).Return(nil, nil).Once()
+	m.On("Err").Return(nil).Once()
+	m.On("Close").Return(nil).Once()
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 2}).Return(
+		[]interface{}{[]byte("7.5"), []byte("100")}, nil,
+	).Once()
+
+	dst := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 20,
+		PureGo:     true,
+	})
+
+	ctx := context.Background()
+	if err := Migrate(ctx, src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := dst.Inspect(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tokens != 7.5 || !state.LastUpdate.Equal(time.Unix(100, 0)) {
+		t.Errorf("expected 7.5 tokens as of %v: %+v", time.Unix(100, 0), state)
+	}
+}
+
+func TestMigrateSkipsNonBuckets(t *testing.T) {
+	s := miniredis.RunT(t)
+	src := New(Config{
+		Type:          TypeRedis,
+		Address:       s.Addr(),
+		RateLimit:     1,
+		BurstLimit:    4,
+		Interval:      time.Hour,
+		StorageLayout: LayoutString,
+	})
+	src.AllowN("foo", 3)
+	src.Block("foo", time.Minute)
+
+	// other data of the layout's type shares the database
+	s.Set("session", "not a bucket")
+
+	dst := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+		PureGo:     true,
+	})
+	if err := Migrate(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ := dst.Keys(context.Background())
+	if fmt.Sprint(keys) != "[foo]" {
+		t.Errorf("expected only the token bucket to be migrated: %q", keys)
+	}
+	if tokens, _ := dst.Tokens("foo"); tokens != 1 {
+		t.Errorf("expected the token bucket to be migrated: %v", tokens)
+	}
+}
+
+func TestMigrateRateLimiter(t *testing.T) {
+	src := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+		PureGo:     true,
+	})
+	dst := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+	})
+
+	src.AllowN("foo", 3)
+	if err := Migrate(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// the destination has the single token left in the source
+	if !dst.Allow("foo") {
+		t.Error("expected to allow foo")
+	}
+	if dst.Allow("foo") {
+		t.Error("expected to not allow foo")
+	}
+}
+
+func TestMigrateUnsupported(t *testing.T) {
+	src := New(Config{Type: TypeDisabled})
+	dst := struct{ Limiter }{New(Config{Type: TypeDisabled})}
+
+	if err := Migrate(context.Background(), src, dst); err != ErrMigrateUnsupported {
+		t.Errorf("expected ErrMigrateUnsupported: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package limiter
+
+import "strings"
+
+// Namespacer is implemented by limiters which can be divided into isolated key
+// spaces sharing their configuration and storage. Only the in-memory Limiter
+// implements it, Redis Limiters isolate key spaces with KeyPrefix.
+type Namespacer interface {
+	// Namespace returns a Limiter whose IDs are independent of those of
+	// other namespaces
+	Namespace(prefix string) Limiter
+}
+
+// Namespace returns a view of the limiter which prefixes keys with the given
+// prefix, so the same key in two namespaces has independent token buckets.
+// Views share the limiter's configuration, maps, and lock. Keys and ResetAll
+// only see the view's own keys, except that ResetAll on the limiter itself
+// removes the keys of every namespace; a namespace of a namespace nests
+// prefixes.
+func (l *inMemoryLimiter) Namespace(prefix string) Limiter {
+	c := *l
+	c.keyLength.prefix = namespaceKey(l.keyLength.prefix + prefix)
+	return &c
+}
+
+// namespaceKey returns the key prefix of the namespace with the given prefix.
+// The prefix is separated from keys so namespaces whose prefixes are prefixes
+// of each other do not share keys.
+func namespaceKey(prefix string) string {
+	return suffixedKey(prefix, "namespace:")
+}
+
+// deletePrefixed deletes the entries of the given map whose keys have the
+// given prefix
+func deletePrefixed[V any](m map[string]V, prefix string) {
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			delete(m, key)
+		}
+	}
+}
+
+// resetPrefixed removes every token bucket and all other per-key state with
+// the given prefix. The caller must hold the lock.
+func (l *inMemoryLimiter) resetPrefixed(prefix string) {
+	deletePrefixed(l.buckets, prefix)
+	deletePrefixed(l.limiters, prefix)
+	deletePrefixed(l.states, prefix)
+	deletePrefixed(l.windows, prefix)
+	deletePrefixed(l.blocks, prefix)
+	deletePrefixed(l.flapping, prefix)
+	deletePrefixed(l.expires, prefix)
+	deletePrefixed(l.stats, prefix)
+	deletePrefixed(l.usages, prefix)
+	deletePrefixed(l.created, prefix)
+	deletePrefixed(l.seen, prefix)
+	deletePrefixed(l.intervals, prefix)
+	deletePrefixed(l.seqs, prefix)
+	for group, members := range l.groups {
+		deletePrefixed(members, prefix)
+		if len(members) == 0 {
+			delete(l.groups, group)
+		}
+	}
+}
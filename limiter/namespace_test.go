@@ -0,0 +1,85 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, PureGo: pureGo})
+		n, ok := l.(Namespacer)
+		if !ok {
+			t.Fatal("expected the in-memory limiter to implement Namespacer")
+		}
+		a, b := n.Namespace("a:"), n.Namespace("b:")
+
+		if !a.Allow("x") {
+			t.Error("expected to allow x in namespace a")
+		}
+		if a.Allow("x") {
+			t.Error("expected to deny x past its burst in namespace a")
+		}
+		if !b.Allow("x") {
+			t.Error("expected x in namespace b to be independent of namespace a")
+		}
+		if !l.Allow("x") {
+			t.Error("expected x outside any namespace to be independent")
+		}
+
+		keys, err := a.Keys(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != "x" {
+			t.Errorf("expected namespace a to list only its own key: %v", keys)
+		}
+
+		// resetting a namespace leaves the others untouched
+		if err := a.ResetAll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !a.Allow("x") {
+			t.Error("expected x to be reset in namespace a")
+		}
+		if b.Allow("x") {
+			t.Error("expected x to remain spent in namespace b")
+		}
+	}
+}
+
+func TestNamespaceSeparated(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1}).(Namespacer)
+
+	// "t" + "ax" and "ta" + "x" would share a bucket without a separator
+	if !l.Namespace("t").Allow("ax") {
+		t.Error("expected to allow ax in namespace t")
+	}
+	if !l.Namespace("ta").Allow("x") {
+		t.Error("expected x in namespace ta to be independent of ax in namespace t")
+	}
+
+}
+
+func TestNamespaceRootResetAll(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, PureGo: pureGo})
+		ns := l.(Namespacer).Namespace("a")
+
+		ns.Allow("x")
+		if err := l.ResetAll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !ns.Allow("x") {
+			t.Error("expected resetting the limiter to reset its namespaces")
+		}
+
+		keys, err := ns.Keys(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != "x" {
+			t.Errorf("expected the namespace to list its key after the reset: %v", keys)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Notifier is implemented by limiters which can signal when a key has tokens
+// again. Only the in-memory Limiter implements it, the Redis Limiter cannot
+// observe buckets changed by other processes.
+type Notifier interface {
+	// Notify returns a channel closed once the given ID's token bucket has at
+	// least one token, and a function to stop waiting
+	Notify(id string) (<-chan struct{}, func())
+}
+
+// Notify returns a channel which is closed once the given key's token bucket
+// has at least one token, immediately if it has one now. Replenishment is
+// computed from the bucket's schedule and rechecked when due, so events
+// allowed in the meantime postpone the signal. The channel is never closed if
+// tokens are never added to the bucket or after cancel is called.
+func (l *inMemoryLimiter) Notify(key string) (<-chan struct{}, func()) {
+	ready := make(chan struct{})
+	done := make(chan struct{})
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+
+	go func() {
+		for {
+			d, err := l.RetryAfter(key, 1)
+			if err != nil {
+				return
+			}
+			if d <= 0 {
+				close(ready)
+				return
+			}
+
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-done:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return ready, cancel
+}
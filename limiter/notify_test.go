@@ -0,0 +1,81 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 1,
+			PureGo:     pureGo,
+		})
+		key := "foo"
+
+		if !l.Allow(key) {
+			t.Fatalf("expected to allow key: %s", key)
+		}
+		expected, err := l.RetryAfter(key, 1)
+		if err != nil || expected <= 0 {
+			t.Fatalf("expected the bucket to be empty: %v %v", expected, err)
+		}
+
+		start := time.Now()
+		ready, cancel := l.(Notifier).Notify(key)
+		defer cancel()
+
+		select {
+		case <-ready:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected to be notified")
+		}
+		if elapsed := time.Since(start); elapsed < expected-10*time.Millisecond {
+			t.Errorf("expected to be notified after %v: %v", expected, elapsed)
+		}
+		if !l.Allow(key) {
+			t.Errorf("expected to allow key once notified: %s", key)
+		}
+	}
+}
+
+func TestNotifyTokens(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1})
+
+	ready, cancel := l.(Notifier).Notify("foo")
+	defer cancel()
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("expected a key with tokens to be notified immediately")
+	}
+}
+
+func TestNotifyCancel(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	l.Allow("foo")
+
+	ready, cancel := l.(Notifier).Notify("foo")
+	cancel()
+	cancel()
+
+	select {
+	case <-ready:
+		t.Error("expected to not be notified after cancel")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyRedisUnsupported(t *testing.T) {
+	if _, ok := New(Config{Type: TypeRedis}).(Notifier); ok {
+		t.Error("expected the Redis limiter to not implement Notifier")
+	}
+}
@@ -0,0 +1,131 @@
+package limiter
+
+import (
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrConflict is returned when a token bucket is modified concurrently on
+// every attempt to take tokens from it with optimistic locking
+var ErrConflict = errors.New("limiter: token bucket modified concurrently")
+
+// defaultOptimisticRetries is how many times decisions made in transactions
+// without OptimisticRetries are retried after a conflict
+const defaultOptimisticRetries = 3
+
+// transactional returns true if token buckets are written in transactions
+// watching them, with optimistic locking or so a bucket and its overflow
+// bucket are decided atomically
+func (l *redisLimiter) transactional() bool {
+	return l.optimisticRetries > 0 || l.overflowBurst > 0 || l.atomic
+}
+
+// atomically returns a copy of the limiter deciding events in transactions
+// regardless of its configuration
+func (l *redisLimiter) atomically() *redisLimiter {
+	c := *l
+	c.atomic = true
+	return &c
+}
+
+// retries returns how many times a decision is retried after a conflict,
+// defaultOptimisticRetries for transactions without OptimisticRetries
+func (l *redisLimiter) retries() int {
+	if l.optimisticRetries == 0 && l.transactional() {
+		return defaultOptimisticRetries
+	}
+	return l.optimisticRetries
+}
+
+// watchBackend is a connBackend which writes token buckets in transactions
+// that fail if a watched key was modified since it was watched, for optimistic
+// locking without scripts
+type watchBackend struct {
+	connBackend
+}
+
+// watch watches the given keys so writes fail if any is modified
+func (b watchBackend) watch(keys ...string) error {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	_, err := b.c.Do("WATCH", args...)
+	return err
+}
+
+// create replaces any bucket pruned since it was read, which is otherwise
+// left in place by prune
+func (b watchBackend) create(key string, bk bucket) error {
+	return b.exec(func(c redis.Conn) error {
+		if _, err := c.Do("DEL", key); err != nil {
+			return err
+		}
+		return b.storage.create(c, key, bk)
+	})
+}
+
+func (b watchBackend) update(key string, bk bucket) error {
+	return b.exec(func(c redis.Conn) error { return b.storage.update(c, key, bk) })
+}
+
+// exec runs the commands sent by the given write function in a transaction,
+// returning ErrConflict if a watched key was modified
+func (b watchBackend) exec(write func(c redis.Conn) error) error {
+	if err := b.c.Send("MULTI"); err != nil {
+		return err
+	}
+	if err := write(queuedConn{b.c}); err != nil {
+		b.c.Do("DISCARD")
+		return err
+	}
+
+	return exec(b.c)
+}
+
+// exec executes the transaction queued on the given connection. EXEC replies
+// nil rather than an array when the transaction was aborted, nothing having
+// been written, which is returned as ErrConflict rather than success.
+func exec(c redis.Conn) error {
+	reply, err := c.Do("EXEC")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return ErrConflict
+	}
+	return nil
+}
+
+// failMode returns whether events are allowed after the given error. Aborted
+// transactions are denied since Redis is available and the token bucket is
+// contended, other errors result in the given key's fail open behavior.
+func (l *redisLimiter) failMode(key string, err error) bool {
+	if err == ErrConflict {
+		return false
+	}
+	return l.keyFailOpen(key)
+}
+
+// queuedConn is a redis.Conn inside a transaction which queues commands rather
+// than waiting for their replies, and ignores the nested transactions storage
+// layouts use to write atomically
+type queuedConn struct {
+	redis.Conn
+}
+
+// Do replies QUEUED as Redis does to commands in a transaction
+func (c queuedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if err := c.Send(cmd, args...); err != nil {
+		return nil, err
+	}
+	return "QUEUED", nil
+}
+
+func (c queuedConn) Send(cmd string, args ...interface{}) error {
+	if cmd == "MULTI" || cmd == "EXEC" {
+		return nil
+	}
+	return c.Conn.Send(cmd, args...)
+}
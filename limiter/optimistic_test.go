@@ -0,0 +1,180 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+// expectOptimisticTake mocks taking two tokens from a full token bucket with
+// optimistic locking of the bucket and the key's block, replying to EXEC with
+// the given reply
+func expectOptimisticTake(m *mockConn, key string, exec interface{}) {
+	m.On("Do", "WATCH", []interface{}{key, blockKey(key)}).Return("OK", nil).Once()
+	expectTake(m, key, exec)
+}
+
+// expectTake mocks taking two tokens from a full token bucket in a
+// transaction, replying to EXEC with the given reply
+func expectTake(m *mockConn, key string, exec interface{}) {
+	last := time.Now().Truncate(time.Second)
+	var n []interface{} = nil
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{[]byte("20"), []byte(fmt.Sprint(last.Unix()))}, nil,
+	).Once()
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 0, 18.0}).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 1, last.Unix()}).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return(exec, nil).Once()
+}
+
+func TestRedisOptimisticRetry(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.optimisticRetries = 1
+	key := "foo"
+
+	// the bucket is modified between the first read and EXEC, which aborts
+	// the transaction, so it is read and written again
+	expectOptimisticTake(m, key, nil)
+	expectOptimisticTake(m, key, []interface{}{"OK", "OK"})
+
+	allowed, remaining, err := l.AllowNWithRemaining(key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || remaining != 18 {
+		t.Errorf("expected to allow key after retrying: %v %v", allowed, remaining)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisOptimisticConflict(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.optimisticRetries = 1
+	key := "foo"
+
+	expectOptimisticTake(m, key, nil)
+	expectOptimisticTake(m, key, nil)
+
+	allowed, _, err := l.AllowNWithRemaining(key, 2)
+	if err != ErrConflict {
+		t.Errorf("expected a conflict once retries are exhausted: %v", err)
+	}
+	if allowed {
+		t.Error("expected to not allow key without failing open")
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisOptimisticConflictFailOpen(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.optimisticRetries = 1
+	l.failOpen = true
+	key := "foo"
+
+	expectOptimisticTake(m, key, nil)
+	expectOptimisticTake(m, key, nil)
+
+	// redis is available, so an aborted transaction does not fail open
+	allowed, _, err := l.AllowNWithRemaining(key, 2)
+	if err != ErrConflict {
+		t.Errorf("expected a conflict once retries are exhausted: %v", err)
+	}
+	if allowed {
+		t.Error("expected to deny key rather than fail open")
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisNilExec(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.failOpen = true
+	key := "foo"
+
+	// a nil EXEC wrote nothing, so the events are not allowed as if it had
+	expectTake(m, key, nil)
+
+	allowed, _, err := l.AllowNWithRemaining(key, 2)
+	if err != ErrConflict {
+		t.Errorf("expected a conflict for a nil EXEC: %v", err)
+	}
+	if allowed {
+		t.Error("expected to deny key rather than fail open")
+	}
+	m.AssertExpectations(t)
+}
+
+// sharedConn is a connection shared by several backends, left open when they
+// are closed
+type sharedConn struct {
+	redis.Conn
+}
+
+func (c sharedConn) Close() error {
+	return nil
+}
+
+func TestRedisNilExecRetry(t *testing.T) {
+	m := &mockConn{}
+	l := New(Config{
+		Type:              TypeRedis,
+		RateLimit:         10,
+		BurstLimit:        20,
+		OptimisticRetries: 1,
+	}).(*redisLimiter)
+	l.newBackend = func() backend {
+		return connBackend{c: sharedConn{m}, storage: l.storage}
+	}
+	m.On("Do", "EXISTS", []interface{}{blockKey("foo")}).Return(int64(0), nil)
+	key := "foo"
+
+	// without WATCH an aborted transaction is retried the same way
+	expectTake(m, key, nil)
+	expectTake(m, key, []interface{}{"OK", "OK"})
+
+	allowed, remaining, err := l.AllowNWithRemaining(key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || remaining != 18 {
+		t.Errorf("expected to allow key after retrying: %v %v", allowed, remaining)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisOptimistic(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		s.FlushAll()
+		l := New(Config{
+			Type:              TypeRedis,
+			Address:           s.Addr(),
+			RateLimit:         1,
+			BurstLimit:        2,
+			Interval:          time.Hour,
+			StorageLayout:     layout,
+			OptimisticRetries: 3,
+		})
+
+		for i := 0; i < 2; i++ {
+			if allowed, _, err := l.AllowNWithRemaining("foo", 1); err != nil || !allowed {
+				t.Errorf("expected to allow event %d with layout %d: %v", i, layout, err)
+			}
+		}
+		if l.Allow("foo") {
+			t.Errorf("expected to deny once the burst is taken with layout %d", layout)
+		}
+		if tokens, _ := l.Tokens("foo"); tokens != 0 {
+			t.Errorf("expected the burst to be taken with layout %d: %v", layout, tokens)
+		}
+	}
+}
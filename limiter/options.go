@@ -0,0 +1,249 @@
+package limiter
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Option overrides a setting for a single AllowWith call
+type Option func(*allowOptions)
+
+// allowOptions are the settings of an AllowWith call, nil overrides keep the
+// limiter's settings
+type allowOptions struct {
+	n        int
+	cost     int
+	costed   bool
+	rate     *float64
+	burst    *int
+	at       time.Time
+	labels   map[string]string
+	failOpen *bool
+}
+
+// WithN sets the number of events, one by default
+func WithN(n int) Option {
+	return func(o *allowOptions) {
+		o.n = n
+	}
+}
+
+// WithCost sets the tokens each event takes, one by default
+func WithCost(cost int) Option {
+	return func(o *allowOptions) {
+		o.cost = cost
+		o.costed = true
+	}
+}
+
+// WithRate overrides the rate limit as AllowDynamic does, bounded by
+// Config.MaxDynamicRate
+func WithRate(rate float64) Option {
+	return func(o *allowOptions) {
+		o.rate = &rate
+	}
+}
+
+// WithBurst overrides the burst limit as AllowDynamic does, bounded by
+// Config.MaxDynamicBurst
+func WithBurst(burst int) Option {
+	return func(o *allowOptions) {
+		o.burst = &burst
+	}
+}
+
+// WithTime decides the events as if it were the given time rather than now
+func WithTime(t time.Time) Option {
+	return func(o *allowOptions) {
+		o.at = t
+	}
+}
+
+// WithLabels rate limits the events in a token bucket of their own for the
+// given labels, so the same labels share a bucket regardless of their order
+func WithLabels(labels map[string]string) Option {
+	return func(o *allowOptions) {
+		o.labels = labels
+	}
+}
+
+// WithFailMode overrides Config.FailOpen and any key's stored override. It
+// only applies to the Redis Limiter, the in-memory Limiter's storage cannot
+// fail.
+func WithFailMode(failOpen bool) Option {
+	return func(o *allowOptions) {
+		o.failOpen = &failOpen
+	}
+}
+
+// newAllowOptions applies the given options in order, later options
+// overriding earlier ones
+func newAllowOptions(opts []Option) allowOptions {
+	o := allowOptions{n: 1, cost: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// tokens returns the tokens the events take
+func (o allowOptions) tokens() int {
+	return o.n * o.cost
+}
+
+// dynamic returns true if the rate or burst limit is overridden
+func (o allowOptions) dynamic() bool {
+	return o.rate != nil || o.burst != nil
+}
+
+// limits returns the overridden rate and burst limits, the given limits where
+// they are not overridden
+func (o allowOptions) limits(rate float64, burst int) (float64, int) {
+	if o.rate != nil {
+		rate = *o.rate
+	}
+	if o.burst != nil {
+		burst = *o.burst
+	}
+	return rate, burst
+}
+
+// labeledKey returns the key of the token bucket for the given key and labels,
+// the key itself if there are no labels. Labels are joined by keySeparator so
+// labeled keys never collide with an ID, which is why the key and labels may
+// not contain it.
+func labeledKey(key string, labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return key, nil
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if strings.Contains(key, keySeparator) {
+		return "", ErrReservedKey
+	}
+	var b strings.Builder
+	b.WriteString(suffixedKey(key, "labels"))
+	for _, name := range names {
+		if strings.Contains(name, keySeparator) || strings.Contains(labels[name], keySeparator) {
+			return "", ErrReservedKey
+		}
+		b.WriteString(keySeparator + name + keySeparator + labels[name])
+	}
+	return b.String(), nil
+}
+
+// labeled returns the limiter with keys built by labeledKey permitted, or the
+// limiter itself if there are no labels
+func (l *redisLimiter) labeled(labels map[string]string) *redisLimiter {
+	if len(labels) == 0 {
+		return l
+	}
+	c := *l
+	c.keyLength.labeled = true
+	return &c
+}
+
+func (l *inMemoryLimiter) labeled(labels map[string]string) *inMemoryLimiter {
+	if len(labels) == 0 {
+		return l
+	}
+	c := *l
+	c.keyLength.labeled = true
+	return &c
+}
+
+// AllowWith returns true if the events described by the given options may
+// happen for the given key, false otherwise, along with any storage error.
+// Without options it is Allow. Rate or burst overrides are decided as
+// AllowDynamic does, ignoring scheduled limits and key intervals.
+func (l *redisLimiter) AllowWith(key string, opts ...Option) (bool, error) {
+	o := newAllowOptions(opts)
+	if o.costed && l.observeCost != nil {
+		l.observeCost(key, float64(o.tokens()))
+	}
+	n := o.tokens()
+	key, err := labeledKey(key, o.labels)
+	if err != nil {
+		l.counts.record(n, false, err)
+		return false, err
+	}
+	l = l.labeled(o.labels)
+
+	if !o.at.IsZero() || o.failOpen != nil {
+		c := *l
+		if !o.at.IsZero() {
+			c.now = func() time.Time { return o.at }
+		}
+		if o.failOpen != nil {
+			c.failOpen = *o.failOpen
+			c.failOpens = nil
+		}
+		l = &c
+	}
+
+	var rate float64
+	var burst int
+	if o.dynamic() {
+		rate, burst, err = l.dynamic.limits(o.limits(l.rate, l.burst))
+		if err != nil {
+			l.counts.record(n, false, err)
+			return false, err
+		}
+	} else {
+		l = l.keyed(key)
+		rate, burst = l.rate, l.burst
+	}
+
+	// layered and sampled events are decided locally and do not surface errors
+	if l.layered != nil || l.sampler != nil {
+		return l.allowN(key, n, rate, burst), nil
+	}
+	allowed, _, err := l.allowNRemaining(key, n, rate, burst)
+	return allowed, err
+}
+
+func (l *inMemoryLimiter) AllowWith(key string, opts ...Option) (bool, error) {
+	o := newAllowOptions(opts)
+	if o.costed && l.observeCost != nil {
+		l.observeCost(key, float64(o.tokens()))
+	}
+	n := o.tokens()
+	key, err := labeledKey(key, o.labels)
+	if err != nil {
+		l.counts.record(n, false, err)
+		return false, err
+	}
+	l = l.labeled(o.labels)
+
+	if !o.at.IsZero() {
+		c := *l
+		c.now = func() time.Time { return o.at }
+		l = &c
+	}
+
+	var ratelimit float64
+	var burst int
+	if o.dynamic() {
+		ratelimit, burst, err = l.dynamic.limits(o.limits(l.rate, l.burst))
+		if err != nil {
+			l.counts.record(n, false, err)
+			return false, err
+		}
+	} else {
+		l = l.keyed(key)
+		ratelimit, burst = l.rate, l.burst
+	}
+
+	allowed, _, err := l.allowNRemaining(key, n, ratelimit, burst)
+	return allowed, err
+}
+
+func (l *disabledLimiter) AllowWith(key string, opts ...Option) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAllowWith(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		l := New(config)
+
+		// two events costing two tokens each from a bucket of five
+		labels := map[string]string{"endpoint": "/search", "method": "GET"}
+		if allowed, err := l.AllowWith("foo", WithN(2), WithCost(2), WithBurst(5), WithLabels(labels)); err != nil || !allowed {
+			t.Errorf("%s: expected four tokens to be taken: %v", name, err)
+		}
+		same := map[string]string{"method": "GET", "endpoint": "/search"}
+		if allowed, _ := l.AllowWith("foo", WithCost(2), WithBurst(5), WithLabels(same)); allowed {
+			t.Errorf("%s: expected the labeled bucket to have one token", name)
+		}
+		if allowed, _ := l.AllowWith("foo", WithBurst(5), WithLabels(same)); !allowed {
+			t.Errorf("%s: expected the last token to be taken", name)
+		}
+
+		// other labels and the unlabeled key have buckets of their own
+		other := map[string]string{"endpoint": "/login", "method": "GET"}
+		if allowed, _ := l.AllowWith("foo", WithN(2), WithCost(2), WithBurst(5), WithLabels(other)); !allowed {
+			t.Errorf("%s: expected other labels to be allowed", name)
+		}
+		if !l.Allow("foo") {
+			t.Errorf("%s: expected the unlabeled key to be allowed", name)
+		}
+		if l.Allow("foo") {
+			t.Errorf("%s: expected the unlabeled key to have the default burst", name)
+		}
+	}
+}
+
+func TestAllowWithLabelsSeparated(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		l := New(config)
+
+		// a labeled key does not share a bucket with an ID spelling it out
+		if allowed, err := l.AllowWith("a", WithLabels(map[string]string{"b": "c"})); err != nil || !allowed {
+			t.Errorf("%s: expected the labeled key to be allowed: %v", name, err)
+		}
+		if !l.Allow("a:b=c") {
+			t.Errorf("%s: expected the ID to have a bucket of its own", name)
+		}
+
+		labels := map[string]string{"b": "c" + keySeparator}
+		if _, err := l.AllowWith("a", WithLabels(labels)); err != ErrReservedKey {
+			t.Errorf("%s: expected a label containing the separator to be reserved, got %v", name, err)
+		}
+	}
+}
+
+func TestAllowWithTime(t *testing.T) {
+	s := miniredis.RunT(t)
+	at := time.Now().Truncate(time.Hour).Add(time.Minute)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+
+		if allowed, err := l.AllowWith("foo", WithTime(at), WithN(2)); err != nil || !allowed {
+			t.Errorf("%s: expected the burst to be taken: %v", name, err)
+		}
+		if allowed, _ := l.AllowWith("foo", WithTime(at)); allowed {
+			t.Errorf("%s: expected to be limited at the same time", name)
+		}
+		if allowed, _ := l.AllowWith("foo", WithTime(at.Add(time.Hour))); !allowed {
+			t.Errorf("%s: expected a token an interval later", name)
+		}
+	}
+}
+
+func TestAllowWithFailMode(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	s.Close()
+
+	// the configured fail closed behavior is overridden per call
+	if allowed, err := l.AllowWith("foo", WithFailMode(true)); err == nil || !allowed {
+		t.Errorf("expected to fail open with an error, got %v, %v", allowed, err)
+	}
+	if allowed, err := l.AllowWith("foo"); err == nil || allowed {
+		t.Errorf("expected to fail closed with an error, got %v, %v", allowed, err)
+	}
+}
+
+func TestAllowWithDynamicBounds(t *testing.T) {
+	l := New(Config{
+		Type:                     TypeInMemory,
+		RateLimit:                1,
+		BurstLimit:               1,
+		Interval:                 time.Hour,
+		MaxDynamicBurst:          2,
+		RejectDynamicOutOfBounds: true,
+	})
+
+	if allowed, err := l.AllowWith("foo", WithBurst(3)); err != ErrDynamicLimit || allowed {
+		t.Errorf("expected ErrDynamicLimit, got %v, %v", allowed, err)
+	}
+}
+
+func TestDisabledAllowWith(t *testing.T) {
+	if allowed, _ := New(Config{Type: TypeDisabled}).AllowWith("foo", WithN(100)); !allowed {
+		t.Error("expected the disabled limiter to allow")
+	}
+	if allowed, _ := New(Config{Type: TypeBlockAll}).AllowWith("foo"); allowed {
+		t.Error("expected the block all limiter to deny")
+	}
+}
@@ -0,0 +1,103 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// penaltyKey returns the key counting the given key's denials while it is
+// penalized
+func penaltyKey(key string) string {
+	return suffixedKey(key, "penalty")
+}
+
+// penalizeScript counts a denial, restarting the quiet period after which the
+// count expires.
+//
+// KEYS[1] penalty key
+// ARGV[1] quiet period (milliseconds)
+var penalizeScript = newScript(1, `
+local count = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+return count
+`)
+
+// penalizedBurst returns the given burst limit lowered by one for each denial,
+// but not below the floor or raised to it
+func penalizedBurst(burst int, denials int64, floor int) int {
+	if int64(burst)-denials >= int64(floor) {
+		return burst - int(denials)
+	}
+	if floor < burst {
+		return floor
+	}
+	return burst
+}
+
+// penalty returns the burst limit in effect for the given key while it is
+// penalized
+func (l *redisLimiter) penalty(db backend, key string, burst int) (int, error) {
+	if l.penaltyQuiet == 0 {
+		return burst, nil
+	}
+
+	denials, err := redis.Int64(db.get(penaltyKey(key)))
+	if err == redis.ErrNil {
+		return burst, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return penalizedBurst(burst, denials, l.penaltyFloor), nil
+}
+
+// penalize counts a denial of the given key if penalties are enabled.
+// Penalties are best effort so errors are ignored.
+func (l *redisLimiter) penalize(db backend, key string) {
+	if l.penaltyQuiet == 0 {
+		return
+	}
+	db.eval(penalizeScript, penaltyKey(key), l.penaltyQuiet.Milliseconds())
+}
+
+// penalty returns the burst limit in effect for the given key while it is
+// penalized. Denials are counted alongside calendar window counts, the window
+// starting at the last denial.
+func (l *inMemoryLimiter) penalty(key string, burst int) int {
+	if l.penaltyQuiet == 0 {
+		return burst
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	w, ok := l.windows[penaltyKey(key)]
+	if !ok || l.quiet(w.start) {
+		return burst
+	}
+	return penalizedBurst(burst, int64(w.count), l.penaltyFloor)
+}
+
+// penalize counts a denial of the given key if penalties are enabled
+func (l *inMemoryLimiter) penalize(key string) {
+	if l.penaltyQuiet == 0 {
+		return
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	w, ok := l.windows[penaltyKey(key)]
+	if !ok || l.quiet(w.start) {
+		w = &windowCount{}
+		l.windows[penaltyKey(key)] = w
+	}
+	w.start = l.now()
+	w.count++
+}
+
+// quiet returns true if the quiet period has passed since the given denial
+func (l *inMemoryLimiter) quiet(denied time.Time) bool {
+	return !l.now().Before(denied.Add(l.penaltyQuiet))
+}
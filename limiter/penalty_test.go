@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestPenalizedBurst(t *testing.T) {
+	for _, tc := range []struct {
+		burst   int
+		denials int64
+		floor   int
+		penalty int
+	}{
+		{5, 0, 1, 5},
+		{5, 3, 1, 2},
+		{5, 10, 1, 1},
+		{5, 10, 2, 2},
+		{2, 1, 3, 2},
+	} {
+		if burst := penalizedBurst(tc.burst, tc.denials, tc.floor); burst != tc.penalty {
+			t.Errorf("expected burst %d after %d denials with floor %d to be %d: %d",
+				tc.burst, tc.denials, tc.floor, tc.penalty, burst)
+		}
+	}
+}
+
+func TestPenalty(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 5
+		config.PenaltyQuiet = 10 * time.Second
+		config.PenaltyFloor = 2
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+		advance := func(d time.Duration) {
+			now = now.Add(d)
+			s.FastForward(d)
+		}
+
+		// allowed returns the number of events allowed before the first denial
+		allowed := func() int {
+			for i := 0; ; i++ {
+				if !l.Allow("foo") {
+					return i
+				}
+			}
+		}
+
+		if n := allowed(); n != 5 {
+			t.Fatalf("%s: expected the full burst to be allowed: %d", name, n)
+		}
+
+		// sustained overuse lowers the effective burst to the floor
+		for i := 0; i < 5; i++ {
+			l.Allow("foo")
+		}
+		advance(5 * time.Second)
+		if n := allowed(); n != 2 {
+			t.Errorf("%s: expected the penalized burst to be allowed: %d", name, n)
+		}
+
+		// backing off for the quiet period restores the burst, the bucket
+		// then refills up to it
+		advance(11 * time.Second)
+		if !l.Allow("foo") {
+			t.Fatalf("%s: expected to allow after backing off", name)
+		}
+		advance(4 * time.Second)
+		if n := allowed(); n != 5 {
+			t.Errorf("%s: expected the full burst to be restored: %d", name, n)
+		}
+	}
+}
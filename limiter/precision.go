@@ -0,0 +1,48 @@
+package limiter
+
+import (
+	"math"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// defaultTokenPrecision is the number of decimal places tokens are stored
+// with when not configured
+const defaultTokenPrecision = 6
+
+// tokenPrecision is the number of decimal places tokens are rounded to before
+// they are stored, a negative precision stores tokens unrounded
+type tokenPrecision int
+
+// round returns the given tokens rounded to the precision
+func (p tokenPrecision) round(tokens float64) float64 {
+	if p < 0 {
+		return tokens
+	}
+	scale := math.Pow10(int(p))
+	return math.Round(tokens*scale) / scale
+}
+
+// roundedStorage rounds the tokens of token buckets before writing them so
+// repeated fractional updates of long lived buckets do not drift
+type roundedStorage struct {
+	storage
+	precision tokenPrecision
+}
+
+func (s roundedStorage) create(c redis.Conn, key string, b bucket) error {
+	b.tokens = s.precision.round(b.tokens)
+	return s.storage.create(c, key, b)
+}
+
+func (s roundedStorage) update(c redis.Conn, key string, b bucket) error {
+	b.tokens = s.precision.round(b.tokens)
+	return s.storage.update(c, key, b)
+}
+
+// setBucket stores the given key's token bucket with its tokens rounded to the
+// configured precision. The caller must hold the lock.
+func (l *inMemoryLimiter) setBucket(key string, tokens float64, now time.Time) {
+	l.buckets[key] = bucket{tokens: l.precision.round(tokens), last: now.Unix()}
+}
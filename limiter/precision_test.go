@@ -0,0 +1,108 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestTokenPrecisionRound(t *testing.T) {
+	for _, tc := range []struct {
+		precision tokenPrecision
+		tokens    float64
+		rounded   float64
+	}{
+		{6, 0.1 + 0.2, 0.3},
+		{6, 2.0000004, 2},
+		{6, 2.0000006, 2.000001},
+		{2, 1.005001, 1.01},
+		{0, 1.6, 2},
+		{-1, 0.1 + 0.2, 0.1 + 0.2},
+	} {
+		if rounded := tc.precision.round(tc.tokens); rounded != tc.rounded {
+			t.Errorf("expected %v rounded to %d places to be %v: %v", tc.tokens, tc.precision, tc.rounded, rounded)
+		}
+	}
+}
+
+// tokenPrecisionSteps is the number of fractional refills simulated
+const tokenPrecisionSteps = 5000
+
+// expectedPrecisionTokens returns the tokens stored in a bucket with a burst
+// of 10 and a rate of 0.3 per interval after trying to take a token each
+// interval, counting in tenths of a token to avoid floating point error
+func expectedPrecisionTokens(steps int) float64 {
+	stored, pending := 90, 0
+	for i := 0; i < steps; i++ {
+		pending += 3
+		if tenths := stored + pending; tenths >= 10 {
+			stored, pending = tenths-10, 0
+		}
+	}
+	return float64(stored) / 10
+}
+
+func TestRedisTokenPrecision(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		s.FlushAll()
+		l := New(Config{
+			Type:          TypeRedis,
+			Address:       s.Addr(),
+			RateLimit:     0.3,
+			BurstLimit:    10,
+			StorageLayout: layout,
+		}).(*redisLimiter)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		l.now = func() time.Time { return now }
+
+		l.Allow("foo")
+		for i := 0; i < tokenPrecisionSteps; i++ {
+			now = now.Add(time.Second)
+			l.Allow("foo")
+		}
+
+		c := l.pool.Get()
+		b, _, err := l.storage.read(c, "foo", false)
+		c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := expectedPrecisionTokens(tokenPrecisionSteps); b.tokens != expected {
+			t.Errorf("expected layout %d to store %v tokens: %v", layout, expected, b.tokens)
+		}
+	}
+}
+
+func TestInMemoryTokenPrecision(t *testing.T) {
+	for _, precision := range []int{0, 3} {
+		l := New(Config{
+			Type:           TypeInMemory,
+			RateLimit:      0.3,
+			BurstLimit:     10,
+			PureGo:         true,
+			TokenPrecision: precision,
+		}).(*inMemoryLimiter)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		l.now = func() time.Time { return now }
+
+		l.Allow("foo")
+		for i := 0; i < tokenPrecisionSteps; i++ {
+			now = now.Add(time.Second)
+			l.Allow("foo")
+		}
+
+		tokens := l.buckets["foo"].tokens
+		if tokens != l.precision.round(tokens) {
+			t.Errorf("expected tokens rounded to %d places: %v", l.precision, tokens)
+		}
+		if expected := expectedPrecisionTokens(tokenPrecisionSteps); tokens != expected {
+			t.Errorf("expected %v tokens: %v", expected, tokens)
+		}
+	}
+}
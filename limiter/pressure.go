@@ -0,0 +1,49 @@
+package limiter
+
+import "math"
+
+// Pressure aggregates the token buckets of a set of keys into a single
+// measure of how close they are to their rate limits
+type Pressure struct {
+	// Keys is the number of keys sampled
+	Keys int
+	// MinRemaining is the fewest tokens remaining in any sampled bucket
+	MinRemaining float64
+	// MeanUtilization is the mean fraction of the burst limit used by the
+	// sampled buckets, from 0 for full buckets to 1 for empty ones
+	MeanUtilization float64
+	// Empty is the number of sampled buckets without tokens
+	Empty int
+}
+
+// SamplePressure returns the Pressure of the given keys' token buckets read
+// with Tokens. Buckets in debt count as empty and fully utilized. It is a
+// read-only point-in-time sample: events allowed while sampling may not be
+// reflected.
+func SamplePressure(l Limiter, keys []string) (Pressure, error) {
+	p := Pressure{Keys: len(keys)}
+	if len(keys) == 0 {
+		return p, nil
+	}
+
+	burst := float64(l.Burst())
+	p.MinRemaining = math.Inf(1)
+
+	var utilization float64
+	for _, key := range keys {
+		tokens, err := l.Tokens(key)
+		if err != nil {
+			return Pressure{}, err
+		}
+
+		p.MinRemaining = math.Min(p.MinRemaining, tokens)
+		if tokens <= 0 {
+			p.Empty++
+		}
+		if burst > 0 {
+			utilization += 1 - math.Max(math.Min(tokens, burst), 0)/burst
+		}
+	}
+	p.MeanUtilization = utilization / float64(len(keys))
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSamplePressure(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 10,
+			Interval:   time.Hour,
+			PureGo:     pureGo,
+		})
+
+		// foo is full, bar has 5 tokens, baz and qux are empty
+		l.AllowN("bar", 5)
+		l.AllowN("baz", 10)
+		l.AllowN("qux", 10)
+
+		p, err := SamplePressure(l, []string{"foo", "bar", "baz", "qux"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Pressure{Keys: 4, MinRemaining: 0, MeanUtilization: 0.625, Empty: 2}
+		if p != expected {
+			t.Errorf("expected %+v: %+v", expected, p)
+		}
+	}
+}
+
+func TestSamplePressureNoKeys(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 10})
+	if p, err := SamplePressure(l, nil); p != (Pressure{}) || err != nil {
+		t.Errorf("expected no pressure: %+v %v", p, err)
+	}
+}
+
+func TestSamplePressureError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "LRANGE", []interface{}{"foo", 0, 1}).Return(nil, errors.New("not good")).Once()
+
+	if _, err := SamplePressure(l, []string{"foo"}); err == nil {
+		t.Error("expected an error")
+	}
+}
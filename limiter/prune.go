@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"time"
+)
+
+// prune deletes the given key if pruning full buckets is enabled and the given
+// tokens fill its bucket, returning true if the key was deleted. A full bucket
+// is indistinguishable from a missing one so idle keys prune themselves rather
+// than lingering in Redis. A watched key is instead deleted by the transaction
+// recreating it, as deleting it first would abort the transaction.
+func (l *redisLimiter) prune(db backend, key string, tokens float64, burst int) (bool, error) {
+	if !l.pruneFull || tokens < float64(burst) {
+		return false, nil
+	}
+	if _, ok := db.(watchBackend); ok {
+		return true, nil
+	}
+	if err := db.del(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// prune deletes the given key's token bucket if it was seeded with a TTL which
+// has passed, or if pruning full buckets is enabled and the bucket is full. The
+// caller must hold the lock.
+func (l *inMemoryLimiter) prune(key string, ratelimit float64, burst int, now time.Time) {
+	if l.expired(key) {
+		delete(l.buckets, key)
+		delete(l.limiters, key)
+		delete(l.states, key)
+		delete(l.expires, key)
+	}
+
+	if !l.pruneFull {
+		return
+	}
+
+	if l.pureGo {
+		if b, ok := l.buckets[key]; ok && refill(b, now, l.interval, ratelimit, burst) >= float64(burst) {
+			delete(l.buckets, key)
+			b.state = l.states[key]
+			l.evicted(key, bucketState(b))
+		}
+		return
+	}
+
+	if limiter, ok := l.limiters[key]; ok && limiterTokens(limiter, now) >= float64(burst) {
+		delete(l.limiters, key)
+		l.evicted(key, BucketState{
+			Tokens:     limiterTokens(limiter, now),
+			LastUpdate: now,
+			State:      l.states[key],
+		})
+	}
+}
+
+// expired returns true if the given key's token bucket was seeded with a TTL
+// which has passed. The caller must hold the lock.
+func (l *inMemoryLimiter) expired(key string) bool {
+	until, ok := l.expires[key]
+	return ok && !l.now().Before(until)
+}
+
+// evicted calls the configured OnEvict callback, if any, with the ID and final
+// state of an evicted token bucket. The callback runs in its own goroutine so
+// it neither holds up the event being decided nor runs under the lock.
+func (l *inMemoryLimiter) evicted(key string, state BucketState) {
+	if l.onEvict == nil {
+		return
+	}
+	go l.onEvict(l.keyLength.id(key), state)
+}
@@ -0,0 +1,203 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRedisPruneFullBucket(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.pruneFull = true
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	// a bucket last updated a minute ago has completely refilled
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Minute).Unix())),
+		}, nil,
+	).Once()
+	m.On("Do", "DEL", []interface{}{key}).Return(int64(1), nil).Once()
+
+	tokens, err := l.Tokens(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens != float64(l.burst) {
+		t.Errorf("expected %v tokens: %v", l.burst, tokens)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisPruneFullBucketRecreate(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.pruneFull = true
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Minute).Unix())),
+		}, nil,
+	).Once()
+
+	// the full bucket is deleted and recreated as a new bucket
+	m.On("Do", "DEL", []interface{}{key}).Return(int64(1), nil).Once()
+	m.On(
+		"Do", "LPUSH", []interface{}{key, now.Unix(), float64(l.burst - 1)},
+	).Return(int64(2), nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisPruneFullBucketWatched(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.pruneFull = true
+	l.optimisticRetries = 1
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+	var n []interface{} = nil
+
+	m.On("Do", "WATCH", []interface{}{key, blockKey(key)}).Return("OK", nil).Once()
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Minute).Unix())),
+		}, nil,
+	).Once()
+
+	// deleting the watched bucket before the transaction would abort it, so
+	// it is deleted by the transaction recreating it
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "DEL", []interface{}{key}).Return(nil).Once()
+	m.On(
+		"Send", "LPUSH", []interface{}{key, now.Unix(), float64(l.burst - 1)},
+	).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{int64(1), int64(2)}, nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	m.AssertNotCalled(t, "Do", "DEL", []interface{}{key})
+	m.AssertExpectations(t)
+}
+
+func TestRedisPruneRefillingBucket(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.pruneFull = true
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Second).Unix())),
+		}, nil,
+	).Once()
+
+	if tokens, _ := l.Tokens(key); tokens != l.rate {
+		t.Errorf("expected %v tokens: %v", l.rate, tokens)
+	}
+	m.AssertNotCalled(t, "Do", "DEL", []interface{}{key})
+}
+
+func TestInMemoryPruneFullBucket(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:             TypeInMemory,
+			RateLimit:        1,
+			BurstLimit:       2,
+			PureGo:           pureGo,
+			PruneFullBuckets: true,
+		}).(*inMemoryLimiter)
+		now := time.Now().Truncate(time.Second)
+		l.now = func() time.Time { return now }
+		key := "foo"
+
+		l.AllowN(key, 2)
+		if !exists(t, l, key) {
+			t.Fatalf("expected key to exist: %s", key)
+		}
+
+		// the bucket has not refilled
+		now = now.Add(time.Second)
+		l.Tokens(key)
+		if !exists(t, l, key) {
+			t.Errorf("expected refilling key to exist: %s", key)
+		}
+
+		// the bucket has refilled and is deleted on the next access
+		now = now.Add(time.Second)
+		if tokens, _ := l.Tokens(key); tokens != 2 {
+			t.Errorf("expected 2 tokens: %v", tokens)
+		}
+		if exists(t, l, key) {
+			t.Errorf("expected full key to be deleted: %s", key)
+		}
+
+		// a full bucket is recreated when tokens are taken
+		if !l.AllowN(key, 2) {
+			t.Errorf("expected to allow key: %s", key)
+		}
+		if tokens, _ := l.Tokens(key); tokens != 0 {
+			t.Errorf("expected 0 tokens: %v", tokens)
+		}
+	}
+}
+
+func TestInMemoryPruneOnEvict(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		type eviction struct {
+			id    string
+			state BucketState
+		}
+		evictions := make(chan eviction, 1)
+
+		l := New(Config{
+			Type:             TypeInMemory,
+			RateLimit:        1,
+			BurstLimit:       2,
+			PureGo:           pureGo,
+			PruneFullBuckets: true,
+			OnEvict: func(id string, state BucketState) {
+				evictions <- eviction{id, state}
+			},
+		}).(*inMemoryLimiter)
+		start := time.Now().Truncate(time.Second)
+		now := start
+		l.now = func() time.Time { return now }
+
+		l.AllowN("foo", 2)
+		now = now.Add(2 * time.Second)
+		l.Tokens("foo")
+
+		// PureGo reports the stored bucket, a rate.Limiter its tokens now
+		expected := BucketState{Tokens: 2, LastUpdate: now}
+		if pureGo {
+			expected = BucketState{Tokens: 0, LastUpdate: start}
+		}
+
+		select {
+		case e := <-evictions:
+			if e.id != "foo" || e.state.Tokens != expected.Tokens || !e.state.LastUpdate.Equal(expected.LastUpdate) {
+				t.Errorf("expected foo to be evicted with %+v: %+v", expected, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected OnEvict to be called")
+		}
+	}
+}
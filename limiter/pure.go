@@ -0,0 +1,37 @@
+package limiter
+
+import (
+	"time"
+)
+
+// takeBucket returns true if the given key's token bucket has enough tokens
+// for the given number of events, false otherwise. Unlike the rate.Limiter
+// based in-memory limiter, it uses the same token bucket math as the Redis
+// limiter so both replenish tokens identically. The tokens remaining in the
+// bucket are also returned.
+func (l *inMemoryLimiter) takeBucket(key string, n int, ratelimit float64, burst int, now time.Time) (bool, float64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.prune(key, ratelimit, burst, now)
+
+	// tokens may be drawn down to, but not beyond, the configured minimum
+	tokens := l.tokens(key, ratelimit, burst, now)
+	if tokens-float64(n) < l.minTokens {
+		return false, tokens
+	}
+
+	l.setBucket(key, tokens-float64(n), now)
+	return true, tokens - float64(n)
+}
+
+// tokens returns the tokens in the given key's token bucket after allotment
+// rounded to the configured precision, a new bucket starts full unless the
+// process is cold starting. The caller must hold the lock.
+func (l *inMemoryLimiter) tokens(key string, ratelimit float64, burst int, now time.Time) float64 {
+	b, ok := l.buckets[key]
+	if !ok {
+		return l.precision.round(l.coldStart.fill(burst, l.now()))
+	}
+	return l.precision.round(refill(b, now, l.interval, ratelimit, burst))
+}
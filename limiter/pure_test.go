@@ -0,0 +1,87 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPureGoMatchesRedis(t *testing.T) {
+	config := Config{
+		RateLimit:  1.5,
+		BurstLimit: 4,
+		Interval:   2 * time.Second,
+		MinTokens:  -1,
+	}
+	now := time.Now().Truncate(time.Hour)
+	clock := func() time.Time { return now }
+
+	config.Type = TypeRedis
+	r := New(config).(*redisLimiter)
+	db := newFakeBackend()
+	r.now = clock
+
+	config.Type = TypeInMemory
+	config.PureGo = true
+	m := New(config).(*inMemoryLimiter)
+	m.now = clock
+
+	key := "foo"
+	for i, step := range []struct {
+		elapsed time.Duration
+		n       int
+	}{
+		{0, 3}, {0, 2}, {0, 1}, {time.Second, 1}, {time.Second, 2},
+		{3 * time.Second, 1}, {10 * time.Second, 5}, {10 * time.Second, 4},
+		{0, 1}, {2 * time.Second, 1}, {0, 1}, {time.Minute, 6},
+	} {
+		now = now.Add(step.elapsed)
+
+		allowed, _, err := r.take(db, key, step.n, r.rate, r.burst, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.AllowN(key, step.n) != allowed {
+			t.Fatalf("expected step %d to match redis decision: %v", i, allowed)
+		}
+		if db.buckets[key] != m.buckets[key] {
+			t.Fatalf("expected step %d to match redis bucket %+v: %+v",
+				i, db.buckets[key], m.buckets[key])
+		}
+	}
+}
+
+func TestPureGoLimiter(t *testing.T) {
+	l := New(Config{
+		Type:          TypeInMemory,
+		RateLimit:     1,
+		BurstLimit:    2,
+		OverflowRate:  1,
+		OverflowBurst: 1,
+		PureGo:        true,
+	}).(*inMemoryLimiter)
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+	key := "foo"
+
+	if !l.AllowN(key, 2) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key from its overflow bucket: %s", key)
+	}
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+
+	now = now.Add(time.Second)
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key after replenishment: %s", key)
+	}
+
+	if allowed, _ := l.AllowChild("bar", "a", 2); !allowed {
+		t.Error("expected to allow child a")
+	}
+	if allowed, _ := l.AllowChild("bar", "b", 1); allowed {
+		t.Error("expected the exhausted parent to throttle child b")
+	}
+}
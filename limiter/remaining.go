@@ -0,0 +1,22 @@
+package limiter
+
+import "math"
+
+// AllowNWithRemaining returns true if the given key has not breached the global
+// rate limit, false otherwise, along with the tokens remaining in its bucket
+// as written by the same round trip. With calendar windows the queries
+// remaining in the current window are returned. Redis server errors are
+// returned alongside the configured fail open behavior.
+func (l *redisLimiter) AllowNWithRemaining(key string, n int) (bool, float64, error) {
+	l = l.keyed(key)
+	return l.allowNRemaining(key, n, l.rate, l.burst)
+}
+
+func (l *inMemoryLimiter) AllowNWithRemaining(key string, n int) (bool, float64, error) {
+	l = l.keyed(key)
+	return l.allowNRemaining(key, n, l.rate, l.burst)
+}
+
+func (l *disabledLimiter) AllowNWithRemaining(key string, n int) (bool, float64, error) {
+	return true, math.MaxFloat64, nil
+}
@@ -0,0 +1,135 @@
+package limiter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisAllowNWithRemaining(t *testing.T) {
+	for _, layout := range []StorageLayout{LayoutList, LayoutHash, LayoutString} {
+		s := miniredis.RunT(t)
+		l := New(Config{
+			Type:          TypeRedis,
+			Address:       s.Addr(),
+			RateLimit:     1,
+			BurstLimit:    5,
+			Interval:      time.Hour,
+			StorageLayout: layout,
+		})
+		key := "foo"
+
+		for _, tc := range []struct {
+			n         int
+			allowed   bool
+			remaining float64
+		}{
+			{2, true, 3},
+			{2, true, 1},
+			{2, false, 1},
+			{1, true, 0},
+		} {
+			allowed, remaining, err := l.AllowNWithRemaining(key, tc.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tc.allowed || remaining != tc.remaining {
+				t.Errorf("expected %v with %v remaining: %v %v", tc.allowed, tc.remaining, allowed, remaining)
+			}
+
+			// the remaining tokens match a subsequent read
+			if tokens, _ := l.Tokens(key); tokens != remaining {
+				t.Errorf("expected %v tokens: %v", remaining, tokens)
+			}
+		}
+	}
+}
+
+func TestRedisAllowNWithRemainingCalendarWindow(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:           TypeRedis,
+		Address:        s.Addr(),
+		RateLimit:      3,
+		CalendarWindow: WindowDay,
+	})
+
+	for _, tc := range []struct {
+		n         int
+		allowed   bool
+		remaining float64
+	}{
+		{2, true, 1},
+		{2, false, 1},
+		{1, true, 0},
+	} {
+		allowed, remaining, err := l.AllowNWithRemaining("foo", tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != tc.allowed || remaining != tc.remaining {
+			t.Errorf("expected %v with %v remaining: %v %v", tc.allowed, tc.remaining, allowed, remaining)
+		}
+	}
+}
+
+func TestRedisAllowNWithRemainingError(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 5,
+		FailOpen:   true,
+	})
+	s.SetError("not good")
+
+	allowed, _, err := l.AllowNWithRemaining("foo", 1)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if !allowed {
+		t.Error("expected to fail open")
+	}
+}
+
+func TestInMemoryAllowNWithRemaining(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 5,
+			Interval:   time.Hour,
+			PureGo:     pureGo,
+		})
+		key := "foo"
+
+		for _, tc := range []struct {
+			n         int
+			allowed   bool
+			remaining float64
+		}{
+			{2, true, 3},
+			{2, true, 1},
+			{2, false, 1},
+			{1, true, 0},
+		} {
+			allowed, remaining, _ := l.AllowNWithRemaining(key, tc.n)
+			if allowed != tc.allowed || math.Abs(remaining-tc.remaining) > 0.01 {
+				t.Errorf("expected %v with %v remaining: %v %v", tc.allowed, tc.remaining, allowed, remaining)
+			}
+			if tokens, _ := l.Tokens(key); math.Abs(tokens-remaining) > 0.01 {
+				t.Errorf("expected %v tokens: %v", remaining, tokens)
+			}
+		}
+	}
+}
+
+func TestDisabledAllowNWithRemaining(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if allowed, remaining, _ := l.AllowNWithRemaining("foo", 1); !allowed || remaining != math.MaxFloat64 {
+		t.Errorf("expected to allow with %v remaining: %v %v", math.MaxFloat64, allowed, remaining)
+	}
+}
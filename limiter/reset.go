@@ -0,0 +1,80 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoKeyPrefix is returned by ResetAll for a Redis Limiter without a
+// KeyPrefix rather than deleting every key in the database
+var ErrNoKeyPrefix = errors.New("limiter: reset requires a key prefix")
+
+// ResetAll deletes every key with the configured KeyPrefix, including token
+// buckets, blocks, and stats. It is scoped to the prefix rather than flushing
+// the database, and returns ErrNoKeyPrefix if no prefix is configured. Keys are
+// found with SCAN so keys created while resetting may survive.
+func (l *redisLimiter) ResetAll(ctx context.Context) error {
+	if l.keyLength.prefix == "" {
+		return ErrNoKeyPrefix
+	}
+
+	c, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	cursor := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var batch []string
+		cursor, batch, err = l.scan(c, cursor)
+		if err != nil {
+			return err
+		}
+
+		if len(batch) > 0 {
+			args := make([]interface{}, len(batch))
+			for i, key := range batch {
+				args[i] = key
+			}
+			if _, err := c.Do("DEL", args...); err != nil {
+				return err
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// forget state kept about the deleted keys
+	if l.sampler != nil {
+		l.sampler.reset()
+	}
+	if l.layered != nil {
+		l.layered.reset()
+	}
+	if cached, ok := l.storage.(cachedStorage); ok {
+		cached.cache.flush()
+	}
+	return nil
+}
+
+// ResetAll removes every token bucket and all other per-key state, useful for
+// reusing a Limiter across tests. A Namespace removes only its own keys.
+func (l *inMemoryLimiter) ResetAll(ctx context.Context) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	// the maps are cleared in place since namespaces share them
+	l.resetPrefixed(l.keyLength.prefix)
+	return nil
+}
+
+func (l *disabledLimiter) ResetAll(ctx context.Context) error {
+	return nil
+}
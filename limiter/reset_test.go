@@ -0,0 +1,126 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisResetAll(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+		KeyPrefix:  "test:",
+		Stats:      true,
+	})
+	ctx := context.Background()
+	s.Set("other", "untouched")
+
+	l.AllowN("foo", 2)
+	l.Allow("bar")
+	l.Block("baz", time.Hour)
+
+	if err := l.ResetAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := s.Keys(); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("expected only keys outside the prefix to remain: %v", keys)
+	}
+	if keys, _ := l.Keys(ctx); len(keys) != 0 {
+		t.Errorf("expected no keys: %v", keys)
+	}
+	if !l.Allow("foo") || !l.Allow("baz") {
+		t.Error("expected reset keys to be allowed")
+	}
+}
+
+func TestRedisResetAllNoPrefix(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{Type: TypeRedis, Address: s.Addr(), RateLimit: 1})
+
+	l.Allow("foo")
+	if err := l.ResetAll(context.Background()); err != ErrNoKeyPrefix {
+		t.Errorf("expected ErrNoKeyPrefix: %v", err)
+	}
+	if !s.Exists("foo") {
+		t.Error("expected keys to remain")
+	}
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		KeyPrefix:  "a*:",
+	})
+	ctx := context.Background()
+	s.Lpush("a1:bar", "1")
+
+	l.Allow("foo")
+	if !s.Exists("a*:foo") {
+		t.Errorf("expected the bucket to be stored with the prefix: %v", s.Keys())
+	}
+
+	// keys are listed without the prefix and only with the literal prefix
+	keys, err := l.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "foo" {
+		t.Errorf("expected to list foo: %v", keys)
+	}
+	if state, err := l.Inspect(ctx, keys[0]); err != nil || state.Tokens != 1 {
+		t.Errorf("expected to inspect listed key: %+v %v", state, err)
+	}
+}
+
+func TestInMemoryResetAll(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 2,
+			Interval:   time.Hour,
+			PureGo:     pureGo,
+		})
+		ctx := context.Background()
+
+		l.AllowN("foo", 2)
+		l.Allow("bar")
+		l.SetState("bar", "pro")
+		l.Block("baz", time.Hour)
+
+		if err := l.ResetAll(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if keys, _ := l.Keys(ctx); len(keys) != 0 {
+			t.Errorf("expected no keys: %v", keys)
+		}
+		for _, key := range []string{"foo", "bar", "baz"} {
+			if exists(t, l, key) {
+				t.Errorf("expected %s to not exist", key)
+			}
+		}
+		if !l.AllowN("foo", 2) || !l.Allow("baz") {
+			t.Error("expected reset keys to be allowed")
+		}
+	}
+}
+
+func TestDisabledResetAll(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.ResetAll(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
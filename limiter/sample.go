@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// sampler deterministically selects a fraction of events to be decided by
+// Redis, the remaining events follow the last decision made for their key
+type sampler struct {
+	rate  float64
+	count uint64
+
+	// denied holds the keys whose last sampled events were denied
+	denied sync.Map
+}
+
+// newSampler returns a sampler selecting the given fraction of events, nil if
+// every event should be decided by Redis
+func newSampler(rate float64) *sampler {
+	if rate <= 0 || rate >= 1 {
+		return nil
+	}
+	return &sampler{rate: rate}
+}
+
+// next returns true if the next event is sampled. Events are counted so
+// exactly one in every 1/rate events is sampled.
+func (s *sampler) next() bool {
+	i := atomic.AddUint64(&s.count, 1) - 1
+	return uint64(float64(i+1)*s.rate) > uint64(float64(i)*s.rate)
+}
+
+// allow returns the decision for the given number of events for the given key.
+// Sampled events are decided by the given function for the number of events
+// they stand in for, capped at the burst limit unless the events alone exceed
+// it.
+func (s *sampler) allow(key string, n, burst int, decide func(n int) bool) bool {
+	if !s.next() {
+		_, denied := s.denied.Load(key)
+		return !denied
+	}
+
+	weighted := int(math.Ceil(float64(n) / s.rate))
+	if weighted > burst {
+		weighted = burst
+	}
+	if weighted < n {
+		weighted = n
+	}
+	if !decide(weighted) {
+		s.denied.Store(key, struct{}{})
+		return false
+	}
+	s.denied.Delete(key)
+	return true
+}
+
+// reset forgets the last sampled outcome of every key
+func (s *sampler) reset() {
+	s.denied.Range(func(key, _ interface{}) bool {
+		s.denied.Delete(key)
+		return true
+	})
+}
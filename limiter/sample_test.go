@@ -0,0 +1,96 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSamplerNext(t *testing.T) {
+	for _, rate := range []float64{0.01, 0.1, 0.25, 0.5, 0.9} {
+		s := newSampler(rate)
+
+		sampled := 0
+		for i := 0; i < 1000; i++ {
+			if s.next() {
+				sampled++
+			}
+		}
+		if expected := int(1000 * rate); sampled != expected {
+			t.Errorf("expected to sample %d of 1000 events at %v: %d", expected, rate, sampled)
+		}
+	}
+}
+
+func TestNewSamplerDisabled(t *testing.T) {
+	for _, rate := range []float64{-1, 0, 1, 2} {
+		if newSampler(rate) != nil {
+			t.Errorf("expected sample rate %v to disable sampling", rate)
+		}
+	}
+}
+
+// redisCommands returns the number of commands a Redis Limiter with the given
+// sample rate issues to allow 1000 events
+func redisCommands(t *testing.T, rate float64) int {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  10000,
+		BurstLimit: 10000,
+		Interval:   time.Hour,
+		SampleRate: rate,
+	})
+
+	for i := 0; i < 1000; i++ {
+		if !l.Allow("foo") {
+			t.Fatalf("expected to allow event %d", i)
+		}
+	}
+	return s.CommandCount()
+}
+
+func TestRedisSampleRateHitRate(t *testing.T) {
+	all := redisCommands(t, 0)
+	for _, rate := range []float64{0.1, 0.5} {
+		sampled := redisCommands(t, rate)
+		if hit := float64(sampled) / float64(all); hit < rate*0.9 || hit > rate*1.1 {
+			t.Errorf("expected Redis to be consulted for about %v of events: %v", rate, hit)
+		}
+	}
+}
+
+func TestRedisSampleRateExtrapolates(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 20,
+		Interval:   time.Hour,
+		SampleRate: 0.5,
+	})
+
+	// every other event is sampled taking 2 tokens
+	for i := 0; i < 20; i++ {
+		if !l.Allow("foo") {
+			t.Fatalf("expected to allow event %d", i)
+		}
+	}
+	if tokens, _ := l.Tokens("foo"); tokens != 0 {
+		t.Errorf("expected sampled events to take all tokens: %v", tokens)
+	}
+
+	// follows the last sampled outcome until the next sample
+	if !l.Allow("foo") {
+		t.Error("expected unsampled event to be allowed")
+	}
+	if l.Allow("foo") {
+		t.Error("expected sampled event to be denied")
+	}
+	if l.Allow("foo") {
+		t.Error("expected unsampled event to be denied")
+	}
+}
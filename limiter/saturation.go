@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Saturation returns the mean utilization of a random sample of at most the
+// given number of keys' token buckets, from 0 when every sampled bucket is
+// full to 1 when every one is empty. All keys are listed with SCAN before
+// sampling, so listing still grows with the key space while reading buckets
+// is bounded by the sample size.
+func (l *redisLimiter) Saturation(ctx context.Context, sampleKeys int) (float64, error) {
+	return saturation(ctx, l, sampleKeys)
+}
+
+// Saturation returns the mean utilization of a random sample of at most the
+// given number of keys' token buckets, from 0 when every sampled bucket is
+// full to 1 when every one is empty
+func (l *inMemoryLimiter) Saturation(ctx context.Context, sampleKeys int) (float64, error) {
+	return saturation(ctx, l, sampleKeys)
+}
+
+// Saturation returns zero as the disabled limiter never limits events
+func (l *disabledLimiter) Saturation(ctx context.Context, sampleKeys int) (float64, error) {
+	return 0, nil
+}
+
+// Saturation returns one as every event is denied
+func (l *blockAllLimiter) Saturation(ctx context.Context, sampleKeys int) (float64, error) {
+	return 1, nil
+}
+
+// saturation samples the given number of the Limiter's keys, or every key if
+// the number is not positive, and returns their mean utilization. Without keys
+// the Limiter is not saturated.
+func saturation(ctx context.Context, l Limiter, sampleKeys int) (float64, error) {
+	keys, err := l.Keys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if sampleKeys > 0 && len(keys) > sampleKeys {
+		// partially shuffle so the first keys are a uniform sample
+		for i := 0; i < sampleKeys; i++ {
+			j := i + rand.Intn(len(keys)-i)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+		keys = keys[:sampleKeys]
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	p, err := SamplePressure(l, keys)
+	if err != nil {
+		return 0, err
+	}
+	return p.MeanUtilization, nil
+}
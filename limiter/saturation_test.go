@@ -0,0 +1,90 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSaturation(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	redis := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	redis.now = func() time.Time { return now }
+
+	inMemory := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+	}).(*inMemoryLimiter)
+	inMemory.now = func() time.Time { return now }
+
+	for name, l := range map[string]Limiter{"redis": redis, "inMemory": inMemory} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if saturation, err := l.Saturation(ctx, 0); err != nil || saturation != 0 {
+				t.Errorf("expected no keys to not be saturated: %v %v", saturation, err)
+			}
+
+			for key, n := range map[string]int{"a": 4, "b": 2, "c": 1} {
+				if !l.AllowN(key, n) {
+					t.Fatalf("expected to allow %d events for %s", n, key)
+				}
+			}
+
+			saturation, err := l.Saturation(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := (1 + 0.5 + 0.25) / 3; math.Abs(saturation-expected) > 1e-9 {
+				t.Errorf("expected saturation %v: %v", expected, saturation)
+			}
+		})
+	}
+}
+
+func TestSaturationSample(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 4,
+		Interval:   time.Hour,
+	}).(*inMemoryLimiter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		l.AllowN(fmt.Sprint(i), 2)
+	}
+
+	// any sample of half used buckets is half saturated
+	saturation, err := l.Saturation(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saturation != 0.5 {
+		t.Errorf("expected a sample to be half saturated: %v", saturation)
+	}
+}
+
+func TestSaturationDisabled(t *testing.T) {
+	ctx := context.Background()
+	if saturation, _ := New(Config{Type: TypeDisabled}).Saturation(ctx, 10); saturation != 0 {
+		t.Errorf("expected the disabled limiter to not be saturated: %v", saturation)
+	}
+	if saturation, _ := New(Config{Type: TypeBlockAll}).Saturation(ctx, 10); saturation != 1 {
+		t.Errorf("expected the block all limiter to be saturated: %v", saturation)
+	}
+}
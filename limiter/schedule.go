@@ -0,0 +1,72 @@
+package limiter
+
+import "time"
+
+// Window overrides the default limits during a daily time range, for example
+// tightening limits during known peaks
+type Window struct {
+	// Start and End are offsets from midnight in the configured Location. A
+	// window ending before it starts spans midnight.
+	Start, End time.Duration
+	// RateLimit overrides the default rate limit, zero keeps the default
+	RateLimit float64
+	// BurstLimit overrides the default burst limit, zero keeps the default
+	BurstLimit int
+}
+
+// contains returns true if the given offset from midnight is within the window
+func (w Window) contains(offset time.Duration) bool {
+	if w.End < w.Start {
+		return offset >= w.Start || offset < w.End
+	}
+	return offset >= w.Start && offset < w.End
+}
+
+// scheduleLimits returns the limits of the first window of the schedule
+// containing the given time, or the given default limits outside any window
+func scheduleLimits(schedule []Window, now time.Time, loc *time.Location, rate float64, burst int) (float64, int, bool) {
+	if len(schedule) == 0 {
+		return rate, burst, false
+	}
+
+	now = now.In(loc)
+	y, m, d := now.Date()
+	offset := now.Sub(time.Date(y, m, d, 0, 0, 0, 0, loc))
+	for _, w := range schedule {
+		if !w.contains(offset) {
+			continue
+		}
+		if w.RateLimit != 0 {
+			rate = w.RateLimit
+		}
+		if w.BurstLimit != 0 {
+			burst = w.BurstLimit
+		}
+		return rate, burst, true
+	}
+	return rate, burst, false
+}
+
+// scheduled returns a copy of the limiter with the limits of the active
+// scheduled window, or the limiter itself outside any window
+func (l *redisLimiter) scheduled() *redisLimiter {
+	rate, burst, ok := scheduleLimits(l.schedule, l.now(), l.location, l.rate, l.burst)
+	if !ok {
+		return l
+	}
+	c := *l
+	c.rate, c.burst = rate, burst
+	return &c
+}
+
+// scheduled returns a copy of the limiter with the limits of the active
+// scheduled window, or the limiter itself outside any window
+func (l *inMemoryLimiter) scheduled() *inMemoryLimiter {
+	rate, burst, ok := scheduleLimits(l.schedule, l.now(), l.location, l.rate, l.burst)
+	if !ok {
+		return l
+	}
+	c := *l
+	c.rate, c.burst = rate, burst
+	return &c
+}
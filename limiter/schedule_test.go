@@ -0,0 +1,90 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestScheduleLimits(t *testing.T) {
+	schedule := []Window{
+		// peak hours
+		{Start: 9 * time.Hour, End: 17 * time.Hour, RateLimit: 1, BurstLimit: 2},
+		// overlaps the end of peak hours, which is listed first
+		{Start: 16 * time.Hour, End: 18 * time.Hour, RateLimit: 5},
+		// spans midnight
+		{Start: 22 * time.Hour, End: 2 * time.Hour, BurstLimit: 50},
+	}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		at    time.Duration
+		rate  float64
+		burst int
+	}{
+		{8 * time.Hour, 10, 20},
+		{9 * time.Hour, 1, 2},
+		{16*time.Hour + 30*time.Minute, 1, 2},
+		{17 * time.Hour, 5, 20},
+		{18 * time.Hour, 10, 20},
+		{23 * time.Hour, 10, 50},
+		{time.Hour, 10, 50},
+		{2 * time.Hour, 10, 20},
+	} {
+		rate, burst, _ := scheduleLimits(schedule, day.Add(tc.at), time.UTC, 10, 20)
+		if rate != tc.rate || burst != tc.burst {
+			t.Errorf("expected %v to have limits %v/%v: %v/%v", tc.at, tc.rate, tc.burst, rate, burst)
+		}
+	}
+}
+
+func TestScheduleLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	schedule := []Window{{Start: 9 * time.Hour, End: 17 * time.Hour, BurstLimit: 2}}
+
+	// 9:00 in UTC is 4:00 in UTC-5
+	at := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	if _, burst, ok := scheduleLimits(schedule, at, loc, 10, 20); ok || burst != 20 {
+		t.Errorf("expected the window to be evaluated in the location: %v", burst)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 3
+		config.Interval = time.Hour
+		config.Schedule = []Window{{Start: 9 * time.Hour, End: 17 * time.Hour, BurstLimit: 1}}
+
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+		l := New(config)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = clock
+		case *inMemoryLimiter:
+			l.now = clock
+		}
+
+		// the peak window's burst limit applies
+		if !l.Allow("peak") {
+			t.Errorf("%s: expected to allow the peak burst", name)
+		}
+		if l.Allow("peak") {
+			t.Errorf("%s: expected to deny past the peak burst", name)
+		}
+
+		// the default burst limit applies off-peak
+		now = time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+		if !l.AllowN("offpeak", 3) {
+			t.Errorf("%s: expected to allow the default burst off-peak", name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRedisScriptNoScript(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	// the script cache was flushed, so the script is sent by source instead
+	m.On("Do", "EVALSHA", mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 14 && args[0] == scripts[allowChildScript].Hash()
+	})).Return(nil, redis.Error("NOSCRIPT No matching script. Please use EVAL.")).Once()
+	m.On("Do", "EVAL", mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 14 && args[0] != scripts[allowChildScript].Hash() && args[2] == "foo"
+	})).Return(int64(1), nil).Once()
+
+	allowed, err := l.AllowChild("foo", "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Error("expected to allow child: a")
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisScriptFlush(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	})
+
+	if allowed, err := l.AllowChild("foo", "a", 1); err != nil || !allowed {
+		t.Fatalf("expected to allow child: %v", err)
+	}
+
+	// as if Redis restarted without its script cache
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Do("SCRIPT", "FLUSH"); err != nil {
+		t.Fatal(err)
+	}
+
+	if allowed, err := l.AllowChild("foo", "a", 1); err != nil || !allowed {
+		t.Fatalf("expected to reload the script and allow child: %v", err)
+	}
+	if allowed, _ := l.AllowChild("foo", "a", 1); allowed {
+		t.Error("expected the reloaded script to deny once the burst is taken")
+	}
+}
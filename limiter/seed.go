@@ -0,0 +1,80 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTokensExceedBurst is returned when seeding a token bucket with more tokens
+// than the burst limit
+var ErrTokensExceedBurst = errors.New("limiter: tokens exceed burst limit")
+
+// ErrInvalidTTL is returned when seeding a token bucket with a TTL which is not
+// positive
+var ErrInvalidTTL = errors.New("limiter: TTL must be positive")
+
+// ttlRestorer is implemented by limiters that can overwrite a key's token
+// bucket with one which expires
+type ttlRestorer interface {
+	restoreTTL(ctx context.Context, key string, state BucketState, ttl time.Duration) error
+}
+
+// seed overwrites the given key's token bucket with the given tokens and last
+// update time, the inverse of Inspect
+func seed(r restorer, burst int, key string, tokens float64, lastUpdate time.Time) error {
+	if tokens > float64(burst) {
+		return ErrTokensExceedBurst
+	}
+	return r.restore(context.Background(), key, BucketState{
+		Tokens:     tokens,
+		LastUpdate: lastUpdate,
+	})
+}
+
+// Seed writes the given key's token bucket with the given tokens and last
+// update time rather than starting it full, for tests and migrations
+func (l *redisLimiter) Seed(key string, tokens float64, lastUpdate time.Time) error {
+	return seed(l, l.burst, key, tokens, lastUpdate)
+}
+
+func (l *inMemoryLimiter) Seed(key string, tokens float64, lastUpdate time.Time) error {
+	return seed(l, l.burst, key, tokens, lastUpdate)
+}
+
+func (l *disabledLimiter) Seed(key string, tokens float64, lastUpdate time.Time) error {
+	return nil
+}
+
+// seedWithTTL overwrites the given key's token bucket with the given tokens and
+// last update time in a single operation which also sets its TTL
+func seedWithTTL(r ttlRestorer, burst int, key string, tokens float64, lastUpdate time.Time, ttl time.Duration) error {
+	if tokens > float64(burst) {
+		return ErrTokensExceedBurst
+	}
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return r.restoreTTL(context.Background(), key, BucketState{
+		Tokens:     tokens,
+		LastUpdate: lastUpdate,
+	}, ttl)
+}
+
+// SeedWithTTL is like Seed but the token bucket, along with the state stored
+// next to it, expires after the given TTL. The bucket is written and its TTL
+// set in one transaction.
+func (l *redisLimiter) SeedWithTTL(key string, tokens float64, lastUpdate time.Time, ttl time.Duration) error {
+	return seedWithTTL(l, l.burst, key, tokens, lastUpdate, ttl)
+}
+
+// SeedWithTTL is like Seed but the token bucket, along with the state stored
+// next to it, expires after the given TTL. Expired buckets are removed the next
+// time they are used.
+func (l *inMemoryLimiter) SeedWithTTL(key string, tokens float64, lastUpdate time.Time, ttl time.Duration) error {
+	return seedWithTTL(l, l.burst, key, tokens, lastUpdate, ttl)
+}
+
+func (l *disabledLimiter) SeedWithTTL(key string, tokens float64, lastUpdate time.Time, ttl time.Duration) error {
+	return nil
+}
@@ -0,0 +1,157 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSeed(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 10
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		if err := l.Seed("foo", 2, now); err != nil {
+			t.Fatal(err)
+		}
+		if tokens, _ := l.Tokens("foo"); tokens != 2 {
+			t.Errorf("%s: expected the seeded tokens: %v", name, tokens)
+		}
+		if !l.AllowN("foo", 2) {
+			t.Errorf("%s: expected to allow the seeded tokens", name)
+		}
+		if l.Allow("foo") {
+			t.Errorf("%s: expected to deny beyond the seeded tokens", name)
+		}
+
+		// tokens are allotted since the seeded last update
+		if err := l.Seed("bar", 0, now.Add(-3*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if tokens, _ := l.Tokens("bar"); tokens != 3 {
+			t.Errorf("%s: expected tokens allotted since the last update: %v", name, tokens)
+		}
+
+		if err := l.Seed("baz", 11, now); err != ErrTokensExceedBurst {
+			t.Errorf("%s: expected tokens exceeding the burst to be rejected: %v", name, err)
+		}
+		if exists, _ := l.Exists("baz"); exists {
+			t.Errorf("%s: expected the rejected bucket to not be written", name)
+		}
+	}
+}
+
+func TestSeedKeyTooLong(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, MaxKeyLength: 1})
+	if err := l.Seed("foo", 1, time.Now()); err != ErrKeyTooLong {
+		t.Errorf("expected ErrKeyTooLong: %v", err)
+	}
+}
+
+func TestDisabledSeed(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.Seed("foo", 1, time.Now()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSeedWithTTL(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 10
+		config.Interval = time.Hour
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		advance := func(d time.Duration) {
+			now = now.Add(d)
+			s.FastForward(d)
+		}
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		if err := l.SeedWithTTL("foo", 2, now, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if name == "redis" {
+			if ttl := s.TTL("foo"); ttl != time.Minute {
+				t.Errorf("%s: expected the TTL to be set: %v", name, ttl)
+			}
+		}
+		state, err := l.Inspect(context.Background(), "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Tokens != 2 || !state.LastUpdate.Equal(now) {
+			t.Errorf("%s: expected the seeded state: %+v", name, state)
+		}
+
+		advance(59 * time.Second)
+		if tokens, _ := l.Tokens("foo"); tokens != 2 {
+			t.Errorf("%s: expected the bucket to not yet expire: %v", name, tokens)
+		}
+
+		// an expired bucket is missing, so full
+		advance(time.Second)
+		if _, err := l.Inspect(context.Background(), "foo"); err != ErrKeyNotFound {
+			t.Errorf("%s: expected the bucket to expire: %v", name, err)
+		}
+		if exists, _ := l.Exists("foo"); exists {
+			t.Errorf("%s: expected the expired bucket to not exist", name)
+		}
+		if tokens, _ := l.Tokens("foo"); tokens != 10 {
+			t.Errorf("%s: expected the expired bucket to be full: %v", name, tokens)
+		}
+
+		// seeding without a TTL clears the TTL
+		if err := l.SeedWithTTL("bar", 2, now, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Seed("bar", 2, now); err != nil {
+			t.Fatal(err)
+		}
+		advance(time.Minute)
+		if tokens, _ := l.Tokens("bar"); tokens != 2 {
+			t.Errorf("%s: expected the reseeded bucket to not expire: %v", name, tokens)
+		}
+
+		if err := l.SeedWithTTL("baz", 11, now, time.Minute); err != ErrTokensExceedBurst {
+			t.Errorf("%s: expected tokens exceeding the burst to be rejected: %v", name, err)
+		}
+		for _, ttl := range []time.Duration{0, -time.Second} {
+			if err := l.SeedWithTTL("baz", 1, now, ttl); err != ErrInvalidTTL {
+				t.Errorf("%s: expected a TTL of %v to be rejected: %v", name, ttl, err)
+			}
+		}
+		if exists, _ := l.Exists("baz"); exists {
+			t.Errorf("%s: expected the rejected bucket to not be written", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package limiter
+
+import (
+	"strconv"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// seqKey returns the key holding the highest sequence number applied to the
+// given key's token bucket and its decision
+func seqKey(key string) string {
+	return suffixedKey(key, "seq")
+}
+
+// allowSeqScript consumes tokens from a token bucket unless the sequence number
+// has already been applied, returning the recorded decision if so. Sequence
+// numbers are compared as decimal strings since Lua numbers cannot represent
+// every uint64. It returns 1 if allowed, 0 otherwise.
+//
+// KEYS[1] bucket key, KEYS[2] seq key
+// ARGV[1] storageArg, ARGV[2] n, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] rate, ARGV[6] burst, ARGV[7] min tokens, ARGV[8] seq
+var allowSeqScript = newScript(2, luaStorage+luaRefill+`
+local seq = ARGV[8]
+local prior = redis.call("HMGET", KEYS[2], "seq", "allowed")
+if prior[1] and (#seq < #prior[1] or (#seq == #prior[1] and seq <= prior[1])) then
+	return tonumber(prior[2])
+end
+
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = read_bucket(KEYS[1])
+local tokens = refill(b, now, tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6]))
+
+local allowed = 0
+if tokens - n >= tonumber(ARGV[7]) then
+	write_bucket(KEYS[1], {tokens = tokens - n, last = now}, b)
+	allowed = 1
+end
+redis.call("HSET", KEYS[2], "seq", seq, "allowed", allowed)
+return allowed
+`)
+
+// seqMark is the highest sequence number applied to a key's token bucket and
+// its decision
+type seqMark struct {
+	seq     uint64
+	allowed bool
+}
+
+// AllowSeq is like AllowN but applies each sequence number of the given key at
+// most once, for replayed events. The highest sequence number applied and its
+// decision are recorded next to the key's token bucket, and any sequence
+// number not above it returns the recorded decision without consuming tokens.
+// The check and the consumption happen atomically in a script. Blocks, lists,
+// and the other per-key features do not apply.
+func (l *redisLimiter) AllowSeq(key string, seq uint64, n int) (bool, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	allowed, err := redis.Bool(db.eval(allowSeqScript,
+		key, seqKey(key),
+		storageArg(l.layout, l.format), n, now, l.interval.Seconds(),
+		l.refillRate(l.rate), l.burst, l.minTokens,
+		strconv.FormatUint(seq, 10),
+	))
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen, err
+	}
+	if allowed {
+		l.allowed.add(n)
+	}
+	return allowed, nil
+}
+
+// AllowSeq is like AllowN but applies each sequence number of the given key at
+// most once, returning the decision recorded with the highest sequence number
+// applied for any sequence number not above it
+func (l *inMemoryLimiter) AllowSeq(key string, seq uint64, n int) (bool, error) {
+	stored, err := l.keyLength.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	// hold the sequence lock across the decision so replays of a sequence
+	// number wait for its decision rather than making their own
+	l.seqMux.Lock()
+	defer l.seqMux.Unlock()
+
+	l.mux.RLock()
+	prior, ok := l.seqs[stored]
+	l.mux.RUnlock()
+	if ok && seq <= prior.seq {
+		return prior.allowed, nil
+	}
+
+	allowed, _, err := l.allowNRemaining(key, n, l.rate, l.burst)
+	if err != nil {
+		return allowed, err
+	}
+
+	l.mux.Lock()
+	l.seqs[stored] = seqMark{seq: seq, allowed: allowed}
+	l.mux.Unlock()
+	return allowed, nil
+}
+
+func (l *disabledLimiter) AllowSeq(key string, seq uint64, n int) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package limiter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAllowSeq(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+
+		for _, tc := range []struct {
+			seq     uint64
+			allowed bool
+		}{
+			{1, true},
+			{1, true},  // duplicate
+			{3, true},  // gap
+			{2, true},  // out of order, returns the decision for 3
+			{4, false}, // the burst is spent
+			{3, false}, // out of order, returns the decision for 4
+			{4, false},
+		} {
+			allowed, err := l.AllowSeq("foo", tc.seq, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tc.allowed {
+				t.Errorf("%s: expected seq %d to return %v: %v", name, tc.seq, tc.allowed, allowed)
+			}
+		}
+
+		// replays consumed no tokens
+		if tokens, _ := l.Tokens("foo"); tokens != 0 {
+			t.Errorf("%s: expected the burst to be spent once: %v", name, tokens)
+		}
+
+		// sequence numbers beyond the precision of a float64 are compared exactly
+		if allowed, _ := l.AllowSeq("bar", math.MaxUint64-1, 1); !allowed {
+			t.Errorf("%s: expected to allow a large seq", name)
+		}
+		if allowed, _ := l.AllowSeq("bar", math.MaxUint64, 1); !allowed {
+			t.Errorf("%s: expected to allow the next large seq", name)
+		}
+		if allowed, _ := l.AllowSeq("bar", math.MaxUint64, 1); !allowed {
+			t.Errorf("%s: expected a replayed large seq to return its decision", name)
+		}
+		if tokens, _ := l.Tokens("bar"); tokens != 0 {
+			t.Errorf("%s: expected 2 large seqs to be applied once each: %v", name, tokens)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package limiter
+
+// softLimit warns when a key's consumption crosses a threshold below its burst
+// limit while its events are still allowed
+type softLimit struct {
+	burst int
+	hook  func(id string, remaining float64)
+}
+
+// check calls the hook if taking the given number of events from a bucket with
+// the given burst limit, leaving the given tokens remaining, took the bucket's
+// consumption to or past the soft burst limit
+func (s softLimit) check(id string, n, burst int, remaining float64) {
+	if s.hook == nil || s.burst <= 0 {
+		return
+	}
+
+	// the remaining tokens at which consumption reaches the soft burst limit
+	threshold := float64(burst - s.burst)
+	if remaining <= threshold && remaining+float64(n) > threshold {
+		s.hook(id, remaining)
+	}
+}
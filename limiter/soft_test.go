@@ -0,0 +1,46 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSoftLimit(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		var warned []string
+		config.RateLimit = 1
+		config.BurstLimit = 4
+		config.Interval = time.Hour
+		config.SoftBurst = 2
+		config.OnSoftLimit = func(id string, remaining float64) {
+			if remaining != 2 {
+				t.Errorf("%s: expected 2 remaining tokens at the soft limit: %v", name, remaining)
+			}
+			warned = append(warned, id)
+		}
+		l := New(config)
+
+		for i := 1; i <= 4; i++ {
+			if !l.Allow("foo bar") {
+				t.Errorf("%s: expected to allow event %d under the hard burst", name, i)
+			}
+			if expected := i >= 2; (len(warned) == 1) != expected {
+				t.Errorf("%s: expected the soft limit to fire once at event 2, after event %d: %v", name, i, warned)
+			}
+		}
+		if l.Allow("foo bar") {
+			t.Errorf("%s: expected to deny past the hard burst", name)
+		}
+		if len(warned) != 1 || warned[0] != "foo bar" {
+			t.Errorf("%s: expected the soft limit to fire once for the ID: %v", name, warned)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// sometimesKey returns the key counting the given key's events for
+// AllowSometimes
+func sometimesKey(key string) string {
+	return suffixedKey(key, "sometimes")
+}
+
+// sometimesScript increments the count of events in the current interval,
+// starting the interval if the count is new. It returns the count.
+//
+// KEYS[1] sometimes key
+// ARGV[1] interval (milliseconds)
+var sometimesScript = newScript(1, `
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// sometimes returns true if the event with the given 1-based count in its
+// interval is one of the first events or, after those, every Mth event
+func sometimes(count int64, first, every int) bool {
+	if count <= int64(first) {
+		return true
+	}
+	return every > 0 && (count-int64(first))%int64(every) == 0
+}
+
+// AllowSometimes returns true for the first events for the given key in each
+// interval and then for every Mth event, like rate.Sometimes, for sampling
+// log output rather than limiting traffic. Counts are reset the given interval
+// after the first event counted, a non-positive interval uses the Limiter's
+// interval. Token buckets are not consulted.
+func (l *redisLimiter) AllowSometimes(key string, first, every int, interval time.Duration) bool {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false
+	}
+	if interval <= 0 {
+		interval = l.interval
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	count, err := redis.Int64(db.eval(sometimesScript, sometimesKey(key), interval.Milliseconds()))
+	if err != nil {
+		// fail open on redis error
+		return l.failOpen
+	}
+	return sometimes(count, first, every)
+}
+
+func (l *inMemoryLimiter) AllowSometimes(key string, first, every int, interval time.Duration) bool {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false
+	}
+	if interval <= 0 {
+		interval = l.interval
+	}
+
+	now := l.now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	// counts share the calendar window counts keyed apart from the key itself
+	w, ok := l.windows[sometimesKey(key)]
+	if !ok || !now.Before(w.start.Add(interval)) {
+		w = &windowCount{start: now}
+		l.windows[sometimesKey(key)] = w
+	}
+	w.count++
+	return sometimes(int64(w.count), first, every)
+}
+
+func (l *disabledLimiter) AllowSometimes(key string, first, every int, interval time.Duration) bool {
+	return true
+}
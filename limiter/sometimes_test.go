@@ -0,0 +1,99 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSometimes(t *testing.T) {
+	for _, tc := range []struct {
+		first, every int
+		allowed      []int64
+	}{
+		{2, 3, []int64{1, 2, 5, 8}},
+		{0, 2, []int64{2, 4, 6, 8}},
+		{3, 0, []int64{1, 2, 3}},
+		{0, 0, nil},
+	} {
+		var allowed []int64
+		for count := int64(1); count <= 8; count++ {
+			if sometimes(count, tc.first, tc.every) {
+				allowed = append(allowed, count)
+			}
+		}
+		if len(allowed) != len(tc.allowed) {
+			t.Errorf("expected first %d every %d to allow %v: %v", tc.first, tc.every, tc.allowed, allowed)
+			continue
+		}
+		for i := range allowed {
+			if allowed[i] != tc.allowed[i] {
+				t.Errorf("expected first %d every %d to allow %v: %v", tc.first, tc.every, tc.allowed, allowed)
+				break
+			}
+		}
+	}
+}
+
+func TestAllowSometimes(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		if l, ok := l.(*inMemoryLimiter); ok {
+			l.now = func() time.Time { return now }
+		}
+
+		var allowed []int
+		for i := 1; i <= 10; i++ {
+			if l.AllowSometimes("foo", 2, 4, time.Minute) {
+				allowed = append(allowed, i)
+			}
+		}
+		if len(allowed) != 4 || allowed[0] != 1 || allowed[1] != 2 || allowed[2] != 6 || allowed[3] != 10 {
+			t.Errorf("%s: expected the first 2 and every 4th event to be allowed: %v", name, allowed)
+		}
+
+		// the counts are reset after the interval
+		now = now.Add(time.Minute)
+		s.FastForward(time.Minute)
+		if !l.AllowSometimes("foo", 2, 4, time.Minute) || !l.AllowSometimes("foo", 2, 4, time.Minute) {
+			t.Errorf("%s: expected the first events of the next interval to be allowed", name)
+		}
+		if l.AllowSometimes("foo", 2, 4, time.Minute) {
+			t.Errorf("%s: expected the third event of the next interval to be denied", name)
+		}
+
+		// keys are counted separately
+		if !l.AllowSometimes("bar", 1, 0, time.Minute) {
+			t.Errorf("%s: expected the first event of another key to be allowed", name)
+		}
+	}
+}
+
+func TestRedisAllowSometimesError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+
+	m.On("Do", "EVALSHA", mock.Anything).Return(nil, errors.New("not good")).Once()
+
+	if l.AllowSometimes("foo", 1, 1, time.Minute) {
+		t.Error("expected to not allow on error")
+	}
+}
+
+func TestDisabledAllowSometimes(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if !l.AllowSometimes("foo", 0, 0, time.Minute) {
+		t.Error("expected disabled limiter to allow")
+	}
+}
@@ -0,0 +1,98 @@
+package limiter
+
+// setStateScript stores state alongside a token bucket, creating a full token
+// bucket if the key does not exist
+//
+// KEYS[1] key
+// ARGV[1] storageArg, ARGV[2] burst, ARGV[3] now, ARGV[4] state
+var setStateScript = newScript(1, luaStorage+`
+local b = read_bucket(KEYS[1])
+if b then
+	write_bucket(KEYS[1], {tokens = b.tokens, last = b.last, state = ARGV[4]}, b)
+else
+	write_bucket(KEYS[1], {tokens = ARGV[2], last = ARGV[3], state = ARGV[4]}, nil)
+end
+return 1
+`)
+
+// AllowWithState returns true if the given key has not breached the global
+// rate limit, false otherwise. The state stored by SetState is read in the
+// same round trip as the token bucket.
+func (l *redisLimiter) AllowWithState(key string, n int) (bool, string, error) {
+	if decided, allowed := l.lists.check(key); decided {
+		return allowed, "", nil
+	}
+
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return false, "", err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	allowed, b, err := l.take(db, key, n, l.rate, l.burst, true)
+	if err == errBlocked {
+		// blocked keys are denied regardless of their tokens
+		return false, "", nil
+	}
+	if err != nil {
+		// fail open on redis error
+		return l.failMode(key, err), "", err
+	}
+	if allowed {
+		l.allowed.add(n)
+	}
+	return allowed, b.state, nil
+}
+
+// SetState stores the given state next to the key's token bucket. Keys without
+// state keep the default two element token bucket.
+func (l *redisLimiter) SetState(key, state string) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	_, err = db.eval(setStateScript, key, storageArg(l.layout, l.format), float64(l.burst), now, state)
+	return err
+}
+
+func (l *inMemoryLimiter) AllowWithState(key string, n int) (bool, string, error) {
+	stateKey, err := l.keyLength.key(key)
+	if err != nil {
+		return false, "", err
+	}
+
+	allowed := l.allowN(key, n, l.rate, l.burst)
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	return allowed, l.states[stateKey], nil
+}
+
+func (l *inMemoryLimiter) SetState(key, state string) error {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.states[key] = state
+	return nil
+}
+
+func (l *disabledLimiter) AllowWithState(key string, n int) (bool, string, error) {
+	return true, "", nil
+}
+
+func (l *disabledLimiter) SetState(key, state string) error {
+	return nil
+}
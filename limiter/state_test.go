@@ -0,0 +1,133 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRedisAllowWithState(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return(
+		[]interface{}{
+			[]byte("5"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+			[]byte("pro"),
+		}, nil,
+	).Once()
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 0, 4.0}).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 1, now.Unix()}).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
+
+	allowed, state, err := l.AllowWithState(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	if state != "pro" {
+		t.Errorf("expected state pro: %s", state)
+	}
+}
+
+func TestRedisAllowWithoutState(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	// a bucket without state keeps the two element list
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Unix())),
+		}, nil,
+	).Once()
+
+	allowed, state, err := l.AllowWithState(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+	if state != "" {
+		t.Errorf("expected empty state: %s", state)
+	}
+}
+
+func TestRedisAllowWithStateError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return(
+		nil, errors.New("not good"),
+	).Once()
+
+	if allowed, _, err := l.AllowWithState(key, 1); allowed || err == nil {
+		t.Error("expected to not allow key and return an error")
+	}
+}
+
+func TestRedisSetState(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "EVALSHA", []interface{}{
+		scripts[setStateScript].Hash(), 1, key, int(LayoutList), float64(l.burst), now.Unix(), "pro",
+	}).Return(int64(1), nil).Once()
+
+	if err := l.SetState(key, "pro"); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestInMemoryState(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	key := "foo"
+
+	if err := l.SetState(key, "pro"); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, state, _ := l.AllowWithState(key, 1)
+	if !allowed || state != "pro" {
+		t.Errorf("expected to allow key with state pro: %v %s", allowed, state)
+	}
+
+	allowed, state, _ = l.AllowWithState(key, 1)
+	if allowed || state != "pro" {
+		t.Errorf("expected to not allow key with state pro: %v %s", allowed, state)
+	}
+}
+
+func TestDisabledState(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.SetState("foo", "pro"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _, err := l.AllowWithState("foo", 1); !allowed || err != nil {
+		t.Error("expected disabled limiter to allow")
+	}
+}
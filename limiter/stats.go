@@ -0,0 +1,122 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// defaultStatsWindow is how long allow and deny counts are kept before they
+// are reset
+const defaultStatsWindow = time.Hour
+
+// statsKey returns the key of the hash counting the given key's allowed and
+// denied events
+func statsKey(key string) string {
+	return suffixedKey(key, "stats")
+}
+
+// countScript increments an allow or deny count, starting the window after
+// which the counts are reset if the counts are new.
+//
+// KEYS[1] stats key
+// ARGV[1] field, ARGV[2] window (milliseconds)
+var countScript = newScript(1, `
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// statsField returns the name of the count incremented for an allowed or
+// denied event
+func statsField(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// count increments the given key's allowed or denied count if stats are
+// enabled. Stats are best effort so errors are ignored.
+func (l *redisLimiter) count(db backend, key string, allowed bool) {
+	if l.statsWindow == 0 {
+		return
+	}
+	db.eval(countScript, statsKey(key), statsField(allowed), l.statsWindow.Milliseconds())
+}
+
+// Stats returns the number of events allowed and denied for the given key
+// since its counts were last reset. Counts are only kept when Config.Stats is
+// set, they are reset StatsWindow after the first event counted.
+func (l *redisLimiter) Stats(key string) (uint64, uint64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	counts, err := redis.Values(c.Do("HMGET", statsKey(key), "allowed", "denied"))
+	if err != nil {
+		return 0, 0, err
+	}
+	var allowed, denied uint64
+	if _, err := redis.Scan(counts, &allowed, &denied); err != nil {
+		return 0, 0, err
+	}
+	return allowed, denied, nil
+}
+
+// keyStats counts a key's allowed and denied events until reset
+type keyStats struct {
+	allowed uint64
+	denied  uint64
+	reset   time.Time
+}
+
+// count increments the given key's allowed or denied count if stats are
+// enabled
+func (l *inMemoryLimiter) count(key string, allowed bool) {
+	if l.statsWindow == 0 {
+		return
+	}
+
+	now := l.now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	s, ok := l.stats[key]
+	if !ok || !now.Before(s.reset) {
+		s = &keyStats{reset: now.Add(l.statsWindow)}
+		l.stats[key] = s
+	}
+	if allowed {
+		s.allowed++
+	} else {
+		s.denied++
+	}
+}
+
+func (l *inMemoryLimiter) Stats(key string) (uint64, uint64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	s, ok := l.stats[key]
+	if !ok || !l.now().Before(s.reset) {
+		return 0, 0, nil
+	}
+	return s.allowed, s.denied, nil
+}
+
+func (l *disabledLimiter) Stats(key string) (uint64, uint64, error) {
+	return 0, 0, nil
+}
@@ -0,0 +1,126 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// allowSequence allows 3 of 5 events for the given key
+func allowSequence(t *testing.T, l Limiter, key string) {
+	for i := 0; i < 5; i++ {
+		if allowed := l.Allow(key); allowed != (i < 3) {
+			t.Fatalf("expected event %d to be allowed %v: %v", i, i < 3, allowed)
+		}
+	}
+}
+
+func TestRedisStats(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:        TypeRedis,
+		Address:     s.Addr(),
+		RateLimit:   1,
+		BurstLimit:  3,
+		Interval:    time.Hour,
+		Stats:       true,
+		StatsWindow: time.Minute,
+	})
+
+	allowSequence(t, l, "foo")
+	allowed, denied, err := l.Stats("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed != 3 || denied != 2 {
+		t.Errorf("expected 3 allowed and 2 denied: %d %d", allowed, denied)
+	}
+
+	// the window starts with the first event counted
+	if ttl := s.TTL(statsKey("foo")); ttl != time.Minute {
+		t.Errorf("expected the counts to reset in 1m: %v", ttl)
+	}
+	l.Allow("foo")
+	if ttl := s.TTL(statsKey("foo")); ttl != time.Minute {
+		t.Errorf("expected counting to not extend the window: %v", ttl)
+	}
+
+	s.FastForward(time.Minute)
+	if allowed, denied, _ := l.Stats("foo"); allowed != 0 || denied != 0 {
+		t.Errorf("expected counts to reset: %d %d", allowed, denied)
+	}
+}
+
+func TestRedisStatsDisabled(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 3,
+		Interval:   time.Hour,
+	})
+
+	allowSequence(t, l, "foo")
+	if s.Exists(statsKey("foo")) {
+		t.Error("expected no counts to be written")
+	}
+	if allowed, denied, err := l.Stats("foo"); allowed != 0 || denied != 0 || err != nil {
+		t.Errorf("expected no counts: %d %d %v", allowed, denied, err)
+	}
+}
+
+func TestInMemoryStats(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:        TypeInMemory,
+			RateLimit:   1,
+			BurstLimit:  3,
+			Interval:    time.Hour,
+			PureGo:      pureGo,
+			Stats:       true,
+			StatsWindow: time.Minute,
+		}).(*inMemoryLimiter)
+		clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		l.now = func() time.Time { return clock }
+
+		allowSequence(t, l, "foo")
+		l.Block("foo", time.Hour)
+		l.Allow("foo")
+
+		allowed, denied, err := l.Stats("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != 3 || denied != 3 {
+			t.Errorf("expected 3 allowed and 3 denied: %d %d", allowed, denied)
+		}
+
+		clock = clock.Add(time.Minute)
+		if allowed, denied, _ := l.Stats("foo"); allowed != 0 || denied != 0 {
+			t.Errorf("expected counts to reset: %d %d", allowed, denied)
+		}
+	}
+}
+
+func TestInMemoryStatsDisabled(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 3,
+		Interval:   time.Hour,
+	})
+
+	allowSequence(t, l, "foo")
+	if allowed, denied, _ := l.Stats("foo"); allowed != 0 || denied != 0 {
+		t.Errorf("expected no counts: %d %d", allowed, denied)
+	}
+}
+
+func TestDisabledStats(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if allowed, denied, err := l.Stats("foo"); allowed != 0 || denied != 0 || err != nil {
+		t.Errorf("expected no counts: %d %d %v", allowed, denied, err)
+	}
+}
@@ -0,0 +1,312 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// StorageLayout defines how token buckets are stored in Redis
+type StorageLayout int
+
+const (
+	// LayoutList stores a token bucket as a list of its tokens, last update
+	// time, and optional state
+	LayoutList StorageLayout = iota
+	// LayoutHash stores a token bucket as a hash with tokens, last, and
+	// optional state fields
+	LayoutHash
+	// LayoutString stores a token bucket as a string of its tokens, last update
+	// time, and optional state separated by colons
+	LayoutString
+)
+
+// ErrMalformedBucket is returned when the value stored at a key is not a token
+// bucket in the configured StorageLayout and TimeFormat
+var ErrMalformedBucket = errors.New("limiter: malformed token bucket")
+
+// malformed returns an error wrapping ErrMalformedBucket for the given value
+// and the error parsing it
+func malformed(v interface{}, err error) error {
+	return fmt.Errorf("%w %q: %v", ErrMalformedBucket, v, err)
+}
+
+// bucket is a token bucket read from or written to Redis
+type bucket struct {
+	tokens float64
+	last   int64
+	state  string
+}
+
+// storage reads and writes token buckets in Redis
+type storage interface {
+	// read returns the token bucket stored at the given key and true, or false
+	// if the key does not exist. State is only guaranteed to be read when
+	// withState is true.
+	read(c redis.Conn, key string, withState bool) (bucket, bool, error)
+
+	// create stores a new token bucket including its state at the given key
+	create(c redis.Conn, key string, b bucket) error
+
+	// update atomically updates the tokens and last update time of the token
+	// bucket stored at the given key leaving its state unchanged
+	update(c redis.Conn, key string, b bucket) error
+}
+
+// newStorage returns the storage for the given layout and time format
+func newStorage(layout StorageLayout, format TimeFormat) storage {
+	switch layout {
+	case LayoutHash:
+		return hashStorage{format: format}
+	case LayoutString:
+		return stringStorage{format: format}
+	}
+	return listStorage{format: format}
+}
+
+// listStorage stores token buckets as lists
+type listStorage struct {
+	format TimeFormat
+}
+
+func (s listStorage) read(c redis.Conn, key string, withState bool) (bucket, bool, error) {
+	end := 1
+	if withState {
+		end = 2
+	}
+
+	// get list of token bucket and last token bucket update
+	resp, err := redis.Values(c.Do("LRANGE", key, 0, end))
+	if err != nil || len(resp) == 0 {
+		return bucket{}, false, err
+	}
+
+	var b bucket
+	var last string
+	if resp, err = redis.Scan(resp, &b.tokens, &last); err != nil {
+		return bucket{}, false, malformed(key, err)
+	}
+	if b.last, err = s.format.decode(last); err != nil {
+		return bucket{}, false, malformed(key, err)
+	}
+	if len(resp) > 0 {
+		if b.state, err = redis.String(resp[0], nil); err != nil {
+			return bucket{}, false, malformed(key, err)
+		}
+	}
+	return b, true, nil
+}
+
+func (s listStorage) create(c redis.Conn, key string, b bucket) error {
+	// elements are pushed onto the head of the list in reverse order
+	args := []interface{}{key}
+	if b.state != "" {
+		args = append(args, b.state)
+	}
+	_, err := c.Do("LPUSH", append(args, s.format.arg(b.last), b.tokens)...)
+	return err
+}
+
+func (s listStorage) update(c redis.Conn, key string, b bucket) error {
+	c.Send("MULTI")
+	c.Send("LSET", key, 0, b.tokens)
+	c.Send("LSET", key, 1, s.format.arg(b.last))
+	return exec(c)
+}
+
+// hashStorage stores token buckets as hashes
+type hashStorage struct {
+	format TimeFormat
+}
+
+func (s hashStorage) read(c redis.Conn, key string, withState bool) (bucket, bool, error) {
+	resp, err := redis.Values(c.Do("HMGET", key, "tokens", "last", "state"))
+	if err != nil || len(resp) < 3 || resp[0] == nil {
+		return bucket{}, false, err
+	}
+
+	var b bucket
+	var last string
+	if resp, err = redis.Scan(resp, &b.tokens, &last); err != nil {
+		return bucket{}, false, malformed(key, err)
+	}
+	if b.last, err = s.format.decode(last); err != nil {
+		return bucket{}, false, malformed(key, err)
+	}
+	if resp[0] != nil {
+		if b.state, err = redis.String(resp[0], nil); err != nil {
+			return bucket{}, false, malformed(key, err)
+		}
+	}
+	return b, true, nil
+}
+
+func (s hashStorage) create(c redis.Conn, key string, b bucket) error {
+	args := []interface{}{key, "tokens", b.tokens, "last", s.format.arg(b.last)}
+	if b.state != "" {
+		args = append(args, "state", b.state)
+	}
+	_, err := c.Do("HSET", args...)
+	return err
+}
+
+func (s hashStorage) update(c redis.Conn, key string, b bucket) error {
+	_, err := c.Do("HSET", key, "tokens", b.tokens, "last", s.format.arg(b.last))
+	return err
+}
+
+// stringStorage stores token buckets as strings
+type stringStorage struct {
+	format TimeFormat
+}
+
+// encode packs a token bucket into a string
+func (s stringStorage) encode(b bucket) string {
+	v := strconv.FormatFloat(b.tokens, 'g', -1, 64) + ":" + s.format.encode(b.last)
+	if b.state != "" {
+		v += ":" + b.state
+	}
+	return v
+}
+
+// decode unpacks a token bucket from a string
+func (s stringStorage) decode(v string) (bucket, error) {
+	var b bucket
+	tokens, rest, ok := strings.Cut(v, ":")
+	if !ok {
+		return b, malformed(v, errors.New("missing separator"))
+	}
+	last, state, _ := s.format.cut(rest)
+
+	var err error
+	if b.tokens, err = strconv.ParseFloat(tokens, 64); err != nil {
+		return b, malformed(v, err)
+	}
+	if b.last, err = s.format.decode(last); err != nil {
+		return b, malformed(v, err)
+	}
+	b.state = state
+	return b, nil
+}
+
+func (s stringStorage) read(c redis.Conn, key string, withState bool) (bucket, bool, error) {
+	v, err := redis.String(c.Do("GET", key))
+	if err == redis.ErrNil {
+		return bucket{}, false, nil
+	}
+	if err != nil {
+		return bucket{}, false, err
+	}
+
+	b, err := s.decode(v)
+	if err != nil {
+		return bucket{}, false, err
+	}
+	return b, true, nil
+}
+
+func (s stringStorage) create(c redis.Conn, key string, b bucket) error {
+	return s.update(c, key, b)
+}
+
+// update stores the whole token bucket including its state which must have
+// been read along with the bucket
+func (s stringStorage) update(c redis.Conn, key string, b bucket) error {
+	_, err := c.Do("SET", key, s.encode(b))
+	return err
+}
+
+// luaStorage defines functions for Lua scripts to read and write token buckets
+// in any layout and time format. Scripts using it must pass storageArg as
+// ARGV[1].
+const luaStorage = `
+local layout, time_format = string.match(ARGV[1], "^(%d+):?(%d*)$")
+layout = tonumber(layout)
+time_format = tonumber(time_format) or 0
+` + luaTime + `
+
+-- read_bucket returns the token bucket stored at the given key, nil if the key
+-- does not exist
+local function read_bucket(key)
+	if layout == 1 then
+		local v = redis.call("HMGET", key, "tokens", "last", "state")
+		if not v[1] then
+			return nil
+		end
+		return {tokens = tonumber(v[1]), last = decode_time(v[2]), state = v[3]}
+	elseif layout == 2 then
+		local v = redis.call("GET", key)
+		if not v then
+			return nil
+		end
+		local pattern = "^([^:]*):([^:]*):?(.*)$"
+		if time_format == 2 then
+			-- the colons of RFC 3339 times are not separators
+			pattern = "^([^:]*):([^Z]*Z):?(.*)$"
+		end
+		local tokens, last, state = string.match(v, pattern)
+		if state == "" then
+			state = false
+		end
+		return {tokens = tonumber(tokens), last = decode_time(last), state = state}
+	end
+	local v = redis.call("LRANGE", key, 0, 2)
+	if #v == 0 then
+		return nil
+	end
+	return {tokens = tonumber(v[1]), last = decode_time(v[2]), state = v[3] or false}
+end
+
+-- write_bucket writes the given token bucket to the given key, exists is the
+-- token bucket previously read from the key, if any. Existing state is kept
+-- when the given bucket has no state.
+local function write_bucket(key, b, exists)
+	if exists and not b.state then
+		b.state = exists.state
+	end
+	local last = encode_time(b.last)
+
+	if layout == 1 then
+		redis.call("HSET", key, "tokens", b.tokens, "last", last)
+		if b.state then
+			redis.call("HSET", key, "state", b.state)
+		end
+	elseif layout == 2 then
+		local v = b.tokens .. ":" .. last
+		if b.state then
+			v = v .. ":" .. b.state
+		end
+		redis.call("SET", key, v)
+	elseif exists then
+		redis.call("LSET", key, 0, b.tokens)
+		redis.call("LSET", key, 1, last)
+		if b.state then
+			if redis.call("LLEN", key) > 2 then
+				redis.call("LSET", key, 2, b.state)
+			else
+				redis.call("RPUSH", key, b.state)
+			end
+		end
+	elseif b.state then
+		redis.call("RPUSH", key, b.tokens, last, b.state)
+	else
+		redis.call("RPUSH", key, b.tokens, last)
+	end
+end
+`
+
+// luaRefill defines a function for Lua scripts to calculate the tokens in a
+// token bucket read by read_bucket after allotting tokens for the intervals
+// elapsed since its last update
+const luaRefill = `
+local function refill(b, now, interval, rate, burst)
+	if not b then
+		return burst
+	end
+	local since = math.floor((now - b.last) / interval)
+	return math.min(b.tokens + since * rate, burst)
+end
+`
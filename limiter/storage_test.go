@@ -0,0 +1,191 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestListStorage(t *testing.T) {
+	m := &mockConn{}
+	s := newStorage(LayoutList, TimeUnix)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 2}).Return(
+		[]interface{}{[]byte("1.5"), []byte("100"), []byte("pro")}, nil,
+	).Once()
+	b, ok, err := s.read(m, key, true)
+	if err != nil || !ok {
+		t.Fatalf("expected to read bucket: %v", err)
+	}
+	if b != (bucket{tokens: 1.5, last: 100, state: "pro"}) {
+		t.Errorf("unexpected bucket: %+v", b)
+	}
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return([]interface{}{}, nil).Once()
+	if _, ok, err := s.read(m, key, false); ok || err != nil {
+		t.Errorf("expected missing bucket: %v", err)
+	}
+
+	m.On("Do", "LPUSH", []interface{}{key, int64(100), 1.5}).Return(int64(2), nil).Once()
+	if err := s.create(m, key, bucket{tokens: 1.5, last: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	var n []interface{} = nil
+	m.On("Send", "MULTI", n).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 0, 1.5}).Return(nil).Once()
+	m.On("Send", "LSET", []interface{}{key, 1, int64(100)}).Return(nil).Once()
+	m.On("Do", "EXEC", n).Return([]interface{}{"OK", "OK"}, nil).Once()
+	if err := s.update(m, key, bucket{tokens: 1.5, last: 100}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestHashStorage(t *testing.T) {
+	m := &mockConn{}
+	s := newStorage(LayoutHash, TimeUnix)
+	key := "foo"
+
+	m.On("Do", "HMGET", []interface{}{key, "tokens", "last", "state"}).Return(
+		[]interface{}{[]byte("1.5"), []byte("100"), nil}, nil,
+	).Once()
+	b, ok, err := s.read(m, key, true)
+	if err != nil || !ok {
+		t.Fatalf("expected to read bucket: %v", err)
+	}
+	if b != (bucket{tokens: 1.5, last: 100}) {
+		t.Errorf("unexpected bucket: %+v", b)
+	}
+
+	m.On("Do", "HMGET", []interface{}{key, "tokens", "last", "state"}).Return(
+		[]interface{}{nil, nil, nil}, nil,
+	).Once()
+	if _, ok, err := s.read(m, key, false); ok || err != nil {
+		t.Errorf("expected missing bucket: %v", err)
+	}
+
+	m.On("Do", "HSET", []interface{}{key, "tokens", 1.5, "last", int64(100)}).Return(int64(2), nil).Twice()
+	if err := s.create(m, key, bucket{tokens: 1.5, last: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.update(m, key, bucket{tokens: 1.5, last: 100, state: "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestStringStorage(t *testing.T) {
+	m := &mockConn{}
+	s := newStorage(LayoutString, TimeUnix)
+	key := "foo"
+
+	m.On("Do", "GET", []interface{}{key}).Return([]byte("1.5:100:a:b"), nil).Once()
+	b, ok, err := s.read(m, key, false)
+	if err != nil || !ok {
+		t.Fatalf("expected to read bucket: %v", err)
+	}
+	if b != (bucket{tokens: 1.5, last: 100, state: "a:b"}) {
+		t.Errorf("unexpected bucket: %+v", b)
+	}
+
+	m.On("Do", "GET", []interface{}{key}).Return(nil, nil).Once()
+	if _, ok, err := s.read(m, key, false); ok || err != nil {
+		t.Errorf("expected missing bucket: %v", err)
+	}
+
+	m.On("Do", "GET", []interface{}{key}).Return([]byte("bad"), nil).Once()
+	if _, _, err := s.read(m, key, false); !errors.Is(err, ErrMalformedBucket) {
+		t.Errorf("expected malformed bucket error: %v", err)
+	}
+
+	m.On("Do", "SET", []interface{}{key, "1.5:100"}).Return("OK", nil).Once()
+	if err := s.create(m, key, bucket{tokens: 1.5, last: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state read with the bucket is written back
+	m.On("Do", "SET", []interface{}{key, "0.5:101:a:b"}).Return("OK", nil).Once()
+	if err := s.update(m, key, bucket{tokens: 0.5, last: 101, state: "a:b"}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisAllowHashLayout(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.storage = newStorage(LayoutHash, TimeUnix)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "HMGET", []interface{}{key, "tokens", "last", "state"}).Return(
+		[]interface{}{nil, nil, nil}, nil,
+	).Once()
+	m.On("Do", "HSET", []interface{}{
+		key, "tokens", float64(l.burst - 1), "last", now.Unix(),
+	}).Return(int64(2), nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+}
+
+func TestStringStorageEncoding(t *testing.T) {
+	s := stringStorage{}
+	for _, b := range []bucket{
+		{tokens: 10, last: 1700000000},
+		{tokens: 0.25, last: 1},
+		{tokens: -3.5, last: 1700000000},
+		{tokens: 1, last: 2, state: "pro"},
+		{tokens: 1, last: 2, state: "a:b"},
+	} {
+		v := s.encode(b)
+		decoded, err := s.decode(v)
+		if err != nil {
+			t.Fatalf("expected to decode %q: %v", v, err)
+		}
+		if decoded != b {
+			t.Errorf("expected %q to decode to %+v: %+v", v, b, decoded)
+		}
+	}
+	if v := s.encode(bucket{tokens: 1.5, last: 100}); v != "1.5:100" {
+		t.Errorf("expected bucket to be packed as tokens:last: %q", v)
+	}
+}
+
+func TestRedisAllowStringLayout(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.storage = newStorage(LayoutString, TimeUnix)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	// the update is a single SET rather than a transaction
+	m.On("Do", "GET", []interface{}{key}).Return([]byte(fmt.Sprintf("5:%d", now.Unix())), nil).Once()
+	m.On("Do", "SET", []interface{}{key, fmt.Sprintf("4:%d", now.Unix())}).Return("OK", nil).Once()
+
+	if !l.Allow(key) {
+		t.Errorf("expected to allow key: %s", key)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestRedisAllowStringLayoutError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.storage = newStorage(LayoutString, TimeUnix)
+	key := "foo"
+
+	m.On("Do", "GET", []interface{}{key}).Return(nil, redis.Error("not good")).Once()
+
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+}
@@ -0,0 +1,92 @@
+package limiter
+
+import "context"
+
+// streamBatchSize is the most IDs AllowStream decides in one batch
+const streamBatchSize = 64
+
+// stream decides the IDs received from the given channel in batches of those
+// already queued, emitting their decisions in order. The returned channel is
+// closed once the IDs are closed and decided, or the context is done.
+func stream(ctx context.Context, ids <-chan string, decide func(batch []string) []Decision) <-chan Decision {
+	decisions := make(chan Decision)
+
+	go func() {
+		defer close(decisions)
+
+		for closed := false; !closed; {
+			var batch []string
+			select {
+			case <-ctx.Done():
+				return
+			case id, ok := <-ids:
+				if !ok {
+					return
+				}
+				batch = append(batch, id)
+			}
+
+			// batch the IDs queued behind the first without waiting for more
+		queued:
+			for len(batch) < streamBatchSize {
+				select {
+				case id, ok := <-ids:
+					if !ok {
+						closed = true
+						break queued
+					}
+					batch = append(batch, id)
+				default:
+					break queued
+				}
+			}
+
+			for _, d := range decide(batch) {
+				select {
+				case decisions <- d:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return decisions
+}
+
+// AllowStream decides an event for each ID received from the given channel,
+// emitting their decisions in order on the returned channel, which is closed
+// once the IDs are closed or the context is done. IDs queued together are
+// decided in a batch like AllowAll, by a single script in one round trip, so
+// only the per-key features AllowAll applies are in effect. Errors are carried
+// by the decisions. The caller must receive every decision or cancel the
+// context.
+func (l *redisLimiter) AllowStream(ctx context.Context, ids <-chan string) <-chan Decision {
+	return stream(ctx, ids, l.decideBatch)
+}
+
+func (l *inMemoryLimiter) AllowStream(ctx context.Context, ids <-chan string) <-chan Decision {
+	return stream(ctx, ids, func(batch []string) []Decision {
+		return decideAll(batch, l.Check)
+	})
+}
+
+func (l *disabledLimiter) AllowStream(ctx context.Context, ids <-chan string) <-chan Decision {
+	return stream(ctx, ids, func(batch []string) []Decision {
+		return decideAll(batch, l.Check)
+	})
+}
+
+// decideAll checks an event for each of the given IDs in order, each decision
+// carrying the error of its check
+func decideAll(batch []string, check func(id string, n int) (Decision, error)) []Decision {
+	decisions := make([]Decision, len(batch))
+	for i, id := range batch {
+		d, err := check(id, 1)
+		if d.Err == nil {
+			d.Err = err
+		}
+		decisions[i] = d
+	}
+	return decisions
+}
@@ -0,0 +1,174 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+)
+
+// queue returns a closed channel holding the given IDs
+func queue(ids ...string) <-chan string {
+	c := make(chan string, len(ids))
+	for _, id := range ids {
+		c <- id
+	}
+	close(c)
+	return c
+}
+
+// collect receives decisions until the channel is closed
+func collect(t *testing.T, decisions <-chan Decision) []Decision {
+	t.Helper()
+	var got []Decision
+	for {
+		select {
+		case d, ok := <-decisions:
+			if !ok {
+				return got
+			}
+			got = append(got, d)
+		case <-time.After(time.Second):
+			t.Fatal("expected the decisions to be closed")
+		}
+	}
+}
+
+func TestAllowStream(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+
+		var got []Decision
+		for _, d := range collect(t, l.AllowStream(context.Background(), queue("foo", "foo", "foo", "bar"))) {
+			got = append(got, Decision{ID: d.ID, Allowed: d.Allowed, Reason: d.Reason})
+		}
+		want := []Decision{
+			{ID: "foo", Allowed: true, Reason: DecisionAllowed},
+			{ID: "foo", Allowed: true, Reason: DecisionAllowed},
+			{ID: "foo", Allowed: false, Reason: DecisionLimited},
+			{ID: "bar", Allowed: true, Reason: DecisionAllowed},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestAllowStreamError(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+		FailOpen:   true,
+	})
+	s.Close()
+
+	for _, d := range collect(t, l.AllowStream(context.Background(), queue("foo", "bar"))) {
+		if !d.Allowed || d.Err == nil {
+			t.Errorf("expected %s to fail open with an error, got %v", d.ID, d)
+		}
+	}
+}
+
+func TestAllowStreamRoundTrip(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	}).(*redisLimiter)
+	var trips int
+	dial := l.pool.Dial
+	l.pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		return tripConn{Conn: c, trips: &trips}, err
+	}
+
+	// the script is loaded by the first batch
+	collect(t, l.AllowStream(context.Background(), queue("foo")))
+	trips = 0
+	if got := collect(t, l.AllowStream(context.Background(), queue("foo", "bar", "baz"))); len(got) != 3 {
+		t.Fatalf("expected 3 decisions, got %v", got)
+	}
+	if trips != 1 {
+		t.Errorf("expected the batch to make one round trip, got %d", trips)
+	}
+}
+
+func TestDecideAllErrors(t *testing.T) {
+	fail := errors.New("not good")
+	decisions := decideAll([]string{"foo"}, func(id string, n int) (Decision, error) {
+		return Decision{ID: id}, fail
+	})
+	if decisions[0].Err != fail {
+		t.Errorf("expected the decision to carry its error: %v", decisions[0].Err)
+	}
+}
+
+func TestStreamBatches(t *testing.T) {
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = "foo"
+	}
+
+	// queued IDs are decided together, up to the batch size
+	var batches []int
+	decisions := stream(context.Background(), queue(ids...), func(batch []string) []Decision {
+		batches = append(batches, len(batch))
+		return decideAll(batch, func(id string, n int) (Decision, error) { return Decision{ID: id, Allowed: true}, nil })
+	})
+	if got := collect(t, decisions); len(got) != len(ids) {
+		t.Errorf("expected %d decisions, got %d", len(ids), len(got))
+	}
+	if want := []int{streamBatchSize, len(ids) - streamBatchSize}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("expected batches of %v, got %v", want, batches)
+	}
+}
+
+func TestAllowStreamCancel(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, RateLimit: 1, BurstLimit: 1, Interval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ids := make(chan string)
+	decisions := l.AllowStream(ctx, ids)
+	ids <- "foo"
+	if d := <-decisions; d.ID != "foo" || !d.Allowed {
+		t.Errorf("expected foo to be allowed, got %v", d)
+	}
+
+	// the stream stops without the IDs being closed
+	cancel()
+	collect(t, decisions)
+}
+
+func TestDisabledAllowStream(t *testing.T) {
+	for _, d := range collect(t, New(Config{Type: TypeDisabled}).AllowStream(context.Background(), queue("foo"))) {
+		if !d.Allowed {
+			t.Error("expected the disabled limiter to allow")
+		}
+	}
+	for _, d := range collect(t, New(Config{Type: TypeBlockAll}).AllowStream(context.Background(), queue("foo"))) {
+		if d.Allowed {
+			t.Error("expected the block all limiter to deny")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// sweeper schedules deleting in-memory token buckets which have been idle for
+// longer than the idle timeout. Sweeps run as events are decided, at most
+// once per idle timeout, rather than on a timer of their own so the clock
+// driving them is the limiter's injectable one.
+type sweeper struct {
+	idle time.Duration
+	mux  sync.Mutex
+	next time.Time
+}
+
+// newSweeper returns a sweeper for the given idle timeout, nil if idle token
+// buckets are kept
+func newSweeper(idle time.Duration) *sweeper {
+	if idle <= 0 {
+		return nil
+	}
+	return &sweeper{idle: idle}
+}
+
+// due returns true if a sweep is due at the given time, scheduling the next
+func (s *sweeper) due(now time.Time) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if now.Before(s.next) {
+		return false
+	}
+	s.next = now.Add(s.idle)
+	return true
+}
+
+// sweep deletes idle token buckets if a sweep is due
+func (l *inMemoryLimiter) sweep() {
+	if l.sweeper != nil && l.sweeper.due(l.now()) {
+		l.sweepNow()
+	}
+}
+
+// sweepNow deletes every token bucket which has not been updated for longer
+// than the idle timeout, along with all other state kept about its key. Keys
+// still blocked are kept so their blocks are not lifted. Buckets are idle as
+// of the limiter's clock so tests can advance it rather than sleep.
+func (l *inMemoryLimiter) sweepNow() {
+	now := l.now()
+	cutoff := now.Add(-l.sweeper.idle)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for key, b := range l.buckets {
+		if until, ok := l.blocks[key]; ok && now.Before(until) {
+			continue
+		}
+		if time.Unix(b.last, 0).Before(cutoff) {
+			b.state = l.states[key]
+			l.forget(key)
+			l.evicted(key, bucketState(b))
+		}
+	}
+
+	// a limiter which never allowed events is idle once it is full
+	for key, limiter := range l.limiters {
+		if until, ok := l.blocks[key]; ok && now.Before(until) {
+			continue
+		}
+		seen, ok := l.seen[key]
+		if ok && !seen.Before(cutoff) || !ok && limiterTokens(limiter, now) < float64(limiter.Burst()) {
+			continue
+		}
+		state := BucketState{
+			Tokens:     limiterTokens(limiter, now),
+			LastUpdate: seen,
+			State:      l.states[key],
+		}
+		l.forget(key)
+		l.evicted(key, state)
+	}
+}
+
+// forget deletes the given key's token bucket and overflow bucket along with
+// every other piece of per-key state, including its group membership. Sweeps
+// and ResetGroup share it so they delete the same state. The caller must hold
+// the lock.
+func (l *inMemoryLimiter) forget(key string) {
+	for _, key := range []string{key, overflowKey(key)} {
+		delete(l.buckets, key)
+		delete(l.limiters, key)
+		delete(l.seen, key)
+	}
+	delete(l.states, key)
+	delete(l.windows, key)
+	delete(l.windows, penaltyKey(key))
+	delete(l.windows, sometimesKey(key))
+	delete(l.blocks, key)
+	delete(l.flapping, key)
+	delete(l.expires, key)
+	delete(l.stats, key)
+	delete(l.usages, key)
+	delete(l.created, key)
+	delete(l.intervals, key)
+	delete(l.seqs, key)
+	if l.groupFunc != nil {
+		group := l.groupFunc(l.keyLength.id(key))
+		delete(l.groups[group], key)
+		if len(l.groups[group]) == 0 {
+			delete(l.groups, group)
+		}
+	}
+}
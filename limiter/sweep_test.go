@@ -0,0 +1,143 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSweepNow(t *testing.T) {
+	for name, config := range map[string]Config{
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.IdleTimeout = time.Minute
+		l := New(config).(*inMemoryLimiter)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		l.now = func() time.Time { return now }
+
+		l.Allow("idle")
+		now = now.Add(30 * time.Second)
+		l.Allow("active")
+
+		// idle is past the threshold while active is not
+		now = now.Add(45 * time.Second)
+		l.sweepNow()
+
+		if exists, _ := l.Exists("idle"); exists {
+			t.Errorf("%s: expected the idle key to be swept", name)
+		}
+		if exists, _ := l.Exists("active"); !exists {
+			t.Errorf("%s: expected the active key to remain", name)
+		}
+	}
+}
+
+func TestSweepDue(t *testing.T) {
+	l := New(Config{
+		Type:        TypeInMemory,
+		PureGo:      true,
+		RateLimit:   1,
+		BurstLimit:  2,
+		IdleTimeout: time.Minute,
+	}).(*inMemoryLimiter)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	// the first event schedules the next sweep a minute later
+	l.Allow("foo")
+	now = now.Add(30 * time.Second)
+	l.Allow("bar")
+	now = now.Add(60 * time.Second)
+	l.Allow("baz")
+	if exists, _ := l.Exists("foo"); exists {
+		t.Error("expected foo to be swept once a sweep was due")
+	}
+	if exists, _ := l.Exists("bar"); !exists {
+		t.Error("expected bar to remain until it is idle")
+	}
+
+	// sweeps run at most once per idle timeout
+	now = now.Add(50 * time.Second)
+	l.Allow("baz")
+	if exists, _ := l.Exists("bar"); !exists {
+		t.Error("expected bar to remain until the next sweep is due")
+	}
+	now = now.Add(10 * time.Second)
+	l.Allow("baz")
+	if exists, _ := l.Exists("bar"); exists {
+		t.Error("expected bar to be swept by the next sweep")
+	}
+}
+
+func TestSweepDisabled(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1}).(*inMemoryLimiter)
+	if l.sweeper != nil {
+		t.Error("expected idle token buckets to be kept by default")
+	}
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	l.Allow("foo")
+	now = now.Add(24 * time.Hour)
+	l.Allow("bar")
+	if exists, _ := l.Exists("foo"); !exists {
+		t.Error("expected foo to remain")
+	}
+}
+
+func TestSweepForgetsState(t *testing.T) {
+	l := New(Config{
+		Type:         TypeInMemory,
+		PureGo:       true,
+		RateLimit:    1,
+		BurstLimit:   2,
+		IdleTimeout:  time.Minute,
+		Stats:        true,
+		UsageWindow:  time.Minute,
+		KeyIntervals: true,
+		GroupFunc:    func(id string) string { return "tenant" },
+	}).(*inMemoryLimiter)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	l.SetInterval("idle", time.Second)
+	l.AllowSeq("idle", 1, 1)
+	l.Allow("blocked")
+	l.Block("blocked", time.Hour)
+
+	now = now.Add(2 * time.Minute)
+	l.sweepNow()
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	key, _ := l.keyLength.key("idle")
+	if _, ok := l.stats[key]; ok {
+		t.Error("expected the idle key's stats to be forgotten")
+	}
+	if _, ok := l.usages[key]; ok {
+		t.Error("expected the idle key's usage to be forgotten")
+	}
+	if _, ok := l.seqs[key]; ok {
+		t.Error("expected the idle key's sequence number to be forgotten")
+	}
+	if _, ok := l.intervals[key]; ok {
+		t.Error("expected the idle key's interval to be forgotten")
+	}
+	if l.groups["tenant"][key] {
+		t.Error("expected the idle key to leave its group")
+	}
+
+	// the blocked key is kept so its block is not lifted
+	blocked, _ := l.keyLength.key("blocked")
+	if _, ok := l.blocks[blocked]; !ok {
+		t.Error("expected the blocked key's block to remain")
+	}
+	if !l.groups["tenant"][blocked] {
+		t.Error("expected the blocked key to remain in its group")
+	}
+}
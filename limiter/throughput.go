@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// throughputSlots is the number of one second slots Throughput is computed
+// over
+const throughputSlots = 10
+
+// throughputSlot counts the events allowed during one second
+type throughputSlot struct {
+	sec   int64
+	count int64
+}
+
+// throughput counts allowed events in a sliding window of one second slots.
+// Counts are updated atomically without locking, events allowed concurrently
+// with a slot being reused for a new second may be dropped.
+type throughput struct {
+	slots [throughputSlots]throughputSlot
+	now   func() time.Time
+}
+
+// newThroughput returns a throughput counter using the given clock
+func newThroughput(now func() time.Time) *throughput {
+	return &throughput{now: now}
+}
+
+// add counts n allowed events
+func (t *throughput) add(n int) {
+	sec := t.now().Unix()
+	s := &t.slots[sec%throughputSlots]
+	for {
+		old := atomic.LoadInt64(&s.sec)
+		if old == sec {
+			atomic.AddInt64(&s.count, int64(n))
+			return
+		}
+		// reuse the slot for the current second
+		if atomic.CompareAndSwapInt64(&s.sec, old, sec) {
+			atomic.StoreInt64(&s.count, int64(n))
+			return
+		}
+	}
+}
+
+// rate returns the mean number of allowed events per second over the window
+func (t *throughput) rate() float64 {
+	sec := t.now().Unix()
+
+	var total int64
+	for i := range t.slots {
+		s := &t.slots[i]
+		if sec-atomic.LoadInt64(&s.sec) < throughputSlots {
+			total += atomic.LoadInt64(&s.count)
+		}
+	}
+	return float64(total) / throughputSlots
+}
+
+// Throughput returns the number of events allowed per second across all keys
+// over the last ten seconds
+func (l *redisLimiter) Throughput() float64 {
+	return l.allowed.rate()
+}
+
+func (l *inMemoryLimiter) Throughput() float64 {
+	return l.allowed.rate()
+}
+
+// Throughput returns zero as the disabled limiter does not count events
+func (l *disabledLimiter) Throughput() float64 {
+	return 0
+}
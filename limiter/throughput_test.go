@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestThroughput(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tp := newThroughput(func() time.Time { return now })
+
+	// allow 5 events per second for 10 seconds
+	for i := 0; i < throughputSlots; i++ {
+		for j := 0; j < 5; j++ {
+			tp.add(1)
+		}
+		now = now.Add(time.Second)
+	}
+	now = now.Add(-time.Nanosecond)
+	if r := tp.rate(); r != 5 {
+		t.Errorf("expected a throughput of 5: %v", r)
+	}
+
+	// slots older than the window are not counted
+	now = now.Add(5 * time.Second)
+	if r := tp.rate(); r != 2.5 {
+		t.Errorf("expected a throughput of 2.5: %v", r)
+	}
+
+	now = now.Add(time.Minute)
+	if r := tp.rate(); r != 0 {
+		t.Errorf("expected a throughput of 0: %v", r)
+	}
+}
+
+func TestInMemoryThroughput(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 20,
+		Interval:   time.Hour,
+	}).(*inMemoryLimiter)
+	now := time.Now()
+	l.allowed = newThroughput(func() time.Time { return now })
+
+	// 15 allowed and 5 denied events
+	l.AllowN("foo", 10)
+	l.AllowN("bar", 5)
+	l.AllowN("foo", 15)
+	if allowed, _ := l.AllowChild("bar", "a", 1); !allowed {
+		t.Fatal("expected to allow child a")
+	}
+
+	if r := l.Throughput(); math.Abs(r-1.6) > 1e-9 {
+		t.Errorf("expected a throughput of 1.6: %v", r)
+	}
+}
+
+func TestRedisThroughput(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	now := time.Now()
+	l.allowed = newThroughput(func() time.Time { return now })
+	key := "foo"
+
+	m.On(
+		"Do", "LRANGE", []interface{}{key, 0, 1},
+	).Return([]interface{}{}, nil).Once()
+	m.On(
+		"Do", "LPUSH", []interface{}{key, now.Unix(), float64(l.burst - 5)},
+	).Return(int64(2), nil).Once()
+	l.now = func() time.Time { return now }
+
+	if !l.AllowN(key, 5) {
+		t.Fatalf("expected to allow key: %s", key)
+	}
+	if r := l.Throughput(); r != 0.5 {
+		t.Errorf("expected a throughput of 0.5: %v", r)
+	}
+}
+
+func TestDisabledThroughput(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	l.Allow("foo")
+	if r := l.Throughput(); r != 0 {
+		t.Errorf("expected a throughput of 0: %v", r)
+	}
+}
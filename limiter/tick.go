@@ -0,0 +1,43 @@
+package limiter
+
+import "time"
+
+// tickTime returns a clock fixed at the given tick, ticks are treated as
+// seconds since the Unix epoch
+func tickTime(tick uint64) func() time.Time {
+	t := time.Unix(int64(tick), 0)
+	return func() time.Time { return t }
+}
+
+// AllowAtTick is like AllowN but token buckets are refilled by RateLimit tokens
+// per tick of a logical clock controlled by the caller rather than per
+// Interval of wall clock time. The tick is stored alongside the tokens as the
+// bucket's last update, so a key's ticks must not go backwards and keys should
+// not be mixed between AllowAtTick and the wall clock methods.
+func (l *redisLimiter) AllowAtTick(key string, tick uint64, n int) bool {
+	return l.atTick(tick).allowN(key, n, l.rate, l.burst)
+}
+
+// atTick returns a copy of the limiter sharing its storage whose clock is
+// fixed at the given tick
+func (l *redisLimiter) atTick(tick uint64) *redisLimiter {
+	c := l.withInterval(time.Second)
+	c.now = tickTime(tick)
+	return c
+}
+
+func (l *inMemoryLimiter) AllowAtTick(key string, tick uint64, n int) bool {
+	return l.atTick(tick).allowN(key, n, l.rate, l.burst)
+}
+
+// atTick returns a copy of the limiter sharing its storage whose clock is
+// fixed at the given tick
+func (l *inMemoryLimiter) atTick(tick uint64) *inMemoryLimiter {
+	c := l.withInterval(time.Second)
+	c.now = tickTime(tick)
+	return c
+}
+
+func (l *disabledLimiter) AllowAtTick(key string, tick uint64, n int) bool {
+	return true
+}
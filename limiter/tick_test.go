@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAllowAtTick(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 2
+		config.Interval = time.Hour
+		l := New(config)
+
+		if !l.AllowAtTick("foo", 10, 2) {
+			t.Fatalf("%s: expected to allow the burst at tick 10", name)
+		}
+		if l.AllowAtTick("foo", 10, 1) {
+			t.Errorf("%s: expected to not allow beyond the burst at tick 10", name)
+		}
+
+		// a tick refills one token regardless of the hour long interval
+		if !l.AllowAtTick("foo", 11, 1) {
+			t.Errorf("%s: expected to allow one event at tick 11", name)
+		}
+		if l.AllowAtTick("foo", 11, 1) {
+			t.Errorf("%s: expected to not allow a second event at tick 11", name)
+		}
+
+		// refilled tokens are capped at the burst
+		if !l.AllowAtTick("foo", 100, 2) {
+			t.Errorf("%s: expected to allow the burst at tick 100", name)
+		}
+		if l.AllowAtTick("foo", 100, 1) {
+			t.Errorf("%s: expected to not allow beyond the burst at tick 100", name)
+		}
+	}
+}
+
+func TestRedisAllowAtTickStoresTick(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:       TypeRedis,
+		Address:    s.Addr(),
+		RateLimit:  1,
+		BurstLimit: 2,
+	})
+
+	l.AllowAtTick("foo", 42, 1)
+	state, err := l.Inspect(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tokens != 1 || state.LastUpdate.Unix() != 42 {
+		t.Errorf("expected 1 token at tick 42: %+v", state)
+	}
+}
+
+func TestDisabledAllowAtTick(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if !l.AllowAtTick("foo", 1, 1) {
+		t.Error("expected disabled limiter to allow")
+	}
+}
@@ -0,0 +1,150 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat defines how the last update time of token buckets is stored in
+// Redis, for tools reading the buckets which expect another format
+type TimeFormat int
+
+const (
+	// TimeUnix stores the last update time in Unix seconds
+	TimeUnix TimeFormat = iota
+	// TimeUnixMilli stores the last update time in Unix milliseconds
+	TimeUnixMilli
+	// TimeRFC3339 stores the last update time as an RFC 3339 timestamp in UTC
+	TimeRFC3339
+)
+
+// encode returns the given last update time in Unix seconds in the format
+func (f TimeFormat) encode(last int64) string {
+	switch f {
+	case TimeUnixMilli:
+		return strconv.FormatInt(last*1000, 10)
+	case TimeRFC3339:
+		return time.Unix(last, 0).UTC().Format(time.RFC3339)
+	}
+	return strconv.FormatInt(last, 10)
+}
+
+// arg returns the given last update time in Unix seconds as a command
+// argument in the format, unchanged for Unix seconds
+func (f TimeFormat) arg(last int64) interface{} {
+	if f == TimeUnix {
+		return last
+	}
+	return f.encode(last)
+}
+
+// decode returns the last update time in Unix seconds of the given value in
+// the format
+func (f TimeFormat) decode(v string) (int64, error) {
+	switch f {
+	case TimeUnixMilli:
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.UnixMilli(ms).Unix(), nil
+	case TimeRFC3339:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return 0, err
+		}
+		return t.Unix(), nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// cut splits the given value at the end of a time in the format followed by
+// a colon separator, as the colons of RFC 3339 times are not separators
+func (f TimeFormat) cut(v string) (string, string, bool) {
+	if f == TimeRFC3339 {
+		i := strings.IndexByte(v, 'Z')
+		if i < 0 {
+			return v, "", false
+		}
+		return v[:i+1], strings.TrimPrefix(v[i+1:], ":"), len(v) > i+1
+	}
+	return strings.Cut(v, ":")
+}
+
+// storageArg returns the argument scripts using luaStorage take as ARGV[1],
+// the layout alone for Unix seconds as before time formats were added
+func storageArg(layout StorageLayout, format TimeFormat) interface{} {
+	if format == TimeUnix {
+		return int(layout)
+	}
+	return fmt.Sprintf("%d:%d", layout, format)
+}
+
+// luaTime defines functions for Lua scripts to encode and decode the last
+// update time of token buckets in the time format given to luaStorage
+const luaTime = `
+-- days_from_civil returns the days since the Unix epoch of the given date
+local function days_from_civil(y, m, d)
+	if m <= 2 then
+		y = y - 1
+	end
+	local era = math.floor(y / 400)
+	local yoe = y - era * 400
+	local doy = math.floor((153 * ((m + 9) % 12) + 2) / 5) + d - 1
+	local doe = yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy
+	return era * 146097 + doe - 719468
+end
+
+-- civil_from_days returns the date the given days since the Unix epoch
+local function civil_from_days(z)
+	z = z + 719468
+	local era = math.floor(z / 146097)
+	local doe = z - era * 146097
+	local yoe = math.floor((doe - math.floor(doe / 1460) + math.floor(doe / 36524) - math.floor(doe / 146096)) / 365)
+	local doy = doe - (365 * yoe + math.floor(yoe / 4) - math.floor(yoe / 100))
+	local mp = math.floor((5 * doy + 2) / 153)
+	local d = doy - math.floor((153 * mp + 2) / 5) + 1
+	local m = mp < 10 and mp + 3 or mp - 9
+	local y = yoe + era * 400
+	if m <= 2 then
+		y = y + 1
+	end
+	return y, m, d
+end
+
+-- encode_time returns the given Unix seconds in the time format
+local function encode_time(t)
+	t = tonumber(t)
+	if time_format == 1 then
+		return string.format("%d", t * 1000)
+	elseif time_format == 2 then
+		local days = math.floor(t / 86400)
+		local secs = t - days * 86400
+		local y, m, d = civil_from_days(days)
+		return string.format("%04d-%02d-%02dT%02d:%02d:%02dZ", y, m, d,
+			math.floor(secs / 3600), math.floor(secs % 3600 / 60), secs % 60)
+	end
+	return t
+end
+
+-- decode_time returns the Unix seconds of the given time in the time format
+local function decode_time(v)
+	if time_format == 1 then
+		return math.floor(tonumber(v) / 1000)
+	elseif time_format == 2 then
+		local y, m, d, h, mi, s, zone, zh, zm = string.match(v,
+			"^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)%.?%d*([Zz+-])(%d*):?(%d*)$")
+		local t = days_from_civil(tonumber(y), tonumber(m), tonumber(d)) * 86400 +
+			tonumber(h) * 3600 + tonumber(mi) * 60 + tonumber(s)
+		if zone == "+" then
+			t = t - tonumber(zh) * 3600 - tonumber(zm) * 60
+		elseif zone == "-" then
+			t = t + tonumber(zh) * 3600 + tonumber(zm) * 60
+		end
+		return t
+	end
+	return tonumber(v)
+end
+`
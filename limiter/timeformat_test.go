@@ -0,0 +1,110 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestTimeFormat(t *testing.T) {
+	for format, want := range map[TimeFormat]string{
+		TimeUnix:      "1700000000",
+		TimeUnixMilli: "1700000000000",
+		TimeRFC3339:   "2023-11-14T22:13:20Z",
+	} {
+		if got := format.encode(1700000000); got != want {
+			t.Errorf("%d: expected %s, got %s", format, want, got)
+		}
+		if got, err := format.decode(want); err != nil || got != 1700000000 {
+			t.Errorf("%d: expected to round trip, got %d: %v", format, got, err)
+		}
+	}
+
+	if _, err := TimeRFC3339.decode("1700000000"); err == nil {
+		t.Error("expected Unix seconds to not decode as RFC 3339")
+	}
+}
+
+func TestTimeFormatString(t *testing.T) {
+	s := stringStorage{format: TimeRFC3339}
+	for _, b := range []bucket{
+		{tokens: 1.5, last: 1700000000},
+		{tokens: 1.5, last: 1700000000, state: "a:b"},
+	} {
+		v := s.encode(b)
+		if got, err := s.decode(v); err != nil || got != b {
+			t.Errorf("expected %s to round trip %v, got %v: %v", v, b, got, err)
+		}
+	}
+}
+
+func TestRedisTimeFormat(t *testing.T) {
+	s := miniredis.RunT(t)
+	now := time.Date(2023, 11, 14, 22, 13, 0, 0, time.UTC)
+
+	// the stored last update time of each layout
+	stored := map[StorageLayout]func(key string) string{
+		LayoutList: func(key string) string {
+			v, _ := s.List(key)
+			return v[1]
+		},
+		LayoutHash:   func(key string) string { return s.HGet(key, "last") },
+		LayoutString: func(key string) string { v, _ := s.Get(key); return v },
+	}
+	formats := map[TimeFormat]string{
+		TimeUnix:      "1699999980",
+		TimeUnixMilli: "1699999980000",
+		TimeRFC3339:   "2023-11-14T22:13:00Z",
+	}
+
+	for layout, last := range stored {
+		for format, want := range formats {
+			s.FlushAll()
+			l := New(Config{
+				Type:          TypeRedis,
+				Address:       s.Addr(),
+				RateLimit:     1,
+				BurstLimit:    2,
+				Interval:      time.Minute,
+				StorageLayout: layout,
+				TimeFormat:    format,
+			}).(*redisLimiter)
+			at := now
+			l.now = func() time.Time { return at }
+
+			// buckets written by Go are stored in the format
+			if !l.AllowN("foo", 2) {
+				t.Fatalf("%d/%d: expected the burst to be taken", layout, format)
+			}
+			if got := last("foo"); got != want && got != "0:"+want {
+				t.Errorf("%d/%d: expected %s to be stored, got %s", layout, format, want, got)
+			}
+
+			// as are buckets written by scripts, which refill identically
+			at = now.Add(time.Minute)
+			if allowed, err := l.AllowSeq("foo", 1, 1); err != nil || !allowed {
+				t.Errorf("%d/%d: expected a token a minute later: %v", layout, format, err)
+			}
+			if allowed, _ := l.AllowSeq("foo", 2, 1); allowed {
+				t.Errorf("%d/%d: expected a single token to be added", layout, format)
+			}
+			if got, want := last("foo"), format.encode(at.Unix()); got != want && got != "0:"+want {
+				t.Errorf("%d/%d: expected %s to be stored, got %s", layout, format, want, got)
+			}
+
+			at = now.Add(3 * time.Minute)
+			if tokens, err := l.Tokens("foo"); err != nil || tokens != 2 {
+				t.Errorf("%d/%d: expected the bucket to refill, got %v: %v", layout, format, tokens, err)
+			}
+
+			// state is stored after the time, even with colons in both
+			if err := l.SetState("foo", "a:b"); err != nil {
+				t.Fatal(err)
+			}
+			if allowed, state, err := l.AllowWithState("foo", 1); err != nil || !allowed || state != "a:b" {
+				t.Errorf("%d/%d: expected the state to be read, got %v, %s: %v", layout, format, allowed, state, err)
+			}
+		}
+	}
+}
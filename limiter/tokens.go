@@ -0,0 +1,140 @@
+package limiter
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Tokens returns the number of tokens in the given key's token bucket after
+// allotting tokens for the intervals elapsed since its last update, the burst
+// limit if the key does not exist
+func (l *redisLimiter) Tokens(key string) (float64, error) {
+	l = l.keyed(key)
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	b, ok, err := db.read(key, false)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return float64(l.burst), nil
+	}
+
+	tokens := refill(b, l.now().Add(l.grace), l.interval, l.refillRate(l.rate), l.burst)
+	if _, err := l.prune(db, key, tokens, l.burst); err != nil {
+		return 0, err
+	}
+	return tokens, nil
+}
+
+// TokensAt returns the number of tokens the given key's token bucket will have
+// at the given time if no events happen until then, the burst limit if the
+// key does not exist. Times before now return the current tokens. Unlike
+// Tokens, full buckets are not pruned.
+func (l *redisLimiter) TokensAt(key string, t time.Time) (float64, error) {
+	l = l.keyed(key)
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	b, ok, err := db.read(key, false)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return float64(l.burst), nil
+	}
+	return refill(b, notBefore(t, l.now()).Add(l.grace), l.interval, l.refillRate(l.rate), l.burst), nil
+}
+
+func (l *inMemoryLimiter) Tokens(key string) (float64, error) {
+	l = l.keyed(key)
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.prune(key, l.refillRate(l.rate), l.burst, now)
+
+	if l.pureGo {
+		return l.tokens(key, l.refillRate(l.rate), l.burst, now), nil
+	}
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		return float64(l.burst), nil
+	}
+	return limiterTokens(limiter, now), nil
+}
+
+func (l *inMemoryLimiter) TokensAt(key string, t time.Time) (float64, error) {
+	l = l.keyed(key)
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// truncate to rate limit on configured interval
+	at := notBefore(t, l.now()).Add(l.grace).Truncate(l.interval)
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.expired(key) {
+		return float64(l.burst), nil
+	}
+
+	if l.pureGo {
+		return l.tokens(key, l.refillRate(l.rate), l.burst, at), nil
+	}
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		return float64(l.burst), nil
+	}
+	return limiterTokens(limiter, at), nil
+}
+
+// notBefore returns the given time, or now if it is earlier
+func notBefore(t, now time.Time) time.Time {
+	if t.Before(now) {
+		return now
+	}
+	return t
+}
+
+// limiterTokens returns the number of tokens the given rate.Limiter has at the
+// given time. A limiter without a rate limit draws down its burst rather than
+// its tokens.
+func limiterTokens(limiter *rate.Limiter, now time.Time) float64 {
+	if limiter.Limit() == 0 {
+		return float64(limiter.Burst())
+	}
+	return limiter.TokensAt(now)
+}
+
+func (l *disabledLimiter) Tokens(key string) (float64, error) {
+	return math.MaxFloat64, nil
+}
+
+func (l *disabledLimiter) TokensAt(key string, t time.Time) (float64, error) {
+	return math.MaxFloat64, nil
+}
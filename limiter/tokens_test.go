@@ -0,0 +1,198 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisTokens(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("2.5"),
+			[]byte(fmt.Sprintf("%d", now.Add(-time.Second).Unix())),
+		}, nil,
+	).Once()
+
+	tokens, err := l.Tokens(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens != 12.5 {
+		t.Errorf("expected 12.5 tokens: %v", tokens)
+	}
+}
+
+func TestRedisTokensNoKey(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return([]interface{}{}, nil).Once()
+
+	if tokens, _ := l.Tokens(key); tokens != float64(l.burst) {
+		t.Errorf("expected %v tokens: %v", l.burst, tokens)
+	}
+}
+
+func TestRedisTokensError(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(nil, errors.New("not good")).Once()
+
+	if _, err := l.Tokens(key); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRedisNoRefill(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	l.noRefill = true
+	key := "foo"
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	// an empty bucket last updated long ago stays empty
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{
+			[]byte("0"),
+			[]byte(fmt.Sprintf("%d", now.Add(-24*time.Hour).Unix())),
+		}, nil,
+	).Once()
+
+	if l.Allow(key) {
+		t.Errorf("expected to not allow key: %s", key)
+	}
+}
+
+func TestInMemoryNoRefill(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 3,
+			NoRefill:   true,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+		now := time.Now().Truncate(time.Second)
+		l.now = func() time.Time { return now }
+		key := "foo"
+
+		for i := 0; i < 3; i++ {
+			if !l.Allow(key) {
+				t.Fatalf("expected to allow key on event %d: %s", i, key)
+			}
+		}
+
+		for _, elapsed := range []time.Duration{0, time.Second, time.Hour, 24 * time.Hour} {
+			now = now.Add(elapsed)
+			if l.Allow(key) {
+				t.Errorf("expected to not allow key after %v: %s", elapsed, key)
+			}
+			if tokens, _ := l.Tokens(key); tokens != 0 {
+				t.Errorf("expected 0 tokens after %v: %v", elapsed, tokens)
+			}
+		}
+	}
+}
+
+func TestInMemoryTokens(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 4,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+		now := time.Now().Truncate(time.Second)
+		l.now = func() time.Time { return now }
+		key := "foo"
+
+		if tokens, _ := l.Tokens(key); tokens != 4 {
+			t.Errorf("expected 4 tokens for a new key: %v", tokens)
+		}
+
+		l.AllowN(key, 3)
+		if tokens, _ := l.Tokens(key); tokens != 1 {
+			t.Errorf("expected 1 token: %v", tokens)
+		}
+
+		now = now.Add(2 * time.Second)
+		if tokens, _ := l.Tokens(key); tokens != 3 {
+			t.Errorf("expected 3 tokens: %v", tokens)
+		}
+	}
+}
+
+func TestDisabledTokens(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if tokens, _ := l.Tokens("foo"); tokens != math.MaxFloat64 {
+		t.Errorf("expected %v tokens: %v", math.MaxFloat64, tokens)
+	}
+}
+
+func TestTokensAt(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 1
+		config.BurstLimit = 5
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+		l := New(config)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = clock
+		case *inMemoryLimiter:
+			l.now = clock
+		}
+
+		if tokens, _ := l.TokensAt("foo", now.Add(time.Hour)); tokens != 5 {
+			t.Errorf("%s: expected a missing key to be full: %v", name, tokens)
+		}
+
+		l.AllowN("foo", 5)
+		for _, tc := range []struct {
+			at     time.Duration
+			tokens float64
+		}{
+			{-time.Hour, 0}, // the past returns the current tokens
+			{0, 0},
+			{time.Second, 1},
+			{2500 * time.Millisecond, 2},
+			{4 * time.Second, 4},
+			{time.Minute, 5}, // clamped to the burst limit
+		} {
+			tokens, err := l.TokensAt("foo", now.Add(tc.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tokens != tc.tokens {
+				t.Errorf("%s: expected %v tokens after %v: %v", name, tc.tokens, tc.at, tokens)
+			}
+		}
+
+		// projecting does not change the bucket
+		if tokens, _ := l.Tokens("foo"); tokens != 0 {
+			t.Errorf("%s: expected the bucket to be unchanged: %v", name, tokens)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package limiter
+
+import (
+	"errors"
+	"math"
+
+	"github.com/garyburd/redigo/redis"
+	"golang.org/x/time/rate"
+)
+
+// ErrInsufficientTokens is returned by Transfer when the source token bucket
+// does not have enough tokens
+var ErrInsufficientTokens = errors.New("limiter: insufficient tokens")
+
+// transferScript atomically moves tokens from one token bucket to another,
+// moving none unless the source has enough tokens. It returns 1 if the tokens
+// were moved, 0 otherwise.
+//
+// KEYS[1] source key, KEYS[2] destination key
+// ARGV[1] storageArg, ARGV[2] n, ARGV[3] now, ARGV[4] interval (seconds)
+// ARGV[5] rate, ARGV[6] burst
+var transferScript = newScript(2, luaStorage+luaRefill+`
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local interval = tonumber(ARGV[4])
+local rate = tonumber(ARGV[5])
+local burst = tonumber(ARGV[6])
+
+local from = read_bucket(KEYS[1])
+local to = read_bucket(KEYS[2])
+local fromTokens = refill(from, now, interval, rate, burst)
+local toTokens = refill(to, now, interval, rate, burst)
+
+if fromTokens < n then
+	return 0
+end
+
+write_bucket(KEYS[1], {tokens = fromTokens - n, last = now}, from)
+write_bucket(KEYS[2], {tokens = math.min(toTokens + n, burst), last = now}, to)
+return 1
+`)
+
+func (l *redisLimiter) Transfer(from, to string, n int) error {
+	from, err := l.keyLength.key(from)
+	if err != nil {
+		return err
+	}
+	to, err = l.keyLength.key(to)
+	if err != nil {
+		return err
+	}
+
+	db := l.backend()
+	defer db.close()
+
+	// truncate to rate limit on configured interval
+	now := l.boundary().Unix()
+
+	moved, err := redis.Bool(db.eval(transferScript,
+		from, to,
+		storageArg(l.layout, l.format), n, now, l.interval.Seconds(),
+		l.refillRate(l.rate), l.burst,
+	))
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return ErrInsufficientTokens
+	}
+	return nil
+}
+
+// Transfer moves tokens between token buckets. Unless using PureGo,
+// rate.Limiter can only be drawn down by whole tokens so the destination's
+// fractional tokens are dropped.
+func (l *inMemoryLimiter) Transfer(from, to string, n int) error {
+	from, err := l.keyLength.key(from)
+	if err != nil {
+		return err
+	}
+	to, err = l.keyLength.key(to)
+	if err != nil {
+		return err
+	}
+
+	ratelimit := l.refillRate(l.rate)
+
+	// truncate to rate limit on configured interval
+	now := l.boundary()
+
+	if l.pureGo {
+		l.mux.Lock()
+		defer l.mux.Unlock()
+
+		fromTokens := l.tokens(from, ratelimit, l.burst, now)
+		if fromTokens < float64(n) {
+			return ErrInsufficientTokens
+		}
+		toTokens := math.Min(l.tokens(to, ratelimit, l.burst, now)+float64(n), float64(l.burst))
+
+		l.setBucket(from, fromTokens-float64(n), now)
+		l.setBucket(to, toTokens, now)
+		return nil
+	}
+
+	source := l.limiter(from, ratelimit, l.burst, now)
+	destination := l.limiter(to, ratelimit, l.burst, now)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if !source.AllowN(now, n) {
+		return ErrInsufficientTokens
+	}
+
+	// a rate.Limiter cannot be given tokens so the destination is replaced by
+	// a new limiter, which starts full, drawn down to its new tokens
+	tokens := math.Min(limiterTokens(destination, now)+float64(n), float64(l.burst))
+	limiter := rate.NewLimiter(rate.Limit(ratelimit), l.burst)
+	if d := l.burst - int(tokens); d > 0 {
+		limiter.ReserveN(now, d)
+	}
+	l.limiters[to] = limiter
+	return nil
+}
+
+func (l *disabledLimiter) Transfer(from, to string, n int) error {
+	return nil
+}
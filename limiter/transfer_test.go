@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTransferLimiters(t *testing.T) map[string]Limiter {
+	s := miniredis.RunT(t)
+
+	limiters := map[string]Limiter{}
+	for name, c := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		c.RateLimit = 1
+		c.BurstLimit = 10
+		c.Interval = time.Hour
+		limiters[name] = New(c)
+	}
+	return limiters
+}
+
+func TestTransfer(t *testing.T) {
+	for name, l := range newTransferLimiters(t) {
+		l.AllowN("to", 6)
+
+		if err := l.Transfer("from", "to", 4); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if tokens, _ := l.Tokens("from"); tokens != 6 {
+			t.Errorf("%s: expected source to have 6 tokens: %v", name, tokens)
+		}
+		if tokens, _ := l.Tokens("to"); tokens != 8 {
+			t.Errorf("%s: expected destination to have 8 tokens: %v", name, tokens)
+		}
+	}
+}
+
+func TestTransferInsufficientTokens(t *testing.T) {
+	for name, l := range newTransferLimiters(t) {
+		l.AllowN("from", 8)
+		l.AllowN("to", 5)
+
+		if err := l.Transfer("from", "to", 3); err != ErrInsufficientTokens {
+			t.Errorf("%s: expected ErrInsufficientTokens: %v", name, err)
+		}
+		if tokens, _ := l.Tokens("from"); tokens != 2 {
+			t.Errorf("%s: expected source to keep 2 tokens: %v", name, tokens)
+		}
+		if tokens, _ := l.Tokens("to"); tokens != 5 {
+			t.Errorf("%s: expected destination to keep 5 tokens: %v", name, tokens)
+		}
+	}
+}
+
+func TestTransferClamp(t *testing.T) {
+	for name, l := range newTransferLimiters(t) {
+		l.AllowN("to", 2)
+
+		// the destination only has room for 2 of the tokens
+		if err := l.Transfer("from", "to", 5); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if tokens, _ := l.Tokens("from"); tokens != 5 {
+			t.Errorf("%s: expected source to have 5 tokens: %v", name, tokens)
+		}
+		if tokens, _ := l.Tokens("to"); tokens != 10 {
+			t.Errorf("%s: expected destination to be capped at 10 tokens: %v", name, tokens)
+		}
+	}
+}
+
+func TestDisabledTransfer(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.Transfer("from", "to", 1); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+package limiter
+
+import "fmt"
+
+// TypedLimiter wraps a Limiter so callers may pass their native identifier
+// type rather than stringifying it at every call site
+type TypedLimiter[K comparable] struct {
+	// Limiter defines the wrapped Limiter
+	Limiter Limiter
+	// KeyFunc converts a typed identifier into the wrapped Limiter's ID,
+	// defaults to fmt.Sprint
+	KeyFunc func(K) string
+}
+
+// NewTyped creates a new TypedLimiter wrapping the given Limiter
+func NewTyped[K comparable](l Limiter, keyFunc func(K) string) *TypedLimiter[K] {
+	return &TypedLimiter[K]{Limiter: l, KeyFunc: keyFunc}
+}
+
+// key returns the ID of the given typed identifier
+func (t *TypedLimiter[K]) key(k K) string {
+	if t.KeyFunc == nil {
+		return fmt.Sprint(k)
+	}
+	return t.KeyFunc(k)
+}
+
+// Allow returns true if an event may happen for the given key
+func (t *TypedLimiter[K]) Allow(k K) bool {
+	return t.Limiter.Allow(t.key(k))
+}
+
+// AllowN returns true if the given number of events may happen for the given
+// key
+func (t *TypedLimiter[K]) AllowN(k K, n int) bool {
+	return t.Limiter.AllowN(t.key(k), n)
+}
+
+// AllowDynamic returns true if an event may happen for the given key taking
+// into consideration the given rate and burst limits
+func (t *TypedLimiter[K]) AllowDynamic(k K, rate float64, burst int) bool {
+	return t.Limiter.AllowDynamic(t.key(k), rate, burst)
+}
+
+// AllowNDynamic returns true if the given number of events may happen for the
+// given key taking into consideration the given rate and burst limits
+func (t *TypedLimiter[K]) AllowNDynamic(k K, n int, rate float64, burst int) bool {
+	return t.Limiter.AllowNDynamic(t.key(k), n, rate, burst)
+}
+
+// AllowWithState returns true if the given number of events may happen for the
+// given key along with the state stored next to the key's token bucket
+func (t *TypedLimiter[K]) AllowWithState(k K, n int) (bool, string, error) {
+	return t.Limiter.AllowWithState(t.key(k), n)
+}
+
+// SetState stores the given state next to the given key's token bucket
+func (t *TypedLimiter[K]) SetState(k K, state string) error {
+	return t.Limiter.SetState(t.key(k), state)
+}
+
+// Tokens returns the number of tokens in the given key's token bucket
+func (t *TypedLimiter[K]) Tokens(k K) (float64, error) {
+	return t.Limiter.Tokens(t.key(k))
+}
@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTypedLimiterInt64(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 2,
+		Interval:   time.Hour,
+	})
+	typed := NewTyped[int64](l, nil)
+
+	var userID int64 = 42
+	if !typed.AllowN(userID, 2) {
+		t.Fatalf("expected to allow key: %d", userID)
+	}
+	if typed.Allow(userID) {
+		t.Errorf("expected to not allow key: %d", userID)
+	}
+
+	// the typed key shares a token bucket with its string form
+	if l.Allow("42") {
+		t.Error("expected to not allow key: 42")
+	}
+	if !typed.Allow(43) {
+		t.Error("expected to allow key: 43")
+	}
+}
+
+type tenantUser struct {
+	tenant string
+	user   int
+}
+
+func TestTypedLimiterStruct(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	typed := &TypedLimiter[tenantUser]{
+		Limiter: l,
+		KeyFunc: func(k tenantUser) string {
+			return fmt.Sprintf("%s:%d", k.tenant, k.user)
+		},
+	}
+
+	k := tenantUser{tenant: "acme", user: 1}
+	if !typed.Allow(k) {
+		t.Fatalf("expected to allow key: %v", k)
+	}
+	if typed.Allow(k) {
+		t.Errorf("expected to not allow key: %v", k)
+	}
+	if tokens, _ := l.Tokens("acme:1"); tokens != 0 {
+		t.Errorf("expected 0 tokens: %v", tokens)
+	}
+	if !typed.Allow(tenantUser{tenant: "acme", user: 2}) {
+		t.Error("expected to allow a different user")
+	}
+
+	if err := typed.SetState(k, "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, state, _ := typed.AllowWithState(k, 1); state != "bar" {
+		t.Errorf("expected state bar: %s", state)
+	}
+}
@@ -0,0 +1,168 @@
+package limiter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// defaultUsageWindows is how many usage windows are kept by default
+const defaultUsageWindows = 24
+
+// usageWindows configures counting allowed events per calendar window for
+// usage reports, the size is zero unless usage is counted
+type usageWindows struct {
+	size      time.Duration
+	retention time.Duration
+}
+
+// start returns the start of the window the given time falls in
+func (u usageWindows) start(t time.Time) time.Time {
+	return t.UTC().Truncate(u.size)
+}
+
+// oldest returns the start of the oldest window kept at the given time
+func (u usageWindows) oldest(now time.Time) time.Time {
+	return u.start(now).Add(u.size - u.retention)
+}
+
+// since returns the start of the oldest window reported by Usage for the
+// given span, bounded by the windows kept
+func (u usageWindows) since(now time.Time, span time.Duration) time.Time {
+	since := u.start(now).Add(u.size - span)
+	if oldest := u.oldest(now); since.Before(oldest) {
+		return oldest
+	}
+	return since
+}
+
+// usageKey returns the key of the hash counting the given key's allowed
+// events, a field per window start
+func usageKey(key string) string {
+	return suffixedKey(key, "usage")
+}
+
+// usageScript adds allowed events to the count of a window, deleting the
+// counts of windows no longer kept, and expires the hash once no window is
+// kept.
+//
+// KEYS[1] usage key
+// ARGV[1] window start (seconds), ARGV[2] n, ARGV[3] oldest window kept
+// (seconds), ARGV[4] retention (milliseconds)
+var usageScript = newScript(1, `
+redis.call("HINCRBY", KEYS[1], ARGV[1], ARGV[2])
+local oldest = tonumber(ARGV[3])
+for _, start in ipairs(redis.call("HKEYS", KEYS[1])) do
+	if tonumber(start) < oldest then
+		redis.call("HDEL", KEYS[1], start)
+	end
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// use adds the given number of allowed events to the given key's usage if
+// usage is counted. Usage is best effort so errors are ignored.
+func (l *redisLimiter) use(db backend, key string, n int) {
+	if l.usage.size == 0 {
+		return
+	}
+	now := l.now()
+	db.eval(usageScript, usageKey(key),
+		l.usage.start(now).Unix(), n, l.usage.oldest(now).Unix(), l.usage.retention.Milliseconds(),
+	)
+}
+
+// Usage returns the number of events allowed for the given key in each
+// UsageWindow started within the given span, the current window included,
+// keyed by the window's start in UTC. Windows without events, and those
+// older than UsageRetention, are left out. The map is empty unless
+// Config.UsageWindow is set.
+func (l *redisLimiter) Usage(key string, span time.Duration) (map[time.Time]uint64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[time.Time]uint64)
+	if l.usage.size == 0 {
+		return usage, nil
+	}
+
+	c := l.pool.Get()
+	defer c.Close()
+
+	counts, err := redis.StringMap(c.Do("HGETALL", usageKey(key)))
+	if err != nil {
+		return nil, err
+	}
+
+	since := l.usage.since(l.now(), span)
+	for field, count := range counts {
+		start, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseUint(count, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if t := time.Unix(start, 0).UTC(); !t.Before(since) {
+			usage[t] = n
+		}
+	}
+	return usage, nil
+}
+
+// use adds the given number of allowed events to the given key's usage if
+// usage is counted, deleting the counts of windows no longer kept
+func (l *inMemoryLimiter) use(key string, n int) {
+	if l.usage.size == 0 {
+		return
+	}
+
+	now := l.now()
+	oldest := l.usage.oldest(now).Unix()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	counts, ok := l.usages[key]
+	if !ok {
+		counts = make(map[int64]uint64)
+		l.usages[key] = counts
+	}
+	counts[l.usage.start(now).Unix()] += uint64(n)
+	for start := range counts {
+		if start < oldest {
+			delete(counts, start)
+		}
+	}
+}
+
+func (l *inMemoryLimiter) Usage(key string, span time.Duration) (map[time.Time]uint64, error) {
+	key, err := l.keyLength.key(key)
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[time.Time]uint64)
+	if l.usage.size == 0 {
+		return usage, nil
+	}
+
+	since := l.usage.since(l.now(), span).Unix()
+
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	for start, n := range l.usages[key] {
+		if start >= since {
+			usage[time.Unix(start, 0).UTC()] = n
+		}
+	}
+	return usage, nil
+}
+
+func (l *disabledLimiter) Usage(key string, span time.Duration) (map[time.Time]uint64, error) {
+	return make(map[time.Time]uint64), nil
+}
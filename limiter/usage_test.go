@@ -0,0 +1,84 @@
+package limiter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestUsage(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 100
+		config.BurstLimit = 100
+		config.Interval = time.Hour
+		config.UsageWindow = time.Hour
+		config.UsageRetention = 2 * time.Hour
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+		ten := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		eleven := ten.Add(time.Hour)
+
+		// allowed events accumulate in the window they happen in
+		l.AllowN("foo", 3)
+		now = now.Add(30 * time.Minute)
+		l.AllowN("foo", 2)
+		if l.AllowN("foo", 1000) {
+			t.Fatalf("%s: expected events beyond the burst to be denied", name)
+		}
+		now = now.Add(20 * time.Minute)
+		l.AllowN("foo", 4)
+
+		usage, err := l.Usage("foo", 2*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[time.Time]uint64{ten: 5, eleven: 4}; !reflect.DeepEqual(usage, want) {
+			t.Errorf("%s: expected usage %v, got %v", name, want, usage)
+		}
+		if usage, _ := l.Usage("foo", time.Hour); !reflect.DeepEqual(usage, map[time.Time]uint64{eleven: 4}) {
+			t.Errorf("%s: expected only the current window: %v", name, usage)
+		}
+
+		// windows beyond the retention are dropped
+		now = now.Add(2 * time.Hour)
+		l.Allow("foo")
+		usage, _ = l.Usage("foo", 24*time.Hour)
+		if want := map[time.Time]uint64{eleven.Add(2 * time.Hour): 1}; !reflect.DeepEqual(usage, want) {
+			t.Errorf("%s: expected expired windows to be dropped: %v", name, usage)
+		}
+
+		if name == "redis" {
+			if ttl := s.TTL(usageKey("foo")); ttl != 2*time.Hour {
+				t.Errorf("%s: expected the counts to expire after the retention: %v", name, ttl)
+			}
+		}
+	}
+}
+
+func TestUsageDisabled(t *testing.T) {
+	for _, l := range []Limiter{
+		New(Config{Type: TypeInMemory, RateLimit: 1}),
+		New(Config{Type: TypeDisabled}),
+	} {
+		l.Allow("foo")
+		if usage, err := l.Usage("foo", time.Hour); err != nil || len(usage) != 0 {
+			t.Errorf("expected no usage without UsageWindow: %v %v", usage, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrNeverAllowed is returned by Wait when the bucket will never have enough
+// tokens because tokens are not added to it
+var ErrNeverAllowed = errors.New("limiter: event will never be allowed")
+
+// WaitForRedis creates a new Limiter like New and blocks until the configured
+// Redis server responds to a PING, retrying at the given interval. It returns
+// the context's error if the context is done before Redis becomes available.
+// Limiters not backed by Redis are returned immediately.
+func WaitForRedis(ctx context.Context, config Config, retry time.Duration) (Limiter, error) {
+	l := New(config)
+
+	r, ok := l.(*redisLimiter)
+	if !ok {
+		return l, nil
+	}
+
+	for {
+		if err := r.ping(ctx); err == nil {
+			return l, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			r.pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// ping borrows a connection from the pool and PINGs the Redis server
+func (l *redisLimiter) ping(ctx context.Context) error {
+	c, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Do("PING")
+	return err
+}
+
+// Wait blocks until an event may happen for the given key or the context is
+// done
+func (l *redisLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the given number of events may happen for the given key or
+// the context is done, sleeping between attempts as shaped by the configured
+// Backoff
+func (l *redisLimiter) WaitN(ctx context.Context, key string, n int) error {
+	l = l.keyed(key)
+	return wait(ctx, l, key, n, l.backoff, l.sleep, func(tokens float64) time.Duration {
+		return l.delay(tokens, n)
+	})
+}
+
+// RetryAfter returns how long until the given number of events may happen for
+// the given key, zero if they may happen now. ErrNeverAllowed is returned if
+// tokens are never added to the key's bucket.
+func (l *redisLimiter) RetryAfter(key string, n int) (time.Duration, error) {
+	l = l.keyed(key)
+	return retryAfter(l, key, n, l.minTokens, l.delay)
+}
+
+// delay returns how long until a bucket with the given tokens has enough
+// tokens for the given number of events
+func (l *redisLimiter) delay(tokens float64, n int) time.Duration {
+	return waitDelay(tokens, n, l.minTokens, l.refillRate(l.rate), l.interval, l.now().Add(l.grace))
+}
+
+func (l *inMemoryLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the given number of events may happen for the given key or
+// the context is done. Events are decided by AllowN against the clock truncated
+// to the interval, and the delay between attempts is the time until the
+// truncated clock reaches the interval with enough tokens, so waiting never
+// takes tokens an immediately following Allow would not see as taken.
+func (l *inMemoryLimiter) WaitN(ctx context.Context, key string, n int) error {
+	l = l.keyed(key)
+	return wait(ctx, l, key, n, l.backoff, l.sleep, func(tokens float64) time.Duration {
+		return l.delay(tokens, n)
+	})
+}
+
+func (l *inMemoryLimiter) RetryAfter(key string, n int) (time.Duration, error) {
+	l = l.keyed(key)
+	return retryAfter(l, key, n, l.minTokens, l.delay)
+}
+
+func (l *inMemoryLimiter) delay(tokens float64, n int) time.Duration {
+	// a rate.Limiter adds tokens per second rather than per interval
+	rate := l.refillRate(l.rate)
+	if !l.pureGo {
+		rate *= l.interval.Seconds()
+	}
+	return waitDelay(tokens, n, l.minTokens, rate, l.interval, l.now().Add(l.grace))
+}
+
+func (l *disabledLimiter) Wait(ctx context.Context, key string) error {
+	return nil
+}
+
+func (l *disabledLimiter) WaitN(ctx context.Context, key string, n int) error {
+	return nil
+}
+
+func (l *disabledLimiter) RetryAfter(key string, n int) (time.Duration, error) {
+	return 0, nil
+}
+
+// retryAfter returns the delay computed from the given key's tokens, zero if
+// the key has enough tokens for the given number of events
+func retryAfter(l Limiter, key string, n int, minTokens float64, delay func(tokens float64, n int) time.Duration) (time.Duration, error) {
+	tokens, err := l.Tokens(key)
+	if err != nil {
+		return 0, err
+	}
+	if tokens-float64(n) >= minTokens {
+		return 0, nil
+	}
+
+	d := delay(tokens, n)
+	if d < 0 {
+		return 0, ErrNeverAllowed
+	}
+	return d, nil
+}
+
+// wait retries AllowN until it allows the given number of events, sleeping for
+// the Backoff of the delay computed from the key's tokens between attempts
+func wait(ctx context.Context, l Limiter, key string, n int, backoff Backoff, sleep func(ctx context.Context, d time.Duration) error, delay func(tokens float64) time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if l.AllowN(key, n) {
+			return nil
+		}
+
+		tokens, err := l.Tokens(key)
+		if err != nil {
+			return err
+		}
+		d := delay(tokens)
+		if d < 0 {
+			return ErrNeverAllowed
+		}
+
+		if err := sleep(ctx, backoff.Backoff(attempt, d)); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep blocks for the given duration, returning the context's error if it is
+// done first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// waitDelay returns how long until a bucket with the given tokens has enough
+// tokens for the given number of events. Tokens are added at interval
+// boundaries so a denied event waits at least until the next boundary. A
+// negative delay is returned if tokens are never added.
+func waitDelay(tokens float64, n int, minTokens, rate float64, interval time.Duration, now time.Time) time.Duration {
+	intervals := 1.0
+	if missing := float64(n) + minTokens - tokens; missing > 0 {
+		if rate <= 0 {
+			return -1
+		}
+		intervals = math.Ceil(missing / rate)
+	}
+
+	next := now.Truncate(interval).Add(interval)
+	return next.Sub(now) + time.Duration(intervals-1)*interval
+}
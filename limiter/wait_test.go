@@ -0,0 +1,240 @@
+package limiter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// freeAddress returns a local address nothing is listening on
+func freeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestWaitForRedis(t *testing.T) {
+	address := freeAddress(t)
+	delay := 200 * time.Millisecond
+
+	s := miniredis.NewMiniRedis()
+	defer s.Close()
+	go func() {
+		time.Sleep(delay)
+		if err := s.StartAddr(address); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	l, err := WaitForRedis(ctx, Config{
+		Type:       TypeRedis,
+		Address:    address,
+		RateLimit:  1,
+		BurstLimit: 1,
+	}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("expected to wait for redis to start: %v", elapsed)
+	}
+	if !l.Allow("foo") {
+		t.Error("expected to allow key: foo")
+	}
+}
+
+func TestWaitForRedisContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	l, err := WaitForRedis(ctx, Config{
+		Type:    TypeRedis,
+		Address: freeAddress(t),
+	}, 20*time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded: %v", err)
+	}
+	if l != nil {
+		t.Errorf("expected no limiter: %v", l)
+	}
+}
+
+func TestWaitForRedisInMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := WaitForRedis(ctx, Config{Type: TypeInMemory}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitDelay(t *testing.T) {
+	now := time.Unix(100, int64(250*time.Millisecond))
+
+	for _, tc := range []struct {
+		tokens    float64
+		n         int
+		minTokens float64
+		rate      float64
+		delay     time.Duration
+	}{
+		// enough tokens waits for the next interval
+		{1, 1, 0, 1, 750 * time.Millisecond},
+		{0, 1, 0, 1, 750 * time.Millisecond},
+		{0, 3, 0, 1, 2750 * time.Millisecond},
+		{0, 3, 0, 2, 1750 * time.Millisecond},
+		{0, 1, -2, 1, 750 * time.Millisecond},
+		{0, 1, 0, 0, -1},
+	} {
+		if d := waitDelay(tc.tokens, tc.n, tc.minTokens, tc.rate, time.Second, now); d != tc.delay {
+			t.Errorf("expected %v tokens to wait %v for %d events: %v", tc.tokens, tc.delay, tc.n, d)
+		}
+	}
+}
+
+func TestInMemoryWait(t *testing.T) {
+	interval := 50 * time.Millisecond
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  20,
+		BurstLimit: 1,
+		Interval:   interval,
+	})
+	ctx := context.Background()
+
+	if err := l.Wait(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := l.Wait(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*interval {
+		t.Errorf("expected to wait up to an interval: %v", elapsed)
+	}
+}
+
+func TestInMemoryWaitThenAllow(t *testing.T) {
+	for name, config := range map[string]Config{
+		"inMemory": {RateLimit: 20, Interval: 50 * time.Millisecond},
+		"pureGo":   {RateLimit: 2, Interval: time.Second, PureGo: true},
+	} {
+		config.Type = TypeInMemory
+		config.BurstLimit = 2
+		l := New(config)
+
+		if !l.AllowN("foo", 2) {
+			t.Fatalf("%s: expected to allow the burst", name)
+		}
+		if err := l.WaitN(context.Background(), "foo", 2); err != nil {
+			t.Fatal(err)
+		}
+
+		// the wait took the refilled burst so nothing is left in this interval
+		if l.Allow("foo") {
+			t.Errorf("%s: expected to deny immediately after waiting for the burst", name)
+		}
+	}
+}
+
+func TestInMemoryWaitContextDone(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+	l.Allow("foo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, "foo"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded: %v", err)
+	}
+}
+
+func TestInMemoryWaitNoRefill(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		NoRefill:   true,
+	})
+	l.Allow("foo")
+
+	if err := l.Wait(context.Background(), "foo"); err != ErrNeverAllowed {
+		t.Errorf("expected ErrNeverAllowed: %v", err)
+	}
+}
+
+func TestDisabledWait(t *testing.T) {
+	l := New(Config{Type: TypeDisabled})
+	if err := l.WaitN(context.Background(), "foo", 100); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInMemoryRetryAfter(t *testing.T) {
+	for _, pureGo := range []bool{false, true} {
+		l := New(Config{
+			Type:       TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 2,
+			PureGo:     pureGo,
+		}).(*inMemoryLimiter)
+		now := time.Unix(100, int64(250*time.Millisecond))
+		l.now = func() time.Time { return now }
+		key := "foo"
+
+		if d, _ := l.RetryAfter(key, 2); d != 0 {
+			t.Errorf("expected a new key to not wait: %v", d)
+		}
+
+		l.AllowN(key, 2)
+		if d, _ := l.RetryAfter(key, 2); d != 1750*time.Millisecond {
+			t.Errorf("expected to wait 1.75s: %v", d)
+		}
+	}
+}
+
+func TestRedisRetryAfter(t *testing.T) {
+	m := &mockConn{}
+	l := newMockRedisLimiter(m)
+	now := time.Unix(100, int64(250*time.Millisecond))
+	l.now = func() time.Time { return now }
+	key := "foo"
+
+	m.On("Do", "LRANGE", []interface{}{key, 0, 1}).Return(
+		[]interface{}{[]byte("0"), []byte("100")}, nil,
+	).Once()
+
+	if d, _ := l.RetryAfter(key, 15); d != 1750*time.Millisecond {
+		t.Errorf("expected to wait 1.75s: %v", d)
+	}
+}
+
+func TestRetryAfterNoRefill(t *testing.T) {
+	l := New(Config{
+		Type:       TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		NoRefill:   true,
+	})
+	l.Allow("foo")
+
+	if _, err := l.RetryAfter("foo", 1); err != ErrNeverAllowed {
+		t.Errorf("expected ErrNeverAllowed: %v", err)
+	}
+}
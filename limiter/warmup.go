@@ -0,0 +1,96 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// createdKey returns the key holding the time the given key's token bucket
+// was created while it warms up
+func createdKey(key string) string {
+	return suffixedKey(key, "created")
+}
+
+// warmUpScript returns the time in milliseconds the given key's token bucket
+// was created, recording the given time if the key is new, or -1 if the key
+// has warmed up. The created time expires once the key has warmed up so a key
+// with a token bucket and no created time has warmed up.
+//
+// KEYS[1] created key, KEYS[2] bucket key
+// ARGV[1] now (milliseconds), ARGV[2] warm up (milliseconds)
+var warmUpScript = newScript(2, `
+local created = redis.call("GET", KEYS[1])
+if created then
+	return tonumber(created)
+end
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return -1
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return tonumber(ARGV[1])
+`)
+
+// warmUpFactor returns the fraction of the rate and burst limits in effect for
+// a key of the given age, scaling linearly from floor to 1 over the warm up
+func warmUpFactor(age, warmUp time.Duration, floor float64) float64 {
+	if age >= warmUp {
+		return 1
+	}
+	if age < 0 {
+		age = 0
+	}
+	return floor + (1-floor)*float64(age)/float64(warmUp)
+}
+
+// warmUp returns the rate and burst limits in effect for the given key while
+// it warms up
+func (l *redisLimiter) warmUp(db backend, key string, rate float64, burst int) (float64, int, error) {
+	if l.warmUpPeriod == 0 {
+		return rate, burst, nil
+	}
+
+	now := l.now()
+	created, err := redis.Int64(db.eval(warmUpScript,
+		createdKey(key), key,
+		now.UnixMilli(), l.warmUpPeriod.Milliseconds(),
+	))
+	if err != nil || created < 0 {
+		return rate, burst, err
+	}
+
+	age := now.Sub(time.UnixMilli(created))
+	rate, burst = childLimits(warmUpFactor(age, l.warmUpPeriod, l.warmUpFloor), rate, burst)
+	return rate, burst, nil
+}
+
+// warmUp returns the rate and burst limits in effect for the given key while
+// it warms up
+func (l *inMemoryLimiter) warmUp(key string, ratelimit float64, burst int) (float64, int) {
+	if l.warmUpPeriod == 0 {
+		return ratelimit, burst
+	}
+
+	now := l.now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	created, ok := l.created[key]
+	if !ok {
+		_, bucket := l.buckets[key]
+		_, limiter := l.limiters[key]
+		if bucket || limiter {
+			return ratelimit, burst
+		}
+		created = now
+		l.created[key] = created
+	}
+
+	age := now.Sub(created)
+	if age >= l.warmUpPeriod {
+		// the key's token bucket now marks it as warmed up
+		delete(l.created, key)
+	}
+	return childLimits(warmUpFactor(age, l.warmUpPeriod, l.warmUpFloor), ratelimit, burst)
+}
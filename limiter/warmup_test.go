@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestWarmUpFactor(t *testing.T) {
+	warmUp := 10 * time.Second
+	for _, tc := range []struct {
+		age    time.Duration
+		factor float64
+	}{
+		{-time.Second, 0.1},
+		{0, 0.1},
+		{5 * time.Second, 0.55},
+		{warmUp, 1},
+		{time.Hour, 1},
+	} {
+		if factor := warmUpFactor(tc.age, warmUp, 0.1); factor != tc.factor {
+			t.Errorf("expected a factor of %v at %v: %v", tc.factor, tc.age, factor)
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		config.RateLimit = 10
+		config.BurstLimit = 10
+		config.WarmUp = 10 * time.Second
+		config.WarmUpFloor = 0.1
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now = func() time.Time { return now }
+		case *inMemoryLimiter:
+			l.now = func() time.Time { return now }
+		}
+
+		// allowed returns the number of events allowed each second
+		var allowed []int
+		for sec := 0; sec < 15; sec++ {
+			count := 0
+			for i := 0; i < 20; i++ {
+				if l.Allow("foo") {
+					count++
+				}
+			}
+			allowed = append(allowed, count)
+			now = now.Add(time.Second)
+		}
+
+		if allowed[0] != 1 {
+			t.Errorf("%s: expected the floor to allow 1 event: %v", name, allowed)
+		}
+		if allowed[5] <= allowed[0] || allowed[5] >= 10 {
+			t.Errorf("%s: expected a partial rate halfway through warming up: %v", name, allowed)
+		}
+		warming := 0
+		for _, count := range allowed[1:10] {
+			warming += count
+		}
+		if warming <= 9 || warming >= 90 {
+			t.Errorf("%s: expected a ramping rate while warming up: %v", name, allowed)
+		}
+		for _, count := range allowed[11:] {
+			if count != 10 {
+				t.Errorf("%s: expected the full rate after warming up: %v", name, allowed)
+				break
+			}
+		}
+	}
+}
+
+func TestWarmUpExistingKey(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := New(Config{
+		Type:        TypeRedis,
+		Address:     s.Addr(),
+		RateLimit:   10,
+		BurstLimit:  10,
+		WarmUp:      10 * time.Second,
+		WarmUpFloor: 0.1,
+	}).(*redisLimiter)
+
+	// keys with token buckets and no created time have warmed up
+	l.warmUpPeriod = 0
+	l.Allow("foo")
+	l.warmUpPeriod = 10 * time.Second
+
+	if !l.AllowN("foo", 9) {
+		t.Error("expected an existing key to not warm up")
+	}
+	if s.Exists(createdKey("foo")) {
+		t.Error("expected no created time for an existing key")
+	}
+
+	l.Allow("bar")
+	if ttl := s.TTL(createdKey("bar")); ttl != 10*time.Second {
+		t.Errorf("expected the created time to expire once warmed up: %v", ttl)
+	}
+}
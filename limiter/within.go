@@ -0,0 +1,50 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// AllowWithin returns true once the given number of events may happen for the
+// given key, waiting up to maxWait for tokens to be added. It returns false
+// without waiting if the key's bucket would not have the tokens within
+// maxWait, including when tokens are never added. Unlike WaitN it never waits
+// for a delay it knows to be too long.
+func (l *redisLimiter) AllowWithin(key string, n int, maxWait time.Duration) (bool, error) {
+	return allowWithin(l, key, n, maxWait, l.now, l.sleep)
+}
+
+func (l *inMemoryLimiter) AllowWithin(key string, n int, maxWait time.Duration) (bool, error) {
+	return allowWithin(l, key, n, maxWait, l.now, l.sleep)
+}
+
+func (l *disabledLimiter) AllowWithin(key string, n int, maxWait time.Duration) (bool, error) {
+	return true, nil
+}
+
+// allowWithin retries AllowN until it allows the given number of events,
+// sleeping for the delay computed by RetryAfter between attempts with the
+// given sleep function, unless the delay would end after the deadline measured
+// by the given clock
+func allowWithin(l Limiter, key string, n int, maxWait time.Duration, now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) (bool, error) {
+	deadline := now().Add(maxWait)
+	for {
+		if l.AllowN(key, n) {
+			return true, nil
+		}
+
+		d, err := l.RetryAfter(key, n)
+		if err == ErrNeverAllowed {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if now().Add(d).After(deadline) {
+			return false, nil
+		}
+		if err := sleep(context.Background(), d); err != nil {
+			return false, err
+		}
+	}
+}
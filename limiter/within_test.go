@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAllowWithinReject(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Hour
+		l := New(config)
+
+		if allowed, err := l.AllowWithin("foo", 1, 2*time.Second); err != nil || !allowed {
+			t.Errorf("%s: expected the first event to be allowed: %v", name, err)
+		}
+
+		// the next token is an hour away so the event is rejected at once
+		start := time.Now()
+		if allowed, err := l.AllowWithin("foo", 1, time.Second); err != nil || allowed {
+			t.Errorf("%s: expected to be rejected: %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%s: expected to not wait: %v", name, elapsed)
+		}
+	}
+}
+
+func TestAllowWithinNeverAllowed(t *testing.T) {
+	l := New(Config{Type: TypeInMemory, PureGo: true, RateLimit: 1, BurstLimit: 1, NoRefill: true})
+	l.Allow("foo")
+	if allowed, err := l.AllowWithin("foo", 1, time.Hour); err != nil || allowed {
+		t.Errorf("expected to be rejected without waiting: %v", err)
+	}
+}
+
+func TestAllowWithinWait(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	for name, config := range map[string]Config{
+		"redis":    {Type: TypeRedis, Address: s.Addr()},
+		"inMemory": {Type: TypeInMemory},
+		"pureGo":   {Type: TypeInMemory, PureGo: true},
+	} {
+		s.FlushAll()
+		config.RateLimit = 1
+		config.BurstLimit = 1
+		config.Interval = time.Minute
+		l := New(config)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		var slept time.Duration
+		clock := func() time.Time { return now }
+		sleep := func(ctx context.Context, d time.Duration) error {
+			slept += d
+			now = now.Add(d)
+			return nil
+		}
+		switch l := l.(type) {
+		case *redisLimiter:
+			l.now, l.sleep = clock, sleep
+		case *inMemoryLimiter:
+			l.now, l.sleep = clock, sleep
+		}
+
+		l.Allow("foo")
+
+		// the next token is added within the maximum wait
+		if allowed, err := l.AllowWithin("foo", 1, 2*time.Minute); err != nil || !allowed {
+			t.Errorf("%s: expected to be allowed after waiting: %v", name, err)
+		}
+		if slept != time.Minute {
+			t.Errorf("%s: expected to wait for the next token: %v", name, slept)
+		}
+
+		// and was taken by the allowed event
+		if l.Allow("foo") {
+			t.Errorf("%s: expected the token to be consumed", name)
+		}
+	}
+}
+
+func TestDisabledAllowWithin(t *testing.T) {
+	if allowed, _ := New(Config{Type: TypeDisabled}).AllowWithin("foo", 1, 0); !allowed {
+		t.Error("expected the disabled limiter to allow")
+	}
+	if allowed, _ := New(Config{Type: TypeBlockAll}).AllowWithin("foo", 1, time.Hour); allowed {
+		t.Error("expected the block all limiter to deny")
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var (
+	// ErrCostMalformed is returned by CostFromHeader for costs which are not
+	// positive integers
+	ErrCostMalformed = errors.New("middleware: malformed cost")
+	// ErrCostTooHigh is returned by CostFromHeader for costs above the maximum
+	ErrCostTooHigh = errors.New("middleware: cost too high")
+)
+
+// CostFunc returns the number of tokens a request costs. With an error the
+// returned cost is charged instead of rejecting the request if the middleware's
+// CostPolicy is CostClamp.
+type CostFunc func(r *http.Request) (int, error)
+
+// CostPolicy defines how requests with invalid costs are handled
+type CostPolicy int
+
+const (
+	// CostReject responds 400 Bad Request to requests with invalid costs
+	CostReject CostPolicy = iota
+	// CostClamp charges the cost returned along with the error, for example
+	// the maximum for costs which are too high
+	CostClamp
+)
+
+// CostFromHeader returns a CostFunc which reads a request's cost as a positive
+// integer from the given header, costing 1 if the header is missing. Costs
+// above the given maximum return ErrCostTooHigh with the maximum, and values
+// which are not positive integers return ErrCostMalformed with a cost of 1.
+func CostFromHeader(name string, max int) CostFunc {
+	return func(r *http.Request) (int, error) {
+		v := r.Header.Get(name)
+		if v == "" {
+			return 1, nil
+		}
+
+		cost, err := strconv.Atoi(v)
+		if err != nil || cost < 1 {
+			return 1, ErrCostMalformed
+		}
+		if cost > max {
+			return max, ErrCostTooHigh
+		}
+		return cost, nil
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blakearoberts/redis-token-bucket-rate-limiter/limiter"
+)
+
+func TestCostFromHeader(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		cost   int
+		err    error
+	}{
+		{"3", 3, nil},
+		{"5", 5, nil},
+		{"", 1, nil},
+		{"abc", 1, ErrCostMalformed},
+		{"2.5", 1, ErrCostMalformed},
+		{"0", 1, ErrCostMalformed},
+		{"-1", 1, ErrCostMalformed},
+		{"6", 5, ErrCostTooHigh},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set("X-Cost", tc.header)
+		}
+
+		cost, err := CostFromHeader("X-Cost", 5)(r)
+		if cost != tc.cost || err != tc.err {
+			t.Errorf("expected %q to cost %d with error %v: %d %v", tc.header, tc.cost, tc.err, cost, err)
+		}
+	}
+}
+
+func TestMiddlewareCost(t *testing.T) {
+	newHandler := func(policy CostPolicy) http.Handler {
+		return New(Config{
+			Limiter: limiter.New(limiter.Config{
+				Type:       limiter.TypeInMemory,
+				RateLimit:  1,
+				BurstLimit: 5,
+				Interval:   time.Hour,
+			}),
+			CostFunc:   CostFromHeader("X-Cost", 3),
+			CostPolicy: policy,
+		})(ok)
+	}
+
+	serve := func(h http.Handler, cost string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if cost != "" {
+			r.Header.Set("X-Cost", cost)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		h := newHandler(CostReject)
+		if code := serve(h, "3"); code != http.StatusOK {
+			t.Errorf("expected status %d: %d", http.StatusOK, code)
+		}
+		if code := serve(h, "3"); code != http.StatusTooManyRequests {
+			t.Errorf("expected the cost to be charged: %d", code)
+		}
+		if code := serve(h, "2"); code != http.StatusOK {
+			t.Errorf("expected the remaining tokens to allow a cheaper request: %d", code)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		h := newHandler(CostReject)
+		for i := 0; i < 5; i++ {
+			if code := serve(h, ""); code != http.StatusOK {
+				t.Errorf("expected request %d to cost 1: %d", i, code)
+			}
+		}
+		if code := serve(h, ""); code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		h := newHandler(CostReject)
+		for _, cost := range []string{"abc", "0", "4"} {
+			if code := serve(h, cost); code != http.StatusBadRequest {
+				t.Errorf("expected cost %q to be rejected: %d", cost, code)
+			}
+		}
+
+		// rejected requests are not charged
+		if code := serve(h, "3"); code != http.StatusOK {
+			t.Errorf("expected status %d: %d", http.StatusOK, code)
+		}
+	})
+
+	t.Run("clamp", func(t *testing.T) {
+		h := newHandler(CostClamp)
+		if code := serve(h, "100"); code != http.StatusOK {
+			t.Errorf("expected an over max cost to be clamped: %d", code)
+		}
+		if code := serve(h, "abc"); code != http.StatusOK {
+			t.Errorf("expected a malformed cost to cost 1: %d", code)
+		}
+
+		// the clamped cost of 3 and malformed cost of 1 leave one token
+		if code := serve(h, "2"); code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+		}
+		if code := serve(h, "1"); code != http.StatusOK {
+			t.Errorf("expected status %d: %d", http.StatusOK, code)
+		}
+	})
+}
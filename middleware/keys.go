@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+)
+
+// KeyFunc returns the rate limiting key of a request
+type KeyFunc func(r *http.Request) (string, error)
+
+// KeyByIP keys requests by the client IP of their remote address
+func KeyByIP(r *http.Request) (string, error) {
+	addr, err := remoteAddr(r)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// KeyByCIDR returns a KeyFunc which keys requests by the subnet of their client
+// IP with the given prefix length, so all clients in a subnet share a token
+// bucket. The prefix length is capped at the address length so IPv4 and IPv6
+// clients may share a KeyFunc, and IPv4-mapped IPv6 addresses are treated as
+// IPv4.
+func KeyByCIDR(mask int) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		addr, err := remoteAddr(r)
+		if err != nil {
+			return "", err
+		}
+
+		bits := mask
+		if bits > addr.BitLen() {
+			bits = addr.BitLen()
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return "", err
+		}
+		return prefix.String(), nil
+	}
+}
+
+// KeyByAttributes returns a KeyFunc which keys requests by the SHA-256 hex
+// digest of the attributes extracted by the given functions, such as client
+// IP, user agent, and device fingerprint, so requests share a token bucket
+// only if every attribute matches. Each attribute is length prefixed so
+// attributes cannot run into each other and empty attributes still count.
+func KeyByAttributes(fns ...func(*http.Request) string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		h := sha256.New()
+		for _, fn := range fns {
+			attr := fn(r)
+			h.Write([]byte(strconv.Itoa(len(attr)) + ":" + attr))
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+// KeyByBodyHash returns a KeyFunc which keys requests by the SHA-256 hex
+// digest of the first maxBytes bytes of their body, so duplicate submissions
+// share a token bucket. The bytes read are put back in front of the unread
+// rest of the body, so handlers still read the full body, even if reading it
+// failed. Requests without a body are keyed as an empty body.
+func KeyByBodyHash(maxBytes int) KeyFunc {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return func(r *http.Request) (string, error) {
+		var buf []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			buf, err = io.ReadAll(io.LimitReader(r.Body, int64(maxBytes)))
+			r.Body = &bodyReader{
+				Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+				Closer: r.Body,
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+
+		sum := sha256.Sum256(buf)
+		return hex.EncodeToString(sum[:]), nil
+	}
+}
+
+// bodyReader is a request body reading the buffered start of the original
+// body before its rest, and closing the original body
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+// remoteAddr returns the client IP of the given request's remote address
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// the remote address may not have a port
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap().WithZone(""), nil
+}
@@ -0,0 +1,268 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestKeyByIP(t *testing.T) {
+	for remoteAddr, expected := range map[string]string{
+		"192.0.2.1:1234":          "192.0.2.1",
+		"192.0.2.1":               "192.0.2.1",
+		"[2001:db8::1]:1234":      "2001:db8::1",
+		"[::ffff:192.0.2.1]:1234": "192.0.2.1",
+		"[fe80::1%eth0]:1234":     "fe80::1",
+		"2001:db8::1":             "2001:db8::1",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+
+		key, err := KeyByIP(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != expected {
+			t.Errorf("expected %s to be keyed by %s: %s", remoteAddr, expected, key)
+		}
+	}
+}
+
+func TestKeyByCIDR(t *testing.T) {
+	for _, tc := range []struct {
+		mask       int
+		remoteAddr string
+		expected   string
+	}{
+		{24, "192.0.2.1:1234", "192.0.2.0/24"},
+		{24, "192.0.2.254:1234", "192.0.2.0/24"},
+		{24, "192.0.3.1:1234", "192.0.3.0/24"},
+		{64, "192.0.2.1:1234", "192.0.2.1/32"},
+		{64, "[2001:db8:0:1::1]:1234", "2001:db8:0:1::/64"},
+		{48, "[2001:db8:0:1::1]:1234", "2001:db8::/48"},
+		{24, "[::ffff:192.0.2.1]:1234", "192.0.2.0/24"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+
+		key, err := KeyByCIDR(tc.mask)(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != tc.expected {
+			t.Errorf("expected %s to be keyed by %s: %s", tc.remoteAddr, tc.expected, key)
+		}
+	}
+}
+
+func TestKeyByCIDRMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		mask       int
+		remoteAddr string
+	}{
+		{24, ""},
+		{24, "not an address"},
+		{24, "192.0.2:1234"},
+		{-1, "192.0.2.1:1234"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+
+		if _, err := KeyByCIDR(tc.mask)(r); err == nil {
+			t.Errorf("expected an error keying %q by /%d", tc.remoteAddr, tc.mask)
+		}
+	}
+}
+
+func TestMiddlewareKeyByCIDR(t *testing.T) {
+	h := New(Config{Limiter: newLimiter(), KeyFunc: KeyByCIDR(24)})(ok)
+
+	if code := serve(h, "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+
+	// a second IP in the same subnet shares the subnet's bucket
+	if code := serve(h, "192.0.2.2:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+
+	// an IP in a different subnet has its own bucket
+	if code := serve(h, "192.0.3.1:1234"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+}
+
+func TestKeyByAttributes(t *testing.T) {
+	keyFunc := KeyByAttributes(
+		func(r *http.Request) string { return r.RemoteAddr },
+		func(r *http.Request) string { return r.UserAgent() },
+		func(r *http.Request) string { return r.Header.Get("X-Device") },
+	)
+
+	key := func(remoteAddr, userAgent, device string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", userAgent)
+		r.Header.Set("X-Device", device)
+
+		key, err := keyFunc(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	base := key("192.0.2.1:1234", "curl", "abc")
+	if key("192.0.2.1:1234", "curl", "abc") != base {
+		t.Error("expected identical requests to share a key")
+	}
+	for _, tc := range [][3]string{
+		{"192.0.2.2:1234", "curl", "abc"},
+		{"192.0.2.1:1234", "wget", "abc"},
+		{"192.0.2.1:1234", "curl", "abd"},
+		{"192.0.2.1:1234", "curl", ""},
+		{"192.0.2.1:1234", "curlabc", ""},
+		{"192.0.2.1:1234", "cur", "labc"},
+	} {
+		if key(tc[0], tc[1], tc[2]) == base {
+			t.Errorf("expected %v to be keyed apart from the base request", tc)
+		}
+	}
+
+	// empty attributes are keyed deterministically
+	if key("192.0.2.1:1234", "", "") != key("192.0.2.1:1234", "", "") {
+		t.Error("expected empty attributes to be keyed deterministically")
+	}
+}
+
+func TestMiddlewareKeyByAttributes(t *testing.T) {
+	h := New(Config{
+		Limiter: newLimiter(),
+		KeyFunc: KeyByAttributes(
+			func(r *http.Request) string { return r.RemoteAddr },
+			func(r *http.Request) string { return r.UserAgent() },
+		),
+	})(ok)
+
+	serve := func(userAgent string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve("curl"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+	if code := serve("wget"); code != http.StatusOK {
+		t.Errorf("expected a differing attribute to get its own bucket: %d", code)
+	}
+	if code := serve("curl"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestKeyByBodyHash(t *testing.T) {
+	keyFunc := KeyByBodyHash(4)
+
+	key := func(body io.Reader) string {
+		r := httptest.NewRequest(http.MethodPost, "/", body)
+		key, err := keyFunc(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	if key(strings.NewReader("abcd")) != key(strings.NewReader("abcd")) {
+		t.Error("expected identical bodies to share a key")
+	}
+	if key(strings.NewReader("abcd")) == key(strings.NewReader("abce")) {
+		t.Error("expected differing bodies to be keyed apart")
+	}
+
+	// only the first maxBytes bytes are hashed
+	if key(strings.NewReader("abcdef")) != key(strings.NewReader("abcdxy")) {
+		t.Error("expected bodies to be keyed by their first 4 bytes")
+	}
+
+	// a missing body is keyed as an empty body
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Body = nil
+	if k, err := keyFunc(r); err != nil || k != key(strings.NewReader("")) {
+		t.Errorf("expected a missing body to be keyed as an empty body: %v", err)
+	}
+}
+
+func TestKeyByBodyHashRestoresBody(t *testing.T) {
+	for _, body := range []string{"", "ab", "abcd", "abcdefgh"} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if _, err := KeyByBodyHash(4)(r); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != body {
+			t.Errorf("expected the handler to read %q: %q", body, b)
+		}
+	}
+}
+
+func TestKeyByBodyHashError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Body = io.NopCloser(io.MultiReader(
+		strings.NewReader("ab"),
+		iotest.ErrReader(errors.New("not good")),
+	))
+
+	if _, err := KeyByBodyHash(4)(r); err == nil {
+		t.Error("expected an error")
+	}
+
+	// the bytes read before the error are still readable
+	b, _ := io.ReadAll(r.Body)
+	if string(b) != "ab" {
+		t.Errorf("expected the bytes read to be restored: %q", b)
+	}
+}
+
+func TestMiddlewareKeyByBodyHash(t *testing.T) {
+	var bodies []string
+	h := New(Config{Limiter: newLimiter(), KeyFunc: KeyByBodyHash(1024)})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	serve := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve(`{"a":1}`); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+	if code := serve(`{"a":2}`); code != http.StatusOK {
+		t.Errorf("expected a differing body to get its own bucket: %d", code)
+	}
+	if code := serve(`{"a":1}`); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+
+	if len(bodies) != 2 || bodies[0] != `{"a":1}` || bodies[1] != `{"a":2}` {
+		t.Errorf("expected the handler to read the full bodies: %q", bodies)
+	}
+}
@@ -0,0 +1,143 @@
+// Package middleware rate limits HTTP requests with a limiter.Limiter
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blakearoberts/redis-token-bucket-rate-limiter/limiter"
+)
+
+// Config defines a struct passed to New to configure the middleware
+type Config struct {
+	// Limiter defines the Limiter requests are allowed by
+	Limiter limiter.Limiter
+	// KeyFunc defines how a request's rate limiting key is extracted,
+	// defaults to KeyByIP
+	KeyFunc KeyFunc
+	// CostFunc defines how many tokens a request costs, defaults to 1
+	CostFunc CostFunc
+	// CostPolicy defines how requests for which CostFunc returns an error are
+	// handled, defaults to CostReject
+	CostPolicy CostPolicy
+	// DeniedResponder writes the response to requests which are not allowed,
+	// defaults to DefaultDeniedResponder
+	DeniedResponder DeniedResponder
+	// Exemplar extracts the trace of a request, such as its trace and span
+	// IDs, which is attached to the Limiter's denied events counter when the
+	// request is denied. Defaults to attaching nothing.
+	Exemplar func(r *http.Request) limiter.Exemplar
+	// Lazy reserves a request's token before calling the handler and only
+	// charges it once the handler returns, refunding it if the handler called
+	// Refund, for handlers which may short-circuit without doing work
+	Lazy bool
+}
+
+// refundKey is the context key of a lazily charged request's refund flag
+type refundKey struct{}
+
+// Refund refunds the token reserved for the request with the given context
+// once its handler returns, for example on a cache hit. It has no effect unless
+// the middleware is Lazy.
+func Refund(ctx context.Context) {
+	if refund, ok := ctx.Value(refundKey{}).(*bool); ok {
+		*refund = true
+	}
+}
+
+// DeniedResponder writes the response to a request which is not allowed given
+// how long until the request's key may retry, zero if unknown
+type DeniedResponder func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+
+// deniedBody is the JSON body written by DefaultDeniedResponder
+type deniedBody struct {
+	Error             string `json:"error"`
+	RetryAfterSeconds int64  `json:"retry_after_seconds"`
+}
+
+// DefaultDeniedResponder responds with 429 Too Many Requests, a Retry-After
+// header, and a JSON body of the form
+// {"error":"rate_limited","retry_after_seconds":N}
+func DefaultDeniedResponder(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(deniedBody{
+		Error:             "rate_limited",
+		RetryAfterSeconds: seconds,
+	})
+}
+
+// New returns middleware which responds with the configured DeniedResponder
+// when the configured Limiter does not allow a request's key, and 400 Bad
+// Request when a key or cost cannot be extracted from the request
+func New(config Config) func(http.Handler) http.Handler {
+	if config.KeyFunc == nil {
+		config.KeyFunc = KeyByIP
+	}
+	if config.DeniedResponder == nil {
+		config.DeniedResponder = DefaultDeniedResponder
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := config.KeyFunc(r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			cost := 1
+			if config.CostFunc != nil {
+				cost, err = config.CostFunc(r)
+				if err != nil && config.CostPolicy == CostReject {
+					http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if config.Lazy {
+				commit, abort := config.Limiter.BeginN(key, cost)
+				if commit == nil {
+					deny(config, w, r, key, cost)
+					return
+				}
+
+				refund := false
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), refundKey{}, &refund)))
+				if refund {
+					abort()
+				} else {
+					commit(cost)
+				}
+				return
+			}
+
+			if !config.Limiter.AllowN(key, cost) {
+				deny(config, w, r, key, cost)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deny responds to a request whose key is not allowed the given cost with the
+// configured DeniedResponder, attaching the request's exemplar, if any, to the
+// Limiter's denied events counter
+func deny(config Config, w http.ResponseWriter, r *http.Request, key string, cost int) {
+	if config.Exemplar != nil {
+		config.Limiter.DeniedExemplar(cost, config.Exemplar(r))
+	}
+
+	// an unknown delay is reported as zero
+	retryAfter, _ := config.Limiter.RetryAfter(key, cost)
+	config.DeniedResponder(w, r, retryAfter)
+}
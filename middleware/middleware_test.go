@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blakearoberts/redis-token-bucket-rate-limiter/limiter"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func newLimiter() limiter.Limiter {
+	return limiter.New(limiter.Config{
+		Type:       limiter.TypeInMemory,
+		RateLimit:  1,
+		BurstLimit: 1,
+		Interval:   time.Hour,
+	})
+}
+
+// serve returns the status code of a request from the given remote address
+func serve(h http.Handler, remoteAddr string) int {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestMiddleware(t *testing.T) {
+	h := New(Config{Limiter: newLimiter()})(ok)
+
+	if code := serve(h, "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+	if code := serve(h, "192.0.2.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+	if code := serve(h, "192.0.2.2:1234"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+}
+
+func TestMiddlewareBadKey(t *testing.T) {
+	h := New(Config{Limiter: newLimiter()})(ok)
+
+	if code := serve(h, "not an address"); code != http.StatusBadRequest {
+		t.Errorf("expected status %d: %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestMiddlewareLazyCommit(t *testing.T) {
+	h := New(Config{Limiter: newLimiter(), Lazy: true})(ok)
+
+	if code := serve(h, "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("expected status %d: %d", http.StatusOK, code)
+	}
+	if code := serve(h, "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the committed token to be charged: %d", code)
+	}
+}
+
+func TestMiddlewareLazyRefund(t *testing.T) {
+	cached := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Refund(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	h := New(Config{Limiter: newLimiter(), Lazy: true})(cached)
+
+	for i := 0; i < 3; i++ {
+		if code := serve(h, "192.0.2.1:1234"); code != http.StatusOK {
+			t.Errorf("expected refunded requests to be allowed: %d", code)
+		}
+	}
+}
+
+func TestMiddlewareExemplar(t *testing.T) {
+	l := newLimiter()
+	h := New(Config{
+		Limiter: l,
+		Exemplar: func(r *http.Request) limiter.Exemplar {
+			return limiter.Exemplar{TraceID: r.Header.Get("X-Trace-Id")}
+		},
+	})(ok)
+
+	serve := func(traceID string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if traceID != "" {
+			r.Header.Set("X-Trace-Id", traceID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	denied := func() string {
+		var buf bytes.Buffer
+		if err := l.WriteOpenMetrics(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, "limiter_denied_total ") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	serve("abc")
+
+	// requests without a trace attach no exemplar
+	if code := serve(""); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+	if line := denied(); strings.Contains(line, "#") {
+		t.Errorf("expected no exemplar without a trace: %s", line)
+	}
+
+	if code := serve("def"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d: %d", http.StatusTooManyRequests, code)
+	}
+	if line := denied(); !strings.HasPrefix(line, `limiter_denied_total 2 # {trace_id="def"} 1 `) {
+		t.Errorf("expected the denied request's trace as the exemplar: %s", line)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blakearoberts/redis-token-bucket-rate-limiter/limiter"
+)
+
+func TestDefaultDeniedResponder(t *testing.T) {
+	w := httptest.NewRecorder()
+	DefaultDeniedResponder(w, httptest.NewRequest(http.MethodGet, "/", nil), 1500*time.Millisecond)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON content type: %s", ct)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "2" {
+		t.Errorf("expected Retry-After to be rounded up to 2: %s", ra)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"error":"rate_limited","retry_after_seconds":2}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestMiddlewareDefaultDeniedResponder(t *testing.T) {
+	h := New(Config{
+		Limiter: limiter.New(limiter.Config{
+			Type:       limiter.TypeInMemory,
+			RateLimit:  1,
+			BurstLimit: 1,
+			Interval:   time.Minute,
+			PureGo:     true,
+		}),
+	})(ok)
+
+	serve(h, "192.0.2.1:1234")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d: %d", http.StatusTooManyRequests, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"error":"rate_limited"`) {
+		t.Errorf("expected a JSON error body: %s", w.Body.String())
+	}
+	if ra := w.Header().Get("Retry-After"); ra == "" || ra == "0" {
+		t.Errorf("expected a Retry-After up to the next interval: %s", ra)
+	}
+}
+
+func TestMiddlewareCustomDeniedResponder(t *testing.T) {
+	var called bool
+	h := New(Config{
+		Limiter: newLimiter(),
+		DeniedResponder: func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+			called = true
+			if retryAfter <= 0 || retryAfter > time.Hour {
+				t.Errorf("expected to retry within the interval: %v", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("slow down"))
+		},
+	})(ok)
+
+	serve(h, "192.0.2.1:1234")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if !called {
+		t.Fatal("expected the custom responder to be called")
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "slow down" {
+		t.Errorf("expected the custom response: %d %s", w.Code, w.Body.String())
+	}
+}